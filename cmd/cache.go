@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/repository/cache"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newCacheStore keeps the cache in Redis when cache.redis_url is set, in process otherwise
+func newCacheStore(cacheConfig config.CacheConfig) (cache.Store, error) {
+	if cacheConfig.RedisURL == "" {
+		return cache.NewLRU(cacheConfig.MaxEntries), nil
+	}
+
+	options, err := redis.ParseURL(cacheConfig.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache redis_url: %w", err)
+	}
+	client := redis.NewClient(options)
+
+	// Lookups go to the database while Redis is down, it doesn't keep the service from starting
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("Redis cache is unreachable, reading from the database until it is back: %v", err)
+	}
+
+	return cache.NewRedis(client, "payment-gateway:"), nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"payment-gateway/internal/gateway"
+	"strconv"
+	"time"
+)
+
+// CallbackSender posts signed status callbacks to the URL a request named in X-Callback-URL
+type CallbackSender struct {
+	client *http.Client
+	delay  time.Duration
+	signer gateway.Signer
+	base   *url.URL
+}
+
+// NewCallbackSender signs callbacks with HMAC-SHA256 when secret is set. A non-nil base
+// replaces the scheme and host of the callback URLs, e.g. to reach a local service.
+func NewCallbackSender(delay time.Duration, secret []byte, base *url.URL) *CallbackSender {
+	sender := &CallbackSender{
+		client: &http.Client{Timeout: 10 * time.Second},
+		delay:  delay,
+		base:   base,
+	}
+	if len(secret) > 0 {
+		sender.signer = gateway.HMACSigner{Secret: secret}
+	}
+	return sender
+}
+
+// Schedule sends one callback per status, in order, each after the configured delay
+func (c *CallbackSender) Schedule(request *simRequest, statuses ...string) {
+	if request.callbackURL == "" {
+		fmt.Printf("no callback URL for %s transaction %d\n", request.gateway, request.transactionID)
+		return
+	}
+
+	go func() {
+		for _, status := range statuses {
+			time.Sleep(c.delay)
+			if err := c.send(request, status); err != nil {
+				fmt.Printf("callback for %s transaction %d failed: %v\n", request.gateway, request.transactionID, err)
+			}
+		}
+	}()
+}
+
+func (c *CallbackSender) send(request *simRequest, status string) error {
+	target, err := c.target(request.callbackURL)
+	if err != nil {
+		return err
+	}
+
+	payload, err := callbackPayload(request, status)
+	if err != nil {
+		return fmt.Errorf("failed to encode callback: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create callback request: %w", err)
+	}
+	req.Header.Set("Content-Type", request.format)
+
+	if err := c.sign(req, payload); err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send callback: %w", err)
+	}
+	defer resp.Body.Close()
+
+	fmt.Printf("callback %s for %s transaction %d: %s\n", status, request.gateway, request.transactionID, resp.Status)
+	return nil
+}
+
+func (c *CallbackSender) target(callbackURL string) (string, error) {
+	target, err := url.Parse(callbackURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid callback URL: %w", err)
+	}
+
+	if c.base != nil {
+		target.Scheme = c.base.Scheme
+		target.Host = c.base.Host
+	}
+
+	return target.String(), nil
+}
+
+// sign adds the same timestamp, nonce and signature headers the service sends to gateways
+func (c *CallbackSender) sign(req *http.Request, payload []byte) error {
+	if c.signer == nil {
+		return nil
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	signature, err := c.signer.Sign(gateway.SigningMessage(timestamp, nonceHex, payload))
+	if err != nil {
+		return fmt.Errorf("failed to sign callback: %w", err)
+	}
+
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set("X-Nonce", nonceHex)
+	req.Header.Set("X-Signature", base64.StdEncoding.EncodeToString(signature))
+
+	return nil
+}
+
+func callbackPayload(request *simRequest, status string) ([]byte, error) {
+	if request.format == "text/xml" {
+		return soapEnvelope(soapBody{
+			XMLName:       xml.Name{Local: "TransactionNotification"},
+			TransactionID: request.transactionID,
+			Status:        status,
+		})
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"transaction_id": request.transactionID,
+		"status":         status,
+	})
+}
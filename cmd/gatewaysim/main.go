@@ -0,0 +1,48 @@
+// Command gatewaysim emulates the PayPal, Stripe, Adyen and SOAP gateway APIs for local
+// end-to-end testing. Point the gateways' base_url at it; it answers deposits and
+// withdrawals in each provider's format and calls back X-Callback-URL after a delay.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "address to listen on")
+	callbackDelay := flag.Duration("callback-delay", 2*time.Second, "delay before each callback is sent")
+	callbackBase := flag.String("callback-base", "", "scheme and host replacing those of X-Callback-URL, e.g. http://localhost:8080")
+	timeoutDelay := flag.Duration("timeout-delay", time.Minute, "how long the timeout scenario holds a request")
+	scriptPath := flag.String("script", "", "JSON file with the scenario rules to play")
+	flag.Parse()
+
+	script, err := LoadScript(*scriptPath)
+	if err != nil {
+		log.Fatalf("Failed to load script: %v", err)
+	}
+
+	var base *url.URL
+	if *callbackBase != "" {
+		base, err = url.Parse(*callbackBase)
+		if err != nil || base.Host == "" {
+			log.Fatalf("Invalid callback base %q", *callbackBase)
+		}
+	}
+
+	// callbacks are signed like gateway requests when a secret is given
+	callbacks := NewCallbackSender(*callbackDelay, []byte(os.Getenv("SIM_CALLBACK_SECRET")), base)
+	simulator := NewSimulator(script, callbacks, *timeoutDelay)
+
+	mux := http.NewServeMux()
+	simulator.Routes(mux)
+	mux.HandleFunc("/_sim/scenarios", script.ScenariosHandler)
+
+	log.Printf("Gateway simulator listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("Failed to start simulator: %v", err)
+	}
+}
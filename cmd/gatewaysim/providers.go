@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Simulator emulates the provider APIs the gateway layer talks to
+type Simulator struct {
+	script       *Script
+	callbacks    *CallbackSender
+	timeoutDelay time.Duration
+	references   atomic.Int64
+}
+
+func NewSimulator(script *Script, callbacks *CallbackSender, timeoutDelay time.Duration) *Simulator {
+	return &Simulator{
+		script:       script,
+		callbacks:    callbacks,
+		timeoutDelay: timeoutDelay,
+	}
+}
+
+// simRequest is a transaction as received by one of the emulated providers
+type simRequest struct {
+	gateway       string
+	format        string
+	transactionID int
+	amount        float64
+	callbackURL   string
+}
+
+// Routes registers the emulated provider endpoints
+func (s *Simulator) Routes(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/oauth2/token", s.handlePayPalToken)
+	mux.HandleFunc("/v2/checkout/orders", s.handle("paypal", "deposit", parsePayPal, paypalResponse))
+	mux.HandleFunc("/v1/payments/payouts", s.handle("paypal", "withdrawal", parsePayPal, paypalResponse))
+	mux.HandleFunc("/v2/payments/captures/", s.handle("paypal", "refund", parsePayPal, paypalResponse))
+	mux.HandleFunc("/v2/payments/authorizations/", bySuffix(map[string]http.HandlerFunc{
+		"/capture": s.handle("paypal", "capture", parsePayPal, paypalResponse),
+		"/void":    s.handleCancel("paypal", "void", paypalCancelResponse),
+	}))
+	mux.HandleFunc("/v1/charges", s.handle("stripe", "deposit", parseStripe, stripeResponse))
+	mux.HandleFunc("/v1/charges/", s.handle("stripe", "capture", parseStripe, stripeResponse))
+	mux.HandleFunc("/v1/payouts", s.handle("stripe", "withdrawal", parseStripe, stripeResponse))
+	mux.HandleFunc("/v1/payouts/", s.handleCancel("stripe", "cancel", stripeCancelResponse))
+	mux.HandleFunc("/v1/refunds", stripeRefunds(
+		s.handle("stripe", "refund", parseStripe, stripeResponse),
+		s.handleCancel("stripe", "void", stripeCancelResponse),
+	))
+	mux.HandleFunc("/v68/payments", s.handle("adyen", "deposit", parseAdyen, adyenResponse))
+	mux.HandleFunc("/v68/payouts", s.handle("adyen", "withdrawal", parseAdyen, adyenResponse))
+	mux.HandleFunc("/v68/payments/", bySuffix(map[string]http.HandlerFunc{
+		"/refunds":  s.handle("adyen", "refund", parseAdyen, adyenResponse),
+		"/captures": s.handle("adyen", "capture", parseAdyen, adyenResponse),
+		"/cancels":  s.handleCancel("adyen", "void", adyenCancelResponse),
+	}))
+	mux.HandleFunc("/v68/cancels", s.handleCancel("adyen", "cancel", adyenCancelResponse))
+	mux.HandleFunc("/api/soap/deposit", s.handle("soap_gateway", "deposit", parseSOAP, soapResponse))
+	mux.HandleFunc("/api/soap/withdrawal", s.handle("soap_gateway", "withdrawal", parseSOAP, soapResponse))
+	mux.HandleFunc("/api/soap/refund", s.handle("soap_gateway", "refund", parseSOAP, soapResponse))
+	mux.HandleFunc("/api/soap/cancel", s.handleCancel("soap_gateway", "cancel", soapCancelResponse))
+}
+
+// bySuffix dispatches the requests under a path to the handler of their last segment
+func bySuffix(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for suffix, handler := range handlers {
+			if strings.HasSuffix(r.URL.Path, suffix) {
+				handler(w, r)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+}
+
+// stripeRefunds tells refunds from voids, which refund an uncaptured charge without an amount
+func stripeRefunds(refund, void http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if form, err := url.ParseQuery(string(body)); err == nil && form.Get("amount") == "" {
+			void(w, r)
+			return
+		}
+		refund(w, r)
+	}
+}
+
+// parseFunc reads the transaction amount from a provider request body
+type parseFunc func(body []byte) (float64, error)
+
+// responseFunc writes the provider's answer for a scenario
+type responseFunc func(w http.ResponseWriter, transactionType, scenario, reference string)
+
+func (s *Simulator) handle(gateway, transactionType string, parse parseFunc, respond responseFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		amount, err := parse(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		transactionID, err := strconv.Atoi(r.Header.Get("X-Transaction-ID"))
+		if err != nil {
+			http.Error(w, "Missing X-Transaction-ID header", http.StatusBadRequest)
+			return
+		}
+
+		request := &simRequest{
+			gateway:       gateway,
+			format:        "application/json",
+			transactionID: transactionID,
+			amount:        amount,
+			callbackURL:   r.Header.Get("X-Callback-URL"),
+		}
+		if gateway == "soap_gateway" {
+			request.format = "text/xml"
+		}
+
+		// Authorizations share the deposit endpoints of PayPal and Stripe
+		if transactionType == "deposit" && isAuthorization(body) {
+			transactionType = "authorization"
+		}
+		final := "COMPLETED"
+		if transactionType == "authorization" {
+			final = "AUTHORIZED"
+		}
+
+		scenario := s.script.Scenario(gateway, transactionType, amount)
+		reference := s.nextReference(gateway)
+		fmt.Printf("%s %s %d (%.2f): %s\n", gateway, transactionType, transactionID, amount, scenario)
+
+		switch scenario {
+		case ScenarioTimeout:
+			// hold the request until the client gives up or the delay passes
+			select {
+			case <-r.Context().Done():
+			case <-time.After(s.timeoutDelay):
+				http.Error(w, "Gateway timeout", http.StatusGatewayTimeout)
+			}
+			return
+		case ScenarioApprove:
+			s.callbacks.Schedule(request, final)
+		case ScenarioDuplicateCallback:
+			s.callbacks.Schedule(request, final, final)
+		case ScenarioOutOfOrderCallback:
+			// the final status arrives before the intermediate one
+			s.callbacks.Schedule(request, final, "PROCESSING")
+		}
+
+		respond(w, transactionType, scenario, reference)
+	}
+}
+
+// isAuthorization reports whether a deposit request only asks for an authorization,
+// a Stripe charge not captured or a PayPal order with the AUTHORIZE intent
+func isAuthorization(body []byte) bool {
+	return bytes.Contains(body, []byte("capture=false")) || bytes.Contains(body, []byte(`"intent":"AUTHORIZE"`))
+}
+
+// handleCancel answers cancellations and voids without sending callbacks. Rules for the
+// "cancel" or "void" type apply, a decline standing for a transaction the provider has
+// already settled.
+func (s *Simulator) handleCancel(gateway, transactionType string, respond responseFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		transactionID, err := strconv.Atoi(r.Header.Get("X-Transaction-ID"))
+		if err != nil {
+			http.Error(w, "Missing X-Transaction-ID header", http.StatusBadRequest)
+			return
+		}
+
+		scenario := s.script.Scenario(gateway, transactionType, 0)
+		fmt.Printf("%s %s %d: %s\n", gateway, transactionType, transactionID, scenario)
+
+		if scenario == ScenarioTimeout {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(s.timeoutDelay):
+				http.Error(w, "Gateway timeout", http.StatusGatewayTimeout)
+			}
+			return
+		}
+
+		respond(w, transactionType, scenario, s.nextReference(gateway))
+	}
+}
+
+func (s *Simulator) nextReference(gateway string) string {
+	reference := s.references.Add(1)
+	prefixes := map[string]string{"paypal": "PAYID", "stripe": "ch", "adyen": "PSP", "soap_gateway": "SG"}
+	return fmt.Sprintf("%s-SIM-%06d", prefixes[gateway], reference)
+}
+
+func (s *Simulator) handlePayPalToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, _, ok := r.BasicAuth(); !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": fmt.Sprintf("SIM-TOKEN-%d", time.Now().UnixNano()),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func parsePayPal(body []byte) (float64, error) {
+	type paypalAmount struct {
+		Value string `json:"value"`
+	}
+	var request struct {
+		Amount        *paypalAmount `json:"amount"`
+		PurchaseUnits []struct {
+			Amount paypalAmount `json:"amount"`
+		} `json:"purchase_units"`
+		Items []struct {
+			Amount paypalAmount `json:"amount"`
+		} `json:"items"`
+	}
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return 0, fmt.Errorf("invalid paypal request: %w", err)
+	}
+
+	var value string
+	switch {
+	case request.Amount != nil:
+		value = request.Amount.Value
+	case len(request.PurchaseUnits) > 0:
+		value = request.PurchaseUnits[0].Amount.Value
+	case len(request.Items) > 0:
+		value = request.Items[0].Amount.Value
+	default:
+		return 0, fmt.Errorf("paypal request has no amount")
+	}
+
+	return strconv.ParseFloat(value, 64)
+}
+
+func paypalResponse(w http.ResponseWriter, transactionType, scenario, reference string) {
+	switch scenario {
+	case ScenarioDecline:
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"name":    "UNPROCESSABLE_ENTITY",
+			"details": []map[string]string{{"issue": "INSTRUMENT_DECLINED"}},
+		})
+	case ScenarioServerError:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"name": "INTERNAL_SERVER_ERROR"})
+	default:
+		if transactionType == "withdrawal" {
+			writeJSON(w, http.StatusCreated, map[string]interface{}{
+				"batch_header": map[string]string{"payout_batch_id": reference, "batch_status": "PENDING"},
+			})
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": reference, "status": "CREATED"})
+	}
+}
+
+func paypalCancelResponse(w http.ResponseWriter, transactionType, scenario, reference string) {
+	switch scenario {
+	case ScenarioDecline:
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"name":    "UNPROCESSABLE_ENTITY",
+			"details": []map[string]string{{"issue": "PREVIOUSLY_CAPTURED"}},
+		})
+	case ScenarioServerError:
+		paypalResponse(w, transactionType, scenario, reference)
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"id": reference, "status": "VOIDED"})
+	}
+}
+
+// parseStripe reads the form amount, minor units are assumed to be hundredths
+func parseStripe(body []byte) (float64, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid stripe request: %w", err)
+	}
+
+	minor, err := strconv.ParseInt(form.Get("amount"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stripe amount: %w", err)
+	}
+
+	return float64(minor) / 100, nil
+}
+
+func stripeResponse(w http.ResponseWriter, _, scenario, reference string) {
+	switch scenario {
+	case ScenarioDecline:
+		writeJSON(w, http.StatusPaymentRequired, map[string]interface{}{
+			"error": map[string]string{"code": "card_declined", "decline_code": "insufficient_funds", "message": "Your card has insufficient funds."},
+		})
+	case ScenarioServerError:
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": map[string]string{"type": "api_error", "message": "Something went wrong on Stripe's end."},
+		})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"id": reference, "status": "pending"})
+	}
+}
+
+func stripeCancelResponse(w http.ResponseWriter, _, scenario, reference string) {
+	switch scenario {
+	case ScenarioDecline:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": map[string]string{"code": "payout_not_cancelable", "message": "Payouts can only be canceled while pending."},
+		})
+	case ScenarioServerError:
+		stripeResponse(w, "cancel", scenario, reference)
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"id": reference, "status": "canceled"})
+	}
+}
+
+// parseAdyen reads the amount object, minor units are assumed to be hundredths
+func parseAdyen(body []byte) (float64, error) {
+	var request struct {
+		Amount struct {
+			Value int64 `json:"value"`
+		} `json:"amount"`
+	}
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return 0, fmt.Errorf("invalid adyen request: %w", err)
+	}
+
+	return float64(request.Amount.Value) / 100, nil
+}
+
+func adyenResponse(w http.ResponseWriter, _, scenario, reference string) {
+	switch scenario {
+	case ScenarioDecline:
+		writeJSON(w, http.StatusOK, map[string]string{
+			"pspReference": reference, "resultCode": "Refused", "refusalReasonCode": "2",
+		})
+	case ScenarioServerError:
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"status": 500, "errorCode": "901", "errorType": "internal",
+		})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"pspReference": reference, "resultCode": "Received"})
+	}
+}
+
+func adyenCancelResponse(w http.ResponseWriter, _, scenario, reference string) {
+	switch scenario {
+	case ScenarioDecline:
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"status": 422, "errorCode": "settled", "errorType": "validation",
+		})
+	case ScenarioServerError:
+		adyenResponse(w, "cancel", scenario, reference)
+	default:
+		writeJSON(w, http.StatusCreated, map[string]string{"pspReference": reference, "status": "received"})
+	}
+}
+
+func parseSOAP(body []byte) (float64, error) {
+	// matches the request element of SOAP 1.1 and 1.2 envelopes alike
+	var envelope struct {
+		Body struct {
+			Request struct {
+				Amount float64 `xml:"amount"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return 0, fmt.Errorf("invalid soap request: %w", err)
+	}
+
+	return envelope.Body.Request.Amount, nil
+}
+
+func soapResponse(w http.ResponseWriter, _, scenario, reference string) {
+	switch scenario {
+	case ScenarioDecline:
+		writeSOAPFault(w, "soap:Client", "Transaction declined")
+	case ScenarioServerError:
+		writeSOAPFault(w, "soap:Server", "Internal error")
+	default:
+		writeSOAP(w, http.StatusOK, soapBody{
+			XMLName:          xml.Name{Local: "TransactionResponse"},
+			GatewayReference: reference,
+			Status:           "PROCESSING",
+		})
+	}
+}
+
+func soapCancelResponse(w http.ResponseWriter, _, scenario, reference string) {
+	switch scenario {
+	case ScenarioDecline:
+		writeSOAPFault(w, "soap:Client", "Transaction already settled")
+	case ScenarioServerError:
+		writeSOAPFault(w, "soap:Server", "Internal error")
+	default:
+		writeSOAP(w, http.StatusOK, soapBody{
+			XMLName:          xml.Name{Local: "TransactionResponse"},
+			GatewayReference: reference,
+			Status:           "CANCELLED",
+		})
+	}
+}
+
+const soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+
+// soapBody is the body element of the SOAP responses and callbacks
+type soapBody struct {
+	XMLName          xml.Name
+	TransactionID    int    `xml:"transaction_id,omitempty"`
+	GatewayReference string `xml:"gateway_reference,omitempty"`
+	Status           string `xml:"status"`
+}
+
+func soapEnvelope(body interface{}) ([]byte, error) {
+	content, err := xml.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope strings.Builder
+	envelope.WriteString(xml.Header)
+	fmt.Fprintf(&envelope, `<soap:Envelope xmlns:soap="%s"><soap:Body>`, soap11Namespace)
+	envelope.Write(content)
+	envelope.WriteString(`</soap:Body></soap:Envelope>`)
+
+	return []byte(envelope.String()), nil
+}
+
+func writeSOAP(w http.ResponseWriter, status int, body interface{}) {
+	payload, err := soapEnvelope(body)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(payload)
+}
+
+func writeSOAPFault(w http.ResponseWriter, code, reason string) {
+	writeSOAP(w, http.StatusInternalServerError, struct {
+		XMLName     xml.Name `xml:"soap:Fault"`
+		FaultCode   string   `xml:"faultcode"`
+		FaultString string   `xml:"faultstring"`
+	}{FaultCode: code, FaultString: reason})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
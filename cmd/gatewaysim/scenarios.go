@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Scenarios the simulator can play for a request
+const (
+	ScenarioApprove            = "approve"
+	ScenarioDecline            = "decline"
+	ScenarioTimeout            = "timeout"
+	ScenarioServerError        = "server_error"
+	ScenarioDuplicateCallback  = "duplicate_callback"
+	ScenarioOutOfOrderCallback = "out_of_order_callback"
+)
+
+var scenarios = map[string]bool{
+	ScenarioApprove:            true,
+	ScenarioDecline:            true,
+	ScenarioTimeout:            true,
+	ScenarioServerError:        true,
+	ScenarioDuplicateCallback:  true,
+	ScenarioOutOfOrderCallback: true,
+}
+
+// Rule plays a scenario for the requests it matches. Empty Gateway and Type and a
+// nil Amount match anything; Times limits how often the rule applies, 0 is forever.
+type Rule struct {
+	Gateway  string   `json:"gateway,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Amount   *float64 `json:"amount,omitempty"`
+	Scenario string   `json:"scenario"`
+	Times    int      `json:"times,omitempty"`
+}
+
+func (r Rule) matches(gateway, transactionType string, amount float64) bool {
+	if r.Gateway != "" && r.Gateway != gateway {
+		return false
+	}
+	if r.Type != "" && r.Type != transactionType {
+		return false
+	}
+	if r.Amount != nil && math.Abs(*r.Amount-amount) >= 0.005 {
+		return false
+	}
+	return true
+}
+
+func (r Rule) validate() error {
+	if !scenarios[r.Scenario] {
+		return fmt.Errorf("unknown scenario %q", r.Scenario)
+	}
+	if r.Times < 0 {
+		return fmt.Errorf("times must not be negative")
+	}
+	return nil
+}
+
+// Script is the ordered list of rules, the first matching rule wins
+type Script struct {
+	mu    sync.Mutex
+	rules []Rule
+}
+
+// LoadScript reads rules from a JSON file holding an array of rules
+func LoadScript(path string) (*Script, error) {
+	script := &Script{}
+	if path == "" {
+		return script, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse script: %w", err)
+	}
+
+	for i, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+
+	script.rules = rules
+	return script, nil
+}
+
+// Scenario returns the scenario to play for a request, approving when no rule matches
+func (s *Script) Scenario(gateway, transactionType string, amount float64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, rule := range s.rules {
+		if !rule.matches(gateway, transactionType, amount) {
+			continue
+		}
+
+		if rule.Times > 0 {
+			s.rules[i].Times--
+			if s.rules[i].Times == 0 {
+				s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			}
+		}
+		return rule.Scenario
+	}
+
+	return ScenarioApprove
+}
+
+// Add puts a rule ahead of the others
+func (s *Script) Add(rule Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append([]Rule{rule}, s.rules...)
+}
+
+func (s *Script) Rules() []Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Rule{}, s.rules...)
+}
+
+func (s *Script) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = nil
+}
+
+// ScenariosHandler lists (GET), adds (POST) and clears (DELETE) the rules at runtime
+func (s *Script) ScenariosHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var rule Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := rule.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.Add(rule)
+	case http.MethodDelete:
+		s.Reset()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Rules())
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
@@ -9,8 +10,10 @@ import (
 	"payment-gateway/internal/api"
 	"payment-gateway/internal/config"
 	"payment-gateway/internal/gateway"
+	"payment-gateway/internal/repository/cache"
 	"payment-gateway/internal/repository/postgres"
 	"payment-gateway/internal/services"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -33,6 +36,18 @@ func main() {
 	}
 	defer database.Close()
 
+	// `main migrate up|down|status` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(database, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	if err := checkSchema(database); err != nil {
+		log.Fatalf("%v, run `main migrate up` first", err)
+	}
+
 	// Set up the HTTP server and routes
 	gatewayConfigPath := os.Getenv("GATEWAY_CONFIG_PATH")
 	if gatewayConfigPath == "" {
@@ -61,19 +76,102 @@ func initializeRepositories(database *sql.DB, gatewayConfig *config.GatewayConfi
 	gatewayRepo := postgres.NewGatewayRepo(database)
 	countryRepo := postgres.NewCountryRepo(database)
 	userRepo := postgres.NewUserRepo(database)
+	routingOverrideRepo := postgres.NewRoutingOverrideRepo(database)
+	transactionAttemptRepo := postgres.NewTransactionAttemptRepo(database)
+	ledgerRepo := postgres.NewLedgerRepo(database)
+	unitOfWork := postgres.NewUnitOfWork(database)
+
+	// Gateways, countries and users are read for every transaction and rarely change
+	var adminOpts []api.AdminHandlerOption
+	if gatewayConfig.Cache.Enabled() {
+		store, err := newCacheStore(gatewayConfig.Cache)
+		if err != nil {
+			log.Fatalf("Failed to create cache: %v", err)
+		}
+		readCache := cache.New(store, time.Duration(gatewayConfig.Cache.TTL)*time.Second)
+
+		cachedGateways := cache.NewGatewayRepo(gatewayRepo, readCache)
+		cachedCountries := cache.NewCountryRepo(countryRepo, readCache)
+		cachedUsers := cache.NewUserRepo(userRepo, readCache)
+		gatewayRepo, countryRepo, userRepo = cachedGateways, cachedCountries, cachedUsers
+
+		adminOpts = append(adminOpts, api.WithCacheInvalidator(cache.NewInvalidator(cachedGateways, cachedCountries, cachedUsers)))
+	}
+
+	routingStrategy, err := services.NewRoutingStrategy(gatewayConfig.Routing)
+	if err != nil {
+		log.Fatalf("Failed to create routing strategy: %v", err)
+	}
+
+	// Maintenance windows live in the database, the configured ones are synced into it at every
+	// start, replacing the config windows stored before and leaving the admin ones alone
+	maintenanceSchedule := services.NewMaintenanceSchedule(gatewayConfig, postgres.NewMaintenanceWindowRepo(database))
+	if err := maintenanceSchedule.Load(context.Background()); err != nil {
+		log.Fatalf("Failed to load maintenance windows: %v", err)
+	}
+	go maintenanceSchedule.Run(context.Background(), 30*time.Second)
 
-	gatewaySelector := services.NewGatewaySelector(gatewayConfig, countryRepo, gatewayRepo, userRepo)
+	gatewaySelector, err := services.NewGatewaySelector(
+		gatewayConfig,
+		countryRepo,
+		gatewayRepo,
+		userRepo,
+		services.WithRoutingStrategy(routingStrategy),
+		services.WithMaintenanceSchedule(maintenanceSchedule),
+		services.WithRoutingOverrides(routingOverrideRepo),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create gateway selector: %v", err)
+	}
+
+	ledger := services.NewLedger(ledgerRepo)
+
+	// Every gateway request is recorded, every money movement goes through the ledger and
+	// status updates lock their transaction; the adaptive strategy also learns from responses and callbacks
+	var (
+		transactionOpts = []services.TransactionProcessorOption{
+			services.WithAttemptRepository(transactionAttemptRepo),
+			services.WithLedger(ledger),
+			services.WithUnitOfWork(unitOfWork),
+		}
+		callbackOpts = []services.CallbackProcessorOption{
+			services.WithCallbackLedger(ledger),
+			services.WithCallbackUnitOfWork(unitOfWork),
+		}
+		routingExplainer api.RoutingExplainer
+	)
+	if adaptive, ok := routingStrategy.(*services.AdaptiveStrategy); ok {
+		transactionOpts = append(transactionOpts, services.WithSendOutcomeRecorder(adaptive))
+		callbackOpts = append(callbackOpts, services.WithCallbackOutcomeRecorder(adaptive))
+		routingExplainer = adaptive
+	}
 
 	// Initialize the gateway client
-	gatewayClient := &gateway.HTTPClient{}
+	gatewayClient, err := gateway.NewHTTPClient(gatewayConfig)
+	if err != nil {
+		log.Fatalf("Failed to create gateway client: %v", err)
+	}
 
 	transactionProcessor := services.NewTransactionProcessor(
 		gatewayConfig,
 		gatewaySelector,
 		transactionRepo,
+		gatewayRepo,
 		gatewayClient,
+		transactionOpts...,
 	)
 
+	// The sweepers run on every instance, an advisory lock lets one of them sweep at a time
+	sweepLocker := postgres.NewAdvisoryLocker(database)
+
+	// Authorizations left uncaptured are voided once their gateway's authorization_ttl passes
+	authorizationSweeper := services.NewAuthorizationSweeper(gatewayConfig, transactionRepo, gatewayRepo, transactionProcessor, sweepLocker)
+	go authorizationSweeper.Run(context.Background(), time.Minute)
+
+	// Withdrawals still PENDING after withdrawals.hold_ttl never reached their gateway, their holds are released
+	holdSweeper := services.NewHoldSweeper(transactionRepo, transactionProcessor, time.Duration(gatewayConfig.Withdrawals.HoldTTL)*time.Second, sweepLocker)
+	go holdSweeper.Run(context.Background(), time.Minute)
+
 	transactionHandler := api.NewTransactionHandler(
 		transactionProcessor,
 	)
@@ -81,11 +179,38 @@ func initializeRepositories(database *sql.DB, gatewayConfig *config.GatewayConfi
 	callbackProcessor := services.NewCallbackProcessor(
 		transactionRepo,
 		gatewayRepo,
+		callbackOpts...,
+	)
+
+	// Transactions whose callback never arrived are looked up at their gateway past its status_sla
+	// and expired past its expire_after
+	staleSweeper := services.NewStaleTransactionSweeper(
+		gatewayConfig,
+		transactionRepo,
+		gatewayRepo,
+		transactionProcessor,
+		callbackProcessor,
+		sweepLocker,
 	)
+	go staleSweeper.Run(context.Background(), time.Minute)
+
+	// Callback URLs carry a signed token when server.callback_token_key is set
+	var callbackHandlerOpts []api.CallbackHandlerOption
+	if tokens := gatewayClient.CallbackTokens(); tokens != nil {
+		callbackHandlerOpts = append(callbackHandlerOpts, api.WithCallbackTokens(tokens))
+	}
+
+	callbackHandler := api.NewCallbackHandler(callbackProcessor, callbackHandlerOpts...)
+
+	routingOverrideService := services.NewRoutingOverrideService(gatewayConfig, routingOverrideRepo)
+
+	adminHandler := api.NewAdminHandler(maintenanceSchedule, routingOverrideService, adminOpts...)
+
+	debugHandler := api.NewDebugHandler(routingExplainer, gatewayClient)
 
-	callbackHandler := api.NewCallbackHandler(callbackProcessor)
+	balanceHandler := api.NewBalanceHandler(ledger)
 
-	router := api.SetupRouter(transactionHandler, callbackHandler)
+	router := api.SetupRouter(transactionHandler, callbackHandler, adminHandler, debugHandler, balanceHandler)
 
 	return router
 }
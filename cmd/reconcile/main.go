@@ -0,0 +1,114 @@
+// Command reconcile checks a gateway's settlement report against the transactions table
+// and stores the discrepancies found. It connects to the database like the server, through
+// the DB_* environment variables, and exits with status 2 when there are discrepancies.
+//
+//	reconcile -gateway stripe -file balance_change_2025-03.csv -from 2025-03-01 -to 2025-03-31
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"payment-gateway/db"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/repository/postgres"
+	"payment-gateway/internal/services"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const dateLayout = "2006-01-02"
+
+func main() {
+	gatewayName := flag.String("gateway", "", "gateway the settlement report comes from, as named in the configuration")
+	reportPath := flag.String("file", "", "settlement report to reconcile")
+	fromDate := flag.String("from", "", "first day of the period, YYYY-MM-DD")
+	toDate := flag.String("to", "", "last day of the period, YYYY-MM-DD")
+	flag.Parse()
+
+	if *gatewayName == "" || *reportPath == "" || *fromDate == "" || *toDate == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	from, err := time.Parse(dateLayout, *fromDate)
+	if err != nil {
+		log.Fatalf("Invalid -from date: %v", err)
+	}
+	to, err := time.Parse(dateLayout, *toDate)
+	if err != nil {
+		log.Fatalf("Invalid -to date: %v", err)
+	}
+	// The last day is included
+	to = to.AddDate(0, 0, 1)
+	if !from.Before(to) {
+		log.Fatalf("The period must not end before it starts")
+	}
+
+	gatewayConfigPath := os.Getenv("GATEWAY_CONFIG_PATH")
+	if gatewayConfigPath == "" {
+		gatewayConfigPath = "internal/config/gateway_config.yaml"
+	}
+
+	gatewayConfig, err := config.LoadGatewayConfig(gatewayConfigPath)
+	if err != nil {
+		log.Fatalf("Failed to load gateway configuration: %v", err)
+	}
+
+	dbURL := "postgres://" + os.Getenv("DB_USER") + ":" + os.Getenv("DB_PASSWORD") + "@" + os.Getenv("DB_HOST") + ":" + os.Getenv("DB_PORT") + "/" + os.Getenv("DB_NAME") + "?sslmode=disable"
+
+	database, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		log.Fatalf("Failed to open database connection: %v", err)
+	}
+	defer database.Close()
+
+	migrator, err := db.NewMigrator(database)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		log.Fatalf("%v, run `main migrate up` first", err)
+	}
+
+	report, err := os.Open(*reportPath)
+	if err != nil {
+		log.Fatalf("Failed to open settlement report: %v", err)
+	}
+	defer report.Close()
+
+	reconciler := services.NewReconciler(
+		gatewayConfig,
+		postgres.NewTransactionRepo(database),
+		postgres.NewGatewayRepo(database),
+		postgres.NewReconciliationRepo(database),
+	)
+
+	run, err := reconciler.Reconcile(context.Background(), *gatewayName, report, filepath.Base(*reportPath), from, to)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+
+	fmt.Printf("Reconciliation %d of %s, %s to %s: %d settlement records, %d matched, %d discrepancies\n",
+		run.ID, run.Gateway, *fromDate, *toDate, run.Records, run.Matched, len(run.Discrepancies))
+
+	for _, item := range run.Discrepancies {
+		transaction := "-"
+		if item.TransactionID != nil {
+			transaction = fmt.Sprint(*item.TransactionID)
+		}
+		fmt.Printf("%-16s reference=%s transaction=%s expected=%.2f %s %s settled=%.2f %s %s\n",
+			item.Kind, item.GatewayReference, transaction,
+			item.ExpectedAmount, item.ExpectedCurrency, item.ExpectedStatus,
+			item.SettledAmount, item.SettledCurrency, item.SettledStatus)
+	}
+
+	if len(run.Discrepancies) > 0 {
+		os.Exit(2)
+	}
+}
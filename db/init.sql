@@ -1,68 +0,0 @@
-DO $$ 
-BEGIN
-    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'gateways') THEN
-        CREATE TABLE gateways (
-            id SERIAL PRIMARY KEY,
-            name VARCHAR(255) NOT NULL UNIQUE,
-            data_format_supported VARCHAR(50) NOT NULL,  
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, 
-            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP  
-        );
-    END IF;
-END $$;
-
-DO $$ 
-BEGIN
-    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'countries') THEN
-        CREATE TABLE countries (
-            id SERIAL PRIMARY KEY,
-            name VARCHAR(255) NOT NULL UNIQUE,
-            code CHAR(2) NOT NULL UNIQUE,
-            currency CHAR(3) NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, 
-            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        );
-    END IF;
-END $$;
-
-DO $$ 
-BEGIN
-    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'gateway_countries') THEN
-        CREATE TABLE gateway_countries (
-            gateway_id INT NOT NULL, 
-            country_id INT NOT NULL,
-            PRIMARY KEY (gateway_id, country_id)
-        );
-    END IF;
-END $$;
-
-DO $$ 
-BEGIN
-    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'transactions') THEN
-        CREATE TABLE transactions (
-            id SERIAL PRIMARY KEY,
-            amount DECIMAL(10, 2) NOT NULL,
-            type VARCHAR(50) NOT NULL,
-            status VARCHAR(50) NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,  
-            gateway_id INT NOT NULL,  
-            country_id INT NOT NULL,  
-            user_id INT NOT NULL
-        );
-    END IF;
-END $$;
-
-DO $$ 
-BEGIN
-    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'users') THEN
-        CREATE TABLE users (
-            id SERIAL PRIMARY KEY,
-            username VARCHAR(255) NOT NULL UNIQUE,
-            email VARCHAR(255) NOT NULL UNIQUE,
-            password VARCHAR(255) NOT NULL,
-            country_id INT,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        );
-    END IF;
-END $$;
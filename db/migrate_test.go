@@ -0,0 +1,273 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"payment-gateway/db"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/lib/pq"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := db.LoadMigrations(os.DirFS("migrations"))
+	if err != nil {
+		t.Fatalf("Expected the migrations to load, got: %v", err)
+	}
+	if len(migrations) < 2 || migrations[0].Name != "initial_schema" {
+		t.Errorf("Unexpected migrations: %+v", migrations)
+	}
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{
+			name: "Missing Down",
+			files: fstest.MapFS{
+				"0001_init.up.sql": {Data: []byte("CREATE TABLE a (id INT);")},
+			},
+			err: "must have both an up and a down file",
+		},
+		{
+			name: "Gap",
+			files: fstest.MapFS{
+				"0001_init.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+				"0001_init.down.sql": {Data: []byte("DROP TABLE a;")},
+				"0003_b.up.sql":      {Data: []byte("CREATE TABLE b (id INT);")},
+				"0003_b.down.sql":    {Data: []byte("DROP TABLE b;")},
+			},
+			err: "migration 2 is missing",
+		},
+		{
+			name: "No Version",
+			files: fstest.MapFS{
+				"init.up.sql": {Data: []byte("CREATE TABLE a (id INT);")},
+			},
+			err: "must start with its version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.LoadMigrations(tt.files)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// TestMigratorRoundTrip applies every migration and reverts them all. It runs in its own schema,
+// so TEST_DATABASE_URL needs a user allowed to create one.
+func TestMigratorRoundTrip(t *testing.T) {
+	database := openSchema(t, "migrate_test")
+	ctx := context.Background()
+
+	migrator, err := db.NewMigrator(database)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	if err := migrator.Check(ctx); !errors.Is(err, db.ErrSchemaMismatch) {
+		t.Errorf("Expected a mismatch on an empty schema, got: %v", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("failed to migrate up: %v", err)
+	}
+	if len(applied) != migrator.Latest() {
+		t.Errorf("Expected %d migrations applied, got %d", migrator.Latest(), len(applied))
+	}
+	if err := migrator.Check(ctx); err != nil {
+		t.Errorf("Expected the schema to be up to date, got: %v", err)
+	}
+
+	// Nothing left to apply
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("Expected nothing applied, got %d and %v", len(applied), err)
+	}
+
+	for version := migrator.Latest(); version > 0; version-- {
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			t.Fatalf("failed to revert migration %d: %v", version, err)
+		}
+		if reverted == nil || reverted.Version != version {
+			t.Fatalf("Expected migration %d reverted, got %+v", version, reverted)
+		}
+	}
+
+	if reverted, err := migrator.Down(ctx); reverted != nil || err != nil {
+		t.Errorf("Expected nothing to revert, got %+v and %v", reverted, err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			t.Errorf("Expected migration %d to be pending", status.Version)
+		}
+	}
+
+	// Going back up from scratch works too
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("failed to migrate up again: %v", err)
+	}
+}
+
+// legacySchema is the schema db/init.sql created, along with a transaction stored by the
+// baseline processTransaction, which never set the country
+const legacySchema = `
+CREATE TABLE gateways (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    data_format_supported VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE countries (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    code CHAR(2) NOT NULL UNIQUE,
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE gateway_countries (
+    gateway_id INT NOT NULL,
+    country_id INT NOT NULL,
+    PRIMARY KEY (gateway_id, country_id)
+);
+CREATE TABLE transactions (
+    id SERIAL PRIMARY KEY,
+    amount DECIMAL(10, 2) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    gateway_id INT NOT NULL,
+    country_id INT NOT NULL,
+    user_id INT NOT NULL
+);
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password VARCHAR(255) NOT NULL,
+    country_id INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO gateways (id, name, data_format_supported, updated_at) VALUES (1, 'gateway_a', 'json', NULL);
+INSERT INTO countries (id, name, code, currency) VALUES (1, 'United States', 'US', 'USD');
+INSERT INTO gateway_countries (gateway_id, country_id) VALUES (1, 1), (1, 99);
+INSERT INTO users (id, username, email, password, country_id) VALUES (1, 'alice', 'alice@example.com', 'x', 1);
+INSERT INTO users (id, username, email, password, country_id) VALUES (2, 'bob', 'bob@example.com', 'x', NULL);
+INSERT INTO transactions (id, amount, type, status, gateway_id, country_id, user_id, created_at)
+    VALUES (1, 10, 'deposit', 'COMPLETED', 1, 0, 1, NULL), (2, 20, 'deposit', 'COMPLETED', 1, 0, 2, NULL);
+`
+
+// TestMigratorAdoptsInitSQLSchema migrates a database set up by init.sql, whose rows break the
+// constraints added since, then reverts it to the adopted schema
+func TestMigratorAdoptsInitSQLSchema(t *testing.T) {
+	database := openSchema(t, "migrate_legacy_test")
+	ctx := context.Background()
+
+	if _, err := database.Exec(legacySchema); err != nil {
+		t.Fatalf("failed to create the init.sql schema: %v", err)
+	}
+
+	migrator, err := db.NewMigrator(database)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("failed to migrate an init.sql database up: %v", err)
+	}
+
+	// The transaction of a user with a country takes theirs, the other one is left as it was
+	var country int
+	if err := database.QueryRow(`SELECT country_id FROM transactions WHERE id = 1`).Scan(&country); err != nil || country != 1 {
+		t.Errorf("Expected transaction 1 backfilled with country 1, got %d and %v", country, err)
+	}
+	if err := database.QueryRow(`SELECT country_id FROM transactions WHERE id = 2`).Scan(&country); err != nil || country != 0 {
+		t.Errorf("Expected transaction 2 left with country 0, got %d and %v", country, err)
+	}
+
+	var orphans int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM gateway_countries WHERE country_id = 99`).Scan(&orphans); err != nil || orphans != 0 {
+		t.Errorf("Expected the orphaned gateway country removed, got %d and %v", orphans, err)
+	}
+
+	var validated bool
+	err = database.QueryRow(`SELECT convalidated FROM pg_constraint WHERE conname = 'transactions_country_id_fkey'`).Scan(&validated)
+	if err != nil || validated {
+		t.Errorf("Expected the country constraint left NOT VALID, got %t and %v", validated, err)
+	}
+	err = database.QueryRow(`SELECT convalidated FROM pg_constraint WHERE conname = 'transactions_user_id_fkey'`).Scan(&validated)
+	if err != nil || !validated {
+		t.Errorf("Expected the user constraint validated, got %t and %v", validated, err)
+	}
+
+	// New rows are checked all the same
+	_, err = database.Exec(`INSERT INTO transactions (amount, type, status, gateway_id, country_id, user_id) VALUES (5, 'deposit', 'PENDING', 1, 0, 1)`)
+	if err == nil {
+		t.Error("Expected a new transaction without a country to be rejected")
+	}
+
+	// Back to the adopted schema, reverting 0001 would drop the tables
+	for version := migrator.Latest(); version > 1; version-- {
+		if _, err := migrator.Down(ctx); err != nil {
+			t.Fatalf("failed to revert migration %d: %v", version, err)
+		}
+	}
+
+	var transactions int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM transactions`).Scan(&transactions); err != nil || transactions != 2 {
+		t.Errorf("Expected the init.sql transactions kept, got %d and %v", transactions, err)
+	}
+}
+
+// openSchema opens TEST_DATABASE_URL on a fresh schema dropped at the end of the test
+func openSchema(t *testing.T, schema string) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	if _, err := admin.Exec(fmt.Sprintf(`DROP SCHEMA IF EXISTS %[1]s CASCADE; CREATE SCHEMA %[1]s`, schema)); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(fmt.Sprintf(`DROP SCHEMA IF EXISTS %s CASCADE`, schema)) })
+
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	database, err := sql.Open("postgres", url+separator+"search_path="+schema)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	return database
+}
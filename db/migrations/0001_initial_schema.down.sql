@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS reconciliation_items;
+DROP TABLE IF EXISTS reconciliation_runs;
+DROP TABLE IF EXISTS postings;
+DROP TABLE IF EXISTS journal_entries;
+DROP TABLE IF EXISTS ledger_accounts;
+DROP TABLE IF EXISTS routing_overrides;
+DROP TABLE IF EXISTS transaction_attempts;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS gateway_countries;
+DROP TABLE IF EXISTS countries;
+DROP TABLE IF EXISTS gateways;
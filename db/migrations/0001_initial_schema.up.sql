@@ -0,0 +1,149 @@
+-- The schema formerly created by db/init.sql. Tables and columns that already exist are
+-- kept, so databases set up by init.sql are adopted as they are.
+
+CREATE TABLE IF NOT EXISTS gateways (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    data_format_supported VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS countries (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    code CHAR(2) NOT NULL UNIQUE,
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS gateway_countries (
+    gateway_id INT NOT NULL,
+    country_id INT NOT NULL,
+    PRIMARY KEY (gateway_id, country_id)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password VARCHAR(255) NOT NULL,
+    country_id INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id SERIAL PRIMARY KEY,
+    amount DECIMAL(10, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL DEFAULT '',
+    fee DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    gateway_reference VARCHAR(255) NOT NULL DEFAULT '',
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    gateway_id INT NOT NULL,
+    country_id INT NOT NULL,
+    user_id INT NOT NULL,
+    parent_id INT REFERENCES transactions (id)
+);
+
+-- Columns added to init.sql after its first release
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS gateway_reference VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES transactions (id);
+
+CREATE INDEX IF NOT EXISTS transactions_gateway_reference_idx ON transactions (gateway_id, gateway_reference);
+CREATE INDEX IF NOT EXISTS transactions_parent_id_idx ON transactions (parent_id);
+CREATE INDEX IF NOT EXISTS transactions_type_status_idx ON transactions (type, status, created_at);
+
+CREATE TABLE IF NOT EXISTS transaction_attempts (
+    id SERIAL PRIMARY KEY,
+    transaction_id INT NOT NULL,
+    gateway VARCHAR(255) NOT NULL,
+    request_payload TEXT NOT NULL DEFAULT '',
+    response_status INT NOT NULL DEFAULT 0,
+    response_body TEXT NOT NULL DEFAULT '',
+    latency_ms BIGINT NOT NULL DEFAULT 0,
+    gateway_reference VARCHAR(255) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS transaction_attempts_transaction_id_idx ON transaction_attempts (transaction_id);
+
+CREATE TABLE IF NOT EXISTS routing_overrides (
+    id SERIAL PRIMARY KEY,
+    user_id INT,
+    merchant_id VARCHAR(255) NOT NULL DEFAULT '',
+    country_code VARCHAR(2) NOT NULL DEFAULT '',
+    currency VARCHAR(3) NOT NULL DEFAULT '',
+    transaction_type VARCHAR(50) NOT NULL DEFAULT '',
+    gateway VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (user_id IS NOT NULL OR merchant_id <> '')
+);
+
+CREATE INDEX IF NOT EXISTS routing_overrides_user_id_idx ON routing_overrides (user_id);
+CREATE INDEX IF NOT EXISTS routing_overrides_merchant_id_idx ON routing_overrides (merchant_id);
+
+-- Double-entry ledger: every journal entry's postings sum to zero. Accounts with no
+-- user_id belong to the platform; balances are kept on the account alongside the postings.
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id SERIAL PRIMARY KEY,
+    user_id INT REFERENCES users (id),
+    type VARCHAR(50) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    balance DECIMAL(14, 2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_accounts_owner_idx ON ledger_accounts (COALESCE(user_id, 0), type, currency);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id SERIAL PRIMARY KEY,
+    transaction_id INT NOT NULL REFERENCES transactions (id),
+    kind VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (transaction_id, kind)
+);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id SERIAL PRIMARY KEY,
+    entry_id INT NOT NULL REFERENCES journal_entries (id),
+    account_id INT NOT NULL REFERENCES ledger_accounts (id),
+    amount DECIMAL(14, 2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS postings_account_id_idx ON postings (account_id);
+
+CREATE TABLE IF NOT EXISTS reconciliation_runs (
+    id SERIAL PRIMARY KEY,
+    gateway VARCHAR(255) NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    records INT NOT NULL DEFAULT 0,
+    matched INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS reconciliation_items (
+    id SERIAL PRIMARY KEY,
+    run_id INT NOT NULL REFERENCES reconciliation_runs (id),
+    kind VARCHAR(50) NOT NULL,
+    gateway_reference VARCHAR(255) NOT NULL DEFAULT '',
+    transaction_id INT REFERENCES transactions (id),
+    expected_amount DECIMAL(14, 2) NOT NULL DEFAULT 0,
+    settled_amount DECIMAL(14, 2) NOT NULL DEFAULT 0,
+    expected_currency VARCHAR(3) NOT NULL DEFAULT '',
+    settled_currency VARCHAR(3) NOT NULL DEFAULT '',
+    expected_status VARCHAR(50) NOT NULL DEFAULT '',
+    settled_status VARCHAR(50) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS reconciliation_items_run_id_idx ON reconciliation_items (run_id);
@@ -0,0 +1,46 @@
+-- The gateways column keeps its name, dataformatsupported was never a valid schema
+DROP INDEX IF EXISTS reconciliation_items_transaction_id_idx;
+ALTER TABLE reconciliation_runs ALTER COLUMN created_at DROP NOT NULL;
+
+DROP INDEX IF EXISTS postings_entry_id_idx;
+ALTER TABLE journal_entries ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE ledger_accounts ALTER COLUMN created_at DROP NOT NULL;
+
+ALTER TABLE routing_overrides
+    DROP CONSTRAINT IF EXISTS routing_overrides_user_id_fkey,
+    ALTER COLUMN created_at DROP NOT NULL;
+
+ALTER TABLE transaction_attempts
+    DROP CONSTRAINT IF EXISTS transaction_attempts_transaction_id_fkey,
+    ALTER COLUMN created_at DROP NOT NULL;
+
+DROP INDEX IF EXISTS transactions_status_idx;
+DROP INDEX IF EXISTS transactions_gateway_id_created_at_idx;
+DROP INDEX IF EXISTS transactions_user_id_idx;
+
+ALTER TABLE transactions
+    DROP CONSTRAINT IF EXISTS transactions_user_id_fkey,
+    DROP CONSTRAINT IF EXISTS transactions_country_id_fkey,
+    DROP CONSTRAINT IF EXISTS transactions_gateway_id_fkey,
+    ALTER COLUMN created_at DROP NOT NULL;
+
+DROP INDEX IF EXISTS users_country_id_idx;
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_country_id_fkey,
+    ALTER COLUMN created_at DROP NOT NULL,
+    ALTER COLUMN updated_at DROP NOT NULL;
+
+DROP INDEX IF EXISTS gateway_countries_country_id_idx;
+
+ALTER TABLE gateway_countries
+    DROP CONSTRAINT IF EXISTS gateway_countries_country_id_fkey,
+    DROP CONSTRAINT IF EXISTS gateway_countries_gateway_id_fkey;
+
+ALTER TABLE countries
+    ALTER COLUMN created_at DROP NOT NULL,
+    ALTER COLUMN updated_at DROP NOT NULL;
+
+ALTER TABLE gateways
+    ALTER COLUMN created_at DROP NOT NULL,
+    ALTER COLUMN updated_at DROP NOT NULL;
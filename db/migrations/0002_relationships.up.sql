@@ -0,0 +1,115 @@
+-- Gateways tables created by hand to match the old query of postgres.GatewayRepo
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'gateways' AND column_name = 'dataformatsupported'
+    ) THEN
+        ALTER TABLE gateways RENAME COLUMN dataformatsupported TO data_format_supported;
+    END IF;
+END $$;
+
+-- init.sql left the timestamps nullable and never checked the references, so rows it
+-- let through are repaired before the constraints go on
+UPDATE gateways SET created_at = COALESCE(created_at, CURRENT_TIMESTAMP), updated_at = COALESCE(updated_at, created_at, CURRENT_TIMESTAMP)
+    WHERE created_at IS NULL OR updated_at IS NULL;
+UPDATE countries SET created_at = COALESCE(created_at, CURRENT_TIMESTAMP), updated_at = COALESCE(updated_at, created_at, CURRENT_TIMESTAMP)
+    WHERE created_at IS NULL OR updated_at IS NULL;
+UPDATE users SET created_at = COALESCE(created_at, CURRENT_TIMESTAMP), updated_at = COALESCE(updated_at, created_at, CURRENT_TIMESTAMP)
+    WHERE created_at IS NULL OR updated_at IS NULL;
+UPDATE transactions SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+UPDATE transaction_attempts SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+UPDATE routing_overrides SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+UPDATE ledger_accounts SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+UPDATE journal_entries SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+UPDATE reconciliation_runs SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+
+DELETE FROM gateway_countries gc
+    WHERE NOT EXISTS (SELECT 1 FROM gateways g WHERE g.id = gc.gateway_id)
+       OR NOT EXISTS (SELECT 1 FROM countries c WHERE c.id = gc.country_id);
+
+UPDATE users u SET country_id = NULL
+    WHERE country_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM countries c WHERE c.id = u.country_id);
+
+DELETE FROM routing_overrides o
+    WHERE user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = o.user_id);
+
+-- processTransaction once stored no country, those transactions take their user's
+UPDATE transactions t SET country_id = u.country_id
+    FROM users u
+    WHERE u.id = t.user_id AND u.country_id IS NOT NULL
+      AND NOT EXISTS (SELECT 1 FROM countries c WHERE c.id = t.country_id);
+
+ALTER TABLE gateways
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN updated_at SET NOT NULL;
+
+ALTER TABLE countries
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN updated_at SET NOT NULL;
+
+ALTER TABLE gateway_countries
+    ADD CONSTRAINT gateway_countries_gateway_id_fkey FOREIGN KEY (gateway_id) REFERENCES gateways (id),
+    ADD CONSTRAINT gateway_countries_country_id_fkey FOREIGN KEY (country_id) REFERENCES countries (id);
+
+CREATE INDEX gateway_countries_country_id_idx ON gateway_countries (country_id);
+
+ALTER TABLE users
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN updated_at SET NOT NULL,
+    ADD CONSTRAINT users_country_id_fkey FOREIGN KEY (country_id) REFERENCES countries (id);
+
+CREATE INDEX users_country_id_idx ON users (country_id);
+
+ALTER TABLE transactions
+    ALTER COLUMN created_at SET NOT NULL,
+    ADD CONSTRAINT transactions_gateway_id_fkey FOREIGN KEY (gateway_id) REFERENCES gateways (id) NOT VALID,
+    ADD CONSTRAINT transactions_country_id_fkey FOREIGN KEY (country_id) REFERENCES countries (id) NOT VALID,
+    ADD CONSTRAINT transactions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+
+-- Lookups by user, by gateway over a period (reconciliation) and by status (sweepers)
+CREATE INDEX transactions_user_id_idx ON transactions (user_id, created_at);
+CREATE INDEX transactions_gateway_id_created_at_idx ON transactions (gateway_id, created_at);
+CREATE INDEX transactions_status_idx ON transactions (status, created_at);
+
+ALTER TABLE transaction_attempts
+    ALTER COLUMN created_at SET NOT NULL,
+    ADD CONSTRAINT transaction_attempts_transaction_id_fkey FOREIGN KEY (transaction_id) REFERENCES transactions (id) NOT VALID;
+
+ALTER TABLE routing_overrides
+    ALTER COLUMN created_at SET NOT NULL,
+    ADD CONSTRAINT routing_overrides_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);
+
+ALTER TABLE ledger_accounts ALTER COLUMN created_at SET NOT NULL;
+
+ALTER TABLE journal_entries ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX postings_entry_id_idx ON postings (entry_id);
+
+ALTER TABLE reconciliation_runs ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX reconciliation_items_transaction_id_idx ON reconciliation_items (transaction_id);
+
+-- Transactions and attempts are history and are never deleted. The constraints above hold for
+-- new rows; they are validated for the old ones unless a row still points nowhere, in which
+-- case the constraint stays NOT VALID and the rows are left for an operator to look at.
+DO $$
+DECLARE
+    target_table TEXT;
+    target_constraint TEXT;
+BEGIN
+    FOR target_table, target_constraint IN
+        SELECT * FROM (VALUES
+            ('transactions', 'transactions_gateway_id_fkey'),
+            ('transactions', 'transactions_country_id_fkey'),
+            ('transactions', 'transactions_user_id_fkey'),
+            ('transaction_attempts', 'transaction_attempts_transaction_id_fkey')
+        ) AS pending (target_table, target_constraint)
+    LOOP
+        BEGIN
+            EXECUTE format('ALTER TABLE %I VALIDATE CONSTRAINT %I', target_table, target_constraint);
+        EXCEPTION WHEN foreign_key_violation THEN
+            RAISE WARNING 'constraint % left NOT VALID: %', target_constraint, SQLERRM;
+        END;
+    END LOOP;
+END $$;
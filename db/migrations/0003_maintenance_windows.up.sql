@@ -0,0 +1,11 @@
+-- Maintenance windows scheduled through the admin API, read by every instance. The windows
+-- of the configuration are synced into the table at every start, next to the admin ones.
+CREATE TABLE maintenance_windows (
+    id SERIAL PRIMARY KEY,
+    gateway VARCHAR(255) NOT NULL,
+    countries TEXT[] NOT NULL DEFAULT '{}',
+    start_at TIMESTAMP NOT NULL,
+    end_at TIMESTAMP NOT NULL,
+    recurrence VARCHAR(20) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- Where each maintenance window comes from, 'config' or 'admin'. Windows stored before are
+-- left empty until the next start tells the configuration's apart.
+ALTER TABLE maintenance_windows ADD COLUMN source VARCHAR(20) NOT NULL DEFAULT '';
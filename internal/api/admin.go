@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/services"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// MaintenanceManager manages the gateway maintenance windows
+type MaintenanceManager interface {
+	List(ctx context.Context) ([]config.MaintenanceWindow, error)
+	Add(ctx context.Context, window config.MaintenanceWindow) (config.MaintenanceWindow, error)
+	Remove(ctx context.Context, id int) error
+}
+
+// RoutingOverrideManager manages the per-user and per-merchant routing overrides
+type RoutingOverrideManager interface {
+	List(ctx context.Context) ([]models.RoutingOverride, error)
+	Create(ctx context.Context, override *models.RoutingOverride) error
+	Delete(ctx context.Context, id int) error
+}
+
+// CacheInvalidator drops cached rows once they changed in the database
+type CacheInvalidator interface {
+	InvalidateGateway(ctx context.Context, id int) error
+	InvalidateCountry(ctx context.Context, id int) error
+	InvalidateUser(ctx context.Context, id int) error
+}
+
+// AdminHandlerOption customises an AdminHandler
+type AdminHandlerOption func(*AdminHandler)
+
+// WithCacheInvalidator lets the admin API drop rows from the cache of gateways, countries and
+// users. The service never changes those rows itself, the endpoint is for changes made to the
+// database directly; without it they show after the cache TTL.
+func WithCacheInvalidator(invalidator CacheInvalidator) AdminHandlerOption {
+	return func(h *AdminHandler) {
+		h.cache = invalidator
+	}
+}
+
+type AdminHandler struct {
+	maintenance MaintenanceManager
+	overrides   RoutingOverrideManager
+	cache       CacheInvalidator
+}
+
+func NewAdminHandler(maintenance MaintenanceManager, overrides RoutingOverrideManager, opts ...AdminHandlerOption) *AdminHandler {
+	handler := &AdminHandler{
+		maintenance: maintenance,
+		overrides:   overrides,
+	}
+
+	for _, opt := range opts {
+		opt(handler)
+	}
+
+	return handler
+}
+
+// ListMaintenanceWindowsHandler lists the maintenance windows (GET /admin/maintenance-windows)
+func (h *AdminHandler) ListMaintenanceWindowsHandler(w http.ResponseWriter, r *http.Request) {
+	windows, err := h.maintenance.List(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, "Maintenance windows", windows)
+}
+
+// CreateMaintenanceWindowHandler schedules a maintenance window
+// Sample Request (POST /admin/maintenance-windows):
+//
+//	{
+//	    "gateway": "soap_gateway",
+//	    "countries": ["DE"],
+//	    "start": "2025-03-09T02:00:00Z",
+//	    "end": "2025-03-09T04:00:00Z",
+//	    "recurrence": "weekly"
+//	}
+func (h *AdminHandler) CreateMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	var window config.MaintenanceWindow
+	if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", errInvalidBody, err))
+		return
+	}
+
+	created, err := h.maintenance.Add(r.Context(), window)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, "Maintenance window created", created)
+}
+
+// DeleteMaintenanceWindowHandler removes a maintenance window (DELETE /admin/maintenance-windows/{id})
+func (h *AdminHandler) DeleteMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, errInvalidID)
+		return
+	}
+
+	if err := h.maintenance.Remove(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRoutingOverridesHandler lists the routing overrides (GET /admin/routing-overrides)
+func (h *AdminHandler) ListRoutingOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	overrides, err := h.overrides.List(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, "Routing overrides", overrides)
+}
+
+// CreateRoutingOverrideHandler forces a user's or merchant's transactions through a gateway
+// Sample Request (POST /admin/routing-overrides):
+//
+//	{
+//	    "user_id": 1,
+//	    "country_code": "DE",
+//	    "currency": "EUR",
+//	    "transaction_type": "withdrawal",
+//	    "gateway": "adyen",
+//	    "reason": "VIP contract",
+//	    "expires_at": "2026-01-01T00:00:00Z"
+//	}
+func (h *AdminHandler) CreateRoutingOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	var override models.RoutingOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", errInvalidBody, err))
+		return
+	}
+
+	if err := h.overrides.Create(r.Context(), &override); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, "Routing override created", override)
+}
+
+// DeleteRoutingOverrideHandler removes a routing override (DELETE /admin/routing-overrides/{id})
+func (h *AdminHandler) DeleteRoutingOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, errInvalidID)
+		return
+	}
+
+	if err := h.overrides.Delete(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// InvalidateCacheHandler drops a gateway, country or user from the cache after it was
+// changed in the database (DELETE /admin/cache/{entity}/{id})
+func (h *AdminHandler) InvalidateCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if h.cache == nil {
+		writeErrorResponse(w, http.StatusNotFound, CodeNotFound, "Cache is not enabled")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, errInvalidID)
+		return
+	}
+
+	switch mux.Vars(r)["entity"] {
+	case "gateways":
+		err = h.cache.InvalidateGateway(r.Context(), id)
+	case "countries":
+		err = h.cache.InvalidateCountry(r.Context(), id)
+	case "users":
+		err = h.cache.InvalidateUser(r.Context(), id)
+	default:
+		err = &services.ValidationError{Message: "Unknown cached entity"}
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes a standard API response
+func writeJSON(w http.ResponseWriter, statusCode int, message string, data interface{}) {
+	response := models.APIResponse{
+		StatusCode: statusCode,
+		Message:    message,
+		Data:       data,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
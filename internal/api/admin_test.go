@@ -0,0 +1,81 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"payment-gateway/internal/api"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+type mockCacheInvalidator struct {
+	invalidated []string
+	err         error
+}
+
+func (m *mockCacheInvalidator) InvalidateGateway(ctx context.Context, id int) error {
+	m.invalidated = append(m.invalidated, "gateway")
+	return m.err
+}
+
+func (m *mockCacheInvalidator) InvalidateCountry(ctx context.Context, id int) error {
+	m.invalidated = append(m.invalidated, "country")
+	return m.err
+}
+
+func (m *mockCacheInvalidator) InvalidateUser(ctx context.Context, id int) error {
+	m.invalidated = append(m.invalidated, "user")
+	return m.err
+}
+
+func TestInvalidateCacheHandler(t *testing.T) {
+	tests := []struct {
+		name                string
+		entity              string
+		id                  string
+		err                 error
+		expectedStatus      int
+		expectedInvalidated []string
+	}{
+		{name: "Gateway", entity: "gateways", id: "1", expectedStatus: http.StatusNoContent, expectedInvalidated: []string{"gateway"}},
+		{name: "Country", entity: "countries", id: "1", expectedStatus: http.StatusNoContent, expectedInvalidated: []string{"country"}},
+		{name: "User", entity: "users", id: "1", expectedStatus: http.StatusNoContent, expectedInvalidated: []string{"user"}},
+		{name: "Invalid ID", entity: "users", id: "abc", expectedStatus: http.StatusBadRequest},
+		{name: "Store Error", entity: "users", id: "1", err: errors.New("connection refused"), expectedStatus: http.StatusInternalServerError, expectedInvalidated: []string{"user"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalidator := &mockCacheInvalidator{err: tt.err}
+			handler := api.NewAdminHandler(nil, nil, api.WithCacheInvalidator(invalidator))
+
+			req, err := http.NewRequest("DELETE", "/admin/cache/"+tt.entity+"/"+tt.id, nil)
+			require.NoError(t, err)
+			req = mux.SetURLVars(req, map[string]string{"entity": tt.entity, "id": tt.id})
+			rr := httptest.NewRecorder()
+
+			handler.InvalidateCacheHandler(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+			require.Equal(t, tt.expectedInvalidated, invalidator.invalidated)
+		})
+	}
+
+	t.Run("Cache Disabled", func(t *testing.T) {
+		handler := api.NewAdminHandler(nil, nil)
+
+		req, err := http.NewRequest("DELETE", "/admin/cache/users/1", nil)
+		require.NoError(t, err)
+		req = mux.SetURLVars(req, map[string]string{"entity": "users", "id": "1"})
+		rr := httptest.NewRecorder()
+
+		handler.InvalidateCacheHandler(rr, req)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		requireErrorCode(t, rr, api.CodeNotFound)
+	})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"payment-gateway/internal/models"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// BalanceProvider returns the balances of the users
+type BalanceProvider interface {
+	Balances(ctx context.Context, userID int) ([]models.Balance, error)
+}
+
+type BalanceHandler struct {
+	balances BalanceProvider
+}
+
+func NewBalanceHandler(balances BalanceProvider) *BalanceHandler {
+	return &BalanceHandler{
+		balances: balances,
+	}
+}
+
+// BalanceHandler returns the available and reserved balances of a user per currency (GET /users/{id}/balance)
+func (h *BalanceHandler) BalanceHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, errInvalidID)
+		return
+	}
+
+	balances, err := h.balances.Balances(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "User balance",
+		Data:       balances,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
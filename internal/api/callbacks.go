@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"payment-gateway/internal/services"
+	"strconv"
 )
 
 // CallbackProcessorInterface defines the contract for callback processing
@@ -13,14 +15,36 @@ type CallbackProcessorInterface interface {
 	ProcessCallback(ctx context.Context, gatewayName string, callbackData []byte) error
 }
 
+// CallbackTokenVerifier checks the token of a callback URL against its transaction
+type CallbackTokenVerifier interface {
+	Verify(transactionID int, token string) bool
+}
+
+// CallbackHandlerOption customises a CallbackHandler
+type CallbackHandlerOption func(*CallbackHandler)
+
+// WithCallbackTokens rejects callbacks without a valid transaction_id and token in their URL
+func WithCallbackTokens(verifier CallbackTokenVerifier) CallbackHandlerOption {
+	return func(h *CallbackHandler) {
+		h.tokens = verifier
+	}
+}
+
 type CallbackHandler struct {
 	callbackProcessor CallbackProcessorInterface
+	tokens            CallbackTokenVerifier
 }
 
-func NewCallbackHandler(callbackProcessor CallbackProcessorInterface) *CallbackHandler {
-	return &CallbackHandler{
+func NewCallbackHandler(callbackProcessor CallbackProcessorInterface, opts ...CallbackHandlerOption) *CallbackHandler {
+	handler := &CallbackHandler{
 		callbackProcessor: callbackProcessor,
 	}
+
+	for _, opt := range opts {
+		opt(handler)
+	}
+
+	return handler
 }
 
 func (h *CallbackHandler) HandlePayPalCallback(w http.ResponseWriter, r *http.Request) {
@@ -40,19 +64,25 @@ func (h *CallbackHandler) HandleSoapGatewayCallback(w http.ResponseWriter, r *ht
 }
 
 func (h *CallbackHandler) handleCallback(w http.ResponseWriter, r *http.Request, gatewayName string) {
+	ctx := r.Context()
+	if h.tokens != nil {
+		transactionID, err := strconv.Atoi(r.URL.Query().Get("transaction_id"))
+		if err != nil || !h.tokens.Verify(transactionID, r.URL.Query().Get("token")) {
+			writeErrorResponse(w, http.StatusUnauthorized, CodeUnauthorized, "Invalid callback token")
+			return
+		}
+		ctx = services.ContextWithCallbackTransaction(ctx, transactionID)
+	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeError(w, r, fmt.Errorf("%w: %v", errInvalidBody, err))
 		return
 	}
 
-	err = h.callbackProcessor.ProcessCallback(r.Context(), gatewayName, body)
+	err = h.callbackProcessor.ProcessCallback(ctx, gatewayName, body)
 	if err != nil {
-		fmt.Printf("Error processing callback from %s: %v\n", gatewayName, err)
-
-		// Return an error response
-		http.Error(w, "Failed to process callback: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -92,7 +92,8 @@ func runCallbackTest(t *testing.T, expectedGatewayName string, handlerFunc func(
 			},
 			expectedStatus: http.StatusInternalServerError,
 			checkResponse: func(t *testing.T, response *httptest.ResponseRecorder) {
-				require.Contains(t, response.Body.String(), "Failed to process callback: processor error")
+				requireErrorCode(t, response, api.CodeInternal)
+				require.NotContains(t, response.Body.String(), "processor error")
 			},
 		},
 		{
@@ -106,7 +107,7 @@ func runCallbackTest(t *testing.T, expectedGatewayName string, handlerFunc func(
 			},
 			expectedStatus: http.StatusBadRequest,
 			checkResponse: func(t *testing.T, response *httptest.ResponseRecorder) {
-				require.Contains(t, response.Body.String(), "Failed to read request body")
+				requireErrorCode(t, response, api.CodeInvalidRequest)
 			},
 		},
 	}
@@ -157,3 +158,50 @@ type errorReader struct{}
 func (e errorReader) Read(p []byte) (n int, err error) {
 	return 0, errors.New("forced read error")
 }
+
+type mockCallbackTokens struct {
+	mockVerify func(transactionID int, token string) bool
+}
+
+func (m *mockCallbackTokens) Verify(transactionID int, token string) bool {
+	return m.mockVerify(transactionID, token)
+}
+
+func TestHandleCallbackVerifiesToken(t *testing.T) {
+	tokens := &mockCallbackTokens{
+		mockVerify: func(transactionID int, token string) bool {
+			return transactionID == 123 && token == "valid"
+		},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"Valid Token", "?transaction_id=123&token=valid", http.StatusOK},
+		{"Invalid Token", "?transaction_id=123&token=forged", http.StatusUnauthorized},
+		{"Other Transaction", "?transaction_id=124&token=valid", http.StatusUnauthorized},
+		{"Missing Token", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := &mockCallbackProcessor{
+				mockProcessCallback: func(ctx context.Context, gatewayName string, callbackData []byte) error {
+					require.Equal(t, http.StatusOK, tt.expectedStatus, "ProcessCallback should not be called")
+					return nil
+				},
+			}
+			handler := api.NewCallbackHandler(processor, api.WithCallbackTokens(tokens))
+
+			req, err := http.NewRequest("POST", "/callback"+tt.query, strings.NewReader(`{"transaction_id": 123, "status": "COMPLETED"}`))
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler.HandleStripeCallback(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"payment-gateway/internal/models"
+)
+
+// RoutingExplainer exposes the state behind the routing decisions
+type RoutingExplainer interface {
+	Explain() models.RoutingReport
+}
+
+// PoolStatsProvider exposes the connection pools of the gateway client
+type PoolStatsProvider interface {
+	PoolStats() []models.GatewayPoolStats
+}
+
+type DebugHandler struct {
+	routingExplainer RoutingExplainer
+	poolStats        PoolStatsProvider
+}
+
+// NewDebugHandler creates the debug handler, routingExplainer may be nil when the
+// configured routing strategy keeps no state
+func NewDebugHandler(routingExplainer RoutingExplainer, poolStats PoolStatsProvider) *DebugHandler {
+	return &DebugHandler{
+		routingExplainer: routingExplainer,
+		poolStats:        poolStats,
+	}
+}
+
+// RoutingHandler returns the rolling gateway statistics and the latest routing decisions (GET /debug/routing)
+func (h *DebugHandler) RoutingHandler(w http.ResponseWriter, r *http.Request) {
+	if h.routingExplainer == nil {
+		writeErrorResponse(w, http.StatusNotFound, CodeNotFound, "Adaptive routing is not enabled")
+		return
+	}
+
+	response := models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Routing state",
+		Data:       h.routingExplainer.Explain(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PoolsHandler returns the connection pool statistics of every gateway (GET /debug/gateway-pools)
+func (h *DebugHandler) PoolsHandler(w http.ResponseWriter, r *http.Request) {
+	response := models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Gateway connection pools",
+		Data:       h.poolStats.PoolStats(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
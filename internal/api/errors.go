@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"payment-gateway/internal/services"
+	"strings"
+)
+
+// Error codes of the error responses
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeUnauthorized        = "unauthorized"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeInvalidTransition   = "invalid_transition"
+	CodeAlreadySettled      = "already_settled"
+	CodeNotRefundable       = "not_refundable"
+	CodeNotCapturable       = "not_capturable"
+	CodeNotCancellable      = "not_cancellable"
+	CodeAmountLimitExceeded = "amount_limit_exceeded"
+	CodeInsufficientFunds   = "insufficient_funds"
+	CodeDeclined            = "declined"
+	CodeGatewayUnavailable  = "gateway_unavailable"
+	CodeInternal            = "internal_error"
+)
+
+// Errors of the requests the handlers can't read
+var (
+	errInvalidBody          = &services.ValidationError{Message: "Invalid request body"}
+	errInvalidTransactionID = &services.ValidationError{Message: "Invalid transaction ID"}
+	errInvalidID            = &services.ValidationError{Message: "Invalid ID"}
+)
+
+type errorMapping struct {
+	err     error
+	status  int
+	code    string
+	message string
+}
+
+// errorMappings turn the errors of the services into responses, the first match wins so the
+// more specific errors come first
+var errorMappings = []errorMapping{
+	{services.ErrNotRefundable, http.StatusUnprocessableEntity, CodeNotRefundable, "The transaction can't be refunded"},
+	{services.ErrNotCapturable, http.StatusUnprocessableEntity, CodeNotCapturable, "The transaction can't be captured"},
+	{services.ErrNotCancellable, http.StatusUnprocessableEntity, CodeNotCancellable, "The transaction can't be cancelled"},
+	{services.ErrAlreadySettled, http.StatusConflict, CodeAlreadySettled, "The transaction is already settled"},
+	{repository.ErrAmountLimitExceeded, http.StatusUnprocessableEntity, CodeAmountLimitExceeded, "The amount exceeds what is left of the transaction"},
+	{repository.ErrInsufficientFunds, http.StatusUnprocessableEntity, CodeInsufficientFunds, "Insufficient funds"},
+	{services.ErrDeclined, http.StatusUnprocessableEntity, CodeDeclined, "The gateway declined the transaction"},
+	{services.ErrInvalidTransition, http.StatusConflict, CodeInvalidTransition, "The transaction can't move to the requested status"},
+	{services.ErrValidation, http.StatusBadRequest, CodeInvalidRequest, "Invalid request"},
+	{repository.ErrNotFound, http.StatusNotFound, CodeNotFound, "Not found"},
+	{repository.ErrConflict, http.StatusConflict, CodeConflict, "The request conflicts with existing data"},
+	{services.ErrGatewayUnavailable, http.StatusServiceUnavailable, CodeGatewayUnavailable, "No gateway is available for the transaction"},
+}
+
+// writeError answers with the status and code of an error. Its message is logged but not
+// sent, only validation errors and what wasn't found are told to the client.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code, message := http.StatusInternalServerError, CodeInternal, "Internal server error"
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			status, code, message = mapping.status, mapping.code, mapping.message
+			break
+		}
+	}
+
+	var validationErr *services.ValidationError
+	var notFoundErr *repository.NotFoundError
+	switch {
+	case code == CodeInvalidRequest && errors.As(err, &validationErr):
+		message = validationErr.Message
+	case code == CodeNotFound && errors.As(err, &notFoundErr) && notFoundErr.Entity != "":
+		message = strings.ToUpper(notFoundErr.Entity[:1]) + notFoundErr.Entity[1:] + " not found"
+	}
+
+	log.Printf("%s %s: %d %s: %v", r.Method, r.URL.Path, status, code, err)
+
+	writeErrorResponse(w, status, code, message)
+}
+
+// writeErrorResponse writes the standard error body
+func writeErrorResponse(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{
+		StatusCode: status,
+		Code:       code,
+		Message:    message,
+	})
+}
@@ -0,0 +1,106 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"payment-gateway/internal/api"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"payment-gateway/internal/services"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireErrorCode checks the response is a standard error body with the code
+func requireErrorCode(t *testing.T, response *httptest.ResponseRecorder, code string) {
+	t.Helper()
+
+	var body models.ErrorResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	require.Equal(t, code, body.Code)
+	require.Equal(t, response.Code, body.StatusCode)
+	require.NotEmpty(t, body.Message)
+}
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		expectedStatus  int
+		expectedCode    string
+		expectedMessage string
+	}{
+		{
+			name:            "Not Found",
+			err:             fmt.Errorf("failed to get user: %w", &repository.NotFoundError{Entity: "user", Key: "ID", Value: 1}),
+			expectedStatus:  http.StatusNotFound,
+			expectedCode:    api.CodeNotFound,
+			expectedMessage: "User not found",
+		},
+		{
+			name:            "Validation",
+			err:             &services.ValidationError{Message: "amount must be positive"},
+			expectedStatus:  http.StatusBadRequest,
+			expectedCode:    api.CodeInvalidRequest,
+			expectedMessage: "amount must be positive",
+		},
+		{
+			name:           "Gateway Unavailable",
+			err:            fmt.Errorf("%w: failed to send request: connection refused", services.ErrGatewayUnavailable),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   api.CodeGatewayUnavailable,
+		},
+		{
+			name:           "Declined",
+			err:            fmt.Errorf("%w: insufficient_funds", services.ErrDeclined),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   api.CodeDeclined,
+		},
+		{
+			name:           "Conflict",
+			err:            fmt.Errorf("failed to create transaction: %w: duplicate key", repository.ErrConflict),
+			expectedStatus: http.StatusConflict,
+			expectedCode:   api.CodeConflict,
+		},
+		{
+			name:            "Internal",
+			err:             errors.New("pq: connection reset by peer"),
+			expectedStatus:  http.StatusInternalServerError,
+			expectedCode:    api.CodeInternal,
+			expectedMessage: "Internal server error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProcessor := &mockTransactionProcessor{
+				mockProcessDeposit: func(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error) {
+					return nil, tt.err
+				},
+			}
+			handler := api.NewTransactionHandler(mockProcessor)
+
+			req, err := http.NewRequest("POST", "/deposit", strings.NewReader(`{"amount": 100.00, "user_id": 1, "currency": "EUR"}`))
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+
+			handler.DepositHandler(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+			require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			requireErrorCode(t, rr, tt.expectedCode)
+			if tt.expectedMessage != "" {
+				require.Contains(t, rr.Body.String(), tt.expectedMessage)
+			}
+			if tt.expectedCode != api.CodeInvalidRequest {
+				require.NotContains(t, rr.Body.String(), tt.err.Error())
+			}
+		})
+	}
+}
@@ -3,13 +3,25 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"payment-gateway/internal/models"
+	"payment-gateway/internal/services"
+	"strconv"
+
+	"github.com/gorilla/mux"
 )
 
 type TransactionProcessorInterface interface {
 	ProcessDeposit(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error)
 	ProcessWithdrawal(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error)
+	ProcessRefund(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error)
+	CancelTransaction(ctx context.Context, transactionID int) (*models.Transaction, error)
+	ProcessAuthorization(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error)
+	ProcessCapture(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error)
+	VoidAuthorization(ctx context.Context, transactionID int) (*models.Transaction, error)
 }
 type TransactionHandler struct {
 	transactionProcessor TransactionProcessorInterface
@@ -27,18 +39,21 @@ func NewTransactionHandler(transactionProcessor TransactionProcessorInterface) *
 //	{
 //	    "amount": 100.00,
 //	    "user_id": 1,
-//	    "currency": "EUR"
+//	    "currency": "EUR",
+//	    "merchant_id": "acme"  (optional, used by routing overrides)
 //	}
 func (h *TransactionHandler) DepositHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.TransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, r, fmt.Errorf("%w: %v", errInvalidBody, err))
 		return
 	}
 
-	transaction, err := h.transactionProcessor.ProcessDeposit(r.Context(), req.UserID, req.Amount, req.Currency)
+	ctx := services.ContextWithMerchantID(r.Context(), req.MerchantID)
+
+	transaction, err := h.transactionProcessor.ProcessDeposit(ctx, req.UserID, req.Amount, req.Currency)
 	if err != nil {
-		http.Error(w, "Failed to process deposit: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -63,13 +78,15 @@ func (h *TransactionHandler) DepositHandler(w http.ResponseWriter, r *http.Reque
 func (h *TransactionHandler) WithdrawalHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.TransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, r, fmt.Errorf("%w: %v", errInvalidBody, err))
 		return
 	}
 
-	transaction, err := h.transactionProcessor.ProcessWithdrawal(r.Context(), req.UserID, req.Amount, req.Currency)
+	ctx := services.ContextWithMerchantID(r.Context(), req.MerchantID)
+
+	transaction, err := h.transactionProcessor.ProcessWithdrawal(ctx, req.UserID, req.Amount, req.Currency)
 	if err != nil {
-		http.Error(w, "Failed to process withdrawal: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -82,3 +99,158 @@ func (h *TransactionHandler) WithdrawalHandler(w http.ResponseWriter, r *http.Re
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// RefundHandler refunds a completed deposit, in full when no amount is given
+// Sample Request (POST /transactions/{id}/refunds):
+//
+//	{
+//	    "amount": 25.00  (optional)
+//	}
+func (h *TransactionHandler) RefundHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, errInvalidTransactionID)
+		return
+	}
+
+	var req models.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, fmt.Errorf("%w: %v", errInvalidBody, err))
+		return
+	}
+
+	refund, err := h.transactionProcessor.ProcessRefund(r.Context(), transactionID, req.Amount)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := models.APIResponse{
+		StatusCode: http.StatusCreated,
+		Message:    "Refund initiated successfully",
+		Data:       refund,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CancelHandler cancels a withdrawal the gateway hasn't settled yet
+// Sample Request (POST /transactions/{id}/cancel), without a body
+func (h *TransactionHandler) CancelHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, errInvalidTransactionID)
+		return
+	}
+
+	transaction, err := h.transactionProcessor.CancelTransaction(r.Context(), transactionID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Withdrawal cancelled successfully",
+		Data:       transaction,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// AuthorizeHandler reserves a deposit to be captured or voided later
+// Sample Request (POST /authorize):
+//
+//	{
+//	    "amount": 100.00,
+//	    "user_id": 1,
+//	    "currency": "EUR"
+//	}
+func (h *TransactionHandler) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.TransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", errInvalidBody, err))
+		return
+	}
+
+	ctx := services.ContextWithMerchantID(r.Context(), req.MerchantID)
+
+	transaction, err := h.transactionProcessor.ProcessAuthorization(ctx, req.UserID, req.Amount, req.Currency)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Authorization initiated successfully",
+		Data:       transaction,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CaptureHandler captures an authorization, in full when no amount is given
+// Sample Request (POST /transactions/{id}/capture):
+//
+//	{
+//	    "amount": 80.00  (optional)
+//	}
+func (h *TransactionHandler) CaptureHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, errInvalidTransactionID)
+		return
+	}
+
+	var req models.CaptureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, fmt.Errorf("%w: %v", errInvalidBody, err))
+		return
+	}
+
+	capture, err := h.transactionProcessor.ProcessCapture(r.Context(), transactionID, req.Amount)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := models.APIResponse{
+		StatusCode: http.StatusCreated,
+		Message:    "Capture initiated successfully",
+		Data:       capture,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// VoidHandler releases an authorization that hasn't been captured
+// Sample Request (POST /transactions/{id}/void), without a body
+func (h *TransactionHandler) VoidHandler(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, errInvalidTransactionID)
+		return
+	}
+
+	transaction, err := h.transactionProcessor.VoidAuthorization(r.Context(), transactionID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := models.APIResponse{
+		StatusCode: http.StatusOK,
+		Message:    "Authorization voided successfully",
+		Data:       transaction,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
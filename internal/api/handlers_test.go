@@ -4,20 +4,29 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"payment-gateway/internal/api"
 	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"payment-gateway/internal/services"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
 )
 
 type mockTransactionProcessor struct {
-	mockProcessDeposit    func(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error)
-	mockProcessWithdrawal func(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error)
+	mockProcessDeposit       func(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error)
+	mockProcessWithdrawal    func(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error)
+	mockProcessRefund        func(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error)
+	mockCancelTransaction    func(ctx context.Context, transactionID int) (*models.Transaction, error)
+	mockProcessAuthorization func(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error)
+	mockProcessCapture       func(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error)
+	mockVoidAuthorization    func(ctx context.Context, transactionID int) (*models.Transaction, error)
 }
 
 func (m *mockTransactionProcessor) ProcessDeposit(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error) {
@@ -28,6 +37,26 @@ func (m *mockTransactionProcessor) ProcessWithdrawal(ctx context.Context, userID
 	return m.mockProcessWithdrawal(ctx, userID, amount, currency)
 }
 
+func (m *mockTransactionProcessor) ProcessRefund(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error) {
+	return m.mockProcessRefund(ctx, transactionID, amount)
+}
+
+func (m *mockTransactionProcessor) CancelTransaction(ctx context.Context, transactionID int) (*models.Transaction, error) {
+	return m.mockCancelTransaction(ctx, transactionID)
+}
+
+func (m *mockTransactionProcessor) ProcessAuthorization(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error) {
+	return m.mockProcessAuthorization(ctx, userID, amount, currency)
+}
+
+func (m *mockTransactionProcessor) ProcessCapture(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error) {
+	return m.mockProcessCapture(ctx, transactionID, amount)
+}
+
+func (m *mockTransactionProcessor) VoidAuthorization(ctx context.Context, transactionID int) (*models.Transaction, error) {
+	return m.mockVoidAuthorization(ctx, transactionID)
+}
+
 func TestDepositHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -94,7 +123,8 @@ func TestDepositHandler(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 			checkResponse: func(t *testing.T, response *httptest.ResponseRecorder) {
-				require.Contains(t, response.Body.String(), "Failed to process deposit")
+				requireErrorCode(t, response, api.CodeInternal)
+				require.NotContains(t, response.Body.String(), "service error")
 			},
 		},
 	}
@@ -195,7 +225,20 @@ func TestWithdrawalHandler(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 			checkResponse: func(t *testing.T, response *httptest.ResponseRecorder) {
-				require.Contains(t, response.Body.String(), "Failed to process withdrawal")
+				requireErrorCode(t, response, api.CodeInternal)
+			},
+		},
+		{
+			name:        "Insufficient Funds",
+			requestBody: `{"amount": 100.00, "user_id": 1, "currency": "EUR"}`,
+			setupMock: func(m *mockTransactionProcessor) {
+				m.mockProcessWithdrawal = func(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error) {
+					return nil, fmt.Errorf("failed to reserve withdrawal 456: %w", repository.ErrInsufficientFunds)
+				}
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			checkResponse: func(t *testing.T, response *httptest.ResponseRecorder) {
+				requireErrorCode(t, response, api.CodeInsufficientFunds)
 			},
 		},
 	}
@@ -230,3 +273,188 @@ func TestWithdrawalHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestRefundHandler(t *testing.T) {
+	parentID := 123
+
+	tests := []struct {
+		name           string
+		transactionID  string
+		requestBody    string
+		refundErr      error
+		expectedAmount float64
+		expectedStatus int
+	}{
+		{name: "Full Refund", transactionID: "123", expectedStatus: http.StatusCreated},
+		{name: "Partial Refund", transactionID: "123", requestBody: `{"amount": 25.5}`, expectedAmount: 25.5, expectedStatus: http.StatusCreated},
+		{name: "Invalid ID", transactionID: "abc", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid Body", transactionID: "123", requestBody: `{"amount": "all"}`, expectedStatus: http.StatusBadRequest},
+		{
+			name:           "Not Refundable",
+			transactionID:  "123",
+			refundErr:      fmt.Errorf("%w: transaction 123 is PROCESSING", services.ErrNotRefundable),
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Over The Refundable Amount",
+			transactionID:  "123",
+			requestBody:    `{"amount": 500}`,
+			refundErr:      fmt.Errorf("failed to create refund: %w", repository.ErrAmountLimitExceeded),
+			expectedAmount: 500,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Gateway Error",
+			transactionID:  "123",
+			refundErr:      errors.New("failed to send request to gateway"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProcessor := &mockTransactionProcessor{
+				mockProcessRefund: func(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error) {
+					require.Equal(t, parentID, transactionID)
+					require.Equal(t, tt.expectedAmount, amount)
+					if tt.refundErr != nil {
+						return nil, tt.refundErr
+					}
+					return &models.Transaction{ID: 124, Amount: 100, Type: "refund", Status: "PENDING", ParentID: &parentID}, nil
+				},
+			}
+
+			handler := api.NewTransactionHandler(mockProcessor)
+
+			req, err := http.NewRequest("POST", "/transactions/"+tt.transactionID+"/refunds", strings.NewReader(tt.requestBody))
+			require.NoError(t, err)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.transactionID})
+
+			rr := httptest.NewRecorder()
+			handler.RefundHandler(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusCreated {
+				var resp models.APIResponse
+				require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+				require.Equal(t, "Refund initiated successfully", resp.Message)
+			}
+		})
+	}
+}
+
+func TestCancelHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		transactionID  string
+		cancelErr      error
+		expectedStatus int
+	}{
+		{name: "Cancelled", transactionID: "123", expectedStatus: http.StatusOK},
+		{name: "Invalid ID", transactionID: "abc", expectedStatus: http.StatusBadRequest},
+		{
+			name:           "Not Cancellable",
+			transactionID:  "123",
+			cancelErr:      fmt.Errorf("%w: only withdrawals can be cancelled", services.ErrNotCancellable),
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Already Settled",
+			transactionID:  "123",
+			cancelErr:      fmt.Errorf("%w: gateway refused to cancel withdrawal 123", services.ErrAlreadySettled),
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Gateway Error",
+			transactionID:  "123",
+			cancelErr:      errors.New("failed to send cancellation to gateway"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProcessor := &mockTransactionProcessor{
+				mockCancelTransaction: func(ctx context.Context, transactionID int) (*models.Transaction, error) {
+					require.Equal(t, 123, transactionID)
+					if tt.cancelErr != nil {
+						return nil, tt.cancelErr
+					}
+					return &models.Transaction{ID: 123, Amount: 50, Type: "withdrawal", Status: "CANCELLED"}, nil
+				},
+			}
+
+			handler := api.NewTransactionHandler(mockProcessor)
+
+			req, err := http.NewRequest("POST", "/transactions/"+tt.transactionID+"/cancel", nil)
+			require.NoError(t, err)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.transactionID})
+
+			rr := httptest.NewRecorder()
+			handler.CancelHandler(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var resp models.APIResponse
+				require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+				require.Equal(t, "Withdrawal cancelled successfully", resp.Message)
+			}
+		})
+	}
+}
+
+func TestCaptureHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		captureErr     error
+		expectedAmount float64
+		expectedStatus int
+	}{
+		{name: "Full Capture", expectedStatus: http.StatusCreated},
+		{name: "Partial Capture", requestBody: `{"amount": 80}`, expectedAmount: 80, expectedStatus: http.StatusCreated},
+		{
+			name:           "Not Capturable",
+			captureErr:     fmt.Errorf("%w: transaction 123 is a deposit, not an authorization", services.ErrNotCapturable),
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Over The Authorized Amount",
+			requestBody:    `{"amount": 500}`,
+			captureErr:     fmt.Errorf("failed to create capture: %w", repository.ErrAmountLimitExceeded),
+			expectedAmount: 500,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProcessor := &mockTransactionProcessor{
+				mockProcessCapture: func(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error) {
+					require.Equal(t, 123, transactionID)
+					require.Equal(t, tt.expectedAmount, amount)
+					if tt.captureErr != nil {
+						return nil, tt.captureErr
+					}
+					return &models.Transaction{ID: 124, Amount: 100, Type: "capture", Status: "PROCESSING"}, nil
+				},
+			}
+
+			handler := api.NewTransactionHandler(mockProcessor)
+
+			req, err := http.NewRequest("POST", "/transactions/123/capture", strings.NewReader(tt.requestBody))
+			require.NoError(t, err)
+			req = mux.SetURLVars(req, map[string]string{"id": "123"})
+
+			rr := httptest.NewRecorder()
+			handler.CaptureHandler(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusCreated {
+				var resp models.APIResponse
+				require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+				require.Equal(t, "Capture initiated successfully", resp.Message)
+			}
+		})
+	}
+}
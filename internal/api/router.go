@@ -4,16 +4,42 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func SetupRouter(transactionHandler *TransactionHandler, callbackHandler *CallbackHandler) *mux.Router {
+func SetupRouter(
+	transactionHandler *TransactionHandler,
+	callbackHandler *CallbackHandler,
+	adminHandler *AdminHandler,
+	debugHandler *DebugHandler,
+	balanceHandler *BalanceHandler,
+) *mux.Router {
 	router := mux.NewRouter()
 
 	router.HandleFunc("/deposit", transactionHandler.DepositHandler).Methods("POST")
 	router.HandleFunc("/withdrawal", transactionHandler.WithdrawalHandler).Methods("POST")
+	router.HandleFunc("/authorize", transactionHandler.AuthorizeHandler).Methods("POST")
+	router.HandleFunc("/transactions/{id}/refunds", transactionHandler.RefundHandler).Methods("POST")
+	router.HandleFunc("/transactions/{id}/cancel", transactionHandler.CancelHandler).Methods("POST")
+	router.HandleFunc("/transactions/{id}/capture", transactionHandler.CaptureHandler).Methods("POST")
+	router.HandleFunc("/transactions/{id}/void", transactionHandler.VoidHandler).Methods("POST")
+
+	router.HandleFunc("/users/{id}/balance", balanceHandler.BalanceHandler).Methods("GET")
 
 	router.HandleFunc("/api/callbacks/paypal", callbackHandler.HandlePayPalCallback).Methods("POST")
 	router.HandleFunc("/api/callbacks/stripe", callbackHandler.HandleStripeCallback).Methods("POST")
 	router.HandleFunc("/api/callbacks/adyen", callbackHandler.HandleAdyenCallback).Methods("POST")
 	router.HandleFunc("/api/callbacks/soap-gateway", callbackHandler.HandleSoapGatewayCallback).Methods("POST")
 
+	router.HandleFunc("/admin/maintenance-windows", adminHandler.ListMaintenanceWindowsHandler).Methods("GET")
+	router.HandleFunc("/admin/maintenance-windows", adminHandler.CreateMaintenanceWindowHandler).Methods("POST")
+	router.HandleFunc("/admin/maintenance-windows/{id}", adminHandler.DeleteMaintenanceWindowHandler).Methods("DELETE")
+
+	router.HandleFunc("/admin/routing-overrides", adminHandler.ListRoutingOverridesHandler).Methods("GET")
+	router.HandleFunc("/admin/routing-overrides", adminHandler.CreateRoutingOverrideHandler).Methods("POST")
+	router.HandleFunc("/admin/routing-overrides/{id}", adminHandler.DeleteRoutingOverrideHandler).Methods("DELETE")
+
+	router.HandleFunc("/admin/cache/{entity:gateways|countries|users}/{id}", adminHandler.InvalidateCacheHandler).Methods("DELETE")
+
+	router.HandleFunc("/debug/routing", debugHandler.RoutingHandler).Methods("GET")
+	router.HandleFunc("/debug/gateway-pools", debugHandler.PoolsHandler).Methods("GET")
+
 	return router
 }
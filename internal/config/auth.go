@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// Authentication schemes supported for gateway requests
+const (
+	AuthStatic                  = "static"
+	AuthBasic                   = "basic"
+	AuthOAuth2ClientCredentials = "oauth2_client_credentials"
+	AuthAPIKeyHeader            = "api_key_header"
+)
+
+// GatewayAuth describes how requests to a gateway are authenticated. Secrets are
+// usually given as ${ENV} references and expanded when the configuration is loaded.
+type GatewayAuth struct {
+	Type string `yaml:"type"`
+
+	// static sends Value as is in Header, which defaults to Authorization;
+	// api_key_header sends Value in Header
+	Header string `yaml:"header"`
+	Value  string `yaml:"value"`
+
+	// basic
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// oauth2_client_credentials
+	TokenURL      string   `yaml:"token_url"`
+	ClientID      string   `yaml:"client_id"`
+	ClientSecret  string   `yaml:"client_secret"`
+	Scopes        []string `yaml:"scopes"`
+	RefreshBefore int      `yaml:"refresh_before"` // seconds before expiry a token is renewed
+}
+
+// IsSet reports whether an auth block was configured
+func (a GatewayAuth) IsSet() bool {
+	return a.Type != ""
+}
+
+func (a *GatewayAuth) expandEnv() {
+	a.Value = os.ExpandEnv(a.Value)
+	a.Username = os.ExpandEnv(a.Username)
+	a.Password = os.ExpandEnv(a.Password)
+	a.TokenURL = os.ExpandEnv(a.TokenURL)
+	a.ClientID = os.ExpandEnv(a.ClientID)
+	a.ClientSecret = os.ExpandEnv(a.ClientSecret)
+}
+
+// Validate checks that the fields needed by the auth type are present and sets defaults
+func (a *GatewayAuth) Validate() error {
+	switch a.Type {
+	case "":
+		return nil
+	case AuthStatic:
+		if a.Header == "" {
+			a.Header = "Authorization"
+		}
+	case AuthAPIKeyHeader:
+		if a.Header == "" {
+			return fmt.Errorf("api_key_header auth requires a header")
+		}
+	case AuthBasic:
+		if a.Username == "" {
+			return fmt.Errorf("basic auth requires a username")
+		}
+	case AuthOAuth2ClientCredentials:
+		if a.TokenURL == "" {
+			return fmt.Errorf("oauth2_client_credentials auth requires a token_url")
+		}
+		if a.RefreshBefore < 0 {
+			return fmt.Errorf("refresh_before must not be negative")
+		}
+		if a.RefreshBefore == 0 {
+			a.RefreshBefore = 60
+		}
+	default:
+		return fmt.Errorf("unknown auth type %s", a.Type)
+	}
+
+	return nil
+}
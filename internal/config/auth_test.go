@@ -0,0 +1,46 @@
+package config_test
+
+import (
+	"payment-gateway/internal/config"
+	"testing"
+)
+
+func TestGatewayAuthValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		auth        config.GatewayAuth
+		expectError bool
+	}{
+		{"Not Configured", config.GatewayAuth{}, false},
+		{"Static Defaults To Authorization", config.GatewayAuth{Type: config.AuthStatic, Value: "Bearer x"}, false},
+		{"API Key Without Header", config.GatewayAuth{Type: config.AuthAPIKeyHeader, Value: "x"}, true},
+		{"Basic Without Username", config.GatewayAuth{Type: config.AuthBasic}, true},
+		{"OAuth2 Without Token URL", config.GatewayAuth{Type: config.AuthOAuth2ClientCredentials, ClientID: "id"}, true},
+		{"OAuth2", config.GatewayAuth{Type: config.AuthOAuth2ClientCredentials, TokenURL: "https://auth.example.com/token"}, false},
+		{"Unknown Type", config.GatewayAuth{Type: "hmac"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.auth.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+		})
+	}
+
+	auth := config.GatewayAuth{Type: config.AuthStatic, Value: "Bearer x"}
+	auth.Validate()
+	if auth.Header != "Authorization" {
+		t.Errorf("Expected static auth to default to the Authorization header, got %s", auth.Header)
+	}
+
+	auth = config.GatewayAuth{Type: config.AuthOAuth2ClientCredentials, TokenURL: "https://auth.example.com/token"}
+	auth.Validate()
+	if auth.RefreshBefore != 60 {
+		t.Errorf("Expected refresh_before to default to 60 seconds, got %d", auth.RefreshBefore)
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxInProcessCacheTTL bounds the TTL of the in-process cache, in seconds. The rows are
+// changed in the database directly and an invalidation only reaches one instance, so the TTL
+// is what bounds how long the others serve a changed row.
+const MaxInProcessCacheTTL = 300
+
+// CacheConfig configures the read-through cache of the gateways, countries and users
+type CacheConfig struct {
+	// TTL is how long, in seconds, a row is cached. 0 disables the cache. Without RedisURL
+	// it is at most MaxInProcessCacheTTL.
+	TTL int `yaml:"ttl"`
+	// MaxEntries bounds the in-process cache. Defaults to 10000.
+	MaxEntries int `yaml:"max_entries"`
+	// RedisURL, e.g. "redis://:password@redis:6379/0", shares the cache between the instances
+	// through Redis instead of keeping it in process. Its size is then bounded by Redis.
+	RedisURL string `yaml:"redis_url"`
+}
+
+// Enabled reports whether rows are cached
+func (c CacheConfig) Enabled() bool {
+	return c.TTL > 0
+}
+
+// Validate checks the settings and fills in the defaults
+func (c *CacheConfig) Validate() error {
+	if c.TTL < 0 || c.MaxEntries < 0 {
+		return fmt.Errorf("cache settings must not be negative")
+	}
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 10000
+	}
+
+	if c.RedisURL == "" && c.TTL > MaxInProcessCacheTTL {
+		return fmt.Errorf("cache ttl must not exceed %d seconds without redis_url, other instances keep serving rows until they expire", MaxInProcessCacheTTL)
+	}
+
+	if c.RedisURL != "" && !strings.HasPrefix(c.RedisURL, "redis://") && !strings.HasPrefix(c.RedisURL, "rediss://") {
+		return fmt.Errorf("cache redis_url must start with redis:// or rediss://")
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package config_test
+
+import (
+	"payment-gateway/internal/config"
+	"testing"
+)
+
+func TestCacheConfigValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		cache       config.CacheConfig
+		expectError bool
+	}{
+		{"Disabled", config.CacheConfig{}, false},
+		{"In Process", config.CacheConfig{TTL: 60, MaxEntries: 100}, false},
+		{"Redis", config.CacheConfig{TTL: 60, RedisURL: "redis://:password@redis:6379/0"}, false},
+		{"Negative TTL", config.CacheConfig{TTL: -1}, true},
+		{"Negative Size", config.CacheConfig{TTL: 60, MaxEntries: -1}, true},
+		{"Not A Redis URL", config.CacheConfig{TTL: 60, RedisURL: "redis:6379"}, true},
+		{"Long In Process TTL", config.CacheConfig{TTL: 3600}, true},
+		{"Long Redis TTL", config.CacheConfig{TTL: 3600, RedisURL: "redis://redis:6379/0"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cache.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+		})
+	}
+
+	cache := config.CacheConfig{TTL: 60}
+	if err := cache.Validate(); err != nil || cache.MaxEntries != 10000 {
+		t.Errorf("Expected 10000 entries by default, got %d and %v", cache.MaxEntries, err)
+	}
+}
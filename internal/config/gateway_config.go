@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,6 +12,42 @@ import (
 type GatewayEndpoints struct {
 	Deposit    string `yaml:"deposit"`
 	Withdrawal string `yaml:"withdrawal"`
+	// Refund may contain {reference}, replaced by the gateway reference of the refunded transaction
+	Refund string `yaml:"refund"`
+	// Cancel voids a pending withdrawal and may contain {reference} as well. Cancellation
+	// is unavailable through gateways without one.
+	Cancel string `yaml:"cancel"`
+	// Authorize, Capture and Void make up the two-step deposit flow; Capture and Void
+	// may contain the {reference} of the authorization
+	Authorize string `yaml:"authorize"`
+	Capture   string `yaml:"capture"`
+	Void      string `yaml:"void"`
+	// Status looks a transaction up by its {reference} to find out what became of it
+	// when no callback arrives. Lookups the gateway can't find are ignored.
+	Status string `yaml:"status"`
+}
+
+// For returns the endpoint of a transaction type, empty when it is not configured
+func (e GatewayEndpoints) For(transactionType string) string {
+	switch transactionType {
+	case "deposit":
+		return e.Deposit
+	case "withdrawal":
+		return e.Withdrawal
+	case "refund":
+		return e.Refund
+	case "cancel":
+		return e.Cancel
+	case "authorization":
+		return e.Authorize
+	case "capture":
+		return e.Capture
+	case "void":
+		return e.Void
+	case "status":
+		return e.Status
+	}
+	return ""
 }
 
 type GatewayRetry struct {
@@ -17,6 +55,74 @@ type GatewayRetry struct {
 	BackoffFactor float64 `yaml:"backoff_factor"`
 }
 
+// FeeSchedule describes what a gateway charges for a transaction: a percentage of
+// the amount plus a fixed part. Countries, Currency and Type narrow the schedule
+// down; an empty value matches anything.
+type FeeSchedule struct {
+	Countries  []string `yaml:"countries"`
+	Currency   string   `yaml:"currency"`
+	Type       string   `yaml:"type"`
+	Percentage float64  `yaml:"percentage"`
+	Fixed      float64  `yaml:"fixed"`
+}
+
+// matches reports whether the schedule applies and how specific the match is
+func (f FeeSchedule) matches(countryCode, currency, transactionType string) (int, bool) {
+	specificity := 0
+
+	if len(f.Countries) > 0 {
+		found := false
+		for _, code := range f.Countries {
+			if strings.EqualFold(code, countryCode) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+		specificity++
+	}
+
+	if f.Currency != "" {
+		if !strings.EqualFold(f.Currency, currency) {
+			return 0, false
+		}
+		specificity++
+	}
+
+	if f.Type != "" {
+		if f.Type != transactionType {
+			return 0, false
+		}
+		specificity++
+	}
+
+	return specificity, true
+}
+
+// GatewayPool tunes the connections kept to a gateway. Timeouts are in seconds.
+type GatewayPool struct {
+	MaxIdleConns        int `yaml:"max_idle_conns"`
+	MaxConnsPerHost     int `yaml:"max_conns_per_host"` // 0 means unlimited
+	IdleConnTimeout     int `yaml:"idle_conn_timeout"`
+	DialTimeout         int `yaml:"dial_timeout"`
+	TLSHandshakeTimeout int `yaml:"tls_handshake_timeout"`
+	MaxConcurrent       int `yaml:"max_concurrent"` // requests in flight, 0 means unlimited
+}
+
+// GatewaySOAP wraps the requests of an XML gateway in a SOAP envelope
+type GatewaySOAP struct {
+	Version   string `yaml:"version"`   // "1.1" (default) or "1.2"
+	Namespace string `yaml:"namespace"` // namespace of the body elements
+	Action    string `yaml:"action"`    // SOAPAction of the requests
+}
+
+// IsSet reports whether the gateway speaks SOAP
+func (s GatewaySOAP) IsSet() bool {
+	return s != GatewaySOAP{}
+}
+
 type GatewayDetails struct {
 	BaseURL     string            `yaml:"base_url"`
 	Endpoints   GatewayEndpoints  `yaml:"endpoints"`
@@ -24,15 +130,88 @@ type GatewayDetails struct {
 	Headers     map[string]string `yaml:"headers"`
 	Timeout     int               `yaml:"timeout"`
 	Retry       GatewayRetry      `yaml:"retry"`
+	Fees        []FeeSchedule     `yaml:"fees"`
+	Credentials map[string]string `yaml:"credentials"`
+	Auth        GatewayAuth       `yaml:"auth"`
+	TLS         GatewayTLS        `yaml:"tls"`
+	Pool        GatewayPool       `yaml:"pool"`
+	Signing     GatewaySigning    `yaml:"signing"`
+	SOAP        GatewaySOAP       `yaml:"soap"`
+	// AuthorizationTTL is how long, in seconds, an uncaptured authorization is kept
+	// before being voided. Defaults to 7 days.
+	AuthorizationTTL int               `yaml:"authorization_ttl"`
+	Settlement       GatewaySettlement `yaml:"settlement"`
+	// StatusSLA is how long, in seconds, a transaction may stay PENDING or PROCESSING
+	// before its status is looked up at the gateway. Defaults to 15 minutes.
+	StatusSLA int `yaml:"status_sla"`
+	// ExpireAfter is how long, in seconds, a transaction may stay PENDING or PROCESSING
+	// before it is marked EXPIRED. Defaults to 3 days.
+	ExpireAfter int `yaml:"expire_after"`
+}
+
+// CalculateFee returns the fee charged by the gateway for the given transaction,
+// using the most specific matching fee schedule. The second return value is false
+// when no schedule applies.
+func (d GatewayDetails) CalculateFee(countryCode, currency, transactionType string, amount float64) (float64, bool) {
+	best := -1
+	var schedule FeeSchedule
+
+	for _, fee := range d.Fees {
+		specificity, ok := fee.matches(countryCode, currency, transactionType)
+		if ok && specificity > best {
+			best = specificity
+			schedule = fee
+		}
+	}
+
+	if best < 0 {
+		return 0, false
+	}
+
+	fee := amount*schedule.Percentage/100 + schedule.Fixed
+	return math.Round(fee*100) / 100, true
 }
 
 type CountryConfig struct {
 	Gateways map[string]int `yaml:"gateways"`
 }
 
+// Routing strategies supported by the gateway selector
+const (
+	RoutingStrategyPriority = "priority"
+	RoutingStrategyCost     = "cost"
+	RoutingStrategyAdaptive = "adaptive"
+)
+
+// AdaptiveRoutingConfig tunes the success-rate based routing strategy
+type AdaptiveRoutingConfig struct {
+	Window        int     `yaml:"window"`         // outcomes kept per gateway and country
+	MinSamples    int     `yaml:"min_samples"`    // outcomes needed before a gateway's score is trusted
+	Epsilon       float64 `yaml:"epsilon"`        // share of traffic used to explore other gateways
+	LatencyWeight float64 `yaml:"latency_weight"` // score penalty for a gateway at the latency target
+	LatencyTarget int     `yaml:"latency_target"` // milliseconds
+}
+
+type RoutingConfig struct {
+	Strategy string                `yaml:"strategy"`
+	Adaptive AdaptiveRoutingConfig `yaml:"adaptive"`
+}
+
+// WithdrawalConfig configures the holds placed on user balances for withdrawals
+type WithdrawalConfig struct {
+	// HoldTTL is how long, in seconds, a withdrawal may stay PENDING before its hold is
+	// taken as orphaned and released
+	HoldTTL int `yaml:"hold_ttl"`
+}
+
 type GatewayConfig struct {
-	Gateways  map[string]GatewayDetails `yaml:"gateways"`
-	Countries map[string]CountryConfig  `yaml:"countries"`
+	Server      ServerConfig              `yaml:"server"`
+	Gateways    map[string]GatewayDetails `yaml:"gateways"`
+	Countries   map[string]CountryConfig  `yaml:"countries"`
+	Routing     RoutingConfig             `yaml:"routing"`
+	Maintenance []MaintenanceWindow       `yaml:"maintenance"`
+	Withdrawals WithdrawalConfig          `yaml:"withdrawals"`
+	Cache       CacheConfig               `yaml:"cache"`
 }
 
 // GetGatewayDetails returns the gateway details for a given gateway name
@@ -41,6 +220,17 @@ func (c *GatewayConfig) GetGatewayDetails(gatewayName string) (GatewayDetails, b
 	return details, exists
 }
 
+// MinStatusSLA returns the shortest status_sla of the gateways, in seconds
+func (c *GatewayConfig) MinStatusSLA() int {
+	min, first := 0, true
+	for _, details := range c.Gateways {
+		if first || details.StatusSLA < min {
+			min, first = details.StatusSLA, false
+		}
+	}
+	return min
+}
+
 type GatewayPriority struct {
 	Name     string
 	ID       int
@@ -58,6 +248,18 @@ func LoadGatewayConfig(configPath string) (*GatewayConfig, error) {
 		return nil, fmt.Errorf("error parsing config file: %w", err)
 	}
 
+	// Credentials and URLs are usually injected through the environment
+	config.Server.PublicBaseURL = os.ExpandEnv(config.Server.PublicBaseURL)
+	config.Cache.RedisURL = os.ExpandEnv(config.Cache.RedisURL)
+	for name, gateway := range config.Gateways {
+		gateway.CallbackURL = os.ExpandEnv(gateway.CallbackURL)
+		for key, value := range gateway.Credentials {
+			gateway.Credentials[key] = os.ExpandEnv(value)
+		}
+		gateway.Auth.expandEnv()
+		config.Gateways[name] = gateway
+	}
+
 	// Validate the configuration
 	if err := validateConfig(&config); err != nil {
 		return nil, err
@@ -75,6 +277,97 @@ func validateConfig(config *GatewayConfig) error {
 		return fmt.Errorf("no countries defined in configuration")
 	}
 
+	switch config.Routing.Strategy {
+	case "":
+		config.Routing.Strategy = RoutingStrategyPriority
+	case RoutingStrategyPriority, RoutingStrategyCost, RoutingStrategyAdaptive:
+	default:
+		return fmt.Errorf("unknown routing strategy %s", config.Routing.Strategy)
+	}
+
+	if err := validateAdaptiveRouting(&config.Routing.Adaptive); err != nil {
+		return err
+	}
+
+	if err := config.Server.validate(); err != nil {
+		return err
+	}
+
+	if config.Withdrawals.HoldTTL < 0 {
+		return fmt.Errorf("withdrawals: hold_ttl must not be negative")
+	}
+	if config.Withdrawals.HoldTTL == 0 {
+		config.Withdrawals.HoldTTL = 15 * 60
+	}
+
+	if err := config.Cache.Validate(); err != nil {
+		return err
+	}
+
+	for gatewayName, gateway := range config.Gateways {
+		for _, fee := range gateway.Fees {
+			if fee.Percentage < 0 || fee.Fixed < 0 {
+				return fmt.Errorf("gateway %s has a negative fee schedule", gatewayName)
+			}
+		}
+
+		if err := config.Server.ValidateCallbackURL(gateway.CallbackURL); err != nil {
+			return fmt.Errorf("gateway %s: %w", gatewayName, err)
+		}
+		if err := gateway.Auth.Validate(); err != nil {
+			return fmt.Errorf("gateway %s: %w", gatewayName, err)
+		}
+		if err := gateway.TLS.Validate(); err != nil {
+			return fmt.Errorf("gateway %s: %w", gatewayName, err)
+		}
+		if err := validatePool(&gateway.Pool); err != nil {
+			return fmt.Errorf("gateway %s: %w", gatewayName, err)
+		}
+		if gateway.AuthorizationTTL < 0 {
+			return fmt.Errorf("gateway %s: authorization_ttl must not be negative", gatewayName)
+		}
+		if gateway.AuthorizationTTL == 0 {
+			gateway.AuthorizationTTL = 7 * 24 * 60 * 60
+		}
+		if gateway.StatusSLA < 0 || gateway.ExpireAfter < 0 {
+			return fmt.Errorf("gateway %s: status_sla and expire_after must not be negative", gatewayName)
+		}
+		if gateway.StatusSLA == 0 {
+			gateway.StatusSLA = 15 * 60
+		}
+		if gateway.ExpireAfter == 0 {
+			gateway.ExpireAfter = 3 * 24 * 60 * 60
+		}
+		if gateway.ExpireAfter < gateway.StatusSLA {
+			return fmt.Errorf("gateway %s: expire_after must not be shorter than status_sla", gatewayName)
+		}
+		if err := gateway.Signing.Validate(); err != nil {
+			return fmt.Errorf("gateway %s: %w", gatewayName, err)
+		}
+		if err := gateway.Settlement.Validate(); err != nil {
+			return fmt.Errorf("gateway %s: %w", gatewayName, err)
+		}
+		if gateway.SOAP.IsSet() {
+			switch gateway.SOAP.Version {
+			case "":
+				gateway.SOAP.Version = "1.1"
+			case "1.1", "1.2":
+			default:
+				return fmt.Errorf("gateway %s: unsupported soap version %s", gatewayName, gateway.SOAP.Version)
+			}
+		}
+		config.Gateways[gatewayName] = gateway
+	}
+
+	for i, window := range config.Maintenance {
+		if _, exists := config.Gateways[window.Gateway]; !exists {
+			return fmt.Errorf("maintenance window %d references unknown gateway %s", i+1, window.Gateway)
+		}
+		if err := window.Validate(); err != nil {
+			return fmt.Errorf("maintenance window %d: %w", i+1, err)
+		}
+	}
+
 	// Validate that all gateways referenced in countries exist
 	for countryCode, country := range config.Countries {
 
@@ -92,3 +385,51 @@ func validateConfig(config *GatewayConfig) error {
 
 	return nil
 }
+
+func validateAdaptiveRouting(adaptive *AdaptiveRoutingConfig) error {
+	if adaptive.Window == 0 {
+		adaptive.Window = 100
+	}
+	if adaptive.MinSamples == 0 {
+		adaptive.MinSamples = 10
+	}
+	if adaptive.LatencyTarget == 0 {
+		adaptive.LatencyTarget = 5000
+	}
+
+	if adaptive.Window < 0 || adaptive.MinSamples < 0 || adaptive.LatencyTarget < 0 || adaptive.LatencyWeight < 0 {
+		return fmt.Errorf("adaptive routing settings must not be negative")
+	}
+
+	if adaptive.MinSamples > adaptive.Window {
+		return fmt.Errorf("adaptive routing min_samples (%d) exceeds window (%d)", adaptive.MinSamples, adaptive.Window)
+	}
+
+	if adaptive.Epsilon < 0 || adaptive.Epsilon > 1 {
+		return fmt.Errorf("adaptive routing epsilon must be between 0 and 1")
+	}
+
+	return nil
+}
+
+func validatePool(pool *GatewayPool) error {
+	if pool.MaxIdleConns < 0 || pool.MaxConnsPerHost < 0 || pool.IdleConnTimeout < 0 ||
+		pool.DialTimeout < 0 || pool.TLSHandshakeTimeout < 0 || pool.MaxConcurrent < 0 {
+		return fmt.Errorf("pool settings must not be negative")
+	}
+
+	if pool.MaxIdleConns == 0 {
+		pool.MaxIdleConns = 10
+	}
+	if pool.IdleConnTimeout == 0 {
+		pool.IdleConnTimeout = 90
+	}
+	if pool.DialTimeout == 0 {
+		pool.DialTimeout = 5
+	}
+	if pool.TLSHandshakeTimeout == 0 {
+		pool.TLSHandshakeTimeout = 5
+	}
+
+	return nil
+}
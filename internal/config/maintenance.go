@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Recurrence of a maintenance window
+const (
+	RecurrenceNone    = ""
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+// Where a maintenance window comes from. Windows of the configuration are kept in step with
+// it at every start and can only be removed from it; the others are added through the admin API.
+const (
+	MaintenanceSourceConfig = "config"
+	MaintenanceSourceAdmin  = "admin"
+)
+
+// MaintenanceWindow is a period announced by a provider during which a gateway must
+// not be used. Start and End are in UTC; a recurring window repeats from Start.
+type MaintenanceWindow struct {
+	ID         int       `yaml:"-" json:"id"`
+	Gateway    string    `yaml:"gateway" json:"gateway"`
+	Countries  []string  `yaml:"countries" json:"countries,omitempty"`
+	Start      time.Time `yaml:"start" json:"start"`
+	End        time.Time `yaml:"end" json:"end"`
+	Recurrence string    `yaml:"recurrence" json:"recurrence,omitempty"`
+	Source     string    `yaml:"-" json:"source"`
+}
+
+// Validate checks that the window is well formed
+func (w MaintenanceWindow) Validate() error {
+	if w.Gateway == "" {
+		return fmt.Errorf("gateway is required")
+	}
+
+	if !w.End.After(w.Start) {
+		return fmt.Errorf("end must be after start")
+	}
+
+	duration := w.End.Sub(w.Start)
+
+	switch w.Recurrence {
+	case RecurrenceNone:
+	case RecurrenceDaily:
+		if duration >= 24*time.Hour {
+			return fmt.Errorf("a daily window must last less than a day")
+		}
+	case RecurrenceWeekly:
+		if duration >= 7*24*time.Hour {
+			return fmt.Errorf("a weekly window must last less than a week")
+		}
+	case RecurrenceMonthly:
+		if duration >= 28*24*time.Hour {
+			return fmt.Errorf("a monthly window must last less than 28 days")
+		}
+	default:
+		return fmt.Errorf("unknown recurrence %s", w.Recurrence)
+	}
+
+	return nil
+}
+
+// SameAs reports whether two windows cover the same gateways, countries and periods,
+// whatever their ID and source
+func (w MaintenanceWindow) SameAs(other MaintenanceWindow) bool {
+	if w.Gateway != other.Gateway || w.Recurrence != other.Recurrence ||
+		!w.Start.Equal(other.Start) || !w.End.Equal(other.End) || len(w.Countries) != len(other.Countries) {
+		return false
+	}
+
+	for i, code := range w.Countries {
+		if !strings.EqualFold(code, other.Countries[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AppliesTo reports whether the window covers the gateway in the given country
+func (w MaintenanceWindow) AppliesTo(gatewayName, countryCode string) bool {
+	if w.Gateway != gatewayName {
+		return false
+	}
+
+	if len(w.Countries) == 0 {
+		return true
+	}
+
+	for _, code := range w.Countries {
+		if strings.EqualFold(code, countryCode) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ActiveAt reports whether the window, or one of its recurrences, covers the given time
+func (w MaintenanceWindow) ActiveAt(now time.Time) bool {
+	now = now.UTC()
+	start := w.Start.UTC()
+	duration := w.End.Sub(w.Start)
+
+	if now.Before(start) {
+		return false
+	}
+
+	var occurrence time.Time
+	switch w.Recurrence {
+	case RecurrenceDaily, RecurrenceWeekly:
+		period := 24 * time.Hour
+		if w.Recurrence == RecurrenceWeekly {
+			period *= 7
+		}
+		occurrence = start.Add(now.Sub(start) / period * period)
+	case RecurrenceMonthly:
+		months := (now.Year()-start.Year())*12 + int(now.Month()-start.Month())
+		occurrence = monthlyOccurrence(start, months)
+		for occurrence.After(now) {
+			months--
+			occurrence = monthlyOccurrence(start, months)
+		}
+	default:
+		occurrence = start
+	}
+
+	return !now.Before(occurrence) && now.Before(occurrence.Add(duration))
+}
+
+// monthlyOccurrence returns the start of a monthly window the given number of months
+// after its first one, on the last day of months too short for its day
+func monthlyOccurrence(start time.Time, months int) time.Time {
+	first := time.Date(start.Year(), start.Month()+time.Month(months), 1,
+		start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+
+	day := start.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+
+	return first.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,104 @@
+package config_test
+
+import (
+	"payment-gateway/internal/config"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowActiveAt(t *testing.T) {
+	start := time.Date(2025, 3, 9, 2, 0, 0, 0, time.UTC) // a Sunday
+	end := start.Add(2 * time.Hour)
+
+	tests := []struct {
+		name       string
+		recurrence string
+		at         time.Time
+		expected   bool
+	}{
+		{"Before Start", config.RecurrenceNone, start.Add(-time.Minute), false},
+		{"Inside Once", config.RecurrenceNone, start.Add(time.Hour), true},
+		{"End Is Exclusive", config.RecurrenceNone, end, false},
+		{"Once Does Not Repeat", config.RecurrenceNone, start.AddDate(0, 0, 7), false},
+		{"Daily Next Day", config.RecurrenceDaily, start.AddDate(0, 0, 1).Add(30 * time.Minute), true},
+		{"Daily Outside", config.RecurrenceDaily, start.AddDate(0, 0, 1).Add(3 * time.Hour), false},
+		{"Weekly Next Week", config.RecurrenceWeekly, start.AddDate(0, 0, 14).Add(time.Hour), true},
+		{"Weekly Other Day", config.RecurrenceWeekly, start.AddDate(0, 0, 15).Add(time.Hour), false},
+		{"Monthly Next Month", config.RecurrenceMonthly, start.AddDate(0, 2, 0).Add(time.Hour), true},
+		{"Monthly Other Day", config.RecurrenceMonthly, start.AddDate(0, 2, 1), false},
+		{"Other Time Zone", config.RecurrenceNone, start.Add(time.Hour).In(time.FixedZone("UTC+4", 4*3600)), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := config.MaintenanceWindow{
+				Gateway:    "stripe",
+				Start:      start,
+				End:        end,
+				Recurrence: tt.recurrence,
+			}
+
+			if err := window.Validate(); err != nil {
+				t.Fatalf("Expected valid window, got: %v", err)
+			}
+
+			if active := window.ActiveAt(tt.at); active != tt.expected {
+				t.Errorf("Expected active=%v at %s, got %v", tt.expected, tt.at, active)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowActiveAtMonthEnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    time.Time
+		at       time.Time
+		expected bool
+	}{
+		{"Jan 31 On Feb 28", time.Date(2025, 1, 31, 2, 0, 0, 0, time.UTC), time.Date(2025, 2, 28, 3, 0, 0, 0, time.UTC), true},
+		{"Jan 31 On Mar 1", time.Date(2025, 1, 31, 2, 0, 0, 0, time.UTC), time.Date(2025, 3, 1, 3, 0, 0, 0, time.UTC), false},
+		{"Jan 31 On Mar 3", time.Date(2025, 1, 31, 2, 0, 0, 0, time.UTC), time.Date(2025, 3, 3, 3, 0, 0, 0, time.UTC), false},
+		{"Jan 31 On Mar 31", time.Date(2025, 1, 31, 2, 0, 0, 0, time.UTC), time.Date(2025, 3, 31, 3, 0, 0, 0, time.UTC), true},
+		{"Jan 31 On Apr 30", time.Date(2025, 1, 31, 2, 0, 0, 0, time.UTC), time.Date(2025, 4, 30, 3, 0, 0, 0, time.UTC), true},
+		{"Jan 31 On Feb 29 Of Leap Year", time.Date(2024, 1, 31, 2, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 3, 0, 0, 0, time.UTC), true},
+		{"Jan 31 On Feb 28 Of Leap Year", time.Date(2024, 1, 31, 2, 0, 0, 0, time.UTC), time.Date(2024, 2, 28, 3, 0, 0, 0, time.UTC), false},
+		{"Jan 30 On Feb 28", time.Date(2025, 1, 30, 2, 0, 0, 0, time.UTC), time.Date(2025, 2, 28, 3, 0, 0, 0, time.UTC), true},
+		{"Jan 29 On Mar 1", time.Date(2025, 1, 29, 2, 0, 0, 0, time.UTC), time.Date(2025, 3, 1, 3, 0, 0, 0, time.UTC), false},
+		{"Feb 29 On Feb 28 Next Year", time.Date(2024, 2, 29, 2, 0, 0, 0, time.UTC), time.Date(2025, 2, 28, 3, 0, 0, 0, time.UTC), true},
+		{"Feb 29 On Mar 29", time.Date(2024, 2, 29, 2, 0, 0, 0, time.UTC), time.Date(2024, 3, 29, 3, 0, 0, 0, time.UTC), true},
+		{"Before Clamped Start", time.Date(2025, 1, 31, 2, 0, 0, 0, time.UTC), time.Date(2025, 2, 28, 1, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := config.MaintenanceWindow{
+				Gateway:    "stripe",
+				Start:      tt.start,
+				End:        tt.start.Add(2 * time.Hour),
+				Recurrence: config.RecurrenceMonthly,
+			}
+
+			if active := window.ActiveAt(tt.at); active != tt.expected {
+				t.Errorf("Expected active=%v at %s, got %v", tt.expected, tt.at, active)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowValidate(t *testing.T) {
+	start := time.Date(2025, 3, 9, 2, 0, 0, 0, time.UTC)
+
+	invalid := []config.MaintenanceWindow{
+		{Start: start, End: start.Add(time.Hour)},
+		{Gateway: "stripe", Start: start, End: start},
+		{Gateway: "stripe", Start: start, End: start.Add(25 * time.Hour), Recurrence: config.RecurrenceDaily},
+		{Gateway: "stripe", Start: start, End: start.Add(time.Hour), Recurrence: "yearly"},
+	}
+
+	for _, window := range invalid {
+		if err := window.Validate(); err == nil {
+			t.Errorf("Expected window %+v to be invalid", window)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Placeholders available in a gateway's callback_url
+const (
+	CallbackTransactionID = "{transaction_id}"
+	CallbackToken         = "{token}"
+)
+
+// ServerConfig describes how the service is reached by the gateways
+type ServerConfig struct {
+	// PublicBaseURL prefixes relative callback URLs, usually set per environment
+	// through the environment, e.g. "${PUBLIC_BASE_URL}"
+	PublicBaseURL string `yaml:"public_base_url"`
+	// CallbackTokenKey is the secret reference ("env:NAME" or "file:/path") of the key
+	// signing the {token} of callback URLs. When set, every callback_url must carry
+	// {transaction_id} and {token}, and callbacks without a valid token are rejected.
+	CallbackTokenKey string `yaml:"callback_token_key"`
+	// CallbackTokenTTL is how long, in seconds, a callback token is accepted after the
+	// request carrying it was sent, 7 days by default
+	CallbackTokenTTL int `yaml:"callback_token_ttl"`
+}
+
+// CallbackURL renders a callback_url template for a transaction, resolving relative
+// URLs against the public base URL
+func (s ServerConfig) CallbackURL(template string, transactionID int, token string) string {
+	callbackURL := strings.NewReplacer(
+		CallbackTransactionID, strconv.Itoa(transactionID),
+		CallbackToken, url.QueryEscape(token),
+	).Replace(template)
+
+	if strings.HasPrefix(callbackURL, "/") {
+		callbackURL = strings.TrimRight(s.PublicBaseURL, "/") + callbackURL
+	}
+
+	return callbackURL
+}
+
+func (s *ServerConfig) validate() error {
+	if s.CallbackTokenTTL < 0 {
+		return fmt.Errorf("server callback_token_ttl must not be negative")
+	}
+	if s.CallbackTokenTTL == 0 {
+		s.CallbackTokenTTL = 7 * 24 * 60 * 60
+	}
+
+	if s.PublicBaseURL == "" {
+		return nil
+	}
+
+	base, err := url.Parse(s.PublicBaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid server public_base_url: %w", err)
+	}
+	if base.Host == "" || base.RawQuery != "" || base.Fragment != "" {
+		return fmt.Errorf("server public_base_url %s must be a scheme and host, optionally with a path", s.PublicBaseURL)
+	}
+
+	return nil
+}
+
+// ValidateCallbackURL checks that a gateway's callback_url renders to an absolute HTTPS URL.
+// Plain HTTP is accepted for loopback hosts, for local testing.
+func (s ServerConfig) ValidateCallbackURL(template string) error {
+	if template == "" {
+		return fmt.Errorf("callback_url is not configured")
+	}
+
+	usesToken := strings.Contains(template, CallbackToken)
+	if usesToken && s.CallbackTokenKey == "" {
+		return fmt.Errorf("callback_url uses %s but server callback_token_key is not set", CallbackToken)
+	}
+	if s.CallbackTokenKey != "" && (!usesToken || !strings.Contains(template, CallbackTransactionID)) {
+		return fmt.Errorf("callback_url must carry %s and %s when callback tokens are enabled", CallbackTransactionID, CallbackToken)
+	}
+
+	if strings.HasPrefix(template, "/") && s.PublicBaseURL == "" {
+		return fmt.Errorf("callback_url %s is relative and server public_base_url is not set", template)
+	}
+
+	callbackURL, err := url.Parse(s.CallbackURL(template, 1, "token"))
+	if err != nil {
+		return fmt.Errorf("invalid callback_url: %w", err)
+	}
+	if callbackURL.Host == "" {
+		return fmt.Errorf("callback_url %s is not absolute", template)
+	}
+
+	switch callbackURL.Scheme {
+	case "https":
+	case "http":
+		if !isLoopback(callbackURL.Hostname()) {
+			return fmt.Errorf("callback_url %s must use https", callbackURL.Redacted())
+		}
+	default:
+		return fmt.Errorf("callback_url %s must use https", callbackURL.Redacted())
+	}
+
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
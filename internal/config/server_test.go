@@ -0,0 +1,68 @@
+package config_test
+
+import (
+	"payment-gateway/internal/config"
+	"testing"
+)
+
+func TestServerConfigCallbackURL(t *testing.T) {
+	server := config.ServerConfig{PublicBaseURL: "https://payments.example.com/"}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"Relative", "/api/callbacks/paypal", "https://payments.example.com/api/callbacks/paypal"},
+		{"Absolute", "https://hooks.example.com/stripe", "https://hooks.example.com/stripe"},
+		{
+			"Placeholders",
+			"/api/callbacks/adyen?transaction_id={transaction_id}&token={token}",
+			"https://payments.example.com/api/callbacks/adyen?transaction_id=42&token=a%2Bb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if callbackURL := server.CallbackURL(tt.template, 42, "a+b"); callbackURL != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, callbackURL)
+			}
+		})
+	}
+}
+
+func TestServerConfigValidateCallbackURL(t *testing.T) {
+	public := config.ServerConfig{PublicBaseURL: "https://payments.example.com"}
+	withTokens := config.ServerConfig{PublicBaseURL: "https://payments.example.com", CallbackTokenKey: "env:CALLBACK_TOKEN_KEY"}
+	tokenized := "/api/callbacks/paypal?transaction_id={transaction_id}&token={token}"
+
+	tests := []struct {
+		name        string
+		server      config.ServerConfig
+		template    string
+		expectError bool
+	}{
+		{"Relative With Base URL", public, "/api/callbacks/paypal", false},
+		{"Relative Without Base URL", config.ServerConfig{}, "/api/callbacks/paypal", true},
+		{"Absolute HTTPS", config.ServerConfig{}, "https://hooks.example.com/paypal", false},
+		{"Plain HTTP", config.ServerConfig{}, "http://hooks.example.com/paypal", true},
+		{"Plain HTTP On Localhost", config.ServerConfig{PublicBaseURL: "http://localhost:8080"}, "/api/callbacks/paypal", false},
+		{"HTTP Base URL", config.ServerConfig{PublicBaseURL: "http://payments.example.com"}, "/api/callbacks/paypal", true},
+		{"Missing", public, "", true},
+		{"Token Without Key", public, tokenized, true},
+		{"Key Without Token", withTokens, "/api/callbacks/paypal", true},
+		{"Tokenized", withTokens, tokenized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.server.ValidateCallbackURL(tt.template)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+		})
+	}
+}
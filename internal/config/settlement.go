@@ -0,0 +1,64 @@
+package config
+
+import "fmt"
+
+// Settlement report formats
+const (
+	SettlementStripe = "stripe" // Stripe's itemized balance change report
+	SettlementAdyen  = "adyen"  // Adyen's settlement details report
+	SettlementCSV    = "csv"    // any CSV file, read through the column mapping
+)
+
+// SettlementColumns names the CSV columns holding each field of a settlement record
+type SettlementColumns struct {
+	Reference string `yaml:"reference"`
+	Amount    string `yaml:"amount"`
+	Currency  string `yaml:"currency"`
+	Status    string `yaml:"status"`
+	Date      string `yaml:"date"`
+}
+
+// GatewaySettlement describes the settlement reports of a gateway, used for reconciliation.
+// Columns, DateLayout, Delimiter, MinorUnits and Statuses only apply to the csv format.
+type GatewaySettlement struct {
+	Format     string            `yaml:"format"`
+	Columns    SettlementColumns `yaml:"columns"`
+	DateLayout string            `yaml:"date_layout"` // Go time layout, defaults to "2006-01-02 15:04:05"
+	Delimiter  string            `yaml:"delimiter"`   // defaults to ","
+	MinorUnits bool              `yaml:"minor_units"` // amounts are in cents rather than decimal
+	// Statuses maps the report's statuses onto transaction statuses, unmapped ones are
+	// kept as is. Records without a status column are taken as COMPLETED.
+	Statuses map[string]string `yaml:"statuses"`
+}
+
+// IsSet reports whether the gateway's settlement reports can be reconciled
+func (s GatewaySettlement) IsSet() bool {
+	return s.Format != ""
+}
+
+// Validate checks the format and column mapping and sets the defaults
+func (s *GatewaySettlement) Validate() error {
+	switch s.Format {
+	case "", SettlementStripe, SettlementAdyen:
+		return nil
+	case SettlementCSV:
+	default:
+		return fmt.Errorf("unknown settlement format %s", s.Format)
+	}
+
+	if s.Columns.Reference == "" || s.Columns.Amount == "" || s.Columns.Date == "" {
+		return fmt.Errorf("settlement csv format requires the reference, amount and date columns")
+	}
+
+	if s.DateLayout == "" {
+		s.DateLayout = "2006-01-02 15:04:05"
+	}
+	if s.Delimiter == "" {
+		s.Delimiter = ","
+	}
+	if len([]rune(s.Delimiter)) != 1 {
+		return fmt.Errorf("settlement delimiter must be a single character")
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package config_test
+
+import (
+	"payment-gateway/internal/config"
+	"testing"
+)
+
+func TestGatewaySettlementValidate(t *testing.T) {
+	columns := config.SettlementColumns{Reference: "ref", Amount: "amount", Date: "date"}
+
+	tests := []struct {
+		name        string
+		settlement  config.GatewaySettlement
+		expectError bool
+	}{
+		{"Not Configured", config.GatewaySettlement{}, false},
+		{"Stripe", config.GatewaySettlement{Format: config.SettlementStripe}, false},
+		{"CSV", config.GatewaySettlement{Format: config.SettlementCSV, Columns: columns}, false},
+		{"CSV Without Reference Column", config.GatewaySettlement{Format: config.SettlementCSV, Columns: config.SettlementColumns{Amount: "amount", Date: "date"}}, true},
+		{"CSV With Long Delimiter", config.GatewaySettlement{Format: config.SettlementCSV, Columns: columns, Delimiter: ";;"}, true},
+		{"Unknown Format", config.GatewaySettlement{Format: "mt940"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settlement.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+		})
+	}
+
+	settlement := config.GatewaySettlement{Format: config.SettlementCSV, Columns: columns}
+	settlement.Validate()
+	if settlement.Delimiter != "," || settlement.DateLayout != "2006-01-02 15:04:05" {
+		t.Errorf("Expected the csv defaults, got delimiter %q and layout %q", settlement.Delimiter, settlement.DateLayout)
+	}
+}
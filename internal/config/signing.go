@@ -0,0 +1,57 @@
+package config
+
+import "fmt"
+
+// Algorithms supported for signing gateway requests
+const (
+	SigningHMACSHA256 = "hmac-sha256"
+	SigningRSASHA256  = "rsa-sha256"
+)
+
+// GatewaySigning describes how requests to a gateway are signed. The signature
+// covers the timestamp, the nonce and the body, separated by newlines, and is
+// sent base64 encoded.
+type GatewaySigning struct {
+	Algorithm       string `yaml:"algorithm"`
+	Key             string `yaml:"key"` // secret reference, e.g. env:NAME or file:/path/key.pem
+	KeyID           string `yaml:"key_id"`
+	SignatureHeader string `yaml:"signature_header"`
+	TimestampHeader string `yaml:"timestamp_header"`
+	NonceHeader     string `yaml:"nonce_header"`
+	KeyIDHeader     string `yaml:"key_id_header"`
+}
+
+// IsSet reports whether request signing was configured
+func (s GatewaySigning) IsSet() bool {
+	return s.Algorithm != ""
+}
+
+// Validate checks the algorithm and key and sets the default header names
+func (s *GatewaySigning) Validate() error {
+	switch s.Algorithm {
+	case "":
+		return nil
+	case SigningHMACSHA256, SigningRSASHA256:
+	default:
+		return fmt.Errorf("unknown signing algorithm %s", s.Algorithm)
+	}
+
+	if s.Key == "" {
+		return fmt.Errorf("signing requires a key")
+	}
+
+	if s.SignatureHeader == "" {
+		s.SignatureHeader = "X-Signature"
+	}
+	if s.TimestampHeader == "" {
+		s.TimestampHeader = "X-Timestamp"
+	}
+	if s.NonceHeader == "" {
+		s.NonceHeader = "X-Nonce"
+	}
+	if s.KeyIDHeader == "" {
+		s.KeyIDHeader = "X-Key-Id"
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// GatewayTLS configures the TLS connection to a gateway: a client certificate for
+// mutual TLS, a private CA bundle and the server name the certificate must carry
+type GatewayTLS struct {
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	CAFile     string `yaml:"ca_file"`
+	MinVersion string `yaml:"min_version"` // "1.2" (default) or "1.3"
+	ServerName string `yaml:"server_name"`
+}
+
+// IsSet reports whether any TLS setting was configured
+func (t GatewayTLS) IsSet() bool {
+	return t != GatewayTLS{}
+}
+
+// Version returns the minimum TLS version as a crypto/tls constant
+func (t GatewayTLS) Version() uint16 {
+	if version, ok := tlsVersions[t.MinVersion]; ok {
+		return version
+	}
+	return tls.VersionTLS12
+}
+
+// Files returns the certificate files the configuration depends on
+func (t GatewayTLS) Files() []string {
+	var files []string
+	for _, file := range []string{t.CertFile, t.KeyFile, t.CAFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Validate checks that the client certificate is complete and the version is known
+func (t GatewayTLS) Validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+
+	if t.MinVersion != "" {
+		if _, ok := tlsVersions[t.MinVersion]; !ok {
+			return fmt.Errorf("unsupported tls min_version %s", t.MinVersion)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"payment-gateway/internal/config"
+	"strings"
+	"time"
+)
+
+// Immediate statuses reported by a gateway when a request is accepted
+const (
+	StatusProcessing = "PROCESSING"
+	StatusCompleted  = "COMPLETED"
+	StatusFailed     = "FAILED"
+)
+
+// ReferencePlaceholder is replaced in refund, cancel, capture, void and status endpoints by
+// the gateway reference of the transaction they apply to
+const ReferencePlaceholder = "{reference}"
+
+// Request is a transaction to be sent to a gateway
+type Request struct {
+	Gateway         string
+	TransactionType string
+	TransactionID   int
+	Amount          float64
+	Currency        string
+	// Payload is the transaction already encoded in the gateway's data format,
+	// used by gateways without a dedicated adapter along with its Headers
+	Payload []byte
+	Headers map[string]string
+	// OriginalReference is the gateway reference of the transaction a refund,
+	// cancellation, capture, void or status lookup is for
+	OriginalReference string
+}
+
+// Result is the gateway's answer to a request. RequestBody and ResponseBody are
+// redacted copies kept to record the attempt, RawResponse is the unredacted body
+// for callers decoding it further and must never be stored.
+type Result struct {
+	GatewayReference string
+	Status           string
+	DeclineCode      string
+	StatusCode       int
+	RequestBody      []byte
+	ResponseBody     []byte
+	RawResponse      []byte
+	Latency          time.Duration
+}
+
+// GatewayAdapter translates transactions into a provider's API
+type GatewayAdapter interface {
+	// BuildRequest creates the provider specific HTTP request for a transaction
+	BuildRequest(ctx context.Context, request *Request, details config.GatewayDetails) (*http.Request, error)
+	// Authenticate adds the provider's credentials to the request
+	Authenticate(ctx context.Context, client *http.Client, req *http.Request, details config.GatewayDetails) error
+	// ParseResponse extracts the gateway reference and immediate status from a response
+	ParseResponse(statusCode int, body []byte) (*Result, error)
+}
+
+// endpointFor returns the configured URL for a request's transaction type
+func endpointFor(request *Request, details config.GatewayDetails) (string, error) {
+	endpoint := details.Endpoints.For(request.TransactionType)
+	if endpoint == "" {
+		return "", fmt.Errorf("no %s endpoint configured", request.TransactionType)
+	}
+
+	if strings.Contains(endpoint, ReferencePlaceholder) {
+		if request.OriginalReference == "" {
+			return "", fmt.Errorf("%s has no original gateway reference", request.TransactionType)
+		}
+		endpoint = strings.ReplaceAll(endpoint, ReferencePlaceholder, url.PathEscape(request.OriginalReference))
+	}
+
+	return details.BaseURL + endpoint, nil
+}
+
+// lookupRequest creates the GET request of a "status" lookup, which the endpoint names
+// the transaction of
+func lookupRequest(ctx context.Context, endpoint string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// currencyExponents lists the currencies whose minor unit is not a hundredth
+var currencyExponents = map[string]int{
+	"BHD": 3, "CLP": 0, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "OMR": 3, "TND": 3, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+}
+
+func currencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// toMinorUnits converts an amount to the currency's smallest unit, e.g. cents
+func toMinorUnits(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(currencyExponent(currency))))
+}
+
+// formatAmount renders an amount as a decimal string with the currency's precision
+func formatAmount(amount float64, currency string) string {
+	return fmt.Sprintf("%.*f", currencyExponent(currency), amount)
+}
+
+// GenericAdapter posts the pre-encoded payload as is, it is used for gateways
+// without a dedicated adapter
+type GenericAdapter struct{}
+
+func (GenericAdapter) BuildRequest(ctx context.Context, request *Request, details config.GatewayDetails) (*http.Request, error) {
+	endpoint, err := endpointFor(request, details)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(request.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for key, value := range request.Headers {
+		req.Header.Set(key, value)
+	}
+
+	return req, nil
+}
+
+func (GenericAdapter) Authenticate(context.Context, *http.Client, *http.Request, config.GatewayDetails) error {
+	return nil
+}
+
+// ParseResponse understands JSON bodies carrying an id or reference and a status
+func (GenericAdapter) ParseResponse(statusCode int, body []byte) (*Result, error) {
+	result := &Result{StatusCode: statusCode, Status: StatusProcessing}
+	if statusCode < 200 || statusCode >= 300 {
+		result.Status = StatusFailed
+	}
+
+	var response struct {
+		ID          string `json:"id"`
+		Reference   string `json:"reference"`
+		Status      string `json:"status"`
+		DeclineCode string `json:"decline_code"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return result, nil
+	}
+
+	result.GatewayReference = response.ID
+	if result.GatewayReference == "" {
+		result.GatewayReference = response.Reference
+	}
+	result.DeclineCode = response.DeclineCode
+
+	switch strings.ToUpper(response.Status) {
+	case StatusCompleted:
+		result.Status = StatusCompleted
+	case StatusFailed, "DECLINED":
+		result.Status = StatusFailed
+	}
+
+	return result, nil
+}
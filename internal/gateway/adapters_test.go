@@ -0,0 +1,701 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripeAdapterContract(t *testing.T) {
+	tests := []struct {
+		name           string
+		request        gateway.Request
+		status         int
+		response       string
+		expectedAmount string
+		expectedResult gateway.Result
+		expectError    bool
+	}{
+		{
+			name:           "Charge Succeeded",
+			request:        gateway.Request{Gateway: "stripe", TransactionType: "deposit", TransactionID: 42, Amount: 100.5, Currency: "EUR"},
+			status:         http.StatusOK,
+			response:       `{"id": "ch_3MmlLrLkdIwHu7ix0snN0B15", "object": "charge", "status": "succeeded"}`,
+			expectedAmount: "10050",
+			expectedResult: gateway.Result{GatewayReference: "ch_3MmlLrLkdIwHu7ix0snN0B15", Status: gateway.StatusCompleted, StatusCode: http.StatusOK},
+		},
+		{
+			name:           "Zero Decimal Currency",
+			request:        gateway.Request{Gateway: "stripe", TransactionType: "withdrawal", TransactionID: 43, Amount: 5000, Currency: "JPY"},
+			status:         http.StatusOK,
+			response:       `{"id": "po_1OaFDbEcg9tTZuTgNYmX0PKB", "object": "payout", "status": "pending"}`,
+			expectedAmount: "5000",
+			expectedResult: gateway.Result{GatewayReference: "po_1OaFDbEcg9tTZuTgNYmX0PKB", Status: gateway.StatusProcessing, StatusCode: http.StatusOK},
+		},
+		{
+			name:           "Card Declined",
+			request:        gateway.Request{Gateway: "stripe", TransactionType: "deposit", TransactionID: 44, Amount: 10, Currency: "USD"},
+			status:         http.StatusPaymentRequired,
+			response:       `{"error": {"type": "card_error", "code": "card_declined", "decline_code": "insufficient_funds", "message": "Your card has insufficient funds."}}`,
+			expectedAmount: "1000",
+			expectedResult: gateway.Result{Status: gateway.StatusFailed, DeclineCode: "insufficient_funds", StatusCode: http.StatusPaymentRequired},
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "Bearer sk_test_123", r.Header.Get("Authorization"))
+				require.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+				require.NotEmpty(t, r.Header.Get("Idempotency-Key"))
+				require.NotEmpty(t, r.Header.Get("X-Callback-URL"))
+
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				form, err := url.ParseQuery(string(body))
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedAmount, form.Get("amount"))
+				require.Equal(t, strings.ToLower(tt.request.Currency), form.Get("currency"))
+
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.response)
+			}))
+			defer server.Close()
+
+			details := testGatewayDetails(server.URL)
+			details.Credentials = map[string]string{"api_key": "sk_test_123"}
+
+			result, err := newTestClient(t).SendTransaction(context.Background(), &tt.request, details)
+			if tt.expectError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.expectedResult, withoutAttempt(result))
+		})
+	}
+}
+
+func TestPayPalAdapterContract(t *testing.T) {
+	tokenRequests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/oauth2/token":
+			tokenRequests++
+			clientID, secret, ok := r.BasicAuth()
+			require.True(t, ok)
+			require.Equal(t, "client", clientID)
+			require.Equal(t, "secret", secret)
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+			io.WriteString(w, `{"access_token": "A21AAF", "token_type": "Bearer", "expires_in": 32400}`)
+
+		case "/deposit":
+			require.Equal(t, "Bearer A21AAF", r.Header.Get("Authorization"))
+			require.Equal(t, "deposit-7", r.Header.Get("PayPal-Request-Id"))
+
+			var order struct {
+				Intent        string `json:"intent"`
+				PurchaseUnits []struct {
+					ReferenceID string `json:"reference_id"`
+					Amount      struct {
+						CurrencyCode string `json:"currency_code"`
+						Value        string `json:"value"`
+					} `json:"amount"`
+				} `json:"purchase_units"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&order))
+			require.Equal(t, "CAPTURE", order.Intent)
+			require.Len(t, order.PurchaseUnits, 1)
+			require.Equal(t, "7", order.PurchaseUnits[0].ReferenceID)
+			require.Equal(t, "EUR", order.PurchaseUnits[0].Amount.CurrencyCode)
+			require.Equal(t, "25.00", order.PurchaseUnits[0].Amount.Value)
+
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id": "5O190127TN364715T", "status": "CREATED"}`)
+
+		case "/withdrawal":
+			require.Equal(t, "Bearer A21AAF", r.Header.Get("Authorization"))
+
+			var payout struct {
+				SenderBatchHeader struct {
+					SenderBatchID string `json:"sender_batch_id"`
+				} `json:"sender_batch_header"`
+				Items []struct {
+					Amount struct {
+						Currency string `json:"currency"`
+						Value    string `json:"value"`
+					} `json:"amount"`
+				} `json:"items"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payout))
+			require.Equal(t, "withdrawal-8", payout.SenderBatchHeader.SenderBatchID)
+			require.Equal(t, "10.00", payout.Items[0].Amount.Value)
+
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"batch_header": {"payout_batch_id": "5UXD2E8A7EBQJ", "batch_status": "PENDING"}}`)
+
+		default:
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	details := testGatewayDetails(server.URL)
+	details.Auth = config.GatewayAuth{
+		Type:          config.AuthOAuth2ClientCredentials,
+		TokenURL:      server.URL + "/v1/oauth2/token",
+		ClientID:      "client",
+		ClientSecret:  "secret",
+		RefreshBefore: 60,
+	}
+	client := newTestClient(t)
+
+	result, err := client.SendTransaction(context.Background(), &gateway.Request{
+		Gateway: "paypal", TransactionType: "deposit", TransactionID: 7, Amount: 25, Currency: "EUR",
+	}, details)
+	require.NoError(t, err)
+	require.Equal(t, "5O190127TN364715T", result.GatewayReference)
+	require.Equal(t, gateway.StatusProcessing, result.Status)
+
+	result, err = client.SendTransaction(context.Background(), &gateway.Request{
+		Gateway: "paypal", TransactionType: "withdrawal", TransactionID: 8, Amount: 10, Currency: "USD",
+	}, details)
+	require.NoError(t, err)
+	require.Equal(t, "5UXD2E8A7EBQJ", result.GatewayReference)
+	require.Equal(t, gateway.StatusProcessing, result.Status)
+
+	// The token is reused until it nears its expiry
+	require.Equal(t, 1, tokenRequests)
+}
+
+func TestPayPalParseResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		statusCode     int
+		response       string
+		expectedResult gateway.Result
+	}{
+		{
+			name:           "Order Awaiting Approval",
+			statusCode:     http.StatusCreated,
+			response:       `{"id": "5O190127TN364715T", "status": "PAYER_ACTION_REQUIRED", "links": [{"href": "https://www.paypal.com/checkoutnow?token=5O190127TN364715T", "rel": "payer-action", "method": "GET"}]}`,
+			expectedResult: gateway.Result{GatewayReference: "5O190127TN364715T", Status: gateway.StatusProcessing, StatusCode: http.StatusCreated},
+		},
+		{
+			name:       "Order Captured",
+			statusCode: http.StatusCreated,
+			response: `{"id": "5O190127TN364715T", "status": "COMPLETED", "purchase_units": [{"reference_id": "7", "payments": {"captures": [
+				{"id": "3C679366HH908993F", "status": "COMPLETED", "amount": {"currency_code": "EUR", "value": "25.00"}}]}}]}`,
+			expectedResult: gateway.Result{GatewayReference: "3C679366HH908993F", Status: gateway.StatusCompleted, StatusCode: http.StatusCreated},
+		},
+		{
+			name:       "Capture Pending",
+			statusCode: http.StatusCreated,
+			response: `{"id": "5O190127TN364715T", "status": "COMPLETED", "purchase_units": [{"reference_id": "7", "payments": {"captures": [
+				{"id": "3C679366HH908993F", "status": "PENDING", "status_details": {"reason": "PENDING_REVIEW"}}]}}]}`,
+			expectedResult: gateway.Result{GatewayReference: "3C679366HH908993F", Status: gateway.StatusProcessing, StatusCode: http.StatusCreated},
+		},
+		{
+			name:       "Capture Declined",
+			statusCode: http.StatusCreated,
+			response: `{"id": "5O190127TN364715T", "status": "COMPLETED", "purchase_units": [{"reference_id": "7", "payments": {"captures": [
+				{"id": "3C679366HH908993F", "status": "DECLINED"}]}}]}`,
+			expectedResult: gateway.Result{GatewayReference: "3C679366HH908993F", Status: gateway.StatusFailed, StatusCode: http.StatusCreated},
+		},
+		{
+			name:       "Order Authorized",
+			statusCode: http.StatusCreated,
+			response: `{"id": "5O190127TN364715T", "status": "COMPLETED", "purchase_units": [{"reference_id": "7", "payments": {"authorizations": [
+				{"id": "0VF52814937998046", "status": "CREATED", "expiration_time": "2026-11-16T15:32:51Z"}]}}]}`,
+			expectedResult: gateway.Result{GatewayReference: "0VF52814937998046", Status: gateway.StatusCompleted, StatusCode: http.StatusCreated},
+		},
+		{
+			name:           "Unprocessable",
+			statusCode:     http.StatusUnprocessableEntity,
+			response:       `{"name": "UNPROCESSABLE_ENTITY", "details": [{"issue": "INSTRUMENT_DECLINED"}]}`,
+			expectedResult: gateway.Result{Status: gateway.StatusFailed, DeclineCode: "INSTRUMENT_DECLINED", StatusCode: http.StatusUnprocessableEntity},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := gateway.PayPalAdapter{}.ParseResponse(tt.statusCode, []byte(tt.response))
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedResult, *result)
+		})
+	}
+}
+
+func TestAdyenAdapterContract(t *testing.T) {
+	tests := []struct {
+		name           string
+		response       string
+		expectedResult gateway.Result
+	}{
+		{
+			name:           "Authorised",
+			response:       `{"pspReference": "NC6HT9CRT65ZGN82", "resultCode": "Authorised"}`,
+			expectedResult: gateway.Result{GatewayReference: "NC6HT9CRT65ZGN82", Status: gateway.StatusCompleted, StatusCode: http.StatusOK},
+		},
+		{
+			name:           "Refused",
+			response:       `{"pspReference": "V4HZ4RBFJGXXGN82", "resultCode": "Refused", "refusalReason": "Not enough balance", "refusalReasonCode": "12"}`,
+			expectedResult: gateway.Result{GatewayReference: "V4HZ4RBFJGXXGN82", Status: gateway.StatusFailed, DeclineCode: "12", StatusCode: http.StatusOK},
+		},
+		{
+			name:           "Received",
+			response:       `{"pspReference": "JN6HT9CRT65ZGN82", "resultCode": "Received"}`,
+			expectedResult: gateway.Result{GatewayReference: "JN6HT9CRT65ZGN82", Status: gateway.StatusProcessing, StatusCode: http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "AQE1hmfx", r.Header.Get("X-API-Key"))
+				require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+				var payment struct {
+					MerchantAccount string `json:"merchantAccount"`
+					Amount          struct {
+						Value    int64  `json:"value"`
+						Currency string `json:"currency"`
+					} `json:"amount"`
+					Reference string `json:"reference"`
+				}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&payment))
+				require.Equal(t, "AcmeECOM", payment.MerchantAccount)
+				require.Equal(t, int64(1999), payment.Amount.Value)
+				require.Equal(t, "EUR", payment.Amount.Currency)
+				require.Equal(t, "9", payment.Reference)
+
+				io.WriteString(w, tt.response)
+			}))
+			defer server.Close()
+
+			details := testGatewayDetails(server.URL)
+			details.Credentials = map[string]string{"api_key": "AQE1hmfx", "merchant_account": "AcmeECOM"}
+
+			result, err := newTestClient(t).SendTransaction(context.Background(), &gateway.Request{
+				Gateway: "adyen", TransactionType: "deposit", TransactionID: 9, Amount: 19.99, Currency: "EUR",
+			}, details)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedResult, withoutAttempt(result))
+		})
+	}
+}
+
+func TestGenericAdapterContract(t *testing.T) {
+	payload := []byte(`<XMLPayload><transaction_id>11</transaction_id></XMLPayload>`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/withdrawal", r.URL.Path)
+		require.Equal(t, "text/xml", r.Header.Get("Content-Type"))
+		require.Equal(t, "process", r.Header.Get("SOAPAction"))
+		require.Equal(t, "11", r.Header.Get("X-Transaction-ID"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, payload, body)
+
+		io.WriteString(w, `<ok/>`)
+	}))
+	defer server.Close()
+
+	details := testGatewayDetails(server.URL)
+	details.Headers = map[string]string{"Content-Type": "text/xml", "SOAPAction": "process"}
+
+	result, err := newTestClient(t).SendTransaction(context.Background(), &gateway.Request{
+		Gateway: "soap_gateway", TransactionType: "withdrawal", TransactionID: 11, Payload: payload,
+	}, details)
+	require.NoError(t, err)
+	require.Equal(t, gateway.StatusProcessing, result.Status)
+	require.Empty(t, result.GatewayReference)
+}
+
+func TestRefundRequests(t *testing.T) {
+	tests := []struct {
+		name         string
+		gateway      string
+		refund       string
+		reference    string
+		expectedPath string
+		checkBody    func(t *testing.T, body string)
+	}{
+		{
+			name:         "Stripe",
+			gateway:      "stripe",
+			refund:       "/v1/refunds",
+			reference:    "ch_123",
+			expectedPath: "/v1/refunds",
+			checkBody: func(t *testing.T, body string) {
+				form, err := url.ParseQuery(body)
+				require.NoError(t, err)
+				require.Equal(t, "ch_123", form.Get("charge"))
+				require.Equal(t, "2550", form.Get("amount"))
+				require.Empty(t, form.Get("currency"))
+			},
+		},
+		{
+			name:         "PayPal",
+			gateway:      "paypal",
+			refund:       "/v2/payments/captures/{reference}/refund",
+			reference:    "3C679366HH908993F",
+			expectedPath: "/v2/payments/captures/3C679366HH908993F/refund",
+			checkBody: func(t *testing.T, body string) {
+				require.JSONEq(t, `{"amount": {"currency_code": "EUR", "value": "25.50"}, "invoice_id": "refund-50"}`, body)
+			},
+		},
+		{
+			name:         "Adyen",
+			gateway:      "adyen",
+			refund:       "/v68/payments/{reference}/refunds",
+			reference:    "NC6HT9CRT65ZGN82",
+			expectedPath: "/v68/payments/NC6HT9CRT65ZGN82/refunds",
+			checkBody: func(t *testing.T, body string) {
+				require.JSONEq(t, `{"merchantAccount": "TestMerchant", "amount": {"value": 2550, "currency": "EUR"}, "reference": "50"}`, body)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/token" {
+					io.WriteString(w, `{"access_token": "token", "expires_in": 3600}`)
+					return
+				}
+
+				require.Equal(t, tt.expectedPath, r.URL.Path)
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				tt.checkBody(t, string(body))
+
+				io.WriteString(w, `{"id": "re_1", "status": "pending"}`)
+			}))
+			defer server.Close()
+
+			details := testGatewayDetails(server.URL)
+			details.Endpoints.Refund = tt.refund
+			details.Credentials = map[string]string{"api_key": "key_123", "merchant_account": "TestMerchant"}
+			if tt.gateway == "paypal" {
+				details.Auth = config.GatewayAuth{Type: config.AuthOAuth2ClientCredentials, TokenURL: server.URL + "/token", RefreshBefore: 60}
+			}
+
+			_, err := newTestClient(t).SendTransaction(context.Background(), &gateway.Request{
+				Gateway: tt.gateway, TransactionType: "refund", TransactionID: 50, Amount: 25.5, Currency: "EUR",
+				OriginalReference: tt.reference,
+			}, details)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSendTransactionRecordsAttempt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id": "ch_1", "status": "succeeded", "payment_method_details": {"card": {"number": "4242424242424242"}}}`)
+	}))
+	defer server.Close()
+
+	details := testGatewayDetails(server.URL)
+	details.Credentials = map[string]string{"api_key": "sk_test_123"}
+
+	result, err := newTestClient(t).SendTransaction(context.Background(), &gateway.Request{
+		Gateway: "stripe", TransactionType: "deposit", TransactionID: 12, Amount: 5, Currency: "EUR",
+	}, details)
+	require.NoError(t, err)
+	require.Equal(t, "ch_1", result.GatewayReference)
+	require.Contains(t, string(result.RequestBody), "amount=500")
+	require.Contains(t, string(result.ResponseBody), `"number":"[REDACTED]"`)
+	require.NotContains(t, string(result.ResponseBody), "4242424242424242")
+	require.Positive(t, result.Latency)
+}
+
+func TestSendTransactionReturnsAttemptOnTransportError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	details := testGatewayDetails(server.URL)
+	details.Credentials = map[string]string{"api_key": "sk_test_123"}
+
+	result, err := newTestClient(t).SendTransaction(context.Background(), &gateway.Request{
+		Gateway: "stripe", TransactionType: "deposit", TransactionID: 13, Amount: 5, Currency: "EUR",
+	}, details)
+	require.Error(t, err)
+	require.NotNil(t, result)
+	require.NotEmpty(t, result.RequestBody)
+	require.Empty(t, result.ResponseBody)
+}
+
+func TestSendTransactionSendsCallbackURL(t *testing.T) {
+	t.Setenv("TEST_CALLBACK_TOKEN_KEY", "callback-key")
+
+	var callbackURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callbackURL = r.Header.Get("X-Callback-URL")
+		io.WriteString(w, `{"id": "ch_1", "status": "pending"}`)
+	}))
+	defer server.Close()
+
+	client, err := gateway.NewHTTPClient(&config.GatewayConfig{Server: config.ServerConfig{
+		PublicBaseURL:    "https://payments.example.com",
+		CallbackTokenKey: "env:TEST_CALLBACK_TOKEN_KEY",
+		CallbackTokenTTL: 60,
+	}})
+	require.NoError(t, err)
+
+	details := testGatewayDetails(server.URL)
+	details.Credentials = map[string]string{"api_key": "sk_test_123"}
+	details.CallbackURL = "/api/callbacks/stripe?transaction_id={transaction_id}&token={token}"
+
+	_, err = client.SendTransaction(context.Background(), &gateway.Request{
+		Gateway: "stripe", TransactionType: "deposit", TransactionID: 14, Amount: 5, Currency: "EUR",
+	}, details)
+	require.NoError(t, err)
+
+	sent, err := url.Parse(callbackURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://payments.example.com/api/callbacks/stripe", sent.Scheme+"://"+sent.Host+sent.Path)
+	require.Equal(t, "14", sent.Query().Get("transaction_id"))
+
+	tokens := client.CallbackTokens()
+	require.True(t, tokens.Verify(14, sent.Query().Get("token")))
+	require.False(t, tokens.Verify(15, sent.Query().Get("token")))
+	require.False(t, gateway.NewCallbackTokens([]byte("other-key"), time.Minute).Verify(14, sent.Query().Get("token")))
+}
+
+func TestCallbackTokensExpire(t *testing.T) {
+	tokens := gateway.NewCallbackTokens([]byte("callback-key"), time.Minute)
+	token, err := tokens.Token(14)
+	require.NoError(t, err)
+	require.True(t, tokens.Verify(14, token))
+
+	// The expiry is signed along with the transaction ID
+	_, signature, _ := strings.Cut(token, ".")
+	extended := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + "." + signature
+	require.False(t, tokens.Verify(14, extended))
+
+	expired, err := gateway.NewCallbackTokens([]byte("callback-key"), -time.Second).Token(14)
+	require.NoError(t, err)
+	require.False(t, tokens.Verify(14, expired))
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "JSON",
+			body:     `{"amount": 10, "card": {"number": "4111111111111111", "cvc": "123"}}`,
+			expected: `{"amount":10,"card":{"cvc":"[REDACTED]","number":"[REDACTED]"}}`,
+		},
+		{
+			name:     "Form",
+			body:     `amount=1000&card[number]=4111111111111111&currency=eur`,
+			expected: `amount=1000&card%5Bnumber%5D=%5BREDACTED%5D&currency=eur`,
+		},
+		{
+			name:     "XML",
+			body:     `<payment><amount>10</amount><api_key>secret</api_key></payment>`,
+			expected: `<payment><amount>10</amount><api_key>[REDACTED]</api_key></payment>`,
+		},
+		{
+			name:     "Card Number In Free Text",
+			body:     `card 4111111111111111 declined`,
+			expected: `card ************1111 declined`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, string(gateway.Redact([]byte(tt.body))))
+		})
+	}
+}
+
+// withoutAttempt drops the recorded request, response and latency so results can be compared
+func withoutAttempt(result *gateway.Result) gateway.Result {
+	stripped := *result
+	stripped.RequestBody, stripped.ResponseBody, stripped.RawResponse, stripped.Latency = nil, nil, nil, 0
+	return stripped
+}
+
+func testGatewayDetails(baseURL string) config.GatewayDetails {
+	return config.GatewayDetails{
+		BaseURL: baseURL,
+		Endpoints: config.GatewayEndpoints{
+			Deposit:    "/deposit",
+			Withdrawal: "/withdrawal",
+		},
+		CallbackURL: "/api/callbacks/test",
+		Timeout:     5,
+	}
+}
+
+func newTestClient(t *testing.T, opts ...gateway.HTTPClientOption) *gateway.HTTPClient {
+	client, err := gateway.NewHTTPClient(&config.GatewayConfig{
+		Server: config.ServerConfig{PublicBaseURL: "https://payments.example.com"},
+	}, opts...)
+	require.NoError(t, err)
+	return client
+}
+
+func TestCancelRequests(t *testing.T) {
+	tests := []struct {
+		name         string
+		gateway      string
+		cancel       string
+		expectedPath string
+		checkBody    func(t *testing.T, body string)
+	}{
+		{
+			name:         "Stripe",
+			gateway:      "stripe",
+			cancel:       "/v1/payouts/{reference}/cancel",
+			expectedPath: "/v1/payouts/po_123/cancel",
+			checkBody: func(t *testing.T, body string) {
+				require.Empty(t, body)
+			},
+		},
+		{
+			name:         "Adyen",
+			gateway:      "adyen",
+			cancel:       "/v68/cancels",
+			expectedPath: "/v68/cancels",
+			checkBody: func(t *testing.T, body string) {
+				require.JSONEq(t, `{"merchantAccount": "TestMerchant", "paymentReference": "50", "reference": "cancel-50"}`, body)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, tt.expectedPath, r.URL.Path)
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				tt.checkBody(t, string(body))
+
+				io.WriteString(w, `{"id": "po_123", "status": "canceled"}`)
+			}))
+			defer server.Close()
+
+			details := testGatewayDetails(server.URL)
+			details.Endpoints.Cancel = tt.cancel
+			details.Credentials = map[string]string{"api_key": "key_123", "merchant_account": "TestMerchant"}
+
+			_, err := newTestClient(t).SendTransaction(context.Background(), &gateway.Request{
+				Gateway: tt.gateway, TransactionType: "cancel", TransactionID: 50, Amount: 25.5, Currency: "EUR",
+				OriginalReference: "po_123",
+			}, details)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthorizationRequests(t *testing.T) {
+	tests := []struct {
+		name            string
+		gateway         string
+		transactionType string
+		endpoints       config.GatewayEndpoints
+		expectedPath    string
+		checkBody       func(t *testing.T, body string)
+	}{
+		{
+			name:            "Stripe Authorization",
+			gateway:         "stripe",
+			transactionType: "authorization",
+			endpoints:       config.GatewayEndpoints{Authorize: "/v1/charges"},
+			expectedPath:    "/v1/charges",
+			checkBody: func(t *testing.T, body string) {
+				form, err := url.ParseQuery(body)
+				require.NoError(t, err)
+				require.Equal(t, "false", form.Get("capture"))
+				require.Equal(t, "2550", form.Get("amount"))
+			},
+		},
+		{
+			name:            "Stripe Capture",
+			gateway:         "stripe",
+			transactionType: "capture",
+			endpoints:       config.GatewayEndpoints{Capture: "/v1/charges/{reference}/capture"},
+			expectedPath:    "/v1/charges/ch_123/capture",
+			checkBody: func(t *testing.T, body string) {
+				require.Equal(t, "amount=2550", body)
+			},
+		},
+		{
+			name:            "Adyen Void",
+			gateway:         "adyen",
+			transactionType: "void",
+			endpoints:       config.GatewayEndpoints{Void: "/v68/payments/{reference}/cancels"},
+			expectedPath:    "/v68/payments/ch_123/cancels",
+			checkBody: func(t *testing.T, body string) {
+				require.JSONEq(t, `{"merchantAccount": "TestMerchant", "reference": "void-50"}`, body)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, tt.expectedPath, r.URL.Path)
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				tt.checkBody(t, string(body))
+
+				io.WriteString(w, `{"id": "ch_123", "status": "succeeded"}`)
+			}))
+			defer server.Close()
+
+			details := testGatewayDetails(server.URL)
+			details.Endpoints = tt.endpoints
+			details.Credentials = map[string]string{"api_key": "key_123", "merchant_account": "TestMerchant"}
+
+			_, err := newTestClient(t).SendTransaction(context.Background(), &gateway.Request{
+				Gateway: tt.gateway, TransactionType: tt.transactionType, TransactionID: 50, Amount: 25.5, Currency: "EUR",
+				OriginalReference: "ch_123",
+			}, details)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestStatusRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodGet, r.Method)
+		require.Equal(t, "/v1/charges/ch_123", r.URL.Path)
+		require.Equal(t, "Bearer key_123", r.Header.Get("Authorization"))
+
+		io.WriteString(w, `{"id": "ch_123", "status": "succeeded"}`)
+	}))
+	defer server.Close()
+
+	details := testGatewayDetails(server.URL)
+	details.Endpoints.Status = "/v1/charges/{reference}"
+	details.Credentials = map[string]string{"api_key": "key_123"}
+
+	result, err := newTestClient(t).SendTransaction(context.Background(), &gateway.Request{
+		Gateway: "stripe", TransactionType: "status", TransactionID: 50, Amount: 25.5, Currency: "EUR",
+		OriginalReference: "ch_123",
+	}, details)
+	require.NoError(t, err)
+	require.Equal(t, gateway.StatusCompleted, result.Status)
+}
@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"payment-gateway/internal/config"
+	"strconv"
+	"strings"
+)
+
+// AdyenAdapter sends the amount as an object in minor units on behalf of the configured merchant account.
+// Cancellations are standalone, naming the payment by the reference it was sent with, while voids
+// name the authorization in their URL. Authorizations rely on the merchant account capturing manually.
+type AdyenAdapter struct{}
+
+type adyenAmount struct {
+	Value    int64  `json:"value"`
+	Currency string `json:"currency"`
+}
+
+type adyenRequest struct {
+	MerchantAccount  string       `json:"merchantAccount"`
+	Amount           *adyenAmount `json:"amount,omitempty"`
+	Reference        string       `json:"reference"`
+	PaymentReference string       `json:"paymentReference,omitempty"`
+}
+
+func (AdyenAdapter) BuildRequest(ctx context.Context, request *Request, details config.GatewayDetails) (*http.Request, error) {
+	endpoint, err := endpointFor(request, details)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.TransactionType == "status" {
+		return lookupRequest(ctx, endpoint)
+	}
+
+	merchantAccount := details.Credentials["merchant_account"]
+	if merchantAccount == "" {
+		return nil, fmt.Errorf("adyen merchant_account credential is not configured")
+	}
+
+	reference := strconv.Itoa(request.TransactionID)
+	body := adyenRequest{
+		MerchantAccount: merchantAccount,
+		Reference:       reference,
+	}
+	switch request.TransactionType {
+	case "cancel":
+		body.Reference = "cancel-" + reference
+		body.PaymentReference = reference
+	case "void":
+		body.Reference = "void-" + reference
+	default:
+		body.Amount = &adyenAmount{
+			Value:    toMinorUnits(request.Amount, request.Currency),
+			Currency: strings.ToUpper(request.Currency),
+		}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal adyen request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", fmt.Sprintf("%s-%d", request.TransactionType, request.TransactionID))
+
+	return req, nil
+}
+
+// Authenticate sends the API key in the X-API-Key header
+func (AdyenAdapter) Authenticate(_ context.Context, _ *http.Client, req *http.Request, details config.GatewayDetails) error {
+	apiKey := details.Credentials["api_key"]
+	if apiKey == "" {
+		return fmt.Errorf("adyen api_key credential is not configured")
+	}
+
+	req.Header.Set("X-API-Key", apiKey)
+	return nil
+}
+
+func (AdyenAdapter) ParseResponse(statusCode int, body []byte) (*Result, error) {
+	var response struct {
+		PSPReference      string `json:"pspReference"`
+		ResultCode        string `json:"resultCode"`
+		RefusalReasonCode string `json:"refusalReasonCode"`
+		ErrorCode         string `json:"errorCode"`
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse adyen response: %w", err)
+	}
+
+	result := &Result{
+		GatewayReference: response.PSPReference,
+		StatusCode:       statusCode,
+		Status:           StatusProcessing,
+	}
+
+	if statusCode < 200 || statusCode >= 300 {
+		result.Status = StatusFailed
+		result.DeclineCode = response.ErrorCode
+		return result, nil
+	}
+
+	switch response.ResultCode {
+	case "Authorised":
+		result.Status = StatusCompleted
+	case "Refused", "Error", "Cancelled":
+		result.Status = StatusFailed
+		result.DeclineCode = response.RefusalReasonCode
+	}
+
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"payment-gateway/internal/config"
+)
+
+// applyAuth authenticates a request with the gateway's auth block
+func (c *HTTPClient) applyAuth(ctx context.Context, client *http.Client, req *http.Request, auth config.GatewayAuth) error {
+	switch auth.Type {
+	case config.AuthStatic, config.AuthAPIKeyHeader:
+		req.Header.Set(auth.Header, auth.Value)
+	case config.AuthBasic:
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case config.AuthOAuth2ClientCredentials:
+		token, err := c.tokens.Token(ctx, client, auth)
+		if err != nil {
+			return fmt.Errorf("failed to get access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	default:
+		return fmt.Errorf("unknown auth type %s", auth.Type)
+	}
+
+	return nil
+}
+
+// authenticate uses the configured auth block, or the adapter's own scheme when there is none
+func (c *HTTPClient) authenticate(ctx context.Context, adapter GatewayAdapter, client *http.Client, req *http.Request, details config.GatewayDetails) error {
+	if details.Auth.IsSet() {
+		return c.applyAuth(ctx, client, req, details.Auth)
+	}
+	return adapter.Authenticate(ctx, client, req, details)
+}
+
+// retryUnauthorized renews a rejected OAuth2 token and prepares the request to be sent again,
+// signed with a fresh nonce. It returns nil when the request should not be retried.
+func (c *HTTPClient) retryUnauthorized(
+	ctx context.Context,
+	client *http.Client,
+	req *http.Request,
+	signer *requestSigner,
+	body []byte,
+	details config.GatewayDetails,
+) (*http.Request, error) {
+	if details.Auth.Type != config.AuthOAuth2ClientCredentials || req.GetBody == nil {
+		return nil, nil
+	}
+
+	c.tokens.Invalidate(details.Auth)
+
+	rewound, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind request body: %w", err)
+	}
+
+	retry := req.Clone(req.Context())
+	retry.Body = rewound
+
+	if signer != nil {
+		if err := signer.sign(retry, body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.applyAuth(ctx, client, retry, details.Auth); err != nil {
+		return nil, err
+	}
+
+	return retry, nil
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CallbackTokens signs the transaction IDs put in callback URLs, so a callback can
+// only be made for the transaction its URL was issued for. A token carries its expiry,
+// a leaked callback URL can't be replayed for longer than the TTL.
+type CallbackTokens struct {
+	signer HMACSigner
+	ttl    time.Duration
+}
+
+func NewCallbackTokens(key []byte, ttl time.Duration) *CallbackTokens {
+	return &CallbackTokens{
+		signer: HMACSigner{Secret: key},
+		ttl:    ttl,
+	}
+}
+
+// Token returns the URL safe token of a transaction, valid for the TTL
+func (t *CallbackTokens) Token(transactionID int) (string, error) {
+	return t.token(transactionID, time.Now().Add(t.ttl).Unix())
+}
+
+// token is the expiry, in Unix seconds, followed by the signature of the transaction ID and expiry
+func (t *CallbackTokens) token(transactionID int, expiresAt int64) (string, error) {
+	expiry := strconv.FormatInt(expiresAt, 10)
+	signature, err := t.signer.Sign([]byte(strconv.Itoa(transactionID) + "." + expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign callback token: %w", err)
+	}
+	return expiry + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify reports whether a token was issued for the transaction and hasn't expired
+func (t *CallbackTokens) Verify(transactionID int, token string) bool {
+	expiry, _, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() >= expiresAt {
+		return false
+	}
+
+	expected, err := t.token(transactionID, expiresAt)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(token))
+}
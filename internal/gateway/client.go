@@ -7,72 +7,243 @@ import (
 	"io"
 	"net/http"
 	"payment-gateway/internal/config"
+	"payment-gateway/internal/secrets"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
+// HTTPClient sends transactions to the gateways, keeping a pooled transport per gateway
 type HTTPClient struct {
+	adapters       map[string]GatewayAdapter
+	tokens         *TokenCache
+	secrets        *secrets.Resolver
+	server         config.ServerConfig
+	callbackTokens *CallbackTokens
+
+	mu      sync.RWMutex
+	pools   map[string]*gatewayPool
+	signers map[string]*requestSigner
+
+	certCheckInterval time.Duration
+}
+
+// HTTPClientOption customises an HTTPClient
+type HTTPClientOption func(*HTTPClient)
+
+// WithSecretResolver sets where signing keys are loaded from, env and file references by default
+func WithSecretResolver(resolver *secrets.Resolver) HTTPClientOption {
+	return func(c *HTTPClient) {
+		c.secrets = resolver
+	}
 }
 
-func NewHTTPClient() *HTTPClient {
-	return &HTTPClient{}
+// WithCertificateCheckInterval sets how often the certificate files of a gateway are
+// checked for rotation, every 30 seconds by default
+func WithCertificateCheckInterval(interval time.Duration) HTTPClientOption {
+	return func(c *HTTPClient) {
+		c.certCheckInterval = interval
+	}
+}
+
+// NewHTTPClient sets up the transports and signers of the configured gateways,
+// failing when their TLS settings, signing keys or the callback token key can't be loaded
+func NewHTTPClient(gatewayConfig *config.GatewayConfig, opts ...HTTPClientOption) (*HTTPClient, error) {
+	client := &HTTPClient{
+		adapters: map[string]GatewayAdapter{
+			"paypal": PayPalAdapter{},
+			"stripe": StripeAdapter{},
+			"adyen":  AdyenAdapter{},
+		},
+		tokens:  NewTokenCache(),
+		secrets: secrets.NewResolver(),
+		server:  gatewayConfig.Server,
+		pools:   make(map[string]*gatewayPool),
+		signers: make(map[string]*requestSigner),
+
+		certCheckInterval: defaultCertificateCheckInterval,
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	if gatewayConfig.Server.CallbackTokenKey != "" {
+		key, err := client.secrets.Resolve(gatewayConfig.Server.CallbackTokenKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load callback token key: %w", err)
+		}
+		client.callbackTokens = NewCallbackTokens(key, time.Duration(gatewayConfig.Server.CallbackTokenTTL)*time.Second)
+	}
+
+	for gatewayName, details := range gatewayConfig.Gateways {
+		if _, _, err := client.poolFor(gatewayName, details); err != nil {
+			return nil, err
+		}
+		if _, err := client.signerFor(gatewayName, details); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// CallbackTokens returns the signer of callback URL tokens, nil when they are not enabled
+func (c *HTTPClient) CallbackTokens() *CallbackTokens {
+	return c.callbackTokens
+}
+
+// RegisterAdapter sets the adapter used for a gateway
+func (c *HTTPClient) RegisterAdapter(gatewayName string, adapter GatewayAdapter) {
+	if c.adapters == nil {
+		c.adapters = make(map[string]GatewayAdapter)
+	}
+	c.adapters[gatewayName] = adapter
+}
+
+// adapterFor returns the adapter registered for a gateway, falling back to the generic one
+func (c *HTTPClient) adapterFor(gatewayName string) GatewayAdapter {
+	if adapter, ok := c.adapters[gatewayName]; ok {
+		return adapter
+	}
+	return GenericAdapter{}
 }
 
 func (c *HTTPClient) SendTransaction(
 	ctx context.Context,
-	transactionType string,
-	payload []byte,
-	transactionID int,
+	request *Request,
 	gatewayDetails config.GatewayDetails,
-) error {
-	var endpoint string
-	if transactionType == "deposit" {
-		endpoint = gatewayDetails.Endpoints.Deposit
-	} else {
-		endpoint = gatewayDetails.Endpoints.Withdrawal
+) (*Result, error) {
+	adapter := c.adapterFor(request.Gateway)
+
+	pool, transport, err := c.poolFor(request.Gateway, gatewayDetails)
+	if err != nil {
+		return nil, err
 	}
 
-	url := gatewayDetails.BaseURL + endpoint
+	if err := pool.acquire(); err != nil {
+		return nil, err
+	}
+	defer pool.release()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payload))
+	req, err := adapter.BuildRequest(pool.trace(ctx), request, gatewayDetails)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
+	// Configured headers apply unless the adapter set its own value
 	for key, value := range gatewayDetails.Headers {
-		req.Header.Set(key, value)
+		if req.Header.Get(key) == "" {
+			req.Header.Set(key, value)
+		}
 	}
 
-	req.Header.Set("X-Transaction-ID", strconv.Itoa(transactionID))
+	req.Header.Set("X-Transaction-ID", strconv.Itoa(request.TransactionID))
 
-	callbackURL := gatewayDetails.CallbackURL
-	if callbackURL != "" {
-		if !strings.HasPrefix(callbackURL, "http") {
-			baseURL := "https://api-domain.com" // Can read from config
-			callbackURL = baseURL + callbackURL
+	if gatewayDetails.CallbackURL != "" {
+		var token string
+		if c.callbackTokens != nil {
+			token, err = c.callbackTokens.Token(request.TransactionID)
+			if err != nil {
+				return nil, err
+			}
 		}
-		req.Header.Set("X-Callback-URL", callbackURL)
+		req.Header.Set("X-Callback-URL", c.server.CallbackURL(gatewayDetails.CallbackURL, request.TransactionID, token))
 	}
 
 	client := &http.Client{
-		Timeout: time.Duration(gatewayDetails.Timeout) * time.Second,
+		Timeout:   time.Duration(gatewayDetails.Timeout) * time.Second,
+		Transport: transport,
+	}
+
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := c.signerFor(request.Gateway, gatewayDetails)
+	if err != nil {
+		return nil, err
+	}
+	if signer != nil {
+		if err := signer.sign(req, requestBody); err != nil {
+			return nil, err
+		}
+	}
+
+	// The attempt is recorded even when the gateway could not be reached
+	attempt := &Result{RequestBody: Redact(requestBody)}
+
+	if err := c.authenticate(ctx, adapter, client, req, gatewayDetails); err != nil {
+		return attempt, fmt.Errorf("failed to authenticate with gateway: %w", err)
 	}
 
+	startedAt := time.Now()
 	resp, err := client.Do(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// An OAuth2 token may have been revoked before its expiry, renew it once
+		retry, retryErr := c.retryUnauthorized(ctx, client, req, signer, requestBody, gatewayDetails)
+		if retryErr != nil {
+			resp.Body.Close()
+			return attempt, fmt.Errorf("failed to authenticate with gateway: %w", retryErr)
+		}
+		if retry != nil {
+			resp.Body.Close()
+			resp, err = client.Do(retry)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		attempt.Latency = time.Since(startedAt)
+		return attempt, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
+	attempt.Latency = time.Since(startedAt)
+	attempt.StatusCode = resp.StatusCode
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return attempt, fmt.Errorf("failed to read response: %w", err)
+	}
+	attempt.ResponseBody = Redact(body)
+	attempt.RawResponse = body
+
+	result, parseErr := adapter.ParseResponse(resp.StatusCode, body)
+	if result == nil {
+		result = attempt
+	} else {
+		result.RequestBody = attempt.RequestBody
+		result.ResponseBody = attempt.ResponseBody
+		result.RawResponse = attempt.RawResponse
+		result.Latency = attempt.Latency
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("gateway returned non-success status: %d, body: %s", resp.StatusCode, string(body))
+		return result, fmt.Errorf("gateway returned non-success status: %d, body: %s", resp.StatusCode, string(attempt.ResponseBody))
+	}
+
+	if parseErr != nil {
+		return result, parseErr
+	}
+
+	return result, nil
+}
+
+// readRequestBody returns the body of a request while leaving it readable
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body.Close()
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
 	}
 
-	return nil
+	return body, nil
 }
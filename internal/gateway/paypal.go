@@ -0,0 +1,183 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"payment-gateway/internal/config"
+	"strconv"
+	"strings"
+)
+
+// PayPalAdapter creates orders for deposits and authorizations, payouts for withdrawals,
+// and captures, refunds and voids authorized payments
+type PayPalAdapter struct{}
+
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+	Value        string `json:"value"`
+}
+
+func (PayPalAdapter) BuildRequest(ctx context.Context, request *Request, details config.GatewayDetails) (*http.Request, error) {
+	endpoint, err := endpointFor(request, details)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.TransactionType == "status" {
+		return lookupRequest(ctx, endpoint)
+	}
+
+	reference := strconv.Itoa(request.TransactionID)
+	value := formatAmount(request.Amount, request.Currency)
+	currency := strings.ToUpper(request.Currency)
+
+	var body interface{}
+	switch request.TransactionType {
+	case "cancel", "void":
+		// payout items and authorizations are cancelled through their URL alone
+		body = struct{}{}
+	case "refund":
+		body = map[string]interface{}{
+			"amount":     paypalAmount{CurrencyCode: currency, Value: value},
+			"invoice_id": "refund-" + reference,
+		}
+	case "capture":
+		// the rest of a partially captured authorization is released
+		body = map[string]interface{}{
+			"amount":        paypalAmount{CurrencyCode: currency, Value: value},
+			"invoice_id":    "capture-" + reference,
+			"final_capture": true,
+		}
+	case "withdrawal":
+		body = map[string]interface{}{
+			"sender_batch_header": map[string]string{
+				"sender_batch_id": "withdrawal-" + reference,
+			},
+			"items": []map[string]interface{}{
+				{
+					"sender_item_id": reference,
+					"amount":         paypalAmount{Currency: currency, Value: value},
+				},
+			},
+		}
+	default:
+		intent := "CAPTURE"
+		if request.TransactionType == "authorization" {
+			intent = "AUTHORIZE"
+		}
+		body = map[string]interface{}{
+			"intent": intent,
+			"purchase_units": []map[string]interface{}{
+				{
+					"reference_id": reference,
+					"custom_id":    reference,
+					"amount":       paypalAmount{CurrencyCode: currency, Value: value},
+				},
+			},
+		}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal paypal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("PayPal-Request-Id", fmt.Sprintf("%s-%d", request.TransactionType, request.TransactionID))
+
+	return req, nil
+}
+
+// Authenticate fails as PayPal needs an oauth2_client_credentials auth block,
+// whose tokens are cached by the client
+func (PayPalAdapter) Authenticate(context.Context, *http.Client, *http.Request, config.GatewayDetails) error {
+	return fmt.Errorf("paypal requires an oauth2_client_credentials auth block")
+}
+
+func (PayPalAdapter) ParseResponse(statusCode int, body []byte) (*Result, error) {
+	var response struct {
+		ID          string `json:"id"`
+		Status      string `json:"status"`
+		Name        string `json:"name"`
+		BatchHeader *struct {
+			PayoutBatchID string `json:"payout_batch_id"`
+			BatchStatus   string `json:"batch_status"`
+		} `json:"batch_header"`
+		PurchaseUnits []struct {
+			Payments struct {
+				Captures       []paypalPayment `json:"captures"`
+				Authorizations []paypalPayment `json:"authorizations"`
+			} `json:"payments"`
+		} `json:"purchase_units"`
+		Details []struct {
+			Issue string `json:"issue"`
+		} `json:"details"`
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse paypal response: %w", err)
+	}
+
+	result := &Result{
+		GatewayReference: response.ID,
+		StatusCode:       statusCode,
+		Status:           StatusProcessing,
+	}
+
+	if statusCode < 200 || statusCode >= 300 {
+		result.Status = StatusFailed
+		result.DeclineCode = response.Name
+		if len(response.Details) > 0 {
+			result.DeclineCode = response.Details[0].Issue
+		}
+		return result, nil
+	}
+
+	status := response.Status
+	if response.BatchHeader != nil {
+		result.GatewayReference = response.BatchHeader.PayoutBatchID
+		status = response.BatchHeader.BatchStatus
+	}
+
+	// Refunds, captures and voids act on the order's capture or authorization,
+	// so its id replaces the order's once the order carries one
+	if len(response.PurchaseUnits) > 0 {
+		payments := response.PurchaseUnits[0].Payments
+		switch {
+		case len(payments.Captures) > 0:
+			result.GatewayReference = payments.Captures[0].ID
+			status = payments.Captures[0].Status
+		case len(payments.Authorizations) > 0:
+			result.GatewayReference = payments.Authorizations[0].ID
+			status = payments.Authorizations[0].Status
+			// An authorization is CREATED once the payer's funds are held
+			if status == "CREATED" {
+				status = "COMPLETED"
+			}
+		}
+	}
+
+	switch status {
+	case "COMPLETED", "SUCCESS":
+		result.Status = StatusCompleted
+	case "VOIDED", "DENIED", "CANCELED", "DECLINED", "FAILED", "EXPIRED":
+		result.Status = StatusFailed
+	}
+
+	return result, nil
+}
+
+// paypalPayment is a capture or authorization of an order
+type paypalPayment struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
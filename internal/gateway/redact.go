@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveFields are the request and response fields never stored in clear text
+var sensitiveFields = map[string]bool{
+	"access_token":          true,
+	"account_number":        true,
+	"api_key":               true,
+	"authorization":         true,
+	"card_number":           true,
+	"client_secret":         true,
+	"cvc":                   true,
+	"cvv":                   true,
+	"encryptedcardnumber":   true,
+	"encryptedsecuritycode": true,
+	"iban":                  true,
+	"number":                true,
+	"password":              true,
+	"refresh_token":         true,
+	"secret":                true,
+	"securitycode":          true,
+	"token":                 true,
+}
+
+var (
+	xmlFieldPattern = regexp.MustCompile(`(?is)<((?:[\w-]+:)?([\w-]+))(\s[^>]*)?>[^<]*</(?:[\w-]+:)?[\w-]+>`)
+	panPattern      = regexp.MustCompile(`\b\d{9,15}(\d{4})\b`)
+)
+
+func isSensitive(field string) bool {
+	return sensitiveFields[strings.ToLower(field)]
+}
+
+// Redact masks credentials and card data in a JSON, form encoded or XML body
+func Redact(body []byte) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return body
+	}
+
+	switch trimmed[0] {
+	case '{', '[':
+		var value interface{}
+		if err := json.Unmarshal(trimmed, &value); err == nil {
+			if masked, err := json.Marshal(redactJSON(value)); err == nil {
+				return maskPANs(masked)
+			}
+		}
+	case '<':
+		return maskPANs(redactXML(trimmed))
+	default:
+		if !looksLikeForm(trimmed) {
+			break
+		}
+		if form, err := url.ParseQuery(string(trimmed)); err == nil && len(form) > 0 {
+			return maskPANs([]byte(redactForm(form).Encode()))
+		}
+	}
+
+	return maskPANs(body)
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSensitive(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item)
+		}
+	}
+	return value
+}
+
+// looksLikeForm reports whether a body is key=value pairs rather than plain text
+func looksLikeForm(body []byte) bool {
+	return bytes.Contains(body, []byte("=")) && !bytes.ContainsAny(body, " \t\n")
+}
+
+func redactForm(form url.Values) url.Values {
+	for key := range form {
+		// nested keys look like card[number]
+		field := key
+		if i := strings.LastIndex(key, "["); i >= 0 {
+			field = strings.TrimSuffix(key[i+1:], "]")
+		}
+		if isSensitive(field) {
+			form[key] = []string{redacted}
+		}
+	}
+	return form
+}
+
+func redactXML(body []byte) []byte {
+	return xmlFieldPattern.ReplaceAllFunc(body, func(element []byte) []byte {
+		match := xmlFieldPattern.FindSubmatch(element)
+		if !isSensitive(string(match[2])) {
+			return element
+		}
+		return []byte("<" + string(match[1]) + string(match[3]) + ">" + redacted + "</" + string(match[1]) + ">")
+	})
+}
+
+// maskPANs hides everything but the last four digits of anything that looks like a card number
+func maskPANs(body []byte) []byte {
+	return panPattern.ReplaceAll(body, []byte("************$1"))
+}
@@ -0,0 +1,159 @@
+package gateway
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"payment-gateway/internal/config"
+	"strconv"
+	"time"
+)
+
+// Signer signs a message with a gateway's key
+type Signer interface {
+	Sign(message []byte) ([]byte, error)
+}
+
+// HMACSigner signs with HMAC-SHA256 and a shared secret
+type HMACSigner struct {
+	Secret []byte
+}
+
+func (s HMACSigner) Sign(message []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write(message)
+	return mac.Sum(nil), nil
+}
+
+// RSASigner signs with RSASSA-PKCS1-v1_5 over SHA-256
+type RSASigner struct {
+	Key *rsa.PrivateKey
+}
+
+func (s RSASigner) Sign(message []byte) ([]byte, error) {
+	digest := sha256.Sum256(message)
+	return rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, digest[:])
+}
+
+// NewSigner creates the signer for an algorithm from its key material; RSA keys are PEM encoded
+func NewSigner(algorithm string, key []byte) (Signer, error) {
+	switch algorithm {
+	case config.SigningHMACSHA256:
+		return HMACSigner{Secret: key}, nil
+	case config.SigningRSASHA256:
+		privateKey, err := parseRSAPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return RSASigner{Key: privateKey}, nil
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %s", algorithm)
+	}
+}
+
+func parseRSAPrivateKey(key []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, fmt.Errorf("signing key is not PEM encoded")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key is not an RSA key")
+	}
+
+	return privateKey, nil
+}
+
+// SigningMessage is what gets signed: the timestamp, the nonce and the body separated by newlines
+func SigningMessage(timestamp, nonce string, body []byte) []byte {
+	message := make([]byte, 0, len(timestamp)+len(nonce)+len(body)+2)
+	message = append(message, timestamp...)
+	message = append(message, '\n')
+	message = append(message, nonce...)
+	message = append(message, '\n')
+	return append(message, body...)
+}
+
+// requestSigner adds the signature headers configured for a gateway
+type requestSigner struct {
+	settings config.GatewaySigning
+	signer   Signer
+}
+
+func (s *requestSigner) sign(req *http.Request, body []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	signature, err := s.signer.Sign(SigningMessage(timestamp, nonceHex, body))
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	req.Header.Set(s.settings.TimestampHeader, timestamp)
+	req.Header.Set(s.settings.NonceHeader, nonceHex)
+	req.Header.Set(s.settings.SignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	if s.settings.KeyID != "" {
+		req.Header.Set(s.settings.KeyIDHeader, s.settings.KeyID)
+	}
+
+	return nil
+}
+
+// signerFor returns the gateway's request signer, or nil when its requests are not signed
+func (c *HTTPClient) signerFor(gatewayName string, details config.GatewayDetails) (*requestSigner, error) {
+	if !details.Signing.IsSet() {
+		return nil, nil
+	}
+
+	c.mu.RLock()
+	current, ok := c.signers[gatewayName]
+	c.mu.RUnlock()
+	if ok && current.settings == details.Signing {
+		return current, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if current, ok := c.signers[gatewayName]; ok && current.settings == details.Signing {
+		return current, nil
+	}
+
+	key, err := c.secrets.Resolve(details.Signing.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key for gateway %s: %w", gatewayName, err)
+	}
+
+	signer, err := NewSigner(details.Signing.Algorithm, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signer for gateway %s: %w", gatewayName, err)
+	}
+
+	next := &requestSigner{settings: details.Signing, signer: signer}
+	c.signers[gatewayName] = next
+
+	return next, nil
+}
@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"payment-gateway/internal/config"
+	"strconv"
+	"strings"
+)
+
+// StripeAdapter sends form encoded requests with amounts in minor units. Authorizations are
+// uncaptured charges, voided by refunding them in full.
+type StripeAdapter struct{}
+
+func (StripeAdapter) BuildRequest(ctx context.Context, request *Request, details config.GatewayDetails) (*http.Request, error) {
+	endpoint, err := endpointFor(request, details)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.TransactionType == "status" {
+		return lookupRequest(ctx, endpoint)
+	}
+
+	form := url.Values{}
+	switch request.TransactionType {
+	case "cancel":
+	case "void":
+		form.Set("charge", request.OriginalReference)
+	case "capture":
+		form.Set("amount", strconv.FormatInt(toMinorUnits(request.Amount, request.Currency), 10))
+	case "refund":
+		// refunds are in the currency of the refunded charge
+		form.Set("amount", strconv.FormatInt(toMinorUnits(request.Amount, request.Currency), 10))
+		form.Set("charge", request.OriginalReference)
+		form.Set("metadata[transaction_id]", strconv.Itoa(request.TransactionID))
+	case "authorization":
+		form.Set("amount", strconv.FormatInt(toMinorUnits(request.Amount, request.Currency), 10))
+		form.Set("currency", strings.ToLower(request.Currency))
+		form.Set("capture", "false")
+		form.Set("metadata[transaction_id]", strconv.Itoa(request.TransactionID))
+	default:
+		form.Set("amount", strconv.FormatInt(toMinorUnits(request.Amount, request.Currency), 10))
+		form.Set("currency", strings.ToLower(request.Currency))
+		form.Set("metadata[transaction_id]", strconv.Itoa(request.TransactionID))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Idempotency-Key", fmt.Sprintf("%s-%d", request.TransactionType, request.TransactionID))
+
+	return req, nil
+}
+
+// Authenticate uses the secret key as a bearer token
+func (StripeAdapter) Authenticate(_ context.Context, _ *http.Client, req *http.Request, details config.GatewayDetails) error {
+	apiKey := details.Credentials["api_key"]
+	if apiKey == "" {
+		return fmt.Errorf("stripe api_key credential is not configured")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	return nil
+}
+
+func (StripeAdapter) ParseResponse(statusCode int, body []byte) (*Result, error) {
+	var response struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Error  *struct {
+			Code        string `json:"code"`
+			DeclineCode string `json:"decline_code"`
+			Message     string `json:"message"`
+		} `json:"error"`
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse stripe response: %w", err)
+	}
+
+	result := &Result{
+		GatewayReference: response.ID,
+		StatusCode:       statusCode,
+	}
+
+	if response.Error != nil {
+		result.Status = StatusFailed
+		result.DeclineCode = response.Error.DeclineCode
+		if result.DeclineCode == "" {
+			result.DeclineCode = response.Error.Code
+		}
+		return result, nil
+	}
+
+	// charges and payouts share most of their statuses
+	switch response.Status {
+	case "succeeded", "paid":
+		result.Status = StatusCompleted
+	case "failed", "canceled":
+		result.Status = StatusFailed
+	default:
+		result.Status = StatusProcessing
+	}
+
+	return result, nil
+}
@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"payment-gateway/internal/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cachedToken struct {
+	value   string
+	renewAt time.Time // zero when the token endpoint gave no lifetime
+}
+
+// tokenCall is a token request in flight, shared by everyone waiting for it
+type tokenCall struct {
+	done  chan struct{}
+	token cachedToken
+	err   error
+}
+
+// TokenCache hands out OAuth2 client credentials tokens. Tokens are renewed ahead
+// of their expiry and concurrent callers needing a new token share a single request.
+type TokenCache struct {
+	mu       sync.Mutex
+	tokens   map[string]cachedToken
+	inflight map[string]*tokenCall
+	now      func() time.Time
+}
+
+func NewTokenCache() *TokenCache {
+	return &TokenCache{
+		tokens:   make(map[string]cachedToken),
+		inflight: make(map[string]*tokenCall),
+		now:      time.Now,
+	}
+}
+
+// Token returns a valid access token for the auth config, requesting one if needed
+func (c *TokenCache) Token(ctx context.Context, client *http.Client, auth config.GatewayAuth) (string, error) {
+	key := tokenKey(auth)
+
+	c.mu.Lock()
+	if token, ok := c.tokens[key]; ok && (token.renewAt.IsZero() || c.now().Before(token.renewAt)) {
+		c.mu.Unlock()
+		return token.value, nil
+	}
+
+	call, ok := c.inflight[key]
+	if !ok {
+		call = &tokenCall{done: make(chan struct{})}
+		c.inflight[key] = call
+		// The request outlives the caller that started it, so it is bound by
+		// the client timeout rather than the caller's context
+		go c.refresh(client, auth, key, call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return "", call.err
+		}
+		return call.token.value, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Invalidate drops the cached token, e.g. after the gateway rejected it
+func (c *TokenCache) Invalidate(auth config.GatewayAuth) {
+	c.mu.Lock()
+	delete(c.tokens, tokenKey(auth))
+	c.mu.Unlock()
+}
+
+func (c *TokenCache) refresh(client *http.Client, auth config.GatewayAuth, key string, call *tokenCall) {
+	call.token, call.err = c.requestToken(context.Background(), client, auth)
+
+	c.mu.Lock()
+	if call.err == nil {
+		c.tokens[key] = call.token
+	}
+	delete(c.inflight, key)
+	c.mu.Unlock()
+
+	close(call.done)
+}
+
+func (c *TokenCache) requestToken(ctx context.Context, client *http.Client, auth config.GatewayAuth) (cachedToken, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(auth.Scopes) > 0 {
+		form.Set("scope", strings.Join(auth.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, auth.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.SetBasicAuth(auth.ClientID, auth.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return cachedToken{}, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.AccessToken == "" {
+		return cachedToken{}, fmt.Errorf("token endpoint returned no access token")
+	}
+
+	token := cachedToken{value: response.AccessToken}
+	if response.ExpiresIn > 0 {
+		lifetime := time.Duration(response.ExpiresIn) * time.Second
+		// Never spend more than half of a short lived token's lifetime renewing it
+		refreshBefore := time.Duration(auth.RefreshBefore) * time.Second
+		if refreshBefore > lifetime/2 {
+			refreshBefore = lifetime / 2
+		}
+
+		token.renewAt = c.now().Add(lifetime - refreshBefore)
+	}
+
+	return token, nil
+}
+
+func tokenKey(auth config.GatewayAuth) string {
+	return auth.TokenURL + "|" + auth.ClientID + "|" + strings.Join(auth.Scopes, " ")
+}
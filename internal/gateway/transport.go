@@ -0,0 +1,310 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrConcurrencyLimit is returned when a gateway already has its maximum number of requests in flight
+var ErrConcurrencyLimit = errors.New("gateway concurrency limit reached")
+
+// defaultCertificateCheckInterval is how often the certificate files of a gateway are checked for rotation
+const defaultCertificateCheckInterval = 30 * time.Second
+
+// gatewayPool holds the transport of one gateway, the limit on its requests in
+// flight and the statistics of its connections
+type gatewayPool struct {
+	name     string
+	settings config.GatewayPool
+	limit    chan struct{} // nil when unlimited
+
+	mu        sync.Mutex // held while the transport is replaced
+	current   atomic.Pointer[gatewayTransport]
+	checkedAt atomic.Int64 // when the certificate files were last checked, in Unix nanoseconds
+	checking  atomic.Bool
+
+	openConns   atomic.Int64
+	newConns    atomic.Int64
+	reusedConns atomic.Int64
+	inFlight    atomic.Int64
+	rejected    atomic.Int64
+}
+
+// gatewayTransport is a transport along with the modification times of the
+// certificate files it was built from
+type gatewayTransport struct {
+	transport *http.Transport
+	settings  config.GatewayTLS
+	modTimes  map[string]time.Time
+}
+
+// rotated reports whether any certificate file changed since the transport was built
+func (t *gatewayTransport) rotated() bool {
+	for file, modTime := range t.modTimes {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newGatewayPool(name string, settings config.GatewayPool) *gatewayPool {
+	pool := &gatewayPool{
+		name:     name,
+		settings: settings,
+	}
+	if settings.MaxConcurrent > 0 {
+		pool.limit = make(chan struct{}, settings.MaxConcurrent)
+	}
+	return pool
+}
+
+// acquire takes a slot for a request without waiting, so a slow gateway can't pile up goroutines
+func (p *gatewayPool) acquire() error {
+	if p.limit != nil {
+		select {
+		case p.limit <- struct{}{}:
+		default:
+			p.rejected.Add(1)
+			return fmt.Errorf("%w: %s allows %d requests in flight", ErrConcurrencyLimit, p.name, p.settings.MaxConcurrent)
+		}
+	}
+
+	p.inFlight.Add(1)
+	return nil
+}
+
+func (p *gatewayPool) release() {
+	p.inFlight.Add(-1)
+	if p.limit != nil {
+		<-p.limit
+	}
+}
+
+// trace counts whether requests got a new or a reused connection
+func (p *gatewayPool) trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				p.reusedConns.Add(1)
+			} else {
+				p.newConns.Add(1)
+			}
+		},
+	})
+}
+
+func (p *gatewayPool) stats() models.GatewayPoolStats {
+	return models.GatewayPoolStats{
+		Gateway:       p.name,
+		OpenConns:     p.openConns.Load(),
+		NewConns:      p.newConns.Load(),
+		ReusedConns:   p.reusedConns.Load(),
+		InFlight:      p.inFlight.Load(),
+		MaxConcurrent: p.settings.MaxConcurrent,
+		Rejected:      p.rejected.Load(),
+	}
+}
+
+// poolFor returns the gateway's pool with a transport ready to use, building the
+// transport again when its certificates rotated
+func (c *HTTPClient) poolFor(gatewayName string, details config.GatewayDetails) (*gatewayPool, *http.Transport, error) {
+	pool := c.pool(gatewayName, details.Pool)
+
+	transport, err := pool.transport(details.TLS, c.certCheckInterval)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up transport for gateway %s: %w", gatewayName, err)
+	}
+
+	return pool, transport, nil
+}
+
+// pool returns the gateway's pool, creating it on first use
+func (c *HTTPClient) pool(gatewayName string, settings config.GatewayPool) *gatewayPool {
+	c.mu.RLock()
+	pool, ok := c.pools[gatewayName]
+	c.mu.RUnlock()
+	if ok {
+		return pool
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if pool, ok := c.pools[gatewayName]; ok {
+		return pool
+	}
+	pool = newGatewayPool(gatewayName, settings)
+	c.pools[gatewayName] = pool
+
+	return pool
+}
+
+// transport returns the pool's transport. Its certificate files are checked for rotation at
+// most once per interval, by a single request while the others keep using the current
+// transport, so only the first request and a change of TLS settings wait for a transport.
+func (p *gatewayPool) transport(settings config.GatewayTLS, interval time.Duration) (*http.Transport, error) {
+	current := p.current.Load()
+	if current == nil || current.settings != settings {
+		return p.replace(settings, current)
+	}
+
+	if time.Since(time.Unix(0, p.checkedAt.Load())) < interval || !p.checking.CompareAndSwap(false, true) {
+		return current.transport, nil
+	}
+	defer p.checking.Store(false)
+
+	if current.rotated() {
+		return p.replace(settings, current)
+	}
+	p.checkedAt.Store(time.Now().UnixNano())
+
+	return current.transport, nil
+}
+
+// replace builds a transport in place of the one seen, unless another request already did
+func (p *gatewayPool) replace(settings config.GatewayTLS, seen *gatewayTransport) (*http.Transport, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	previous := p.current.Load()
+	if previous != seen && previous.settings == settings {
+		return previous.transport, nil
+	}
+
+	next, err := p.newTransport(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous != nil {
+		previous.transport.CloseIdleConnections()
+	}
+	p.current.Store(next)
+	p.checkedAt.Store(time.Now().UnixNano())
+
+	return next.transport, nil
+}
+
+// PoolStats returns the connection and request statistics of every gateway
+func (c *HTTPClient) PoolStats() []models.GatewayPoolStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := make([]models.GatewayPoolStats, 0, len(c.pools))
+	for _, pool := range c.pools {
+		stats = append(stats, pool.stats())
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Gateway < stats[j].Gateway
+	})
+
+	return stats
+}
+
+func (p *gatewayPool) newTransport(settings config.GatewayTLS) (*gatewayTransport, error) {
+	// Stat before reading so a file rotated in between is picked up next time
+	modTimes := make(map[string]time.Time)
+	for _, file := range settings.Files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(p.settings.DialTimeout) * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			p.openConns.Add(1)
+			return &countedConn{Conn: conn, pool: p}, nil
+		},
+		TLSClientConfig:     tlsConfig,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        p.settings.MaxIdleConns,
+		MaxIdleConnsPerHost: p.settings.MaxIdleConns, // every gateway talks to a single host
+		MaxConnsPerHost:     p.settings.MaxConnsPerHost,
+		IdleConnTimeout:     time.Duration(p.settings.IdleConnTimeout) * time.Second,
+		TLSHandshakeTimeout: time.Duration(p.settings.TLSHandshakeTimeout) * time.Second,
+	}
+
+	return &gatewayTransport{
+		transport: transport,
+		settings:  settings,
+		modTimes:  modTimes,
+	}, nil
+}
+
+// countedConn keeps the number of open connections of a pool up to date
+type countedConn struct {
+	net.Conn
+	pool      *gatewayPool
+	closeOnce sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.pool.openConns.Add(-1)
+	})
+	return c.Conn.Close()
+}
+
+func newTLSConfig(settings config.GatewayTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: settings.Version(),
+		ServerName: settings.ServerName,
+	}
+
+	if settings.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if settings.CAFile != "" {
+		bundle, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", settings.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,258 @@
+package gateway_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Bank CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a certificate for a server name or a client and returns it PEM encoded with its key
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage, dnsNames ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// newMTLSServer starts a server only reachable as gateway.test that echoes the client certificate's name
+func newMTLSServer(t *testing.T, ca *testCA) *httptest.Server {
+	certPEM, keyPEM := ca.issue(t, "gateway.test", x509.ExtKeyUsageServerAuth, "gateway.test")
+	serverCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id": "`+r.TLS.PeerCertificates[0].Subject.CommonName+`", "status": "pending"}`)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	server.StartTLS()
+
+	return server
+}
+
+func TestSendTransactionMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	server := newMTLSServer(t, ca)
+	defer server.Close()
+
+	dir := t.TempDir()
+	settings := config.GatewayTLS{
+		CertFile:   filepath.Join(dir, "client.pem"),
+		KeyFile:    filepath.Join(dir, "client.key"),
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		MinVersion: "1.2",
+		ServerName: "gateway.test",
+	}
+
+	modTime := time.Now().Add(-time.Minute)
+	certPEM, keyPEM := ca.issue(t, "merchant-2024", x509.ExtKeyUsageClientAuth)
+	writeFile(t, settings.CertFile, certPEM, modTime)
+	writeFile(t, settings.KeyFile, keyPEM, modTime)
+	writeFile(t, settings.CAFile, ca.pem, modTime)
+
+	details := testGatewayDetails(server.URL)
+	details.TLS = settings
+	client := newTestClient(t, gateway.WithCertificateCheckInterval(0))
+	waitingClient := newTestClient(t)
+	request := &gateway.Request{Gateway: "bank", TransactionType: "deposit", TransactionID: 16, Payload: []byte(`{}`)}
+
+	result, err := client.SendTransaction(context.Background(), request, details)
+	require.NoError(t, err)
+	require.Equal(t, "merchant-2024", result.GatewayReference)
+
+	result, err = waitingClient.SendTransaction(context.Background(), request, details)
+	require.NoError(t, err)
+	require.Equal(t, "merchant-2024", result.GatewayReference)
+
+	// A rotated certificate is picked up without restarting
+	certPEM, keyPEM = ca.issue(t, "merchant-2025", x509.ExtKeyUsageClientAuth)
+	writeFile(t, settings.CertFile, certPEM, modTime.Add(time.Second))
+	writeFile(t, settings.KeyFile, keyPEM, modTime.Add(time.Second))
+
+	result, err = client.SendTransaction(context.Background(), request, details)
+	require.NoError(t, err)
+	require.Equal(t, "merchant-2025", result.GatewayReference)
+
+	// Until the next check the files aren't looked at
+	result, err = waitingClient.SendTransaction(context.Background(), request, details)
+	require.NoError(t, err)
+	require.Equal(t, "merchant-2024", result.GatewayReference)
+}
+
+func TestSendTransactionRejectsUntrustedGateway(t *testing.T) {
+	ca := newTestCA(t)
+	server := newMTLSServer(t, ca)
+	defer server.Close()
+
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, "merchant", x509.ExtKeyUsageClientAuth)
+	writeFile(t, filepath.Join(dir, "client.pem"), certPEM, time.Now())
+	writeFile(t, filepath.Join(dir, "client.key"), keyPEM, time.Now())
+	writeFile(t, filepath.Join(dir, "ca.pem"), ca.pem, time.Now())
+
+	tests := []struct {
+		name     string
+		settings config.GatewayTLS
+	}{
+		{"Unknown CA", config.GatewayTLS{
+			CertFile: filepath.Join(dir, "client.pem"), KeyFile: filepath.Join(dir, "client.key"), ServerName: "gateway.test",
+		}},
+		{"Wrong Server Name", config.GatewayTLS{
+			CertFile: filepath.Join(dir, "client.pem"), KeyFile: filepath.Join(dir, "client.key"), CAFile: filepath.Join(dir, "ca.pem"), ServerName: "other.test",
+		}},
+		{"No Client Certificate", config.GatewayTLS{
+			CAFile: filepath.Join(dir, "ca.pem"), ServerName: "gateway.test",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details := testGatewayDetails(server.URL)
+			details.TLS = tt.settings
+
+			_, err := newTestClient(t).SendTransaction(context.Background(), &gateway.Request{
+				Gateway: "bank", TransactionType: "deposit", TransactionID: 17, Payload: []byte(`{}`),
+			}, details)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSendTransactionReusesConnections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id": "ref", "status": "pending"}`)
+	}))
+	defer server.Close()
+
+	details := testGatewayDetails(server.URL)
+	details.Pool = config.GatewayPool{MaxIdleConns: 2, IdleConnTimeout: 30, DialTimeout: 1, TLSHandshakeTimeout: 1}
+
+	client, err := gateway.NewHTTPClient(&config.GatewayConfig{
+		Gateways: map[string]config.GatewayDetails{"acquirer": details},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := client.SendTransaction(context.Background(), &gateway.Request{
+			Gateway: "acquirer", TransactionType: "deposit", TransactionID: 18 + i, Payload: []byte(`{}`),
+		}, details)
+		require.NoError(t, err)
+	}
+
+	stats := client.PoolStats()
+	require.Len(t, stats, 1)
+	require.Equal(t, "acquirer", stats[0].Gateway)
+	require.Equal(t, int64(1), stats[0].NewConns)
+	require.Equal(t, int64(2), stats[0].ReusedConns)
+	require.Equal(t, int64(1), stats[0].OpenConns)
+	require.Zero(t, stats[0].InFlight)
+}
+
+func TestSendTransactionConcurrencyLimit(t *testing.T) {
+	started := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-unblock
+		io.WriteString(w, `{"id": "ref", "status": "pending"}`)
+	}))
+	defer server.Close()
+
+	details := testGatewayDetails(server.URL)
+	details.Pool = config.GatewayPool{MaxConcurrent: 1}
+	client := newTestClient(t)
+	request := &gateway.Request{Gateway: "slow", TransactionType: "deposit", TransactionID: 21, Payload: []byte(`{}`)}
+
+	done := make(chan error)
+	go func() {
+		_, err := client.SendTransaction(context.Background(), request, details)
+		done <- err
+	}()
+	<-started
+
+	// The slow gateway's only slot is taken, further requests fail fast
+	_, err := client.SendTransaction(context.Background(), request, details)
+	require.ErrorIs(t, err, gateway.ErrConcurrencyLimit)
+
+	stats := client.PoolStats()
+	require.Equal(t, int64(1), stats[0].InFlight)
+	require.Equal(t, int64(1), stats[0].Rejected)
+
+	close(unblock)
+	require.NoError(t, <-done)
+
+	_, err = client.SendTransaction(context.Background(), request, details)
+	require.NoError(t, err)
+}
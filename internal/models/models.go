@@ -20,16 +20,36 @@ type Gateway struct {
 }
 
 type Transaction struct {
-	ID        int
-	Amount    float64
-	Type      string
-	Status    string
-	GatewayID int
-	CountryID int
-	UserID    int
+	ID               int
+	Amount           float64
+	Currency         string
+	Fee              float64
+	Type             string
+	Status           string
+	GatewayID        int
+	CountryID        int
+	UserID           int
+	GatewayReference string
+	// ParentID is the transaction a refund belongs to, nil for other transactions
+	ParentID  *int
 	CreatedAt time.Time
 }
 
+// TransactionAttempt records a single request sent to a gateway for a transaction.
+// Payloads are stored redacted.
+type TransactionAttempt struct {
+	ID               int       `json:"id"`
+	TransactionID    int       `json:"transaction_id"`
+	Gateway          string    `json:"gateway"`
+	RequestPayload   string    `json:"request_payload"`
+	ResponseStatus   int       `json:"response_status"`
+	ResponseBody     string    `json:"response_body"`
+	LatencyMs        int64     `json:"latency_ms"`
+	GatewayReference string    `json:"gateway_reference,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
 type Country struct {
 	ID        int       `json:"id" xml:"id"`
 	Name      string    `json:"name" xml:"name"`
@@ -41,9 +61,20 @@ type Country struct {
 
 // a standard request structure for the transactions
 type TransactionRequest struct {
-	Amount   float64 `json:"amount"`
-	UserID   int     `json:"user_id"`
-	Currency string  `json:"currency"`
+	Amount     float64 `json:"amount"`
+	UserID     int     `json:"user_id"`
+	Currency   string  `json:"currency"`
+	MerchantID string  `json:"merchant_id,omitempty"`
+}
+
+// RefundRequest asks for a refund of a deposit, the whole refundable amount when Amount is 0
+type RefundRequest struct {
+	Amount float64 `json:"amount,omitempty"`
+}
+
+// CaptureRequest asks for a capture of an authorization, the whole authorized amount when Amount is 0
+type CaptureRequest struct {
+	Amount float64 `json:"amount,omitempty"`
 }
 
 // a standard response structure for the APIs
@@ -52,3 +83,156 @@ type APIResponse struct {
 	Message    string      `json:"message" xml:"message"`
 	Data       interface{} `json:"data,omitempty" xml:"data,omitempty"`
 }
+
+// ErrorResponse is the body of every error response. Code is stable and meant for programs,
+// Message for people.
+type ErrorResponse struct {
+	StatusCode int    `json:"status_code" xml:"status_code"`
+	Code       string `json:"code" xml:"code"`
+	Message    string `json:"message" xml:"message"`
+}
+
+// GatewayStats summarises the recent outcomes of a gateway in a country
+type GatewayStats struct {
+	Gateway      string  `json:"gateway"`
+	CountryID    int     `json:"country_id"`
+	Samples      int     `json:"samples"`
+	SuccessRate  float64 `json:"success_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	Score        float64 `json:"score"`
+}
+
+// RoutingDecision explains why a gateway was picked for a transaction
+type RoutingDecision struct {
+	CountryCode string         `json:"country_code"`
+	Gateway     string         `json:"gateway"`
+	Explored    bool           `json:"explored"`
+	Candidates  []GatewayStats `json:"candidates"`
+	DecidedAt   time.Time      `json:"decided_at"`
+}
+
+// RoutingReport is the state of the adaptive router exposed for debugging
+type RoutingReport struct {
+	Strategy  string            `json:"strategy"`
+	Stats     []GatewayStats    `json:"stats"`
+	Decisions []RoutingDecision `json:"decisions"`
+}
+
+// RoutingOverride forces the transactions of a user or a merchant through a given
+// gateway. Empty CountryCode, Currency and TransactionType match anything.
+type RoutingOverride struct {
+	ID              int        `json:"id"`
+	UserID          *int       `json:"user_id,omitempty"`
+	MerchantID      string     `json:"merchant_id,omitempty"`
+	CountryCode     string     `json:"country_code,omitempty"`
+	Currency        string     `json:"currency,omitempty"`
+	TransactionType string     `json:"transaction_type,omitempty"`
+	Gateway         string     `json:"gateway"`
+	Reason          string     `json:"reason,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// GatewayPoolStats describes the connections and requests of a gateway's transport
+type GatewayPoolStats struct {
+	Gateway       string `json:"gateway"`
+	OpenConns     int64  `json:"open_conns"`
+	NewConns      int64  `json:"new_conns"`
+	ReusedConns   int64  `json:"reused_conns"`
+	InFlight      int64  `json:"in_flight"`
+	MaxConcurrent int    `json:"max_concurrent"`
+	Rejected      int64  `json:"rejected"`
+}
+
+// LedgerAccount holds the balance of a user, or of the platform when UserID is nil,
+// in a currency
+type LedgerAccount struct {
+	ID       int     `json:"id"`
+	UserID   *int    `json:"user_id,omitempty"`
+	Type     string  `json:"type"`
+	Currency string  `json:"currency"`
+	Balance  float64 `json:"balance"`
+}
+
+// JournalEntry records the money movements of a transaction; its postings sum to zero
+type JournalEntry struct {
+	ID            int
+	TransactionID int
+	// Kind tells the entries of a transaction apart, a transaction has at most one of each kind
+	Kind string
+	// Requires is the kind of an earlier entry of the transaction without which this one is skipped
+	Requires string
+	// Excludes is the kind of another entry of the transaction with which this one is skipped,
+	// so that at most one of the two is recorded
+	Excludes string
+	// NoOverdraft rejects the entry when it would take a user account below zero
+	NoOverdraft bool
+	Postings    []Posting
+	CreatedAt   time.Time
+}
+
+// Posting credits an account with Amount, or debits it when Amount is negative.
+// The account is created on first use.
+type Posting struct {
+	UserID      *int
+	AccountType string
+	Currency    string
+	Amount      float64
+}
+
+// Balance is what a user holds in a currency: Available can be withdrawn, Reserved is
+// held for withdrawals in flight
+type Balance struct {
+	Currency  string  `json:"currency"`
+	Available float64 `json:"available"`
+	Reserved  float64 `json:"reserved"`
+}
+
+// SettlementRecord is a line of a gateway's settlement report
+type SettlementRecord struct {
+	GatewayReference string
+	Amount           float64
+	Currency         string
+	Status           string
+	SettledAt        time.Time
+}
+
+// Kinds of reconciliation discrepancies
+const (
+	// ReconciliationMissing is a completed transaction the gateway didn't settle
+	ReconciliationMissing = "missing"
+	// ReconciliationExtra is a settlement for a transaction we don't know of
+	ReconciliationExtra = "extra"
+	// ReconciliationAmountMismatch is a settlement of another amount or currency than the transaction's
+	ReconciliationAmountMismatch = "amount_mismatch"
+	// ReconciliationStatusMismatch is a settlement in another status than the transaction's
+	ReconciliationStatusMismatch = "status_mismatch"
+)
+
+// ReconciliationItem is a discrepancy between a transaction and a gateway's settlement report
+type ReconciliationItem struct {
+	ID               int     `json:"id"`
+	Kind             string  `json:"kind"`
+	GatewayReference string  `json:"gateway_reference"`
+	TransactionID    *int    `json:"transaction_id,omitempty"`
+	ExpectedAmount   float64 `json:"expected_amount,omitempty"`
+	SettledAmount    float64 `json:"settled_amount,omitempty"`
+	ExpectedCurrency string  `json:"expected_currency,omitempty"`
+	SettledCurrency  string  `json:"settled_currency,omitempty"`
+	ExpectedStatus   string  `json:"expected_status,omitempty"`
+	SettledStatus    string  `json:"settled_status,omitempty"`
+}
+
+// ReconciliationRun is the result of reconciling a gateway's settlement report over a period
+type ReconciliationRun struct {
+	ID      int    `json:"id"`
+	Gateway string `json:"gateway"`
+	// Source names the settlement report, e.g. its file name
+	Source        string               `json:"source"`
+	PeriodStart   time.Time            `json:"period_start"`
+	PeriodEnd     time.Time            `json:"period_end"`
+	Records       int                  `json:"records"`
+	Matched       int                  `json:"matched"`
+	Discrepancies []ReconciliationItem `json:"discrepancies"`
+	CreatedAt     time.Time            `json:"created_at"`
+}
@@ -0,0 +1,103 @@
+// Package cache puts a read-through cache in front of the gateway, country and user
+// repositories, whose rows are read for every transaction and rarely change. Entries live in
+// process or in Redis, shared by every instance, and are dropped after a TTL or when the admin
+// API invalidates them. Nothing in the service changes these rows, they are edited in the
+// database directly, so the TTL bounds how long a change takes to show unless it is followed
+// by an invalidation. An in-process invalidation only reaches the instance making it.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Store keeps encoded entries until they expire
+type Store interface {
+	// Get returns the entry of a key, found is false when there is none or it has expired
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Cache keeps rows in a Store for a TTL. Concurrent misses of a key read the row once.
+type Cache struct {
+	store Store
+	ttl   time.Duration
+	group singleflight.Group
+}
+
+func New(store Store, ttl time.Duration) *Cache {
+	return &Cache{
+		store: store,
+		ttl:   ttl,
+	}
+}
+
+// load returns the row cached under key, or the one fetch returns on a miss, which is then
+// cached under every key returned by keys. The cache is only there to spare the database:
+// when the store fails, the error is logged and the row fetched.
+func load[T any](ctx context.Context, c *Cache, key string, fetch func() (*T, error), keys func(row *T) []string) (*T, error) {
+	if row, found := get[T](ctx, c, key); found {
+		return row, nil
+	}
+
+	data, err, _ := c.group.Do(key, func() (interface{}, error) {
+		row, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+
+		for _, k := range keys(row) {
+			if err := c.store.Set(ctx, k, data, c.ttl); err != nil {
+				log.Printf("cache: failed to set %s: %v", k, err)
+			}
+		}
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every caller decodes its own copy of the row
+	var row T
+	if err := json.Unmarshal(data.([]byte), &row); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return &row, nil
+}
+
+// get returns the row cached under key, found is false on a miss or when the store fails
+func get[T any](ctx context.Context, c *Cache, key string) (*T, bool) {
+	data, found, err := c.store.Get(ctx, key)
+	if err != nil {
+		log.Printf("cache: failed to get %s: %v", key, err)
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+
+	var row T
+	if err := json.Unmarshal(data, &row); err != nil {
+		log.Printf("cache: failed to decode %s: %v", key, err)
+		return nil, false
+	}
+	return &row, true
+}
+
+func (c *Cache) delete(ctx context.Context, keys ...string) error {
+	if err := c.store.Delete(ctx, keys...); err != nil {
+		return fmt.Errorf("failed to invalidate %v: %w", keys, err)
+	}
+	return nil
+}
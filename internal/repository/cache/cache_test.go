@@ -0,0 +1,316 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"payment-gateway/internal/repository/cache"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gatewaySource is the repository behind the cache, counting the lookups that reach it
+type gatewaySource struct {
+	mu       sync.Mutex
+	gateways map[int]models.Gateway
+	calls    int
+	// delay holds the lookups back, so that concurrent ones overlap
+	delay time.Duration
+}
+
+func (s *gatewaySource) FindByID(ctx context.Context, id int) (*models.Gateway, error) {
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+
+	gateway, exists := s.gateways[id]
+	if !exists {
+		return nil, &repository.NotFoundError{Entity: "gateway", Key: "ID", Value: id}
+	}
+	return &gateway, nil
+}
+
+func (s *gatewaySource) FindByName(ctx context.Context, name string) (*models.Gateway, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+
+	for _, gateway := range s.gateways {
+		if gateway.Name == name {
+			return &gateway, nil
+		}
+	}
+	return nil, &repository.NotFoundError{Entity: "gateway", Key: "name", Value: name}
+}
+
+func (s *gatewaySource) rename(id int, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gateway := s.gateways[id]
+	gateway.Name = name
+	s.gateways[id] = gateway
+}
+
+func (s *gatewaySource) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func newGatewaySource() *gatewaySource {
+	return &gatewaySource{
+		gateways: map[int]models.Gateway{
+			1: {ID: 1, Name: "stripe", DataFormatSupported: "application/json"},
+		},
+	}
+}
+
+func TestGatewayRepo(t *testing.T) {
+	ctx := context.Background()
+	source := newGatewaySource()
+	gateways := cache.NewGatewayRepo(source, cache.New(cache.NewLRU(100), time.Minute))
+
+	for i := 0; i < 3; i++ {
+		gateway, err := gateways.FindByID(ctx, 1)
+		if err != nil {
+			t.Fatalf("failed to find gateway: %v", err)
+		}
+		if gateway.Name != "stripe" || gateway.DataFormatSupported != "application/json" {
+			t.Errorf("Unexpected gateway: %+v", gateway)
+		}
+		// What is returned is a copy
+		gateway.Name = "changed"
+	}
+
+	// The lookup by ID cached the gateway under its name too
+	if gateway, err := gateways.FindByName(ctx, "stripe"); err != nil || gateway.ID != 1 {
+		t.Errorf("Expected gateway 1, got %+v and %v", gateway, err)
+	}
+	if calls := source.callCount(); calls != 1 {
+		t.Errorf("Expected a single lookup, got %d", calls)
+	}
+
+	// Missing gateways aren't cached
+	for i := 0; i < 2; i++ {
+		if _, err := gateways.FindByID(ctx, 2); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got: %v", err)
+		}
+	}
+	if calls := source.callCount(); calls != 3 {
+		t.Errorf("Expected every lookup of a missing gateway to reach the repository, got %d lookups", calls)
+	}
+}
+
+func TestGatewayRepoInvalidate(t *testing.T) {
+	ctx := context.Background()
+	source := newGatewaySource()
+	gateways := cache.NewGatewayRepo(source, cache.New(cache.NewLRU(100), time.Minute))
+
+	if _, err := gateways.FindByName(ctx, "stripe"); err != nil {
+		t.Fatalf("failed to find gateway: %v", err)
+	}
+
+	source.rename(1, "stripe-eu")
+	if gateway, _ := gateways.FindByID(ctx, 1); gateway == nil || gateway.Name != "stripe" {
+		t.Errorf("Expected the cached gateway before invalidation, got %+v", gateway)
+	}
+
+	if err := gateways.Invalidate(ctx, 1); err != nil {
+		t.Fatalf("failed to invalidate gateway: %v", err)
+	}
+
+	if gateway, err := gateways.FindByID(ctx, 1); err != nil || gateway.Name != "stripe-eu" {
+		t.Errorf("Expected the renamed gateway, got %+v and %v", gateway, err)
+	}
+	if _, err := gateways.FindByName(ctx, "stripe"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected the old name to be gone, got: %v", err)
+	}
+
+	// Invalidating a gateway that doesn't exist isn't an error
+	if err := gateways.Invalidate(ctx, 2); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
+
+func TestConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	source := newGatewaySource()
+	source.delay = 50 * time.Millisecond
+	gateways := cache.NewGatewayRepo(source, cache.New(cache.NewLRU(100), time.Minute))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := gateways.FindByID(ctx, 1); err != nil {
+				t.Errorf("failed to find gateway: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := source.callCount(); calls != 1 {
+		t.Errorf("Expected the concurrent misses to share a lookup, got %d", calls)
+	}
+}
+
+// failingStore stands in for an unreachable Redis
+type failingStore struct{}
+
+func (failingStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (failingStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingStore) Delete(ctx context.Context, keys ...string) error {
+	return errors.New("connection refused")
+}
+
+func TestStoreFailure(t *testing.T) {
+	ctx := context.Background()
+	source := newGatewaySource()
+	gateways := cache.NewGatewayRepo(source, cache.New(failingStore{}, time.Minute))
+
+	if gateway, err := gateways.FindByID(ctx, 1); err != nil || gateway.Name != "stripe" {
+		t.Errorf("Expected the gateway from the repository, got %+v and %v", gateway, err)
+	}
+	if err := gateways.Invalidate(ctx, 1); err == nil {
+		t.Error("Expected invalidation to fail")
+	}
+}
+
+type countrySource struct {
+	calls int
+}
+
+func (s *countrySource) FindByID(ctx context.Context, id int) (*models.Country, error) {
+	s.calls++
+	return &models.Country{ID: id, Name: "France", Code: "FR", Currency: "EUR"}, nil
+}
+
+type userSource struct {
+	calls int
+}
+
+func (s *userSource) FindByID(ctx context.Context, id int) (*models.User, error) {
+	s.calls++
+	return &models.User{ID: id, Username: "alice", CountryID: 1}, nil
+}
+
+func TestInvalidator(t *testing.T) {
+	ctx := context.Background()
+	readCache := cache.New(cache.NewLRU(100), time.Minute)
+	countrySource, userSource := &countrySource{}, &userSource{}
+	countries := cache.NewCountryRepo(countrySource, readCache)
+	users := cache.NewUserRepo(userSource, readCache)
+	invalidator := cache.NewInvalidator(cache.NewGatewayRepo(newGatewaySource(), readCache), countries, users)
+
+	for i := 0; i < 2; i++ {
+		if country, err := countries.FindByID(ctx, 1); err != nil || country.Code != "FR" {
+			t.Errorf("Unexpected country: %+v and %v", country, err)
+		}
+		if user, err := users.FindByID(ctx, 1); err != nil || user.Username != "alice" {
+			t.Errorf("Unexpected user: %+v and %v", user, err)
+		}
+	}
+	if countrySource.calls != 1 || userSource.calls != 1 {
+		t.Errorf("Expected a single lookup each, got %d and %d", countrySource.calls, userSource.calls)
+	}
+
+	if err := invalidator.InvalidateCountry(ctx, 1); err != nil {
+		t.Fatalf("failed to invalidate country: %v", err)
+	}
+	if err := invalidator.InvalidateUser(ctx, 1); err != nil {
+		t.Fatalf("failed to invalidate user: %v", err)
+	}
+	countries.FindByID(ctx, 1)
+	users.FindByID(ctx, 1)
+	if countrySource.calls != 2 || userSource.calls != 2 {
+		t.Errorf("Expected the invalidated rows to be looked up again, got %d and %d", countrySource.calls, userSource.calls)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(2)
+
+	lru.Set(ctx, "a", []byte("1"), time.Minute)
+	lru.Set(ctx, "b", []byte("2"), time.Minute)
+	// Reading a makes b the least recently used
+	lru.Get(ctx, "a")
+	lru.Set(ctx, "c", []byte("3"), time.Minute)
+
+	if _, found, _ := lru.Get(ctx, "b"); found {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, found, _ := lru.Get(ctx, key); !found {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+	if lru.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", lru.Len())
+	}
+
+	testStore(t, lru)
+}
+
+func TestRedis(t *testing.T) {
+	url := os.Getenv("TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("TEST_REDIS_URL is not set")
+	}
+
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+	client := redis.NewClient(options)
+	defer client.Close()
+
+	testStore(t, cache.NewRedis(client, "payment-gateway-test:"))
+}
+
+// testStore checks what every Store does
+func testStore(t *testing.T, store cache.Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, found, err := store.Get(ctx, "missing"); found || err != nil {
+		t.Errorf("Expected a miss, got %v and %v", found, err)
+	}
+
+	if err := store.Set(ctx, "key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	if value, found, err := store.Get(ctx, "key"); !found || err != nil || string(value) != "value" {
+		t.Errorf("Expected value, got %q, %v and %v", value, found, err)
+	}
+
+	if err := store.Delete(ctx, "key", "missing"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, found, _ := store.Get(ctx, "key"); found {
+		t.Error("Expected the deleted key to be gone")
+	}
+
+	if err := store.Set(ctx, "short", []byte("value"), 50*time.Millisecond); err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, found, _ := store.Get(ctx, "short"); found {
+		t.Error("Expected the entry to expire")
+	}
+}
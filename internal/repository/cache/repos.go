@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+)
+
+func gatewayIDKey(id int) string {
+	return fmt.Sprintf("gateway:id:%d", id)
+}
+
+func gatewayNameKey(name string) string {
+	return "gateway:name:" + name
+}
+
+// gatewayKeys caches a gateway under its ID and its name, whichever it was looked up by
+func gatewayKeys(gateway *models.Gateway) []string {
+	return []string{gatewayIDKey(gateway.ID), gatewayNameKey(gateway.Name)}
+}
+
+func countryKey(id int) string {
+	return fmt.Sprintf("country:id:%d", id)
+}
+
+func userKey(id int) string {
+	return fmt.Sprintf("user:id:%d", id)
+}
+
+type GatewayRepo struct {
+	next  repository.Gateway
+	cache *Cache
+}
+
+func NewGatewayRepo(next repository.Gateway, cache *Cache) *GatewayRepo {
+	return &GatewayRepo{
+		next:  next,
+		cache: cache,
+	}
+}
+
+var _ repository.Gateway = (*GatewayRepo)(nil)
+
+func (r *GatewayRepo) FindByID(ctx context.Context, id int) (*models.Gateway, error) {
+	return load(ctx, r.cache, gatewayIDKey(id), func() (*models.Gateway, error) {
+		return r.next.FindByID(ctx, id)
+	}, gatewayKeys)
+}
+
+func (r *GatewayRepo) FindByName(ctx context.Context, name string) (*models.Gateway, error) {
+	return load(ctx, r.cache, gatewayNameKey(name), func() (*models.Gateway, error) {
+		return r.next.FindByName(ctx, name)
+	}, gatewayKeys)
+}
+
+// Invalidate drops a gateway from the cache, under the name it was cached with and under its
+// current one in case it was renamed
+func (r *GatewayRepo) Invalidate(ctx context.Context, id int) error {
+	keys := []string{gatewayIDKey(id)}
+
+	if cached, found := get[models.Gateway](ctx, r.cache, gatewayIDKey(id)); found {
+		keys = append(keys, gatewayNameKey(cached.Name))
+	}
+
+	current, err := r.next.FindByID(ctx, id)
+	switch {
+	case err == nil:
+		keys = append(keys, gatewayNameKey(current.Name))
+	case !errors.Is(err, repository.ErrNotFound):
+		return fmt.Errorf("failed to find gateway: %w", err)
+	}
+
+	return r.cache.delete(ctx, keys...)
+}
+
+type CountryRepo struct {
+	next  repository.Country
+	cache *Cache
+}
+
+func NewCountryRepo(next repository.Country, cache *Cache) *CountryRepo {
+	return &CountryRepo{
+		next:  next,
+		cache: cache,
+	}
+}
+
+var _ repository.Country = (*CountryRepo)(nil)
+
+func (r *CountryRepo) FindByID(ctx context.Context, id int) (*models.Country, error) {
+	return load(ctx, r.cache, countryKey(id), func() (*models.Country, error) {
+		return r.next.FindByID(ctx, id)
+	}, func(country *models.Country) []string {
+		return []string{countryKey(country.ID)}
+	})
+}
+
+// Invalidate drops a country from the cache
+func (r *CountryRepo) Invalidate(ctx context.Context, id int) error {
+	return r.cache.delete(ctx, countryKey(id))
+}
+
+type UserRepo struct {
+	next  repository.User
+	cache *Cache
+}
+
+func NewUserRepo(next repository.User, cache *Cache) *UserRepo {
+	return &UserRepo{
+		next:  next,
+		cache: cache,
+	}
+}
+
+var _ repository.User = (*UserRepo)(nil)
+
+func (r *UserRepo) FindByID(ctx context.Context, id int) (*models.User, error) {
+	return load(ctx, r.cache, userKey(id), func() (*models.User, error) {
+		return r.next.FindByID(ctx, id)
+	}, func(user *models.User) []string {
+		return []string{userKey(user.ID)}
+	})
+}
+
+// Invalidate drops a user from the cache
+func (r *UserRepo) Invalidate(ctx context.Context, id int) error {
+	return r.cache.delete(ctx, userKey(id))
+}
+
+// Invalidator drops rows from the cached repositories once they changed in the database
+type Invalidator struct {
+	gateways  *GatewayRepo
+	countries *CountryRepo
+	users     *UserRepo
+}
+
+func NewInvalidator(gateways *GatewayRepo, countries *CountryRepo, users *UserRepo) *Invalidator {
+	return &Invalidator{
+		gateways:  gateways,
+		countries: countries,
+		users:     users,
+	}
+}
+
+func (i *Invalidator) InvalidateGateway(ctx context.Context, id int) error {
+	return i.gateways.Invalidate(ctx, id)
+}
+
+func (i *Invalidator) InvalidateCountry(ctx context.Context, id int) error {
+	return i.countries.Invalidate(ctx, id)
+}
+
+func (i *Invalidator) InvalidateUser(ctx context.Context, id int) error {
+	return i.users.Invalidate(ctx, id)
+}
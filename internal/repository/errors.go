@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when the row looked up doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a row can't be stored next to one already there, such as a second gateway of the same name
+	ErrConflict = errors.New("conflict")
+)
+
+// NotFoundError tells which row wasn't found, it is ErrNotFound
+type NotFoundError struct {
+	// Entity is what was looked up, e.g. "transaction"
+	Entity string
+	// Key is the column it was looked up by, e.g. "ID"
+	Key   string
+	Value interface{}
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s with %s %v not found", e.Entity, e.Key, e.Value)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
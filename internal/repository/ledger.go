@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"payment-gateway/internal/models"
+)
+
+// ErrInsufficientFunds is returned when a journal entry would overdraw a user account
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+type Ledger interface {
+	// Record stores a journal entry and applies its postings to the account balances, all
+	// or nothing. Recording an entry the transaction already has, one whose Requires entry
+	// is missing or one whose Excludes entry exists, does nothing.
+	Record(ctx context.Context, entry *models.JournalEntry) error
+	// ListAccounts returns the ledger accounts of a user
+	ListAccounts(ctx context.Context, userID int) ([]models.LedgerAccount, error)
+}
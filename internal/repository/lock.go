@@ -0,0 +1,10 @@
+package repository
+
+import "context"
+
+// Locker takes locks shared by every instance of the service
+type Locker interface {
+	// TryLock takes the named lock unless another holder has it, acquired is false then.
+	// The lock is held until unlock is called.
+	TryLock(ctx context.Context, name string) (unlock func(), acquired bool, err error)
+}
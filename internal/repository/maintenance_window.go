@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"payment-gateway/internal/config"
+)
+
+type MaintenanceWindow interface {
+	// Create stores a window added through the admin API
+	Create(ctx context.Context, window *config.MaintenanceWindow) error
+	FindByID(ctx context.Context, id int) (*config.MaintenanceWindow, error)
+	Delete(ctx context.Context, id int) error
+	// List returns the windows ordered by ID
+	List(ctx context.Context) ([]config.MaintenanceWindow, error)
+	// SyncConfig makes the windows of the configuration source those given: missing ones are
+	// created and those no longer given are deleted, however many instances sync at the same
+	// time. A window created before sources were recorded that is the same as a given one is
+	// taken as the configuration's.
+	SyncConfig(ctx context.Context, windows []config.MaintenanceWindow) error
+}
+
+// MaintenanceSync is what syncing the windows of the configuration changes in those stored
+type MaintenanceSync struct {
+	// Sources are the new sources of stored windows by ID
+	Sources map[int]string
+	// Deleted are the IDs of the configuration's windows it no longer has
+	Deleted []int
+	// Created are the configuration's windows not stored yet
+	Created []config.MaintenanceWindow
+}
+
+// SyncMaintenanceSources compares the stored windows with those of the configuration,
+// for the repositories to implement SyncConfig
+func SyncMaintenanceSources(stored, configured []config.MaintenanceWindow) MaintenanceSync {
+	changes := MaintenanceSync{Sources: make(map[int]string)}
+	remaining := append([]config.MaintenanceWindow(nil), configured...)
+
+	// take removes the configured window the same as a stored one, if any
+	take := func(window config.MaintenanceWindow) bool {
+		for i, candidate := range remaining {
+			if candidate.SameAs(window) {
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, window := range stored {
+		if window.Source == config.MaintenanceSourceConfig && !take(window) {
+			changes.Deleted = append(changes.Deleted, window.ID)
+		}
+	}
+
+	// Windows stored before sources were recorded only match what the others left
+	for _, window := range stored {
+		if window.Source != "" {
+			continue
+		}
+		if take(window) {
+			changes.Sources[window.ID] = config.MaintenanceSourceConfig
+		} else {
+			changes.Sources[window.ID] = config.MaintenanceSourceAdmin
+		}
+	}
+
+	for _, window := range remaining {
+		window.ID = 0
+		window.Source = config.MaintenanceSourceConfig
+		changes.Created = append(changes.Created, window)
+	}
+
+	return changes
+}
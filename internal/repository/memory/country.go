@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sync"
+	"time"
+)
+
+type CountryRepo struct {
+	mu        sync.RWMutex
+	lastID    int
+	countries map[int]models.Country
+}
+
+func NewCountryRepo() *CountryRepo {
+	return &CountryRepo{
+		countries: make(map[int]models.Country),
+	}
+}
+
+var _ repository.Country = (*CountryRepo)(nil)
+
+// Add stores a country, assigning its ID and timestamps. Names and codes are unique.
+func (r *CountryRepo) Add(ctx context.Context, country *models.Country) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.countries {
+		if existing.Name == country.Name || existing.Code == country.Code {
+			return fmt.Errorf("%w: country %s (%s) already exists", repository.ErrConflict, country.Name, country.Code)
+		}
+	}
+
+	r.lastID++
+	country.ID = r.lastID
+	country.CreatedAt = time.Now()
+	country.UpdatedAt = country.CreatedAt
+	r.countries[country.ID] = *country
+
+	return nil
+}
+
+func (r *CountryRepo) FindByID(ctx context.Context, id int) (*models.Country, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	country, exists := r.countries[id]
+	if !exists {
+		return nil, &repository.NotFoundError{Entity: "country", Key: "ID", Value: id}
+	}
+
+	return &country, nil
+}
@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sync"
+	"time"
+)
+
+type GatewayRepo struct {
+	mu       sync.RWMutex
+	lastID   int
+	gateways map[int]models.Gateway
+}
+
+func NewGatewayRepo() *GatewayRepo {
+	return &GatewayRepo{
+		gateways: make(map[int]models.Gateway),
+	}
+}
+
+var _ repository.Gateway = (*GatewayRepo)(nil)
+
+// Add stores a gateway, assigning its ID and timestamps. Names are unique.
+func (r *GatewayRepo) Add(ctx context.Context, gateway *models.Gateway) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.gateways {
+		if existing.Name == gateway.Name {
+			return fmt.Errorf("%w: gateway %s already exists", repository.ErrConflict, gateway.Name)
+		}
+	}
+
+	r.lastID++
+	gateway.ID = r.lastID
+	gateway.CreatedAt = time.Now()
+	gateway.UpdatedAt = gateway.CreatedAt
+	r.gateways[gateway.ID] = *gateway
+
+	return nil
+}
+
+func (r *GatewayRepo) FindByID(ctx context.Context, id int) (*models.Gateway, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	gateway, exists := r.gateways[id]
+	if !exists {
+		return nil, &repository.NotFoundError{Entity: "gateway", Key: "ID", Value: id}
+	}
+
+	return &gateway, nil
+}
+
+func (r *GatewayRepo) FindByName(ctx context.Context, name string) (*models.Gateway, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, gateway := range r.gateways {
+		if gateway.Name == name {
+			return &gateway, nil
+		}
+	}
+
+	return nil, &repository.NotFoundError{Entity: "gateway", Key: "name", Value: name}
+}
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sort"
+	"sync"
+	"time"
+)
+
+type accountKey struct {
+	userID      int
+	accountType string
+	currency    string
+}
+
+type entryKey struct {
+	transactionID int
+	kind          string
+}
+
+type LedgerRepo struct {
+	mu            sync.Mutex
+	lastAccountID int
+	lastEntryID   int
+	accounts      map[accountKey]models.LedgerAccount
+	entries       map[entryKey]models.JournalEntry
+}
+
+func NewLedgerRepo() *LedgerRepo {
+	return &LedgerRepo{
+		accounts: make(map[accountKey]models.LedgerAccount),
+		entries:  make(map[entryKey]models.JournalEntry),
+	}
+}
+
+var _ repository.Ledger = (*LedgerRepo)(nil)
+
+func (r *LedgerRepo) Record(ctx context.Context, entry *models.JournalEntry) error {
+	_, err := r.record(entry)
+	return err
+}
+
+// record records an entry, telling whether it did
+func (r *LedgerRepo) record(entry *models.JournalEntry) (bool, error) {
+	var total float64
+	for _, posting := range entry.Postings {
+		total += posting.Amount
+	}
+	if math.Abs(total) >= 0.005 {
+		return false, fmt.Errorf("journal entry %s of transaction %d is unbalanced by %.2f", entry.Kind, entry.TransactionID, total)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry.Requires != "" && !r.recorded(entry.TransactionID, entry.Requires) {
+		return false, nil
+	}
+	if entry.Excludes != "" && r.recorded(entry.TransactionID, entry.Excludes) {
+		return false, nil
+	}
+	if r.recorded(entry.TransactionID, entry.Kind) {
+		return false, nil
+	}
+
+	if entry.NoOverdraft {
+		for _, posting := range entry.Postings {
+			balance := r.accounts[keyOf(posting)].Balance
+			if posting.UserID != nil && posting.Amount < 0 && balance+posting.Amount < -0.005 {
+				return false, fmt.Errorf("%w: %s balance of user %d is %.2f %s, %.2f needed",
+					repository.ErrInsufficientFunds, posting.AccountType, *posting.UserID, balance, posting.Currency, -posting.Amount)
+			}
+		}
+	}
+
+	r.lastEntryID++
+	entry.ID = r.lastEntryID
+	entry.CreatedAt = time.Now()
+	r.entries[entryKey{entry.TransactionID, entry.Kind}] = *entry
+	r.apply(entry.Postings, 1)
+
+	return true, nil
+}
+
+func (r *LedgerRepo) recorded(transactionID int, kind string) bool {
+	_, exists := r.entries[entryKey{transactionID, kind}]
+	return exists
+}
+
+// Entries returns the journal entries of a transaction in the order they were recorded
+func (r *LedgerRepo) Entries(transactionID int) []models.JournalEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []models.JournalEntry
+	for key, entry := range r.entries {
+		if key.transactionID == transactionID {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	return entries
+}
+
+// apply adds the postings to the account balances, times sign, creating the accounts on first use
+func (r *LedgerRepo) apply(postings []models.Posting, sign float64) {
+	for _, posting := range postings {
+		key := keyOf(posting)
+		account, exists := r.accounts[key]
+		if !exists {
+			r.lastAccountID++
+			account = models.LedgerAccount{ID: r.lastAccountID, Type: posting.AccountType, Currency: posting.Currency}
+			if posting.UserID != nil {
+				userID := *posting.UserID
+				account.UserID = &userID
+			}
+		}
+		account.Balance = roundCents(account.Balance + sign*posting.Amount)
+		r.accounts[key] = account
+	}
+}
+
+// undo takes back an entry record recorded. The accounts it created stay, with nothing on them.
+func (r *LedgerRepo) undo(entry *models.JournalEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, entryKey{entry.TransactionID, entry.Kind})
+	r.apply(entry.Postings, -1)
+}
+
+func keyOf(posting models.Posting) accountKey {
+	key := accountKey{accountType: posting.AccountType, currency: posting.Currency}
+	if posting.UserID != nil {
+		key.userID = *posting.UserID
+	}
+	return key
+}
+
+func (r *LedgerRepo) ListAccounts(ctx context.Context, userID int) ([]models.LedgerAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var accounts []models.LedgerAccount
+	for _, account := range r.accounts {
+		if account.UserID != nil && *account.UserID == userID {
+			owner := *account.UserID
+			account.UserID = &owner
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Currency != accounts[j].Currency {
+			return accounts[i].Currency < accounts[j].Currency
+		}
+		return accounts[i].Type < accounts[j].Type
+	})
+
+	return accounts, nil
+}
@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/repository"
+	"sort"
+	"sync"
+)
+
+type MaintenanceWindowRepo struct {
+	mu      sync.RWMutex
+	lastID  int
+	windows map[int]config.MaintenanceWindow
+}
+
+func NewMaintenanceWindowRepo() *MaintenanceWindowRepo {
+	return &MaintenanceWindowRepo{
+		windows: make(map[int]config.MaintenanceWindow),
+	}
+}
+
+var _ repository.MaintenanceWindow = (*MaintenanceWindowRepo)(nil)
+
+func (r *MaintenanceWindowRepo) Create(ctx context.Context, window *config.MaintenanceWindow) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	window.Source = config.MaintenanceSourceAdmin
+	r.insert(window)
+	return nil
+}
+
+// insert stores a window like the INSERT of the Postgres repository, which keeps times in UTC
+func (r *MaintenanceWindowRepo) insert(window *config.MaintenanceWindow) {
+	r.lastID++
+	window.ID = r.lastID
+
+	stored := *window
+	stored.Countries = append([]string(nil), window.Countries...)
+	stored.Start = stored.Start.UTC()
+	stored.End = stored.End.UTC()
+	r.windows[stored.ID] = stored
+}
+
+func (r *MaintenanceWindowRepo) FindByID(ctx context.Context, id int) (*config.MaintenanceWindow, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	window, exists := r.windows[id]
+	if !exists {
+		return nil, &repository.NotFoundError{Entity: "maintenance window", Key: "ID", Value: id}
+	}
+
+	window.Countries = append([]string(nil), window.Countries...)
+	return &window, nil
+}
+
+func (r *MaintenanceWindowRepo) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.windows[id]; !exists {
+		return &repository.NotFoundError{Entity: "maintenance window", Key: "ID", Value: id}
+	}
+
+	delete(r.windows, id)
+	return nil
+}
+
+func (r *MaintenanceWindowRepo) List(ctx context.Context) ([]config.MaintenanceWindow, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.list(), nil
+}
+
+func (r *MaintenanceWindowRepo) list() []config.MaintenanceWindow {
+	var windows []config.MaintenanceWindow
+	for _, window := range r.windows {
+		window.Countries = append([]string(nil), window.Countries...)
+		windows = append(windows, window)
+	}
+
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].ID < windows[j].ID
+	})
+
+	return windows
+}
+
+func (r *MaintenanceWindowRepo) SyncConfig(ctx context.Context, windows []config.MaintenanceWindow) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changes := repository.SyncMaintenanceSources(r.list(), windows)
+	for id, source := range changes.Sources {
+		window := r.windows[id]
+		window.Source = source
+		r.windows[id] = window
+	}
+	for _, id := range changes.Deleted {
+		delete(r.windows, id)
+	}
+	for i := range changes.Created {
+		r.insert(&changes.Created[i])
+	}
+
+	return nil
+}
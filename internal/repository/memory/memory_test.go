@@ -0,0 +1,32 @@
+package memory_test
+
+import (
+	"payment-gateway/internal/repository/memory"
+	"payment-gateway/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repos {
+		gateways := memory.NewGatewayRepo()
+		countries := memory.NewCountryRepo()
+		users := memory.NewUserRepo()
+		transactions := memory.NewTransactionRepo()
+		ledger := memory.NewLedgerRepo()
+
+		return repositorytest.Repos{
+			Transactions: transactions,
+			Gateways:     gateways,
+			Countries:    countries,
+			Users:        users,
+			Ledger:       ledger,
+			UnitOfWork:   memory.NewUnitOfWork(transactions, gateways, countries, users, ledger),
+
+			MaintenanceWindows: memory.NewMaintenanceWindowRepo(),
+
+			AddGateway: gateways.Add,
+			AddCountry: countries.Add,
+			AddUser:    users.Add,
+		}
+	})
+}
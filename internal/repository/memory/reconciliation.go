@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sync"
+	"time"
+)
+
+type ReconciliationRepo struct {
+	mu         sync.Mutex
+	lastRunID  int
+	lastItemID int
+	runs       []models.ReconciliationRun
+}
+
+func NewReconciliationRepo() *ReconciliationRepo {
+	return &ReconciliationRepo{}
+}
+
+var _ repository.Reconciliation = (*ReconciliationRepo)(nil)
+
+func (r *ReconciliationRepo) Create(ctx context.Context, run *models.ReconciliationRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastRunID++
+	run.ID = r.lastRunID
+	run.CreatedAt = time.Now()
+	for i := range run.Discrepancies {
+		r.lastItemID++
+		run.Discrepancies[i].ID = r.lastItemID
+	}
+
+	stored := *run
+	stored.Discrepancies = append([]models.ReconciliationItem(nil), run.Discrepancies...)
+	r.runs = append(r.runs, stored)
+
+	return nil
+}
+
+// Runs returns the stored reconciliation runs in the order they were created
+func (r *ReconciliationRepo) Runs() []models.ReconciliationRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]models.ReconciliationRun(nil), r.runs...)
+}
@@ -0,0 +1,265 @@
+// Package memory implements the repositories in memory, for tests and demos. They behave like
+// the Postgres repositories: IDs are assigned on creation, lookups of missing rows fail, and
+// they are safe for concurrent use. Rows are copied in and out, so callers never share them.
+// References between repositories, such as a transaction's gateway, aren't checked.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sort"
+	"sync"
+	"time"
+)
+
+type TransactionRepo struct {
+	mu           sync.RWMutex
+	lastID       int
+	transactions map[int]models.Transaction
+}
+
+func NewTransactionRepo() *TransactionRepo {
+	return &TransactionRepo{
+		transactions: make(map[int]models.Transaction),
+	}
+}
+
+var _ repository.Transaction = (*TransactionRepo)(nil)
+
+func (r *TransactionRepo) Create(ctx context.Context, transaction *models.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if transaction.ParentID != nil {
+		if _, exists := r.transactions[*transaction.ParentID]; !exists {
+			return fmt.Errorf("failed to create transaction: %w: parent transaction %d doesn't exist", repository.ErrConflict, *transaction.ParentID)
+		}
+	}
+
+	r.insert(transaction)
+	return nil
+}
+
+// insert stores a transaction like the INSERT of the Postgres repository: amounts are
+// rounded to cents and created_at is the current time
+func (r *TransactionRepo) insert(transaction *models.Transaction) {
+	r.lastID++
+	transaction.ID = r.lastID
+
+	stored := copyTransaction(*transaction)
+	stored.Amount = roundCents(stored.Amount)
+	stored.Fee = roundCents(stored.Fee)
+	stored.GatewayReference = ""
+	stored.CreatedAt = time.Now()
+	r.transactions[stored.ID] = stored
+}
+
+func (r *TransactionRepo) CreateChild(ctx context.Context, child *models.Transaction) error {
+	if child.ParentID == nil {
+		return fmt.Errorf("%s has no parent transaction", child.Type)
+	}
+
+	// Holding the write lock serialises concurrent refunds or captures
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parent, exists := r.transactions[*child.ParentID]
+	if !exists {
+		return &repository.NotFoundError{Entity: "transaction", Key: "ID", Value: *child.ParentID}
+	}
+
+	used := r.childrenAmount(parent.ID, child.Type)
+	if remaining := parent.Amount - used; child.Amount > remaining+0.005 {
+		return fmt.Errorf("%w: %.2f requested, %.2f left", repository.ErrAmountLimitExceeded, child.Amount, remaining)
+	}
+
+	r.insert(child)
+	return nil
+}
+
+func (r *TransactionRepo) ChildrenAmount(ctx context.Context, id int, childType string) (float64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.childrenAmount(id, childType), nil
+}
+
+func (r *TransactionRepo) childrenAmount(id int, childType string) float64 {
+	var amount float64
+	for _, transaction := range r.transactions {
+		if transaction.ParentID != nil && *transaction.ParentID == id &&
+			transaction.Type == childType && !contains(repository.FailedChildStatuses, transaction.Status) {
+			amount += transaction.Amount
+		}
+	}
+	return roundCents(amount)
+}
+
+func (r *TransactionRepo) CompletedChildrenAmount(ctx context.Context, id int, childType string) (float64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var amount float64
+	for _, transaction := range r.transactions {
+		if transaction.ParentID != nil && *transaction.ParentID == id &&
+			transaction.Type == childType && transaction.Status == "COMPLETED" {
+			amount += transaction.Amount
+		}
+	}
+	return roundCents(amount), nil
+}
+
+func (r *TransactionRepo) ListByStatus(ctx context.Context, transactionType, status string, createdBefore time.Time) ([]models.Transaction, error) {
+	return r.list(func(transaction *models.Transaction) bool {
+		return transaction.Type == transactionType && transaction.Status == status && transaction.CreatedAt.Before(createdBefore)
+	}), nil
+}
+
+func (r *TransactionRepo) ListByStatuses(ctx context.Context, statuses []string, createdBefore time.Time, afterID, limit int) ([]models.Transaction, error) {
+	transactions := r.list(func(transaction *models.Transaction) bool {
+		return contains(statuses, transaction.Status) && transaction.CreatedAt.Before(createdBefore) && transaction.ID > afterID
+	})
+
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].ID < transactions[j].ID
+	})
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+
+	return transactions, nil
+}
+
+func (r *TransactionRepo) ListByGateway(ctx context.Context, gatewayID int, from, to time.Time) ([]models.Transaction, error) {
+	return r.list(func(transaction *models.Transaction) bool {
+		return transaction.GatewayID == gatewayID && !transaction.CreatedAt.Before(from) && transaction.CreatedAt.Before(to)
+	}), nil
+}
+
+func (r *TransactionRepo) ListByGatewayReferences(ctx context.Context, gatewayID int, references []string) ([]models.Transaction, error) {
+	if len(references) == 0 {
+		return nil, nil
+	}
+
+	return r.list(func(transaction *models.Transaction) bool {
+		return transaction.GatewayID == gatewayID && contains(references, transaction.GatewayReference)
+	}), nil
+}
+
+// list returns the transactions matching, oldest first
+func (r *TransactionRepo) list(matches func(transaction *models.Transaction) bool) []models.Transaction {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var transactions []models.Transaction
+	for _, transaction := range r.transactions {
+		if matches(&transaction) {
+			transactions = append(transactions, copyTransaction(transaction))
+		}
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].CreatedAt.Equal(transactions[j].CreatedAt) {
+			return transactions[i].CreatedAt.Before(transactions[j].CreatedAt)
+		}
+		return transactions[i].ID < transactions[j].ID
+	})
+
+	return transactions
+}
+
+func (r *TransactionRepo) GetByID(ctx context.Context, id int) (*models.Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transaction, exists := r.transactions[id]
+	if !exists {
+		return nil, &repository.NotFoundError{Entity: "transaction", Key: "ID", Value: id}
+	}
+
+	transaction = copyTransaction(transaction)
+	return &transaction, nil
+}
+
+// GetByIDForUpdate is GetByID, units of work run one at a time so there is nothing to lock
+func (r *TransactionRepo) GetByIDForUpdate(ctx context.Context, id int) (*models.Transaction, error) {
+	return r.GetByID(ctx, id)
+}
+
+func (r *TransactionRepo) UpdateStatus(ctx context.Context, id int, status string) error {
+	return r.update(id, func(transaction *models.Transaction) {
+		transaction.Status = status
+	})
+}
+
+func (r *TransactionRepo) SetGatewayReference(ctx context.Context, id int, reference string) error {
+	return r.update(id, func(transaction *models.Transaction) {
+		transaction.GatewayReference = reference
+	})
+}
+
+func (r *TransactionRepo) update(id int, change func(transaction *models.Transaction)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	transaction, exists := r.transactions[id]
+	if !exists {
+		return &repository.NotFoundError{Entity: "transaction", Key: "ID", Value: id}
+	}
+
+	change(&transaction)
+	r.transactions[id] = transaction
+	return nil
+}
+
+// row returns a copy of a stored transaction, nil when there is none
+func (r *TransactionRepo) row(id int) *models.Transaction {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transaction, exists := r.transactions[id]
+	if !exists {
+		return nil
+	}
+
+	transaction = copyTransaction(transaction)
+	return &transaction
+}
+
+// restore puts back a transaction as row returned it, removing it when nil
+func (r *TransactionRepo) restore(id int, transaction *models.Transaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if transaction == nil {
+		delete(r.transactions, id)
+		return
+	}
+	r.transactions[id] = *transaction
+}
+
+// copyTransaction copies the parent ID too, so stored and returned transactions share nothing
+func copyTransaction(transaction models.Transaction) models.Transaction {
+	if transaction.ParentID != nil {
+		parentID := *transaction.ParentID
+		transaction.ParentID = &parentID
+	}
+	return transaction
+}
+
+// roundCents rounds like the DECIMAL(10, 2) columns of the transactions table
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
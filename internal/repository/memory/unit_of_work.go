@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sync"
+)
+
+// UnitOfWork runs units of work one at a time, which stands in for the row locks taken in
+// Postgres, and undoes the changes of the units that fail. Calls made outside units of work
+// aren't isolated from them. Like a sequence, the IDs of undone transactions aren't reused.
+type UnitOfWork struct {
+	mu           sync.Mutex
+	transactions *TransactionRepo
+	gateways     *GatewayRepo
+	countries    *CountryRepo
+	users        *UserRepo
+	ledger       *LedgerRepo
+}
+
+func NewUnitOfWork(transactions *TransactionRepo, gateways *GatewayRepo, countries *CountryRepo, users *UserRepo, ledger *LedgerRepo) *UnitOfWork {
+	return &UnitOfWork{
+		transactions: transactions,
+		gateways:     gateways,
+		countries:    countries,
+		users:        users,
+		ledger:       ledger,
+	}
+}
+
+var _ repository.UnitOfWork = (*UnitOfWork)(nil)
+
+func (u *UnitOfWork) Do(ctx context.Context, fn func(repos repository.Repositories) error) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	transactions := &unitTransactionRepo{
+		TransactionRepo: u.transactions,
+		before:          make(map[int]*models.Transaction),
+	}
+	ledger := &unitLedgerRepo{LedgerRepo: u.ledger}
+
+	committed := false
+	defer func() {
+		if !committed {
+			ledger.rollback()
+			transactions.rollback()
+		}
+	}()
+
+	err := fn(repository.Repositories{
+		Transactions: transactions,
+		Gateways:     u.gateways,
+		Countries:    u.countries,
+		Users:        u.users,
+		Ledger:       ledger,
+	})
+	if err != nil {
+		return err
+	}
+
+	committed = true
+	return nil
+}
+
+// unitTransactionRepo remembers the transactions a unit of work changes as they were before,
+// nil for the ones it created
+type unitTransactionRepo struct {
+	*TransactionRepo
+	before map[int]*models.Transaction
+}
+
+func (r *unitTransactionRepo) Create(ctx context.Context, transaction *models.Transaction) error {
+	if err := r.TransactionRepo.Create(ctx, transaction); err != nil {
+		return err
+	}
+	r.before[transaction.ID] = nil
+	return nil
+}
+
+func (r *unitTransactionRepo) CreateChild(ctx context.Context, child *models.Transaction) error {
+	if err := r.TransactionRepo.CreateChild(ctx, child); err != nil {
+		return err
+	}
+	r.before[child.ID] = nil
+	return nil
+}
+
+func (r *unitTransactionRepo) UpdateStatus(ctx context.Context, id int, status string) error {
+	r.remember(id)
+	return r.TransactionRepo.UpdateStatus(ctx, id, status)
+}
+
+func (r *unitTransactionRepo) SetGatewayReference(ctx context.Context, id int, reference string) error {
+	r.remember(id)
+	return r.TransactionRepo.SetGatewayReference(ctx, id, reference)
+}
+
+func (r *unitTransactionRepo) remember(id int) {
+	if _, remembered := r.before[id]; !remembered {
+		r.before[id] = r.row(id)
+	}
+}
+
+func (r *unitTransactionRepo) rollback() {
+	for id, transaction := range r.before {
+		r.restore(id, transaction)
+	}
+}
+
+// unitLedgerRepo remembers the entries a unit of work records
+type unitLedgerRepo struct {
+	*LedgerRepo
+	recorded []*models.JournalEntry
+}
+
+func (r *unitLedgerRepo) Record(ctx context.Context, entry *models.JournalEntry) error {
+	recorded, err := r.record(entry)
+	if err != nil {
+		return err
+	}
+	if recorded {
+		recordedEntry := *entry
+		recordedEntry.Postings = append([]models.Posting(nil), entry.Postings...)
+		r.recorded = append(r.recorded, &recordedEntry)
+	}
+	return nil
+}
+
+func (r *unitLedgerRepo) rollback() {
+	for i := len(r.recorded) - 1; i >= 0; i-- {
+		r.undo(r.recorded[i])
+	}
+}
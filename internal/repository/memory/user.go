@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sync"
+	"time"
+)
+
+type UserRepo struct {
+	mu     sync.RWMutex
+	lastID int
+	users  map[int]models.User
+}
+
+func NewUserRepo() *UserRepo {
+	return &UserRepo{
+		users: make(map[int]models.User),
+	}
+}
+
+var _ repository.User = (*UserRepo)(nil)
+
+// Add stores a user, assigning their ID and timestamps. Usernames and emails are unique.
+func (r *UserRepo) Add(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Username == user.Username || existing.Email == user.Email {
+			return fmt.Errorf("%w: user %s already exists", repository.ErrConflict, user.Username)
+		}
+	}
+
+	r.lastID++
+	user.ID = r.lastID
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	r.users[user.ID] = *user
+
+	return nil
+}
+
+func (r *UserRepo) FindByID(ctx context.Context, id int) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, exists := r.users[id]
+	if !exists {
+		return nil, &repository.NotFoundError{Entity: "user", Key: "ID", Value: id}
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,122 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"payment-gateway/db"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository/postgres"
+	"payment-gateway/internal/repository/repositorytest"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// conformanceSchema keeps the conformance tests, which need empty tables, away from the data
+// of the database they run in
+const conformanceSchema = "repository_conformance"
+
+func TestConformance(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer admin.Close()
+
+	if _, err := admin.Exec(`DROP SCHEMA IF EXISTS ` + conformanceSchema + ` CASCADE; CREATE SCHEMA ` + conformanceSchema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	defer admin.Exec(`DROP SCHEMA IF EXISTS ` + conformanceSchema + ` CASCADE`)
+
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	database, err := sql.Open("postgres", url+separator+"search_path="+conformanceSchema)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	migrator, err := db.NewMigrator(database)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repos {
+		_, err := database.Exec(`TRUNCATE gateways, countries, users, transactions, ledger_accounts, maintenance_windows RESTART IDENTITY CASCADE`)
+		if err != nil {
+			t.Fatalf("failed to empty tables: %v", err)
+		}
+
+		return repositorytest.Repos{
+			Transactions: postgres.NewTransactionRepo(database),
+			Gateways:     postgres.NewGatewayRepo(database),
+			Countries:    postgres.NewCountryRepo(database),
+			Users:        postgres.NewUserRepo(database),
+			Ledger:       postgres.NewLedgerRepo(database),
+			UnitOfWork:   postgres.NewUnitOfWork(database),
+
+			MaintenanceWindows: postgres.NewMaintenanceWindowRepo(database),
+
+			AddGateway: func(ctx context.Context, gateway *models.Gateway) error {
+				return database.QueryRowContext(ctx, `
+					INSERT INTO gateways (name, data_format_supported) VALUES ($1, $2)
+					RETURNING id, created_at, updated_at`,
+					gateway.Name, gateway.DataFormatSupported,
+				).Scan(&gateway.ID, &gateway.CreatedAt, &gateway.UpdatedAt)
+			},
+			AddCountry: func(ctx context.Context, country *models.Country) error {
+				return database.QueryRowContext(ctx, `
+					INSERT INTO countries (name, code, currency) VALUES ($1, $2, $3)
+					RETURNING id, created_at, updated_at`,
+					country.Name, country.Code, country.Currency,
+				).Scan(&country.ID, &country.CreatedAt, &country.UpdatedAt)
+			},
+			AddUser: func(ctx context.Context, user *models.User) error {
+				return database.QueryRowContext(ctx, `
+					INSERT INTO users (username, email, password, country_id) VALUES ($1, $2, '', NULLIF($3, 0))
+					RETURNING id, created_at, updated_at`,
+					user.Username, user.Email, user.CountryID,
+				).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+			},
+		}
+	})
+}
+
+// openTestDB connects to the database named by TEST_DATABASE_URL and migrates it,
+// skipping the test when it isn't set
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	database, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	migrator, err := db.NewMigrator(database)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	return database
+}
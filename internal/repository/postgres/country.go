@@ -9,7 +9,7 @@ import (
 )
 
 type CountryRepo struct {
-	db *sql.DB
+	db querier
 }
 
 func NewCountryRepo(db *sql.DB) repository.Country {
@@ -33,7 +33,7 @@ func (r *CountryRepo) FindByID(ctx context.Context, id int) (*models.Country, er
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("country with ID %d not found", id)
+		return nil, &repository.NotFoundError{Entity: "country", Key: "ID", Value: id}
 	}
 
 	if err != nil {
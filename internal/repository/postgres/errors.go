@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"payment-gateway/internal/repository"
+
+	"github.com/lib/pq"
+)
+
+// integrityViolation is the class of the errors Postgres returns for rows breaking a
+// constraint: duplicate keys, missing referenced rows, NULLs and checks
+const integrityViolation = "23"
+
+// constraintError wraps the errors of rows breaking a constraint with repository.ErrConflict
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Class() == integrityViolation {
+		return fmt.Errorf("%w: %s", repository.ErrConflict, pqErr.Message)
+	}
+	return err
+}
@@ -9,7 +9,7 @@ import (
 )
 
 type GatewayRepo struct {
-	db *sql.DB
+	db querier
 }
 
 func NewGatewayRepo(db *sql.DB) repository.Gateway {
@@ -19,7 +19,7 @@ func NewGatewayRepo(db *sql.DB) repository.Gateway {
 }
 
 func (r *GatewayRepo) FindByID(ctx context.Context, id int) (*models.Gateway, error) {
-	query := `SELECT id, name, dataformatsupported, created_at, updated_at 
+	query := `SELECT id, name, data_format_supported, created_at, updated_at 
               FROM gateways WHERE id = $1`
 
 	var gateway models.Gateway
@@ -32,18 +32,18 @@ func (r *GatewayRepo) FindByID(ctx context.Context, id int) (*models.Gateway, er
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("country with ID %d not found", id)
+		return nil, &repository.NotFoundError{Entity: "gateway", Key: "ID", Value: id}
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("error querying country: %w", err)
+		return nil, fmt.Errorf("error querying gateway: %w", err)
 	}
 
 	return &gateway, nil
 }
 
 func (r *GatewayRepo) FindByName(ctx context.Context, name string) (*models.Gateway, error) {
-	query := `SELECT id, name, dataformatsupported, created_at, updated_at 
+	query := `SELECT id, name, data_format_supported, created_at, updated_at 
               FROM gateways WHERE name = $1`
 
 	var gateway models.Gateway
@@ -56,11 +56,11 @@ func (r *GatewayRepo) FindByName(ctx context.Context, name string) (*models.Gate
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("country with Name %s not found", name)
+		return nil, &repository.NotFoundError{Entity: "gateway", Key: "name", Value: name}
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("error querying country: %w", err)
+		return nil, fmt.Errorf("error querying gateway: %w", err)
 	}
 
 	return &gateway, nil
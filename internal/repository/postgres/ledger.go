@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sort"
+	"time"
+)
+
+type LedgerRepo struct {
+	db querier
+}
+
+func NewLedgerRepo(db *sql.DB) repository.Ledger {
+	return &LedgerRepo{
+		db: db,
+	}
+}
+
+func (r *LedgerRepo) Record(ctx context.Context, entry *models.JournalEntry) error {
+	var total float64
+	for _, posting := range entry.Postings {
+		total += posting.Amount
+	}
+	if math.Abs(total) >= 0.005 {
+		return fmt.Errorf("journal entry %s of transaction %d is unbalanced by %.2f", entry.Kind, entry.TransactionID, total)
+	}
+
+	return withTx(ctx, r.db, func(tx querier) error {
+		return record(ctx, tx, entry)
+	})
+}
+
+func record(ctx context.Context, tx querier, entry *models.JournalEntry) error {
+	if entry.Requires != "" {
+		var exists bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM journal_entries WHERE transaction_id = $1 AND kind = $2)`,
+			entry.TransactionID, entry.Requires,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to look up journal entry: %w", err)
+		}
+		if !exists {
+			return nil
+		}
+	}
+
+	if entry.Excludes != "" {
+		// Locking the transaction serialises the entries excluding each other
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT 1 FROM transactions WHERE id = $1 FOR UPDATE`, entry.TransactionID).Scan(new(int))
+		if err != nil {
+			return fmt.Errorf("failed to lock transaction: %w", err)
+		}
+		err = tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM journal_entries WHERE transaction_id = $1 AND kind = $2)`,
+			entry.TransactionID, entry.Excludes,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to look up journal entry: %w", err)
+		}
+		if exists {
+			return nil
+		}
+	}
+
+	entry.CreatedAt = time.Now()
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO journal_entries (transaction_id, kind, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (transaction_id, kind) DO NOTHING
+		RETURNING id`,
+		entry.TransactionID, entry.Kind, entry.CreatedAt,
+	).Scan(&entry.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Already recorded, e.g. by a repeated callback
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	// Accounts are locked in the same order by every entry so concurrent entries can't deadlock
+	postings := append([]models.Posting(nil), entry.Postings...)
+	sort.Slice(postings, func(i, j int) bool {
+		return accountKey(postings[i]) < accountKey(postings[j])
+	})
+
+	for _, posting := range postings {
+		accountID, balance, err := lockAccount(ctx, tx, posting)
+		if err != nil {
+			return err
+		}
+
+		if entry.NoOverdraft && posting.UserID != nil && posting.Amount < 0 && balance+posting.Amount < -0.005 {
+			return fmt.Errorf("%w: %s balance of user %d is %.2f %s, %.2f needed",
+				repository.ErrInsufficientFunds, posting.AccountType, *posting.UserID, balance, posting.Currency, -posting.Amount)
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO postings (entry_id, account_id, amount) VALUES ($1, $2, $3)`, entry.ID, accountID, posting.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to create posting: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE ledger_accounts SET balance = balance + $1 WHERE id = $2`, posting.Amount, accountID)
+		if err != nil {
+			return fmt.Errorf("failed to update account balance: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func accountKey(posting models.Posting) string {
+	userID := 0
+	if posting.UserID != nil {
+		userID = *posting.UserID
+	}
+	return fmt.Sprintf("%d/%s/%s", userID, posting.AccountType, posting.Currency)
+}
+
+// lockAccount creates the account of a posting if needed and locks it, returning its id and balance
+func lockAccount(ctx context.Context, tx querier, posting models.Posting) (int, float64, error) {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO ledger_accounts (user_id, type, currency) VALUES ($1, $2, $3)
+		ON CONFLICT ((COALESCE(user_id, 0)), type, currency) DO NOTHING`,
+		posting.UserID, posting.AccountType, posting.Currency,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create ledger account: %w", err)
+	}
+
+	var (
+		id      int
+		balance float64
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, balance FROM ledger_accounts
+		WHERE COALESCE(user_id, 0) = COALESCE($1, 0) AND type = $2 AND currency = $3
+		FOR UPDATE`,
+		posting.UserID, posting.AccountType, posting.Currency,
+	).Scan(&id, &balance)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lock ledger account: %w", err)
+	}
+
+	return id, balance, nil
+}
+
+func (r *LedgerRepo) ListAccounts(ctx context.Context, userID int) ([]models.LedgerAccount, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, type, currency, balance FROM ledger_accounts
+		WHERE user_id = $1 ORDER BY currency, type`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ledger accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []models.LedgerAccount
+	for rows.Next() {
+		var account models.LedgerAccount
+		if err := rows.Scan(&account.ID, &account.UserID, &account.Type, &account.Currency, &account.Balance); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list ledger accounts: %w", err)
+	}
+
+	return accounts, nil
+}
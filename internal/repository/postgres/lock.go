@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"payment-gateway/internal/repository"
+)
+
+// AdvisoryLocker takes Postgres session advisory locks, keyed on the hash of their name
+type AdvisoryLocker struct {
+	db *sql.DB
+}
+
+func NewAdvisoryLocker(db *sql.DB) repository.Locker {
+	return &AdvisoryLocker{
+		db: db,
+	}
+}
+
+func (l *AdvisoryLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	// Session locks belong to a connection, which is kept out of the pool while the lock is held
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to take lock %s: %w", name, err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		defer conn.Close()
+
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, name)
+		if err == nil {
+			return
+		}
+
+		// Closing the session is the only other way to release the lock
+		log.Printf("failed to release lock %s, dropping its connection: %v", name, err)
+		conn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+	}
+
+	return unlock, true, nil
+}
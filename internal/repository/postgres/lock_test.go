@@ -0,0 +1,33 @@
+package postgres_test
+
+import (
+	"context"
+	"payment-gateway/internal/repository/postgres"
+	"testing"
+)
+
+func TestAdvisoryLockerExcludesOtherHolders(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	// Each locker stands for an instance of the service
+	first := postgres.NewAdvisoryLocker(db)
+	second := postgres.NewAdvisoryLocker(db)
+
+	unlock, acquired, err := first.TryLock(ctx, "lock-test")
+	if err != nil || !acquired {
+		t.Fatalf("expected the lock to be taken, got %v and %v", acquired, err)
+	}
+
+	if _, acquired, err := second.TryLock(ctx, "lock-test"); err != nil || acquired {
+		t.Fatalf("expected the lock to be busy, got %v and %v", acquired, err)
+	}
+
+	unlock()
+
+	unlock, acquired, err = second.TryLock(ctx, "lock-test")
+	if err != nil || !acquired {
+		t.Fatalf("expected the released lock to be taken, got %v and %v", acquired, err)
+	}
+	unlock()
+}
@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/repository"
+
+	"github.com/lib/pq"
+)
+
+type MaintenanceWindowRepo struct {
+	db querier
+}
+
+func NewMaintenanceWindowRepo(db *sql.DB) repository.MaintenanceWindow {
+	return &MaintenanceWindowRepo{
+		db: db,
+	}
+}
+
+const maintenanceWindowColumns = `id, gateway, countries, start_at, end_at, recurrence, source`
+
+func (r *MaintenanceWindowRepo) Create(ctx context.Context, window *config.MaintenanceWindow) error {
+	window.Source = config.MaintenanceSourceAdmin
+	return createMaintenanceWindow(ctx, r.db, window)
+}
+
+func createMaintenanceWindow(ctx context.Context, q querier, window *config.MaintenanceWindow) error {
+	countries := window.Countries
+	if countries == nil {
+		countries = []string{}
+	}
+
+	err := q.QueryRowContext(ctx, `
+		INSERT INTO maintenance_windows (gateway, countries, start_at, end_at, recurrence, source)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		window.Gateway,
+		pq.Array(countries),
+		window.Start.UTC(),
+		window.End.UTC(),
+		window.Recurrence,
+		window.Source,
+	).Scan(&window.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create maintenance window: %w", constraintError(err))
+	}
+
+	return nil
+}
+
+func (r *MaintenanceWindowRepo) FindByID(ctx context.Context, id int) (*config.MaintenanceWindow, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+maintenanceWindowColumns+` FROM maintenance_windows WHERE id = $1`, id)
+
+	window, err := scanMaintenanceWindow(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &repository.NotFoundError{Entity: "maintenance window", Key: "ID", Value: id}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find maintenance window: %w", err)
+	}
+
+	return window, nil
+}
+
+func (r *MaintenanceWindowRepo) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM maintenance_windows WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete maintenance window: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return &repository.NotFoundError{Entity: "maintenance window", Key: "ID", Value: id}
+	}
+
+	return nil
+}
+
+func (r *MaintenanceWindowRepo) List(ctx context.Context) ([]config.MaintenanceWindow, error) {
+	return listMaintenanceWindows(ctx, r.db)
+}
+
+func listMaintenanceWindows(ctx context.Context, q querier) ([]config.MaintenanceWindow, error) {
+	rows, err := q.QueryContext(ctx, `SELECT `+maintenanceWindowColumns+` FROM maintenance_windows ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list maintenance windows: %w", err)
+	}
+	defer rows.Close()
+
+	var windows []config.MaintenanceWindow
+	for rows.Next() {
+		window, err := scanMaintenanceWindow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance window: %w", err)
+		}
+		windows = append(windows, *window)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over maintenance windows: %w", err)
+	}
+
+	return windows, nil
+}
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMaintenanceWindow(row rowScanner) (*config.MaintenanceWindow, error) {
+	var window config.MaintenanceWindow
+	err := row.Scan(&window.ID, &window.Gateway, pq.Array(&window.Countries), &window.Start, &window.End, &window.Recurrence, &window.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(window.Countries) == 0 {
+		window.Countries = nil
+	}
+	window.Start = window.Start.UTC()
+	window.End = window.End.UTC()
+
+	return &window, nil
+}
+
+func (r *MaintenanceWindowRepo) SyncConfig(ctx context.Context, windows []config.MaintenanceWindow) error {
+	return withTx(ctx, r.db, func(tx querier) error {
+		// Instances starting together sync one after the other
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE maintenance_windows IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return fmt.Errorf("failed to lock maintenance windows: %w", err)
+		}
+
+		stored, err := listMaintenanceWindows(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		sources := repository.SyncMaintenanceSources(stored, windows)
+		for id, source := range sources.Sources {
+			if _, err := tx.ExecContext(ctx, `UPDATE maintenance_windows SET source = $1 WHERE id = $2`, source, id); err != nil {
+				return fmt.Errorf("failed to update maintenance window: %w", err)
+			}
+		}
+		if len(sources.Deleted) > 0 {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM maintenance_windows WHERE id = ANY($1)`, pq.Array(sources.Deleted)); err != nil {
+				return fmt.Errorf("failed to delete maintenance windows: %w", err)
+			}
+		}
+		for i := range sources.Created {
+			if err := createMaintenanceWindow(ctx, tx, &sources.Created[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
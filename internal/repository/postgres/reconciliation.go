@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"time"
+)
+
+type ReconciliationRepo struct {
+	db *sql.DB
+}
+
+func NewReconciliationRepo(db *sql.DB) repository.Reconciliation {
+	return &ReconciliationRepo{
+		db: db,
+	}
+}
+
+func (r *ReconciliationRepo) Create(ctx context.Context, run *models.ReconciliationRun) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	run.CreatedAt = time.Now()
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO reconciliation_runs (gateway, source, period_start, period_end, records, matched, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		run.Gateway,
+		run.Source,
+		run.PeriodStart,
+		run.PeriodEnd,
+		run.Records,
+		run.Matched,
+		run.CreatedAt,
+	).Scan(&run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create reconciliation run: %w", err)
+	}
+
+	for i := range run.Discrepancies {
+		item := &run.Discrepancies[i]
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO reconciliation_items (run_id, kind, gateway_reference, transaction_id, expected_amount, settled_amount,
+				expected_currency, settled_currency, expected_status, settled_status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id`,
+			run.ID,
+			item.Kind,
+			item.GatewayReference,
+			item.TransactionID,
+			item.ExpectedAmount,
+			item.SettledAmount,
+			item.ExpectedCurrency,
+			item.SettledCurrency,
+			item.ExpectedStatus,
+			item.SettledStatus,
+		).Scan(&item.ID)
+		if err != nil {
+			return fmt.Errorf("failed to create reconciliation item: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit reconciliation run: %w", err)
+	}
+
+	return nil
+}
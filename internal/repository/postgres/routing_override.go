@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"time"
+)
+
+type RoutingOverrideRepo struct {
+	db *sql.DB
+}
+
+func NewRoutingOverrideRepo(db *sql.DB) repository.RoutingOverride {
+	return &RoutingOverrideRepo{
+		db: db,
+	}
+}
+
+const routingOverrideColumns = `id, user_id, merchant_id, country_code, currency, transaction_type, gateway, reason, expires_at, created_at`
+
+func (r *RoutingOverrideRepo) Create(ctx context.Context, override *models.RoutingOverride) error {
+	query := `INSERT INTO routing_overrides (user_id, merchant_id, country_code, currency, transaction_type, gateway, reason, expires_at, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id`
+
+	override.CreatedAt = time.Now()
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		override.UserID,
+		override.MerchantID,
+		override.CountryCode,
+		override.Currency,
+		override.TransactionType,
+		override.Gateway,
+		override.Reason,
+		override.ExpiresAt,
+		override.CreatedAt,
+	).Scan(&override.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create routing override: %w", constraintError(err))
+	}
+
+	return nil
+}
+
+func (r *RoutingOverrideRepo) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM routing_overrides WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete routing override: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return &repository.NotFoundError{Entity: "routing override", Key: "ID", Value: id}
+	}
+
+	return nil
+}
+
+func (r *RoutingOverrideRepo) List(ctx context.Context) ([]models.RoutingOverride, error) {
+	query := `SELECT ` + routingOverrideColumns + ` FROM routing_overrides ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routing overrides: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRoutingOverrides(rows)
+}
+
+func (r *RoutingOverrideRepo) FindActive(ctx context.Context, userID int, merchantID string, at time.Time) ([]models.RoutingOverride, error) {
+	query := `SELECT ` + routingOverrideColumns + ` FROM routing_overrides
+	WHERE (user_id = $1 OR ($2 <> '' AND merchant_id = $2))
+	AND (expires_at IS NULL OR expires_at > $3)
+	ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, merchantID, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find routing overrides: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRoutingOverrides(rows)
+}
+
+func scanRoutingOverrides(rows *sql.Rows) ([]models.RoutingOverride, error) {
+	var overrides []models.RoutingOverride
+	for rows.Next() {
+		var override models.RoutingOverride
+		var userID sql.NullInt64
+		var expiresAt sql.NullTime
+
+		if err := rows.Scan(
+			&override.ID,
+			&userID,
+			&override.MerchantID,
+			&override.CountryCode,
+			&override.Currency,
+			&override.TransactionType,
+			&override.Gateway,
+			&override.Reason,
+			&expiresAt,
+			&override.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan routing override: %w", err)
+		}
+
+		if userID.Valid {
+			id := int(userID.Int64)
+			override.UserID = &id
+		}
+		if expiresAt.Valid {
+			override.ExpiresAt = &expiresAt.Time
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over routing overrides: %w", err)
+	}
+
+	return overrides, nil
+}
@@ -8,10 +8,12 @@ import (
 	"payment-gateway/internal/models"
 	"payment-gateway/internal/repository"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type TransactionRepo struct {
-	db *sql.DB
+	db querier
 }
 
 func NewTransactionRepo(db *sql.DB) repository.Transaction {
@@ -22,8 +24,8 @@ func NewTransactionRepo(db *sql.DB) repository.Transaction {
 
 func (r *TransactionRepo) Create(ctx context.Context, transaction *models.Transaction) error {
 
-	query := ` INSERT INTO transactions (amount, type, status, gateway_id, country_id, user_id, created_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	query := ` INSERT INTO transactions (amount, currency, fee, type, status, gateway_id, country_id, user_id, parent_id, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	RETURNING id
 	`
 
@@ -31,43 +33,219 @@ func (r *TransactionRepo) Create(ctx context.Context, transaction *models.Transa
 		ctx,
 		query,
 		transaction.Amount,
+		transaction.Currency,
+		transaction.Fee,
 		transaction.Type,
 		transaction.Status,
 		transaction.GatewayID,
 		transaction.CountryID,
 		transaction.UserID,
+		transaction.ParentID,
 		time.Now(),
 	).Scan(&transaction.ID)
 
 	if err != nil {
-		return fmt.Errorf("failed to create transaction: %w", err)
+		return fmt.Errorf("failed to create transaction: %w", constraintError(err))
 	}
 
 	return nil
 }
 
+func (r *TransactionRepo) CreateChild(ctx context.Context, child *models.Transaction) error {
+	if child.ParentID == nil {
+		return fmt.Errorf("%s has no parent transaction", child.Type)
+	}
+
+	return withTx(ctx, r.db, func(tx querier) error {
+		// Locking the parent serialises concurrent refunds or captures of the same transaction
+		var amount float64
+		err := tx.QueryRowContext(ctx, `SELECT amount FROM transactions WHERE id = $1 FOR UPDATE`, *child.ParentID).Scan(&amount)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return &repository.NotFoundError{Entity: "transaction", Key: "ID", Value: *child.ParentID}
+			}
+			return fmt.Errorf("failed to lock transaction: %w", err)
+		}
+
+		var used float64
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(amount), 0) FROM transactions
+			WHERE parent_id = $1 AND type = $2 AND status <> ALL($3)`,
+			*child.ParentID,
+			child.Type,
+			pq.Array(repository.FailedChildStatuses),
+		).Scan(&used)
+		if err != nil {
+			return fmt.Errorf("failed to sum %ss: %w", child.Type, err)
+		}
+
+		if remaining := amount - used; child.Amount > remaining+0.005 {
+			return fmt.Errorf("%w: %.2f requested, %.2f left", repository.ErrAmountLimitExceeded, child.Amount, remaining)
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO transactions (amount, currency, fee, type, status, gateway_id, country_id, user_id, parent_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id`,
+			child.Amount,
+			child.Currency,
+			child.Fee,
+			child.Type,
+			child.Status,
+			child.GatewayID,
+			child.CountryID,
+			child.UserID,
+			child.ParentID,
+			time.Now(),
+		).Scan(&child.ID)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", child.Type, constraintError(err))
+		}
+
+		return nil
+	})
+}
+
+func (r *TransactionRepo) ChildrenAmount(ctx context.Context, id int, childType string) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(amount), 0) FROM transactions
+		WHERE parent_id = $1 AND type = $2 AND status <> ALL($3)`
+
+	var amount float64
+	if err := r.db.QueryRowContext(ctx, query, id, childType, pq.Array(repository.FailedChildStatuses)).Scan(&amount); err != nil {
+		return 0, fmt.Errorf("failed to sum %ss: %w", childType, err)
+	}
+
+	return amount, nil
+}
+
+func (r *TransactionRepo) CompletedChildrenAmount(ctx context.Context, id int, childType string) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(amount), 0) FROM transactions
+		WHERE parent_id = $1 AND type = $2 AND status = 'COMPLETED'`
+
+	var amount float64
+	if err := r.db.QueryRowContext(ctx, query, id, childType).Scan(&amount); err != nil {
+		return 0, fmt.Errorf("failed to sum completed %ss: %w", childType, err)
+	}
+
+	return amount, nil
+}
+
+func (r *TransactionRepo) ListByStatus(ctx context.Context, transactionType, status string, createdBefore time.Time) ([]models.Transaction, error) {
+	return r.list(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions
+		WHERE type = $1 AND status = $2 AND created_at < $3
+		ORDER BY created_at
+	`, transactionType, status, createdBefore)
+}
+
+func (r *TransactionRepo) ListByStatuses(ctx context.Context, statuses []string, createdBefore time.Time, afterID, limit int) ([]models.Transaction, error) {
+	return r.list(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions
+		WHERE status = ANY($1) AND created_at < $2 AND id > $3
+		ORDER BY id
+		LIMIT $4
+	`, pq.Array(statuses), createdBefore, afterID, limit)
+}
+
+func (r *TransactionRepo) ListByGateway(ctx context.Context, gatewayID int, from, to time.Time) ([]models.Transaction, error) {
+	return r.list(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions
+		WHERE gateway_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at
+	`, gatewayID, from, to)
+}
+
+func (r *TransactionRepo) ListByGatewayReferences(ctx context.Context, gatewayID int, references []string) ([]models.Transaction, error) {
+	if len(references) == 0 {
+		return nil, nil
+	}
+
+	return r.list(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions
+		WHERE gateway_id = $1 AND gateway_reference = ANY($2)
+		ORDER BY created_at
+	`, gatewayID, pq.Array(references))
+}
+
+const transactionColumns = `id, amount, currency, fee, type, status, user_id, gateway_id, country_id, gateway_reference, parent_id, created_at`
+
+func (r *TransactionRepo) list(ctx context.Context, query string, args ...interface{}) ([]models.Transaction, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		var transaction models.Transaction
+		if err := rows.Scan(
+			&transaction.ID,
+			&transaction.Amount,
+			&transaction.Currency,
+			&transaction.Fee,
+			&transaction.Type,
+			&transaction.Status,
+			&transaction.UserID,
+			&transaction.GatewayID,
+			&transaction.CountryID,
+			&transaction.GatewayReference,
+			&transaction.ParentID,
+			&transaction.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
 func (r *TransactionRepo) GetByID(ctx context.Context, id int) (*models.Transaction, error) {
+	return r.get(ctx, id, "")
+}
+
+func (r *TransactionRepo) GetByIDForUpdate(ctx context.Context, id int) (*models.Transaction, error) {
+	return r.get(ctx, id, "FOR UPDATE")
+}
+
+// get reads a transaction, the lock clause is appended to the query
+func (r *TransactionRepo) get(ctx context.Context, id int, lock string) (*models.Transaction, error) {
 	query := `
-		SELECT id, amount, type, status, user_id, gateway_id, country_id, created_at 
+		SELECT id, amount, currency, fee, type, status, user_id, gateway_id, country_id, gateway_reference, parent_id, created_at 
 		FROM transactions 
 		WHERE id = $1
-	`
+	` + lock
 
 	var transaction models.Transaction
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&transaction.ID,
 		&transaction.Amount,
+		&transaction.Currency,
+		&transaction.Fee,
 		&transaction.Type,
 		&transaction.Status,
 		&transaction.UserID,
 		&transaction.GatewayID,
 		&transaction.CountryID,
+		&transaction.GatewayReference,
+		&transaction.ParentID,
 		&transaction.CreatedAt,
 	)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("transaction with ID %d not found", id)
+			return nil, &repository.NotFoundError{Entity: "transaction", Key: "ID", Value: id}
 		}
 		return nil, fmt.Errorf("failed to get transaction: %w", err)
 	}
@@ -89,7 +267,27 @@ func (r *TransactionRepo) UpdateStatus(ctx context.Context, id int, status strin
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("transaction with ID %d not found", id)
+		return &repository.NotFoundError{Entity: "transaction", Key: "ID", Value: id}
+	}
+
+	return nil
+}
+
+func (r *TransactionRepo) SetGatewayReference(ctx context.Context, id int, reference string) error {
+	query := `UPDATE transactions SET gateway_reference = $1 WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, reference, id)
+	if err != nil {
+		return fmt.Errorf("failed to update gateway reference: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return &repository.NotFoundError{Entity: "transaction", Key: "ID", Value: id}
 	}
 
 	return nil
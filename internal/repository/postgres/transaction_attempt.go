@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"time"
+)
+
+type TransactionAttemptRepo struct {
+	db *sql.DB
+}
+
+func NewTransactionAttemptRepo(db *sql.DB) repository.TransactionAttempt {
+	return &TransactionAttemptRepo{
+		db: db,
+	}
+}
+
+func (r *TransactionAttemptRepo) Create(ctx context.Context, attempt *models.TransactionAttempt) error {
+	query := `INSERT INTO transaction_attempts (transaction_id, gateway, request_payload, response_status, response_body, latency_ms, gateway_reference, error, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id`
+
+	attempt.CreatedAt = time.Now()
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		attempt.TransactionID,
+		attempt.Gateway,
+		attempt.RequestPayload,
+		attempt.ResponseStatus,
+		attempt.ResponseBody,
+		attempt.LatencyMs,
+		attempt.GatewayReference,
+		attempt.Error,
+		attempt.CreatedAt,
+	).Scan(&attempt.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create transaction attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TransactionAttemptRepo) ListByTransaction(ctx context.Context, transactionID int) ([]models.TransactionAttempt, error) {
+	query := `
+		SELECT id, transaction_id, gateway, request_payload, response_status, response_body, latency_ms, gateway_reference, error, created_at
+		FROM transaction_attempts
+		WHERE transaction_id = $1
+		ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transaction attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []models.TransactionAttempt
+	for rows.Next() {
+		var attempt models.TransactionAttempt
+		if err := rows.Scan(
+			&attempt.ID,
+			&attempt.TransactionID,
+			&attempt.Gateway,
+			&attempt.RequestPayload,
+			&attempt.ResponseStatus,
+			&attempt.ResponseBody,
+			&attempt.LatencyMs,
+			&attempt.GatewayReference,
+			&attempt.Error,
+			&attempt.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction attempt: %w", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over transaction attempts: %w", err)
+	}
+
+	return attempts, nil
+}
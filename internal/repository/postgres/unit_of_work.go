@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"payment-gateway/internal/repository"
+)
+
+// querier runs the statements of a repository, on the database or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// withTx calls fn in a new transaction, or in the transaction of the unit of work q already is
+func withTx(ctx context.Context, q querier, fn func(tx querier) error) error {
+	db, ok := q.(*sql.DB)
+	if !ok {
+		return fn(q)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+type UnitOfWork struct {
+	db *sql.DB
+}
+
+func NewUnitOfWork(db *sql.DB) repository.UnitOfWork {
+	return &UnitOfWork{
+		db: db,
+	}
+}
+
+func (u *UnitOfWork) Do(ctx context.Context, fn func(repos repository.Repositories) error) error {
+	return withTx(ctx, u.db, func(tx querier) error {
+		return fn(repository.Repositories{
+			Transactions: &TransactionRepo{db: tx},
+			Gateways:     &GatewayRepo{db: tx},
+			Countries:    &CountryRepo{db: tx},
+			Users:        &UserRepo{db: tx},
+			Ledger:       &LedgerRepo{db: tx},
+		})
+	})
+}
@@ -9,7 +9,7 @@ import (
 )
 
 type UserRepo struct {
-	db *sql.DB
+	db querier
 }
 
 func NewUserRepo(db *sql.DB) repository.User {
@@ -19,7 +19,8 @@ func NewUserRepo(db *sql.DB) repository.User {
 }
 
 func (r *UserRepo) FindByID(ctx context.Context, id int) (*models.User, error) {
-	query := `SELECT id, username, email, country_id FROM users WHERE id = $1`
+	// Users may have no country yet
+	query := `SELECT id, username, email, COALESCE(country_id, 0), created_at, updated_at FROM users WHERE id = $1`
 
 	var user models.User
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
@@ -32,7 +33,7 @@ func (r *UserRepo) FindByID(ctx context.Context, id int) (*models.User, error) {
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user with ID %d not found", id)
+		return nil, &repository.NotFoundError{Entity: "user", Key: "ID", Value: id}
 	}
 
 	if err != nil {
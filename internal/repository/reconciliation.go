@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+	"payment-gateway/internal/models"
+)
+
+type Reconciliation interface {
+	// Create stores a reconciliation run along with its discrepancies
+	Create(ctx context.Context, run *models.ReconciliationRun) error
+}
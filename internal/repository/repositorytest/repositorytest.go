@@ -0,0 +1,870 @@
+// Package repositorytest holds the conformance tests every implementation of the repositories
+// must pass, so that the in-memory repositories can stand in for the Postgres ones.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Repos are the repositories under test. The gateway, country and user repositories are read
+// only, so the implementation also tells how to add the rows they return.
+type Repos struct {
+	Transactions repository.Transaction
+	Gateways     repository.Gateway
+	Countries    repository.Country
+	Users        repository.User
+	Ledger       repository.Ledger
+	UnitOfWork   repository.UnitOfWork
+
+	MaintenanceWindows repository.MaintenanceWindow
+
+	AddGateway func(ctx context.Context, gateway *models.Gateway) error
+	AddCountry func(ctx context.Context, country *models.Country) error
+	AddUser    func(ctx context.Context, user *models.User) error
+}
+
+// Run runs the conformance tests, each against the empty repositories newRepos returns
+func Run(t *testing.T, newRepos func(t *testing.T) Repos) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repos Repos)
+	}{
+		{"Gateways", testGateways},
+		{"Countries", testCountries},
+		{"Users", testUsers},
+		{"Transaction Create And Get", testTransactionCreate},
+		{"Transaction Updates", testTransactionUpdates},
+		{"Transaction Children", testTransactionChildren},
+		{"Concurrent Children", testConcurrentChildren},
+		{"Transaction Lists", testTransactionLists},
+		{"Maintenance Windows", testMaintenanceWindows},
+		{"Ledger", testLedger},
+		{"Ledger In Unit Of Work", testLedgerInUnitOfWork},
+		{"Concurrent Reservations", testConcurrentReservations},
+		{"Unit Of Work", testUnitOfWork},
+		{"Concurrent Units Of Work", testConcurrentUnitsOfWork},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepos(t))
+		})
+	}
+}
+
+func testGateways(t *testing.T, repos Repos) {
+	ctx := context.Background()
+
+	gateway := &models.Gateway{Name: "stripe", DataFormatSupported: "application/json"}
+	if err := repos.AddGateway(ctx, gateway); err != nil {
+		t.Fatalf("failed to add gateway: %v", err)
+	}
+	if err := repos.AddGateway(ctx, &models.Gateway{Name: "stripe", DataFormatSupported: "text/xml"}); err == nil {
+		t.Error("Expected a second gateway of the same name to be rejected")
+	}
+
+	found, err := repos.Gateways.FindByID(ctx, gateway.ID)
+	if err != nil {
+		t.Fatalf("failed to find gateway by ID: %v", err)
+	}
+	if found.Name != "stripe" || found.DataFormatSupported != "application/json" || found.CreatedAt.IsZero() {
+		t.Errorf("Unexpected gateway: %+v", found)
+	}
+
+	found, err = repos.Gateways.FindByName(ctx, "stripe")
+	if err != nil {
+		t.Fatalf("failed to find gateway by name: %v", err)
+	}
+	if found.ID != gateway.ID {
+		t.Errorf("Expected gateway %d, got %d", gateway.ID, found.ID)
+	}
+
+	if _, err := repos.Gateways.FindByID(ctx, gateway.ID+1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing gateway ID, got: %v", err)
+	}
+	if _, err := repos.Gateways.FindByName(ctx, "paypal"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing gateway name, got: %v", err)
+	}
+}
+
+func testCountries(t *testing.T, repos Repos) {
+	ctx := context.Background()
+
+	country := &models.Country{Name: "France", Code: "FR", Currency: "EUR"}
+	if err := repos.AddCountry(ctx, country); err != nil {
+		t.Fatalf("failed to add country: %v", err)
+	}
+	if err := repos.AddCountry(ctx, &models.Country{Name: "Francia", Code: "FR", Currency: "EUR"}); err == nil {
+		t.Error("Expected a second country of the same code to be rejected")
+	}
+
+	found, err := repos.Countries.FindByID(ctx, country.ID)
+	if err != nil {
+		t.Fatalf("failed to find country: %v", err)
+	}
+	if found.Name != "France" || found.Code != "FR" || found.Currency != "EUR" || found.CreatedAt.IsZero() {
+		t.Errorf("Unexpected country: %+v", found)
+	}
+
+	if _, err := repos.Countries.FindByID(ctx, country.ID+1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing country, got: %v", err)
+	}
+}
+
+func testUsers(t *testing.T, repos Repos) {
+	ctx := context.Background()
+
+	country := &models.Country{Name: "France", Code: "FR", Currency: "EUR"}
+	if err := repos.AddCountry(ctx, country); err != nil {
+		t.Fatalf("failed to add country: %v", err)
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", CountryID: country.ID}
+	if err := repos.AddUser(ctx, user); err != nil {
+		t.Fatalf("failed to add user: %v", err)
+	}
+	if err := repos.AddUser(ctx, &models.User{Username: "alice", Email: "other@example.com"}); err == nil {
+		t.Error("Expected a second user of the same username to be rejected")
+	}
+
+	found, err := repos.Users.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to find user: %v", err)
+	}
+	if found.Username != "alice" || found.Email != "alice@example.com" || found.CountryID != country.ID || found.CreatedAt.IsZero() {
+		t.Errorf("Unexpected user: %+v", found)
+	}
+
+	// Users may have no country yet
+	homeless := &models.User{Username: "bob", Email: "bob@example.com"}
+	if err := repos.AddUser(ctx, homeless); err != nil {
+		t.Fatalf("failed to add user: %v", err)
+	}
+	if found, err := repos.Users.FindByID(ctx, homeless.ID); err != nil || found.CountryID != 0 {
+		t.Errorf("Expected a user without country, got %+v and %v", found, err)
+	}
+
+	if _, err := repos.Users.FindByID(ctx, homeless.ID+1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing user, got: %v", err)
+	}
+}
+
+// fixtures are the rows transactions refer to
+type fixtures struct {
+	gatewayID      int
+	otherGatewayID int
+	countryID      int
+	userID         int
+}
+
+func addFixtures(t *testing.T, repos Repos) fixtures {
+	t.Helper()
+	ctx := context.Background()
+
+	gateway := &models.Gateway{Name: "stripe", DataFormatSupported: "application/json"}
+	otherGateway := &models.Gateway{Name: "paypal", DataFormatSupported: "application/json"}
+	country := &models.Country{Name: "France", Code: "FR", Currency: "EUR"}
+	for _, err := range []error{
+		repos.AddGateway(ctx, gateway),
+		repos.AddGateway(ctx, otherGateway),
+		repos.AddCountry(ctx, country),
+	} {
+		if err != nil {
+			t.Fatalf("failed to add fixtures: %v", err)
+		}
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", CountryID: country.ID}
+	if err := repos.AddUser(ctx, user); err != nil {
+		t.Fatalf("failed to add user: %v", err)
+	}
+
+	return fixtures{
+		gatewayID:      gateway.ID,
+		otherGatewayID: otherGateway.ID,
+		countryID:      country.ID,
+		userID:         user.ID,
+	}
+}
+
+func (f fixtures) transaction(transactionType, status string, amount float64) *models.Transaction {
+	return &models.Transaction{
+		Amount:    amount,
+		Currency:  "EUR",
+		Type:      transactionType,
+		Status:    status,
+		GatewayID: f.gatewayID,
+		CountryID: f.countryID,
+		UserID:    f.userID,
+	}
+}
+
+func create(t *testing.T, repos Repos, transaction *models.Transaction) *models.Transaction {
+	t.Helper()
+
+	if err := repos.Transactions.Create(context.Background(), transaction); err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	return transaction
+}
+
+func testTransactionCreate(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	first := create(t, repos, f.transaction("deposit", "PENDING", 100.25))
+	second := create(t, repos, f.transaction("deposit", "PENDING", 50))
+	if first.ID <= 0 || second.ID <= 0 || first.ID == second.ID {
+		t.Fatalf("Expected distinct IDs, got %d and %d", first.ID, second.ID)
+	}
+
+	found, err := repos.Transactions.GetByID(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if found.Amount != 100.25 || found.Currency != "EUR" || found.Type != "deposit" || found.Status != "PENDING" ||
+		found.GatewayID != f.gatewayID || found.CountryID != f.countryID || found.UserID != f.userID ||
+		found.ParentID != nil || found.GatewayReference != "" || found.CreatedAt.IsZero() {
+		t.Errorf("Unexpected transaction: %+v", found)
+	}
+
+	// What is returned is a copy
+	found.Status = "COMPLETED"
+	if again, _ := repos.Transactions.GetByID(ctx, first.ID); again.Status != "PENDING" {
+		t.Errorf("Expected the stored transaction to be unchanged, got %s", again.Status)
+	}
+
+	if _, err := repos.Transactions.GetByID(ctx, second.ID+1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing transaction, got: %v", err)
+	}
+}
+
+func testTransactionUpdates(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	transaction := create(t, repos, f.transaction("deposit", "PENDING", 100))
+
+	if err := repos.Transactions.UpdateStatus(ctx, transaction.ID, "PROCESSING"); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	if err := repos.Transactions.SetGatewayReference(ctx, transaction.ID, "ch_1"); err != nil {
+		t.Fatalf("failed to set gateway reference: %v", err)
+	}
+
+	found, err := repos.Transactions.GetByID(ctx, transaction.ID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if found.Status != "PROCESSING" || found.GatewayReference != "ch_1" {
+		t.Errorf("Expected PROCESSING with reference ch_1, got %s with %q", found.Status, found.GatewayReference)
+	}
+
+	if err := repos.Transactions.UpdateStatus(ctx, transaction.ID+1, "FAILED"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound updating a missing transaction, got: %v", err)
+	}
+	if err := repos.Transactions.SetGatewayReference(ctx, transaction.ID+1, "ch_2"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound setting the reference of a missing transaction, got: %v", err)
+	}
+}
+
+func child(f fixtures, parentID int, transactionType string, amount float64) *models.Transaction {
+	transaction := f.transaction(transactionType, "PENDING", amount)
+	transaction.ParentID = &parentID
+	return transaction
+}
+
+func testTransactionChildren(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	deposit := create(t, repos, f.transaction("deposit", "COMPLETED", 100))
+
+	refund := child(f, deposit.ID, "refund", 60)
+	if err := repos.Transactions.CreateChild(ctx, refund); err != nil {
+		t.Fatalf("failed to create refund: %v", err)
+	}
+	if found, err := repos.Transactions.GetByID(ctx, refund.ID); err != nil || found.ParentID == nil || *found.ParentID != deposit.ID {
+		t.Errorf("Expected the refund of transaction %d, got %+v and %v", deposit.ID, found, err)
+	}
+
+	err := repos.Transactions.CreateChild(ctx, child(f, deposit.ID, "refund", 40.01))
+	if !errors.Is(err, repository.ErrAmountLimitExceeded) {
+		t.Errorf("Expected ErrAmountLimitExceeded, got: %v", err)
+	}
+
+	// Failed refunds give their amount back, other types of children don't count
+	if err := repos.Transactions.UpdateStatus(ctx, refund.ID, "FAILED"); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	for _, c := range []*models.Transaction{child(f, deposit.ID, "refund", 70), child(f, deposit.ID, "capture", 100)} {
+		if err := repos.Transactions.CreateChild(ctx, c); err != nil {
+			t.Errorf("failed to create %s: %v", c.Type, err)
+		}
+	}
+
+	refunded, err := repos.Transactions.ChildrenAmount(ctx, deposit.ID, "refund")
+	if err != nil || refunded != 70 {
+		t.Errorf("Expected 70 refunded, got %v and %v", refunded, err)
+	}
+	if amount, err := repos.Transactions.ChildrenAmount(ctx, refund.ID, "refund"); err != nil || amount != 0 {
+		t.Errorf("Expected nothing refunded, got %v and %v", amount, err)
+	}
+
+	// Neither do the children in any other status that didn't go through
+	authorization := create(t, repos, f.transaction("authorization", "AUTHORIZED", 100))
+	for _, status := range repository.FailedChildStatuses {
+		capture := child(f, authorization.ID, "capture", 100)
+		if err := repos.Transactions.CreateChild(ctx, capture); err != nil {
+			t.Fatalf("failed to create capture after a %s one: %v", status, err)
+		}
+		if err := repos.Transactions.UpdateStatus(ctx, capture.ID, status); err != nil {
+			t.Fatalf("failed to update status: %v", err)
+		}
+	}
+	if captured, err := repos.Transactions.ChildrenAmount(ctx, authorization.ID, "capture"); err != nil || captured != 0 {
+		t.Errorf("Expected nothing captured, got %v and %v", captured, err)
+	}
+
+	// Only the completed children count as settled
+	for _, status := range []string{"PENDING", "COMPLETED"} {
+		capture := child(f, authorization.ID, "capture", 40)
+		if err := repos.Transactions.CreateChild(ctx, capture); err != nil {
+			t.Fatalf("failed to create capture: %v", err)
+		}
+		if err := repos.Transactions.UpdateStatus(ctx, capture.ID, status); err != nil {
+			t.Fatalf("failed to update status: %v", err)
+		}
+	}
+	if completed, err := repos.Transactions.CompletedChildrenAmount(ctx, authorization.ID, "capture"); err != nil || completed != 40 {
+		t.Errorf("Expected 40 captured, got %v and %v", completed, err)
+	}
+
+	if err := repos.Transactions.CreateChild(ctx, child(f, refund.ID+100, "refund", 1)); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing parent, got: %v", err)
+	}
+	if err := repos.Transactions.CreateChild(ctx, f.transaction("refund", "PENDING", 1)); err == nil {
+		t.Error("Expected an error for a child without parent")
+	}
+}
+
+func testConcurrentChildren(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	deposit := create(t, repos, f.transaction("deposit", "COMPLETED", 100))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		created  int
+		rejected int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repos.Transactions.CreateChild(ctx, child(f, deposit.ID, "refund", 30))
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, repository.ErrAmountLimitExceeded):
+				rejected++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 3 || rejected != 7 {
+		t.Errorf("Expected 3 refunds created and 7 rejected, got %d and %d", created, rejected)
+	}
+}
+
+func ids(transactions []models.Transaction) string {
+	ids := make([]int, len(transactions))
+	for i, transaction := range transactions {
+		ids[i] = transaction.ID
+	}
+	return fmt.Sprint(ids)
+}
+
+func testTransactionLists(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	pending := create(t, repos, f.transaction("deposit", "PENDING", 10))
+	processing := create(t, repos, f.transaction("deposit", "PROCESSING", 20))
+	withdrawal := create(t, repos, f.transaction("withdrawal", "PENDING", 30))
+	other := f.transaction("deposit", "PENDING", 40)
+	other.GatewayID = f.otherGatewayID
+	other = create(t, repos, other)
+
+	for _, reference := range []struct {
+		id        int
+		reference string
+	}{{pending.ID, "ch_1"}, {processing.ID, "ch_2"}, {other.ID, "ch_1"}} {
+		if err := repos.Transactions.SetGatewayReference(ctx, reference.id, reference.reference); err != nil {
+			t.Fatalf("failed to set gateway reference: %v", err)
+		}
+	}
+
+	// The database may not share the clock or time zone of the tests, so the bounds are wide
+	later := time.Now().Add(24 * time.Hour)
+	earlier := time.Now().Add(-24 * time.Hour)
+
+	check := func(name string, transactions []models.Transaction, err error, expected ...*models.Transaction) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			return
+		}
+		want := make([]models.Transaction, len(expected))
+		for i, transaction := range expected {
+			want[i] = *transaction
+		}
+		if ids(transactions) != ids(want) {
+			t.Errorf("%s: expected transactions %s, got %s", name, ids(want), ids(transactions))
+		}
+	}
+
+	listed, err := repos.Transactions.ListByStatus(ctx, "deposit", "PENDING", later)
+	check("ListByStatus", listed, err, pending, other)
+	listed, err = repos.Transactions.ListByStatus(ctx, "deposit", "PENDING", earlier)
+	check("ListByStatus created before", listed, err)
+
+	listed, err = repos.Transactions.ListByStatuses(ctx, []string{"PENDING", "PROCESSING"}, later, 0, 10)
+	check("ListByStatuses", listed, err, pending, processing, withdrawal, other)
+	listed, err = repos.Transactions.ListByStatuses(ctx, []string{"PROCESSING"}, later, 0, 10)
+	check("ListByStatuses one status", listed, err, processing)
+	listed, err = repos.Transactions.ListByStatuses(ctx, []string{"PENDING", "PROCESSING"}, later, 0, 2)
+	check("ListByStatuses first page", listed, err, pending, processing)
+	listed, err = repos.Transactions.ListByStatuses(ctx, []string{"PENDING", "PROCESSING"}, later, processing.ID, 2)
+	check("ListByStatuses next page", listed, err, withdrawal, other)
+	listed, err = repos.Transactions.ListByStatuses(ctx, []string{"PENDING", "PROCESSING"}, earlier, 0, 10)
+	check("ListByStatuses created before", listed, err)
+
+	listed, err = repos.Transactions.ListByGateway(ctx, f.gatewayID, earlier, later)
+	check("ListByGateway", listed, err, pending, processing, withdrawal)
+	listed, err = repos.Transactions.ListByGateway(ctx, f.gatewayID, later, later.Add(time.Hour))
+	check("ListByGateway outside the period", listed, err)
+
+	listed, err = repos.Transactions.ListByGatewayReferences(ctx, f.gatewayID, []string{"ch_1", "ch_3"})
+	check("ListByGatewayReferences", listed, err, pending)
+	listed, err = repos.Transactions.ListByGatewayReferences(ctx, f.gatewayID, nil)
+	check("ListByGatewayReferences without references", listed, err)
+}
+
+func testMaintenanceWindows(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	start := time.Date(2025, 3, 9, 2, 0, 0, 0, time.FixedZone("CET", 3600))
+
+	list := func() []config.MaintenanceWindow {
+		t.Helper()
+		windows, err := repos.MaintenanceWindows.List(ctx)
+		if err != nil {
+			t.Fatalf("failed to list maintenance windows: %v", err)
+		}
+		return windows
+	}
+
+	configured := []config.MaintenanceWindow{
+		{Gateway: "stripe", Start: start, End: start.Add(2 * time.Hour), Recurrence: "weekly"},
+		{Gateway: "paypal", Countries: []string{"DE", "FR"}, Start: start, End: start.Add(time.Hour)},
+	}
+	if err := repos.MaintenanceWindows.SyncConfig(ctx, configured); err != nil {
+		t.Fatalf("failed to sync maintenance windows: %v", err)
+	}
+	synced := list()
+	if len(synced) != 2 || synced[0].Source != config.MaintenanceSourceConfig || synced[1].Source != config.MaintenanceSourceConfig {
+		t.Fatalf("Expected the configured windows stored, got %+v", synced)
+	}
+
+	// Syncing the same windows again, as the next instance to start does, changes nothing
+	if err := repos.MaintenanceWindows.SyncConfig(ctx, configured); err != nil {
+		t.Fatalf("failed to sync maintenance windows again: %v", err)
+	}
+	if again := list(); fmt.Sprint(again) != fmt.Sprint(synced) {
+		t.Errorf("Expected %+v after syncing again, got %+v", synced, again)
+	}
+
+	added := &config.MaintenanceWindow{Gateway: "adyen", Start: start, End: start.Add(time.Hour)}
+	if err := repos.MaintenanceWindows.Create(ctx, added); err != nil {
+		t.Fatalf("failed to create maintenance window: %v", err)
+	}
+	found, err := repos.MaintenanceWindows.FindByID(ctx, added.ID)
+	if err != nil || found.Gateway != "adyen" || found.Source != config.MaintenanceSourceAdmin {
+		t.Errorf("Expected the added window from the admin API, got %+v and %v", found, err)
+	}
+	if _, err := repos.MaintenanceWindows.FindByID(ctx, added.ID+100); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound finding a missing window, got: %v", err)
+	}
+
+	// The stripe window is removed from the configuration and a daily one added, the window
+	// added through the admin API stays
+	daily := config.MaintenanceWindow{Gateway: "stripe", Start: start, End: start.Add(time.Hour), Recurrence: "daily"}
+	if err := repos.MaintenanceWindows.SyncConfig(ctx, []config.MaintenanceWindow{configured[1], daily}); err != nil {
+		t.Fatalf("failed to sync changed maintenance windows: %v", err)
+	}
+	windows := list()
+	if len(windows) != 3 || windows[0].ID != synced[1].ID || windows[1].ID != added.ID || windows[2].Recurrence != "daily" || windows[2].Source != config.MaintenanceSourceConfig {
+		t.Fatalf("Expected the paypal, the added and the daily window, got %+v", windows)
+	}
+
+	if err := repos.MaintenanceWindows.Delete(ctx, added.ID); err != nil {
+		t.Fatalf("failed to delete maintenance window: %v", err)
+	}
+	if err := repos.MaintenanceWindows.Delete(ctx, added.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting a missing window, got: %v", err)
+	}
+
+	paypal := list()[0]
+	if paypal.Gateway != "paypal" || fmt.Sprint(paypal.Countries) != "[DE FR]" || paypal.Recurrence != "" ||
+		!paypal.Start.Equal(start) || paypal.Start.Location() != time.UTC || !paypal.End.Equal(start.Add(time.Hour)) {
+		t.Errorf("Unexpected maintenance window: %+v", paypal)
+	}
+	if windows[1].Countries != nil {
+		t.Errorf("Expected a window for every country, got %v", windows[1].Countries)
+	}
+}
+
+// entry moves amount from the available account of the user to the settlement account
+func (f fixtures) entry(transactionID int, kind string, amount float64) *models.JournalEntry {
+	userID := f.userID
+	return &models.JournalEntry{
+		TransactionID: transactionID,
+		Kind:          kind,
+		Postings: []models.Posting{
+			{UserID: &userID, AccountType: "available", Currency: "EUR", Amount: -amount},
+			{AccountType: "settlement", Currency: "EUR", Amount: amount},
+		},
+	}
+}
+
+// available returns the balance of the user's available account
+func available(t *testing.T, repos Repos, f fixtures) float64 {
+	t.Helper()
+
+	accounts, err := repos.Ledger.ListAccounts(context.Background(), f.userID)
+	if err != nil {
+		t.Fatalf("failed to list ledger accounts: %v", err)
+	}
+	for _, account := range accounts {
+		if account.Type == "available" && account.Currency == "EUR" {
+			return account.Balance
+		}
+	}
+	return 0
+}
+
+func testLedger(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	deposit := create(t, repos, f.transaction("deposit", "COMPLETED", 100))
+	withdrawal := create(t, repos, f.transaction("withdrawal", "PENDING", 30))
+
+	credit := f.entry(deposit.ID, "deposit_completed", -100)
+	if err := repos.Ledger.Record(ctx, credit); err != nil {
+		t.Fatalf("failed to record entry: %v", err)
+	}
+	if credit.ID <= 0 || credit.CreatedAt.IsZero() {
+		t.Errorf("Expected the entry to get an ID and creation time, got %+v", credit)
+	}
+	// Recording it again does nothing
+	if err := repos.Ledger.Record(ctx, f.entry(deposit.ID, "deposit_completed", -100)); err != nil {
+		t.Fatalf("failed to record entry again: %v", err)
+	}
+	if balance := available(t, repos, f); balance != 100 {
+		t.Errorf("Expected 100 available, got %.2f", balance)
+	}
+
+	unbalanced := f.entry(withdrawal.ID, "unbalanced", 10)
+	unbalanced.Postings[1].Amount = 5
+	if err := repos.Ledger.Record(ctx, unbalanced); err == nil {
+		t.Error("Expected an unbalanced entry to be rejected")
+	}
+
+	overdraft := f.entry(withdrawal.ID, "overdraft", 150)
+	overdraft.NoOverdraft = true
+	if err := repos.Ledger.Record(ctx, overdraft); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds, got: %v", err)
+	}
+
+	dependent := f.entry(withdrawal.ID, "dependent", 30)
+	dependent.Requires = "reserved"
+	if err := repos.Ledger.Record(ctx, dependent); err != nil {
+		t.Fatalf("failed to record entry: %v", err)
+	}
+	if balance := available(t, repos, f); balance != 100 {
+		t.Errorf("Expected an entry missing its required one to be skipped, got %.2f available", balance)
+	}
+
+	if err := repos.Ledger.Record(ctx, f.entry(withdrawal.ID, "reserved", 30)); err != nil {
+		t.Fatalf("failed to record entry: %v", err)
+	}
+	if err := repos.Ledger.Record(ctx, dependent); err != nil {
+		t.Fatalf("failed to record entry: %v", err)
+	}
+	if balance := available(t, repos, f); balance != 40 {
+		t.Errorf("Expected 40 available, got %.2f", balance)
+	}
+
+	// An entry is skipped once the one it excludes is recorded
+	excluded := f.entry(withdrawal.ID, "excluded", 10)
+	excluded.Excludes = "dependent"
+	if err := repos.Ledger.Record(ctx, excluded); err != nil {
+		t.Fatalf("failed to record entry: %v", err)
+	}
+	if balance := available(t, repos, f); balance != 40 {
+		t.Errorf("Expected an entry excluded by a recorded one to be skipped, got %.2f available", balance)
+	}
+
+	accounts, err := repos.Ledger.ListAccounts(ctx, f.userID+1)
+	if err != nil || len(accounts) != 0 {
+		t.Errorf("Expected no accounts for another user, got %+v and %v", accounts, err)
+	}
+}
+
+// testLedgerInUnitOfWork records entries in units of work, which commit or roll back with the
+// rest of the unit and don't wait for the transaction rows the unit locked
+func testLedgerInUnitOfWork(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	deposit := create(t, repos, f.transaction("deposit", "PROCESSING", 100))
+
+	failure := errors.New("failure")
+	err := repos.UnitOfWork.Do(ctx, func(uow repository.Repositories) error {
+		if _, err := uow.Transactions.GetByIDForUpdate(ctx, deposit.ID); err != nil {
+			return err
+		}
+		if err := uow.Ledger.Record(ctx, f.entry(deposit.ID, "deposit_completed", -100)); err != nil {
+			return err
+		}
+		if err := uow.Transactions.UpdateStatus(ctx, deposit.ID, "COMPLETED"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of the unit of work, got: %v", err)
+	}
+	if balance := available(t, repos, f); balance != 0 {
+		t.Errorf("Expected the entry to be rolled back, got %.2f available", balance)
+	}
+
+	err = repos.UnitOfWork.Do(ctx, func(uow repository.Repositories) error {
+		if _, err := uow.Transactions.GetByIDForUpdate(ctx, deposit.ID); err != nil {
+			return err
+		}
+		if err := uow.Ledger.Record(ctx, f.entry(deposit.ID, "deposit_completed", -100)); err != nil {
+			return err
+		}
+		return uow.Transactions.UpdateStatus(ctx, deposit.ID, "COMPLETED")
+	})
+	if err != nil {
+		t.Fatalf("failed to run unit of work: %v", err)
+	}
+	if balance := available(t, repos, f); balance != 100 {
+		t.Errorf("Expected the entry to be committed, got %.2f available", balance)
+	}
+}
+
+// testConcurrentReservations places more overdraft-checked holds at once than the user's
+// balance covers, of which only those the balance covers may go through
+func testConcurrentReservations(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	deposit := create(t, repos, f.transaction("deposit", "COMPLETED", 100))
+	if err := repos.Ledger.Record(ctx, f.entry(deposit.ID, "deposit_completed", -100)); err != nil {
+		t.Fatalf("failed to record entry: %v", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+		rejected int
+	)
+	for i := 0; i < 10; i++ {
+		withdrawal := create(t, repos, f.transaction("withdrawal", "PENDING", 30))
+
+		hold := f.entry(withdrawal.ID, "withdrawal_reserved", 30)
+		hold.Postings[1] = models.Posting{UserID: hold.Postings[0].UserID, AccountType: "reserved", Currency: "EUR", Amount: 30}
+		hold.NoOverdraft = true
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repos.Ledger.Record(ctx, hold)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				reserved++
+			case errors.Is(err, repository.ErrInsufficientFunds):
+				rejected++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != 3 || rejected != 7 {
+		t.Errorf("Expected 3 reservations and 7 rejections, got %d and %d", reserved, rejected)
+	}
+
+	accounts, err := repos.Ledger.ListAccounts(ctx, f.userID)
+	if err != nil {
+		t.Fatalf("failed to list ledger accounts: %v", err)
+	}
+	balances := make(map[string]float64)
+	for _, account := range accounts {
+		balances[account.Type] = account.Balance
+	}
+	if balances["available"] != 10 || balances["reserved"] != 90 {
+		t.Errorf("Expected 10 available and 90 reserved, got %v", balances)
+	}
+}
+
+func testUnitOfWork(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	deposit := create(t, repos, f.transaction("deposit", "PENDING", 100))
+
+	var created *models.Transaction
+	err := repos.UnitOfWork.Do(ctx, func(uow repository.Repositories) error {
+		locked, err := uow.Transactions.GetByIDForUpdate(ctx, deposit.ID)
+		if err != nil {
+			return err
+		}
+		if locked.Status != "PENDING" {
+			t.Errorf("Expected PENDING, got %s", locked.Status)
+		}
+		if _, err := uow.Gateways.FindByID(ctx, f.gatewayID); err != nil {
+			return err
+		}
+
+		created = f.transaction("withdrawal", "PENDING", 20)
+		if err := uow.Transactions.Create(ctx, created); err != nil {
+			return err
+		}
+		return uow.Transactions.UpdateStatus(ctx, deposit.ID, "PROCESSING")
+	})
+	if err != nil {
+		t.Fatalf("failed to run unit of work: %v", err)
+	}
+
+	if found, err := repos.Transactions.GetByID(ctx, deposit.ID); err != nil || found.Status != "PROCESSING" {
+		t.Errorf("Expected the committed status PROCESSING, got %+v and %v", found, err)
+	}
+	if _, err := repos.Transactions.GetByID(ctx, created.ID); err != nil {
+		t.Errorf("Expected the committed transaction, got: %v", err)
+	}
+
+	// A failing unit of work leaves nothing behind
+	failure := errors.New("failure")
+	var discarded *models.Transaction
+	err = repos.UnitOfWork.Do(ctx, func(uow repository.Repositories) error {
+		discarded = f.transaction("deposit", "PENDING", 30)
+		if err := uow.Transactions.Create(ctx, discarded); err != nil {
+			return err
+		}
+		if err := uow.Transactions.UpdateStatus(ctx, deposit.ID, "COMPLETED"); err != nil {
+			return err
+		}
+		if err := uow.Transactions.SetGatewayReference(ctx, deposit.ID, "ch_1"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the error of the unit of work, got: %v", err)
+	}
+
+	if found, err := repos.Transactions.GetByID(ctx, deposit.ID); err != nil || found.Status != "PROCESSING" || found.GatewayReference != "" {
+		t.Errorf("Expected the changes to be rolled back, got %+v and %v", found, err)
+	}
+	if _, err := repos.Transactions.GetByID(ctx, discarded.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected the created transaction to be rolled back, got: %v", err)
+	}
+
+	// So does one that panics
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to go through")
+			}
+		}()
+		repos.UnitOfWork.Do(ctx, func(uow repository.Repositories) error {
+			if err := uow.Transactions.UpdateStatus(ctx, deposit.ID, "FAILED"); err != nil {
+				return err
+			}
+			panic("failure")
+		})
+	}()
+	if found, err := repos.Transactions.GetByID(ctx, deposit.ID); err != nil || found.Status != "PROCESSING" {
+		t.Errorf("Expected the changes to be rolled back after a panic, got %+v and %v", found, err)
+	}
+
+	err = repos.UnitOfWork.Do(ctx, func(uow repository.Repositories) error {
+		_, err := uow.Transactions.GetByIDForUpdate(ctx, created.ID+100)
+		return err
+	})
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound locking a missing transaction, got: %v", err)
+	}
+}
+
+// testConcurrentUnitsOfWork appends to the gateway reference of a transaction from concurrent
+// units of work, which only adds up when the row lock serialises them
+func testConcurrentUnitsOfWork(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	f := addFixtures(t, repos)
+
+	deposit := create(t, repos, f.transaction("deposit", "PENDING", 100))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repos.UnitOfWork.Do(ctx, func(uow repository.Repositories) error {
+				locked, err := uow.Transactions.GetByIDForUpdate(ctx, deposit.ID)
+				if err != nil {
+					return err
+				}
+				return uow.Transactions.SetGatewayReference(ctx, deposit.ID, locked.GatewayReference+"x")
+			})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	found, err := repos.Transactions.GetByID(ctx, deposit.ID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if len(found.GatewayReference) != 10 {
+		t.Errorf("Expected 10 updates, got %q", found.GatewayReference)
+	}
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"payment-gateway/internal/models"
+	"time"
+)
+
+type RoutingOverride interface {
+	Create(ctx context.Context, override *models.RoutingOverride) error
+	Delete(ctx context.Context, id int) error
+	List(ctx context.Context) ([]models.RoutingOverride, error)
+	// FindActive returns the overrides of a user or a merchant that have not expired at the given time
+	FindActive(ctx context.Context, userID int, merchantID string, at time.Time) ([]models.RoutingOverride, error)
+}
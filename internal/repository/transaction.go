@@ -2,11 +2,49 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"payment-gateway/internal/models"
+	"time"
 )
 
+// ErrAmountLimitExceeded is returned when a refund or capture would take the refunds
+// or captures of a transaction over its amount
+var ErrAmountLimitExceeded = errors.New("amount exceeds what is left of the transaction")
+
+// FailedChildStatuses are the statuses of the refunds and captures that have not gone
+// through, which aren't counted against the amount left to refund or capture
+var FailedChildStatuses = []string{"FAILED", "DECLINED", "REJECTED", "EXPIRED", "CANCELLED", "VOIDED"}
+
 type Transaction interface {
 	Create(ctx context.Context, transaction *models.Transaction) error
 	UpdateStatus(ctx context.Context, transactionID int, status string) error
 	GetByID(ctx context.Context, transactionID int) (*models.Transaction, error)
+	// GetByIDForUpdate is GetByID that also locks the transaction until the end of the unit
+	// of work it runs in, so that it can be updated based on what was read. Outside a unit
+	// of work the lock is released right away.
+	GetByIDForUpdate(ctx context.Context, transactionID int) (*models.Transaction, error)
+	SetGatewayReference(ctx context.Context, transactionID int, reference string) error
+	// CreateChild creates a refund or capture of its parent transaction, failing with
+	// ErrAmountLimitExceeded when the children of its type not in FailedChildStatuses
+	// would exceed the parent's amount
+	CreateChild(ctx context.Context, child *models.Transaction) error
+	// ChildrenAmount sums the children of a type of a transaction not in FailedChildStatuses
+	ChildrenAmount(ctx context.Context, transactionID int, childType string) (float64, error)
+	// CompletedChildrenAmount sums the COMPLETED children of a type of a transaction
+	CompletedChildrenAmount(ctx context.Context, transactionID int, childType string) (float64, error)
+	// ListByStatus returns the transactions of a type in a status created before the given time
+	ListByStatus(ctx context.Context, transactionType, status string, createdBefore time.Time) ([]models.Transaction, error)
+	// ListByStatuses returns up to limit transactions of any type in one of the statuses created
+	// before the given time, those with an ID above afterID ordered by ID, so that they can be
+	// listed a page at a time
+	ListByStatuses(ctx context.Context, statuses []string, createdBefore time.Time, afterID, limit int) ([]models.Transaction, error)
+	// ListByGateway returns the transactions sent to a gateway created in [from, to)
+	ListByGateway(ctx context.Context, gatewayID int, from, to time.Time) ([]models.Transaction, error)
+	// ListByGatewayReferences returns the transactions of a gateway with the given references
+	ListByGatewayReferences(ctx context.Context, gatewayID int, references []string) ([]models.Transaction, error)
+}
+
+type TransactionAttempt interface {
+	Create(ctx context.Context, attempt *models.TransactionAttempt) error
+	ListByTransaction(ctx context.Context, transactionID int) ([]models.TransactionAttempt, error)
 }
@@ -0,0 +1,19 @@
+package repository
+
+import "context"
+
+// Repositories are the repositories a unit of work runs its calls through
+type Repositories struct {
+	Transactions Transaction
+	Gateways     Gateway
+	Countries    Country
+	Users        User
+	Ledger       Ledger
+}
+
+// UnitOfWork runs several repository calls as one database transaction
+type UnitOfWork interface {
+	// Do calls fn with repositories bound to a new transaction, committed when fn returns nil
+	// and rolled back when it fails or panics. Units of work don't nest.
+	Do(ctx context.Context, fn func(repos Repositories) error) error
+}
@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Provider looks up secret material by name in one backend
+type Provider interface {
+	Get(name string) ([]byte, error)
+}
+
+// ProviderFunc adapts a function to a Provider
+type ProviderFunc func(name string) ([]byte, error)
+
+func (f ProviderFunc) Get(name string) ([]byte, error) {
+	return f(name)
+}
+
+// EnvProvider reads secrets from environment variables
+var EnvProvider = ProviderFunc(func(name string) ([]byte, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	return []byte(value), nil
+})
+
+// FileProvider reads secrets from files, e.g. mounted by the orchestrator
+var FileProvider = ProviderFunc(func(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return data, nil
+})
+
+// Resolver resolves references of the form "scheme:name", e.g. "env:SIGNING_KEY"
+// or "file:/run/secrets/signing.pem", with the provider registered for the scheme
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewResolver creates a resolver knowing the env and file schemes
+func NewResolver() *Resolver {
+	return &Resolver{
+		providers: map[string]Provider{
+			"env":  EnvProvider,
+			"file": FileProvider,
+		},
+	}
+}
+
+// Register sets the provider used for a scheme, e.g. a vault client
+func (r *Resolver) Register(scheme string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[scheme] = provider
+}
+
+// Resolve returns the secret a reference points to
+func (r *Resolver) Resolve(ref string) ([]byte, error) {
+	scheme, name, ok := strings.Cut(ref, ":")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("invalid secret reference %q, expected scheme:name", ref)
+	}
+
+	r.mu.RLock()
+	provider, exists := r.providers[scheme]
+	r.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown secret scheme %s", scheme)
+	}
+
+	secret, err := provider.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secret %s: %w", ref, err)
+	}
+
+	return secret, nil
+}
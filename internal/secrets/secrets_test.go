@@ -0,0 +1,50 @@
+package secrets_test
+
+import (
+	"os"
+	"path/filepath"
+	"payment-gateway/internal/secrets"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("TEST_SIGNING_SECRET", "env-secret")
+
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, []byte("file-secret"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		ref         string
+		expected    string
+		expectError bool
+	}{
+		{"Environment", "env:TEST_SIGNING_SECRET", "env-secret", false},
+		{"File", "file:" + file, "file-secret", false},
+		{"Unset Environment", "env:TEST_MISSING_SECRET", "", true},
+		{"Missing File", "file:" + file + ".missing", "", true},
+		{"Unknown Scheme", "vault:payments/key", "", true},
+		{"Plain Value", "whsec_123", "", true},
+	}
+
+	resolver := secrets.NewResolver()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := resolver.Resolve(tt.ref)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got secret %q", secret)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if string(secret) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, secret)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// number of routing decisions kept for the debug endpoint
+const maxRoutingDecisions = 50
+
+// OutcomeRecorder receives the result of every gateway interaction
+type OutcomeRecorder interface {
+	// RecordOutcome records the result of a request and how long the gateway took to answer
+	RecordOutcome(gatewayName string, countryID int, success bool, latency time.Duration)
+	// RecordResult records a result that comes without a latency, such as the final status
+	// a gateway calls back with
+	RecordResult(gatewayName string, countryID int, success bool)
+	// RecordLatency records how long a gateway took to answer a request whose result is
+	// only known from its final status
+	RecordLatency(gatewayName string, countryID int, latency time.Duration)
+}
+
+type outcome struct {
+	success bool
+	// scored tells the outcomes that count towards the success rate apart
+	scored bool
+	// timed tells the outcomes with a latency apart
+	timed   bool
+	latency time.Duration
+}
+
+type statsKey struct {
+	gateway   string
+	countryID int
+}
+
+// gatewayWindow is a ring buffer of the latest outcomes of a gateway in a country
+type gatewayWindow struct {
+	outcomes []outcome
+	next     int
+	full     bool
+}
+
+func (w *gatewayWindow) add(o outcome) {
+	w.outcomes[w.next] = o
+	w.next = (w.next + 1) % len(w.outcomes)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+func (w *gatewayWindow) samples() []outcome {
+	if w.full {
+		return w.outcomes
+	}
+	return w.outcomes[:w.next]
+}
+
+// AdaptiveStrategy routes traffic to the gateways with the best rolling success
+// rate and latency. A share of the traffic (epsilon) is sent to a random other
+// gateway so that a recovering gateway is noticed.
+type AdaptiveStrategy struct {
+	settings  config.AdaptiveRoutingConfig
+	mu        sync.Mutex
+	windows   map[statsKey]*gatewayWindow
+	decisions []models.RoutingDecision
+	random    *rand.Rand
+}
+
+func NewAdaptiveStrategy(settings config.AdaptiveRoutingConfig) *AdaptiveStrategy {
+	if settings.Window <= 0 {
+		settings.Window = 100
+	}
+
+	return &AdaptiveStrategy{
+		settings: settings,
+		windows:  make(map[statsKey]*gatewayWindow),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (s *AdaptiveStrategy) Name() string {
+	return config.RoutingStrategyAdaptive
+}
+
+// RecordOutcome adds the result of a gateway request to the rolling window
+func (s *AdaptiveStrategy) RecordOutcome(gatewayName string, countryID int, success bool, latency time.Duration) {
+	s.record(gatewayName, countryID, outcome{success: success, scored: true, timed: true, latency: latency})
+}
+
+// RecordResult adds the result of a callback to the rolling window, it counts towards the
+// success rate only
+func (s *AdaptiveStrategy) RecordResult(gatewayName string, countryID int, success bool) {
+	s.record(gatewayName, countryID, outcome{success: success, scored: true})
+}
+
+// RecordLatency adds the latency of a gateway request to the rolling window, it counts
+// towards the latency only
+func (s *AdaptiveStrategy) RecordLatency(gatewayName string, countryID int, latency time.Duration) {
+	s.record(gatewayName, countryID, outcome{timed: true, latency: latency})
+}
+
+func (s *AdaptiveStrategy) record(gatewayName string, countryID int, o outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := statsKey{gateway: gatewayName, countryID: countryID}
+	window, exists := s.windows[key]
+	if !exists {
+		window = &gatewayWindow{outcomes: make([]outcome, s.settings.Window)}
+		s.windows[key] = window
+	}
+
+	window.add(o)
+}
+
+func (s *AdaptiveStrategy) Rank(_ context.Context, _ RoutingRequest, country *models.Country, candidates []RoutingCandidate) []RoutingCandidate {
+	ranked := append([]RoutingCandidate(nil), candidates...)
+	if len(ranked) == 0 {
+		return ranked
+	}
+
+	countryID, countryCode := 0, ""
+	if country != nil {
+		countryID, countryCode = country.ID, country.Code
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]models.GatewayStats, len(ranked))
+	for _, candidate := range ranked {
+		stats[candidate.Name] = s.statsLocked(statsKey{gateway: candidate.Name, countryID: countryID})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		left, right := stats[ranked[i].Name], stats[ranked[j].Name]
+		if left.Score != right.Score {
+			return left.Score > right.Score
+		}
+		if ranked[i].Priority != ranked[j].Priority {
+			return ranked[i].Priority > ranked[j].Priority
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+
+	explored := false
+	if len(ranked) > 1 && s.random.Float64() < s.settings.Epsilon {
+		pick := 1 + s.random.Intn(len(ranked)-1)
+		ranked[0], ranked[pick] = ranked[pick], ranked[0]
+		explored = true
+	}
+
+	decision := models.RoutingDecision{
+		CountryCode: countryCode,
+		Gateway:     ranked[0].Name,
+		Explored:    explored,
+		DecidedAt:   time.Now().UTC(),
+	}
+	for _, candidate := range ranked {
+		decision.Candidates = append(decision.Candidates, stats[candidate.Name])
+	}
+
+	s.decisions = append(s.decisions, decision)
+	if len(s.decisions) > maxRoutingDecisions {
+		s.decisions = s.decisions[len(s.decisions)-maxRoutingDecisions:]
+	}
+
+	return ranked
+}
+
+// Explain returns the current statistics and the latest routing decisions
+func (s *AdaptiveStrategy) Explain() models.RoutingReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := models.RoutingReport{
+		Strategy:  s.Name(),
+		Stats:     make([]models.GatewayStats, 0, len(s.windows)),
+		Decisions: append([]models.RoutingDecision(nil), s.decisions...),
+	}
+
+	for key := range s.windows {
+		report.Stats = append(report.Stats, s.statsLocked(key))
+	}
+
+	sort.Slice(report.Stats, func(i, j int) bool {
+		if report.Stats[i].CountryID != report.Stats[j].CountryID {
+			return report.Stats[i].CountryID < report.Stats[j].CountryID
+		}
+		return report.Stats[i].Gateway < report.Stats[j].Gateway
+	})
+
+	return report
+}
+
+// statsLocked scores a gateway in a country. Until it has enough samples a gateway
+// keeps the best possible score so that new and unused gateways still get traffic.
+func (s *AdaptiveStrategy) statsLocked(key statsKey) models.GatewayStats {
+	stats := models.GatewayStats{
+		Gateway:     key.gateway,
+		CountryID:   key.countryID,
+		SuccessRate: 1,
+		Score:       1,
+	}
+
+	window, exists := s.windows[key]
+	if !exists {
+		return stats
+	}
+
+	samples := window.samples()
+	if len(samples) == 0 {
+		return stats
+	}
+
+	successes, scored, timed := 0, 0, 0
+	var totalLatency time.Duration
+	for _, o := range samples {
+		if o.scored {
+			scored++
+		}
+		if o.success {
+			successes++
+		}
+		if o.timed {
+			timed++
+			totalLatency += o.latency
+		}
+	}
+
+	stats.Samples = scored
+	if scored > 0 {
+		stats.SuccessRate = float64(successes) / float64(scored)
+	}
+	if timed > 0 {
+		stats.AvgLatencyMs = float64(totalLatency.Milliseconds()) / float64(timed)
+	}
+
+	if stats.Samples < s.settings.MinSamples {
+		return stats
+	}
+
+	latencyRatio := 0.0
+	if s.settings.LatencyTarget > 0 {
+		latencyRatio = stats.AvgLatencyMs / float64(s.settings.LatencyTarget)
+	}
+	stats.Score = stats.SuccessRate - s.settings.LatencyWeight*latencyRatio
+
+	return stats
+}
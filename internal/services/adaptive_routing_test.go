@@ -0,0 +1,200 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/services"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveStrategyShiftsAwayFromDegradedGateway(t *testing.T) {
+	strategy := services.NewAdaptiveStrategy(config.AdaptiveRoutingConfig{
+		Window:        20,
+		MinSamples:    5,
+		LatencyWeight: 0.1,
+		LatencyTarget: 1000,
+	})
+
+	country := &models.Country{ID: 1, Code: "US"}
+	candidates := []services.RoutingCandidate{
+		{Name: "paypal", Priority: 10},
+		{Name: "stripe", Priority: 8},
+	}
+
+	ranked := strategy.Rank(context.Background(), services.RoutingRequest{}, country, candidates)
+	if ranked[0].Name != "paypal" {
+		t.Fatalf("Expected priority to break ties without samples, got %s", ranked[0].Name)
+	}
+
+	for i := 0; i < 10; i++ {
+		strategy.RecordOutcome("paypal", country.ID, i%2 == 0, 200*time.Millisecond)
+		strategy.RecordOutcome("stripe", country.ID, true, 300*time.Millisecond)
+	}
+
+	ranked = strategy.Rank(context.Background(), services.RoutingRequest{}, country, candidates)
+	if ranked[0].Name != "stripe" {
+		t.Errorf("Expected traffic to shift to stripe, got %s", ranked[0].Name)
+	}
+
+	// Outcomes in another country must not influence this one
+	strategy.RecordOutcome("stripe", 2, false, time.Second)
+
+	report := strategy.Explain()
+	if len(report.Stats) != 3 {
+		t.Fatalf("Expected stats for 3 gateway/country pairs, got %d", len(report.Stats))
+	}
+
+	if len(report.Decisions) != 2 {
+		t.Fatalf("Expected 2 recorded decisions, got %d", len(report.Decisions))
+	}
+
+	last := report.Decisions[1]
+	if last.Gateway != "stripe" || last.CountryCode != "US" || last.Explored {
+		t.Errorf("Unexpected decision: %+v", last)
+	}
+}
+
+func TestAdaptiveStrategyExplores(t *testing.T) {
+	strategy := services.NewAdaptiveStrategy(config.AdaptiveRoutingConfig{
+		Window:     10,
+		MinSamples: 1,
+		Epsilon:    1,
+	})
+
+	country := &models.Country{ID: 1, Code: "US"}
+	candidates := []services.RoutingCandidate{
+		{Name: "paypal", Priority: 10},
+		{Name: "stripe", Priority: 8},
+	}
+
+	strategy.RecordOutcome("stripe", country.ID, false, 0)
+
+	ranked := strategy.Rank(context.Background(), services.RoutingRequest{}, country, candidates)
+	if ranked[0].Name != "stripe" {
+		t.Errorf("Expected exploration to pick the degraded gateway, got %s", ranked[0].Name)
+	}
+}
+
+func TestAdaptiveStrategyResultsCarryNoLatency(t *testing.T) {
+	strategy := services.NewAdaptiveStrategy(config.AdaptiveRoutingConfig{Window: 10})
+
+	strategy.RecordOutcome("stripe", 1, true, 200*time.Millisecond)
+	strategy.RecordOutcome("stripe", 1, true, 400*time.Millisecond)
+	strategy.RecordResult("stripe", 1, false)
+	strategy.RecordResult("stripe", 1, true)
+
+	stats := strategy.Explain().Stats
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats for 1 gateway/country pair, got %d", len(stats))
+	}
+	if stats[0].Samples != 4 || stats[0].SuccessRate != 0.75 || stats[0].AvgLatencyMs != 300 {
+		t.Errorf("Expected 4 samples, a 0.75 success rate and 300ms of latency, got %+v", stats[0])
+	}
+}
+
+func TestAdaptiveStrategyLatencyIsNotScored(t *testing.T) {
+	strategy := services.NewAdaptiveStrategy(config.AdaptiveRoutingConfig{Window: 10})
+
+	strategy.RecordLatency("stripe", 1, 100*time.Millisecond)
+	strategy.RecordLatency("stripe", 1, 300*time.Millisecond)
+	strategy.RecordResult("stripe", 1, false)
+
+	stats := strategy.Explain().Stats
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats for 1 gateway/country pair, got %d", len(stats))
+	}
+	if stats[0].Samples != 1 || stats[0].SuccessRate != 0 || stats[0].AvgLatencyMs != 200 {
+		t.Errorf("Expected 1 sample, a 0 success rate and 200ms of latency, got %+v", stats[0])
+	}
+}
+
+func TestAdaptiveStrategyScoresEachTransactionOnce(t *testing.T) {
+	ctx := context.Background()
+	repos := newMemoryRepos(t)
+	strategy := services.NewAdaptiveStrategy(config.AdaptiveRoutingConfig{Window: 10})
+
+	var response func() (*gateway.Result, error)
+	sent := 0
+	client := &mockClient{
+		mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+			sent++
+			return response()
+		},
+	}
+	attempts := 1
+
+	country := &models.Country{ID: 1, Code: "US", Currency: "USD"}
+	processor := services.NewTransactionProcessor(
+		&mockGatewayConfigProvider{
+			mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+				return config.GatewayDetails{
+					Endpoints: config.GatewayEndpoints{Deposit: "/v1/charges"},
+					Retry:     config.GatewayRetry{MaxAttempts: attempts},
+				}, true
+			},
+		},
+		&mockGatewaySelectorProvider{
+			mockSelectGatewayForUser: func(ctx context.Context, request services.RoutingRequest) (*services.GatewaySelection, error) {
+				return &services.GatewaySelection{Gateway: repos.gateway, Country: country}, nil
+			},
+		},
+		repos.transactions, repos.gateways, client,
+		services.WithUnitOfWork(repos.unitOfWork),
+		services.WithSendOutcomeRecorder(strategy),
+	)
+	callbacks := services.NewCallbackProcessor(repos.transactions, repos.gateways,
+		services.WithCallbackUnitOfWork(repos.unitOfWork),
+		services.WithCallbackOutcomeRecorder(strategy),
+	)
+
+	// Accepted, the callback decides
+	response = func() (*gateway.Result, error) {
+		return &gateway.Result{GatewayReference: "ch_1", Status: gateway.StatusProcessing, StatusCode: 200}, nil
+	}
+	deposit, err := processor.ProcessDeposit(ctx, 1, 100, "USD")
+	if err != nil {
+		t.Fatalf("failed to deposit: %v", err)
+	}
+	if err := callbacks.ApplyStatus(ctx, deposit.ID, services.StatusCompleted, services.EventCallbackProcessed); err != nil {
+		t.Fatalf("failed to complete deposit: %v", err)
+	}
+
+	// Declined in the response, the repeated callback is ignored
+	response = func() (*gateway.Result, error) {
+		return &gateway.Result{Status: gateway.StatusFailed, DeclineCode: "card_declined", StatusCode: 200}, nil
+	}
+	if _, err := processor.ProcessDeposit(ctx, 1, 100, "USD"); !errors.Is(err, services.ErrDeclined) {
+		t.Fatalf("Expected ErrDeclined, got: %v", err)
+	}
+	declined, err := repos.transactions.ListByStatus(ctx, "deposit", services.StatusFailed, time.Now())
+	if err != nil || len(declined) != 1 {
+		t.Fatalf("Expected the declined deposit to be failed, got %v and %v", declined, err)
+	}
+	if err := callbacks.ApplyStatus(ctx, declined[0].ID, services.StatusFailed, services.EventCallbackProcessed); err != nil {
+		t.Fatalf("failed to fail deposit: %v", err)
+	}
+
+	// Unavailable on every attempt, scored once
+	attempts, sent = 2, 0
+	response = func() (*gateway.Result, error) {
+		return &gateway.Result{StatusCode: 503}, errors.New("gateway returned non-success status: 503")
+	}
+	if _, err := processor.ProcessDeposit(ctx, 1, 100, "USD"); !errors.Is(err, services.ErrGatewayUnavailable) {
+		t.Fatalf("Expected ErrGatewayUnavailable, got: %v", err)
+	}
+	if sent != 2 {
+		t.Fatalf("Expected the deposit to be sent twice, got %d", sent)
+	}
+
+	stats := strategy.Explain().Stats
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats for 1 gateway/country pair, got %d", len(stats))
+	}
+	if stats[0].Samples != 3 || stats[0].SuccessRate != 1.0/3 {
+		t.Errorf("Expected 3 samples and a 1/3 success rate, got %+v", stats[0])
+	}
+}
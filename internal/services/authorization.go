@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"time"
+)
+
+// ErrNotCapturable is returned when a capture is requested for a transaction that can't be captured
+var ErrNotCapturable = errors.New("transaction can't be captured")
+
+// ProcessAuthorization reserves an amount at a gateway able to authorize it, to be captured
+// or voided later. It moves to AUTHORIZED through the gateway's callback.
+func (p *TransactionProcessor) ProcessAuthorization(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error) {
+	return p.processTransaction(ctx, userID, amount, currency, "authorization")
+}
+
+// ProcessCapture captures an authorization, what is left of it when amount is 0. Each capture is
+// a child transaction completed through the gateway's callback. The authorization stays
+// AUTHORIZED, so a failed capture can be retried or the authorization voided, until its
+// completed captures add up to its amount and it moves to CAPTURED; what isn't captured is
+// released when it is voided.
+func (p *TransactionProcessor) ProcessCapture(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error) {
+	if amount < 0 {
+		return nil, fmt.Errorf("%w: amount must not be negative", ErrNotCapturable)
+	}
+
+	var (
+		authorization      *models.Transaction
+		authorizingGateway *models.Gateway
+		capture            *models.Transaction
+	)
+	// The capture is reserved against the locked authorization before it is sent, a void or
+	// another capture can't slip in between
+	err := p.unitOfWork.Do(ctx, func(repos repository.Repositories) error {
+		var err error
+		authorization, err = repos.Transactions.GetByIDForUpdate(ctx, transactionID)
+		if err != nil {
+			return fmt.Errorf("failed to get transaction: %w", err)
+		}
+
+		if authorization.Type != "authorization" {
+			return fmt.Errorf("%w: transaction %d is a %s, not an authorization", ErrNotCapturable, authorization.ID, authorization.Type)
+		}
+		if err := CheckTransition(authorization.Status, StatusCaptured); err != nil {
+			return fmt.Errorf("%w: %v", ErrNotCapturable, err)
+		}
+		if authorization.GatewayReference == "" {
+			return fmt.Errorf("%w: authorization %d has no gateway reference", ErrNotCapturable, authorization.ID)
+		}
+
+		authorizingGateway, err = repos.Gateways.FindByID(ctx, authorization.GatewayID)
+		if err != nil {
+			return fmt.Errorf("failed to find gateway: %w", err)
+		}
+
+		captured, err := repos.Transactions.ChildrenAmount(ctx, authorization.ID, "capture")
+		if err != nil {
+			return fmt.Errorf("failed to sum captures: %w", err)
+		}
+
+		captureAmount := amount
+		if captureAmount == 0 {
+			captureAmount = authorization.Amount - captured
+		}
+		captureAmount = math.Round(captureAmount*100) / 100
+		if captureAmount <= 0 {
+			return fmt.Errorf("%w: authorization %d has nothing left to capture", ErrNotCapturable, authorization.ID)
+		}
+
+		capture = &models.Transaction{
+			Amount:    captureAmount,
+			Currency:  authorization.Currency,
+			Fee:       captureFee(authorization, captured, captureAmount),
+			Type:      "capture",
+			Status:    StatusPending,
+			GatewayID: authorization.GatewayID,
+			CountryID: authorization.CountryID,
+			UserID:    authorization.UserID,
+			ParentID:  &authorization.ID,
+			CreatedAt: time.Now(),
+		}
+
+		// The repository caps the captures of an authorization at its amount
+		if err := repos.Transactions.CreateChild(ctx, capture); err != nil {
+			return fmt.Errorf("failed to create capture: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.submit(ctx, capture, authorizingGateway, authorization.GatewayReference); err != nil {
+		return nil, err
+	}
+
+	return capture, nil
+}
+
+// settleAuthorization moves the authorization of a capture that just completed to CAPTURED
+// once its completed captures add up to its amount, returning it when it did. It runs in the
+// unit of work completing the capture; a voided authorization is left alone.
+func settleAuthorization(ctx context.Context, repos repository.Repositories, capture *models.Transaction) (*models.Transaction, error) {
+	if capture.Type != "capture" || capture.Status != StatusCompleted || capture.ParentID == nil {
+		return nil, nil
+	}
+
+	authorization, err := repos.Transactions.GetByIDForUpdate(ctx, *capture.ParentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if authorization.Status != StatusAuthorized {
+		return nil, nil
+	}
+
+	captured, err := repos.Transactions.CompletedChildrenAmount(ctx, authorization.ID, "capture")
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum captures: %w", err)
+	}
+	if captured < authorization.Amount-0.005 {
+		return nil, nil
+	}
+
+	// The captures carry the ledger entries, the authorization has none of its own
+	if err := repos.Transactions.UpdateStatus(ctx, authorization.ID, StatusCaptured); err != nil {
+		return nil, fmt.Errorf("failed to update authorization status: %w", err)
+	}
+	authorization.Status = StatusCaptured
+
+	return authorization, nil
+}
+
+// captureFee is the share of an authorization's fee a capture bears. It is prorated on the
+// amount captured so far, so the fees of the captures add up to the authorization's.
+func captureFee(authorization *models.Transaction, captured, amount float64) float64 {
+	if authorization.Amount <= 0 {
+		return authorization.Fee
+	}
+
+	share := func(amount float64) float64 {
+		return math.Round(authorization.Fee*amount/authorization.Amount*100) / 100
+	}
+	return math.Round((share(captured+amount)-share(captured))*100) / 100
+}
+
+// VoidAuthorization releases what is left of an authorization that hasn't been captured in full
+// and moves it to VOIDED. A gateway refusing the void is taken as the authorization having been
+// settled.
+func (p *TransactionProcessor) VoidAuthorization(ctx context.Context, transactionID int) (*models.Transaction, error) {
+	authorization, err := p.transactionRepo.GetByID(ctx, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	if authorization.Type != "authorization" {
+		return nil, fmt.Errorf("%w: only authorizations can be voided, transaction %d is a %s", ErrNotCancellable, authorization.ID, authorization.Type)
+	}
+	if authorization.Status == StatusCaptured {
+		return nil, fmt.Errorf("%w: authorization %d is %s", ErrAlreadySettled, authorization.ID, authorization.Status)
+	}
+
+	if err := p.cancel(ctx, authorization, "void", StatusVoided); err != nil {
+		return nil, err
+	}
+
+	return authorization, nil
+}
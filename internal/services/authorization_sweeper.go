@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"time"
+)
+
+// authorizationSweepLock is the lock held by the instance sweeping expired authorizations
+const authorizationSweepLock = "authorization-sweep"
+
+// AuthorizationVoider voids authorizations
+type AuthorizationVoider interface {
+	VoidAuthorization(ctx context.Context, transactionID int) (*models.Transaction, error)
+}
+
+// AuthorizationSweeper voids the authorizations left uncaptured for longer than
+// the authorization_ttl of their gateway
+type AuthorizationSweeper struct {
+	gatewayConfig   GatewayConfigProvider
+	transactionRepo repository.Transaction
+	gatewayRepo     repository.Gateway
+	voider          AuthorizationVoider
+	locker          repository.Locker
+}
+
+func NewAuthorizationSweeper(
+	gatewayConfig GatewayConfigProvider,
+	transactionRepo repository.Transaction,
+	gatewayRepo repository.Gateway,
+	voider AuthorizationVoider,
+	locker repository.Locker,
+) *AuthorizationSweeper {
+	return &AuthorizationSweeper{
+		gatewayConfig:   gatewayConfig,
+		transactionRepo: transactionRepo,
+		gatewayRepo:     gatewayRepo,
+		voider:          voider,
+		locker:          locker,
+	}
+}
+
+// Run sweeps at every interval until the context is done
+func (s *AuthorizationSweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				log.Printf("authorization sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// Sweep voids the expired authorizations and returns how many were voided. Only one instance
+// sweeps at a time, the others return right away. Failing to void one is logged and left for
+// the next sweep.
+func (s *AuthorizationSweeper) Sweep(ctx context.Context) (int, error) {
+	unlock, acquired, err := s.locker.TryLock(ctx, authorizationSweepLock)
+	if err != nil {
+		return 0, err
+	}
+	if !acquired {
+		return 0, nil
+	}
+	defer unlock()
+
+	now := time.Now()
+
+	authorizations, err := s.transactionRepo.ListByStatus(ctx, "authorization", StatusAuthorized, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list authorizations: %w", err)
+	}
+
+	// TTLs are per gateway, so they are looked up once per gateway
+	ttls := make(map[int]time.Duration)
+	voided := 0
+	for _, authorization := range authorizations {
+		ttl, ok := ttls[authorization.GatewayID]
+		if !ok {
+			ttl, err = s.ttlFor(ctx, authorization.GatewayID)
+			if err != nil {
+				log.Printf("authorization %d: %v", authorization.ID, err)
+				continue
+			}
+			ttls[authorization.GatewayID] = ttl
+		}
+
+		if now.Sub(authorization.CreatedAt) < ttl {
+			continue
+		}
+
+		if _, err := s.voider.VoidAuthorization(ctx, authorization.ID); err != nil {
+			log.Printf("failed to void expired authorization %d: %v", authorization.ID, err)
+			continue
+		}
+		voided++
+	}
+
+	return voided, nil
+}
+
+func (s *AuthorizationSweeper) ttlFor(ctx context.Context, gatewayID int) (time.Duration, error) {
+	gateway, err := s.gatewayRepo.FindByID(ctx, gatewayID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find gateway: %w", err)
+	}
+
+	details, exists := s.gatewayConfig.GetGatewayDetails(gateway.Name)
+	if !exists {
+		return 0, fmt.Errorf("gateway %s not found in configuration", gateway.Name)
+	}
+
+	return time.Duration(details.AuthorizationTTL) * time.Second, nil
+}
@@ -0,0 +1,89 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/services"
+	"testing"
+	"time"
+)
+
+type mockAuthorizationVoider struct {
+	voided []int
+	err    error
+}
+
+func (m *mockAuthorizationVoider) VoidAuthorization(ctx context.Context, transactionID int) (*models.Transaction, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.voided = append(m.voided, transactionID)
+	return &models.Transaction{ID: transactionID, Status: "VOIDED"}, nil
+}
+
+func TestAuthorizationSweeperSweep(t *testing.T) {
+	now := time.Now()
+	authorizations := []models.Transaction{
+		{ID: 1, Type: "authorization", Status: "AUTHORIZED", GatewayID: 1, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: 2, Type: "authorization", Status: "AUTHORIZED", GatewayID: 1, CreatedAt: now.Add(-10 * time.Minute)},
+		{ID: 3, Type: "authorization", Status: "AUTHORIZED", GatewayID: 2, CreatedAt: now.Add(-2 * time.Hour)},
+	}
+
+	transactionRepo := &mockTransactionRepo{
+		mockListByStatus: func(ctx context.Context, transactionType, status string, createdBefore time.Time) ([]models.Transaction, error) {
+			if transactionType != "authorization" || status != "AUTHORIZED" {
+				t.Errorf("Unexpected listing of %s %s", status, transactionType)
+			}
+			return authorizations, nil
+		},
+	}
+
+	gatewayRepo := &mockGatewayRepo{
+		mockFindByID: func(ctx context.Context, id int) (*models.Gateway, error) {
+			names := map[int]string{1: "stripe", 2: "adyen"}
+			return &models.Gateway{ID: id, Name: names[id]}, nil
+		},
+	}
+
+	// Authorizations last an hour at stripe and a day at adyen
+	gatewayConfig := &mockGatewayConfigProvider{
+		mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+			ttls := map[string]int{"stripe": 3600, "adyen": 86400}
+			return config.GatewayDetails{AuthorizationTTL: ttls[name]}, true
+		},
+	}
+
+	voider := &mockAuthorizationVoider{}
+	locker := &mockLocker{}
+	sweeper := services.NewAuthorizationSweeper(gatewayConfig, transactionRepo, gatewayRepo, voider, locker)
+
+	voided, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if voided != 1 || len(voider.voided) != 1 || voider.voided[0] != 1 {
+		t.Errorf("Expected only authorization 1 to be voided, got %v", voider.voided)
+	}
+	if !locker.unlocked {
+		t.Error("Expected the lock to be released")
+	}
+
+	// Failures are left for the next sweep
+	voider.err = errors.New("gateway unavailable")
+	voided, err = sweeper.Sweep(context.Background())
+	if err != nil || voided != 0 {
+		t.Errorf("Expected failed voids to be skipped, got %d and %v", voided, err)
+	}
+
+	// Another instance is sweeping
+	locker.busy = true
+	transactionRepo.mockListByStatus = func(ctx context.Context, transactionType, status string, createdBefore time.Time) ([]models.Transaction, error) {
+		t.Error("Expected nothing to be listed without the lock")
+		return nil, nil
+	}
+	if voided, err := sweeper.Sweep(context.Background()); voided != 0 || err != nil {
+		t.Errorf("Expected the sweep to be skipped, got %d and %v", voided, err)
+	}
+}
@@ -0,0 +1,421 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"payment-gateway/internal/services"
+	"testing"
+)
+
+// newCaptureCallbacks returns the processor of the callbacks completing or failing captures
+func newCaptureCallbacks(repos memoryRepos) *services.CallbackProcessor {
+	return services.NewCallbackProcessor(repos.transactions, repos.gateways, services.WithCallbackUnitOfWork(repos.unitOfWork))
+}
+
+// newCaptureProcessor stores an authorization and returns a processor capturing it, the requests
+// sent to the gateway are appended to sent
+func newCaptureProcessor(t *testing.T, repos memoryRepos, authorization *models.Transaction, sent *[]*gateway.Request) *services.TransactionProcessor {
+	t.Helper()
+	ctx := context.Background()
+
+	authorization.GatewayID = repos.gateway.ID
+	if err := repos.transactions.Create(ctx, authorization); err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	if err := repos.transactions.SetGatewayReference(ctx, authorization.ID, "ch_123"); err != nil {
+		t.Fatalf("failed to set gateway reference: %v", err)
+	}
+
+	client := &mockClient{
+		mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+			*sent = append(*sent, request)
+			return &gateway.Result{GatewayReference: "ch_123", Status: gateway.StatusProcessing, StatusCode: 200}, nil
+		},
+	}
+
+	gatewayConfig := &mockGatewayConfigProvider{
+		mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+			return config.GatewayDetails{
+				Endpoints: config.GatewayEndpoints{Capture: "/v1/charges/{reference}/capture", Void: "/v1/charges/{reference}/void"},
+				Retry:     config.GatewayRetry{MaxAttempts: 1},
+			}, true
+		},
+	}
+
+	return services.NewTransactionProcessor(gatewayConfig, &mockGatewaySelectorProvider{}, repos.transactions, repos.gateways, client,
+		services.WithUnitOfWork(repos.unitOfWork),
+	)
+}
+
+func TestProcessCapture(t *testing.T) {
+	authorization := models.Transaction{
+		Amount:   100,
+		Currency: "EUR",
+		Fee:      2.5,
+		Type:     "authorization",
+		Status:   "AUTHORIZED",
+		UserID:   123,
+	}
+	captured := authorization
+	captured.Status = "CAPTURED"
+	deposit := authorization
+	deposit.Type = "deposit"
+
+	tests := []struct {
+		name                  string
+		authorization         models.Transaction
+		amount                float64
+		expectedAmount        float64
+		expectedFee           float64
+		expectedAuthorization string
+		expectedErr           error
+	}{
+		{name: "Full Capture", authorization: authorization, expectedAmount: 100, expectedFee: 2.5, expectedAuthorization: "CAPTURED"},
+		{name: "Partial Capture", authorization: authorization, amount: 80, expectedAmount: 80, expectedFee: 2, expectedAuthorization: "AUTHORIZED"},
+		{name: "Over The Authorized Amount", authorization: authorization, amount: 120, expectedErr: repository.ErrAmountLimitExceeded},
+		{name: "Already Captured", authorization: captured, expectedErr: services.ErrNotCapturable},
+		{name: "Deposit", authorization: deposit, expectedErr: services.ErrNotCapturable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := newMemoryRepos(t)
+
+			var sent []*gateway.Request
+			authorization := tt.authorization
+			processor := newCaptureProcessor(t, repos, &authorization, &sent)
+
+			capture, err := processor.ProcessCapture(ctx, authorization.ID, tt.amount)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got: %v", tt.expectedErr, err)
+				}
+				if len(sent) != 0 {
+					t.Error("Expected no request to be sent to the gateway")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if capture.Type != "capture" || capture.Amount != tt.expectedAmount || capture.Fee != tt.expectedFee || capture.ParentID == nil || *capture.ParentID != authorization.ID {
+				t.Errorf("Unexpected capture: %+v", capture)
+			}
+			if len(sent) != 1 || sent[0].TransactionType != "capture" || sent[0].TransactionID != capture.ID || sent[0].OriginalReference != "ch_123" {
+				t.Errorf("Unexpected gateway requests: %+v", sent)
+			}
+
+			storedCapture, err := repos.transactions.GetByID(ctx, capture.ID)
+			if err != nil {
+				t.Fatalf("failed to get capture: %v", err)
+			}
+			if storedCapture.Status != "PROCESSING" {
+				t.Errorf("Expected the capture to move to PROCESSING, got %s", storedCapture.Status)
+			}
+			// The capture isn't settled until the gateway calls back
+			expectAuthorizationStatus(t, repos, authorization.ID, "AUTHORIZED")
+
+			if err := newCaptureCallbacks(repos).ApplyStatus(ctx, capture.ID, "COMPLETED", services.EventCallbackProcessed); err != nil {
+				t.Fatalf("failed to complete capture: %v", err)
+			}
+			expectAuthorizationStatus(t, repos, authorization.ID, tt.expectedAuthorization)
+		})
+	}
+}
+
+// expectAuthorizationStatus fails the test unless the authorization is in the status
+func expectAuthorizationStatus(t *testing.T, repos memoryRepos, authorizationID int, expected string) {
+	t.Helper()
+
+	stored, err := repos.transactions.GetByID(context.Background(), authorizationID)
+	if err != nil {
+		t.Fatalf("failed to get authorization: %v", err)
+	}
+	if stored.Status != expected {
+		t.Errorf("Expected the authorization to be %s, got %s", expected, stored.Status)
+	}
+}
+
+func TestProcessCaptureInParts(t *testing.T) {
+	ctx := context.Background()
+	repos := newMemoryRepos(t)
+
+	var sent []*gateway.Request
+	authorization := &models.Transaction{Amount: 100, Currency: "EUR", Fee: 1, Type: "authorization", Status: "AUTHORIZED", UserID: 123}
+	processor := newCaptureProcessor(t, repos, authorization, &sent)
+
+	// The last capture takes what is left, the fees add up to the authorization's
+	var amounts, fees []float64
+	for i, amount := range []float64{33, 33, 0} {
+		capture, err := processor.ProcessCapture(ctx, authorization.ID, amount)
+		if err != nil {
+			t.Fatalf("capture %d: expected no error, got: %v", i, err)
+		}
+		amounts = append(amounts, capture.Amount)
+		fees = append(fees, capture.Fee)
+
+		if err := newCaptureCallbacks(repos).ApplyStatus(ctx, capture.ID, "COMPLETED", services.EventCallbackProcessed); err != nil {
+			t.Fatalf("failed to complete capture %d: %v", i, err)
+		}
+		expected := "AUTHORIZED"
+		if i == 2 {
+			expected = "CAPTURED"
+		}
+		expectAuthorizationStatus(t, repos, authorization.ID, expected)
+	}
+
+	if fmt.Sprint(amounts) != "[33 33 34]" || fmt.Sprint(fees) != "[0.33 0.33 0.34]" {
+		t.Errorf("Unexpected captures of %v with fees of %v", amounts, fees)
+	}
+	if _, err := processor.ProcessCapture(ctx, authorization.ID, 0); !errors.Is(err, services.ErrNotCapturable) {
+		t.Errorf("Expected ErrNotCapturable once captured in full, got: %v", err)
+	}
+	if len(sent) != 3 {
+		t.Errorf("Expected 3 captures sent to the gateway, got %d", len(sent))
+	}
+}
+
+// TestProcessCaptureFailsAfterAcceptance has the gateway accept a capture and fail it in its
+// callback, which must leave the authorization to be captured again or voided
+func TestProcessCaptureFailsAfterAcceptance(t *testing.T) {
+	ctx := context.Background()
+	repos := newMemoryRepos(t)
+
+	var sent []*gateway.Request
+	authorization := &models.Transaction{Amount: 100, Currency: "EUR", Type: "authorization", Status: "AUTHORIZED", UserID: 123}
+	processor := newCaptureProcessor(t, repos, authorization, &sent)
+	callbacks := newCaptureCallbacks(repos)
+
+	capture, err := processor.ProcessCapture(ctx, authorization.ID, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := callbacks.ApplyStatus(ctx, capture.ID, "FAILED", services.EventCallbackProcessed); err != nil {
+		t.Fatalf("failed to fail capture: %v", err)
+	}
+	expectAuthorizationStatus(t, repos, authorization.ID, "AUTHORIZED")
+
+	retried, err := processor.ProcessCapture(ctx, authorization.ID, 0)
+	if err != nil {
+		t.Fatalf("Expected the capture to be retried, got: %v", err)
+	}
+	if retried.Amount != 100 {
+		t.Errorf("Expected the whole authorization captured again, got %.2f", retried.Amount)
+	}
+	if err := callbacks.ApplyStatus(ctx, retried.ID, "FAILED", services.EventCallbackProcessed); err != nil {
+		t.Fatalf("failed to fail capture: %v", err)
+	}
+
+	if _, err := processor.VoidAuthorization(ctx, authorization.ID); err != nil {
+		t.Fatalf("Expected the authorization to be voided, got: %v", err)
+	}
+	expectAuthorizationStatus(t, repos, authorization.ID, "VOIDED")
+}
+
+func TestVoidAuthorization(t *testing.T) {
+	authorization := models.Transaction{
+		ID:               456,
+		Amount:           100,
+		Currency:         "EUR",
+		Type:             "authorization",
+		Status:           "AUTHORIZED",
+		GatewayID:        2,
+		GatewayReference: "ch_123",
+	}
+	captured := authorization
+	captured.Status = "CAPTURED"
+
+	tests := []struct {
+		name          string
+		authorization models.Transaction
+		statusCode    int
+		expectedErr   error
+	}{
+		{name: "Voided", authorization: authorization, statusCode: 200},
+		{name: "Refused By Gateway", authorization: authorization, statusCode: 400, expectedErr: services.ErrAlreadySettled},
+		{name: "Already Captured", authorization: captured, expectedErr: services.ErrAlreadySettled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent *gateway.Request
+			var statuses []string
+
+			transactionRepo := &mockTransactionRepo{
+				mockGetByID: func(ctx context.Context, transactionID int) (*models.Transaction, error) {
+					stored := tt.authorization
+					return &stored, nil
+				},
+				mockUpdateStatus: func(ctx context.Context, transactionID int, status string) error {
+					statuses = append(statuses, status)
+					return nil
+				},
+			}
+
+			gatewayRepo := &mockGatewayRepo{
+				mockFindByID: func(ctx context.Context, id int) (*models.Gateway, error) {
+					return &models.Gateway{ID: id, Name: "stripe", DataFormatSupported: "application/json"}, nil
+				},
+			}
+
+			client := &mockClient{
+				mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+					sent = request
+					result := &gateway.Result{StatusCode: tt.statusCode}
+					if tt.statusCode >= 400 {
+						return result, errors.New("gateway returned non-success status")
+					}
+					return result, nil
+				},
+			}
+
+			gatewayConfig := &mockGatewayConfigProvider{
+				mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+					return config.GatewayDetails{
+						Endpoints: config.GatewayEndpoints{Void: "/v1/refunds"},
+						Retry:     config.GatewayRetry{MaxAttempts: 1},
+					}, true
+				},
+			}
+
+			processor := services.NewTransactionProcessor(gatewayConfig, &mockGatewaySelectorProvider{}, transactionRepo, gatewayRepo, client)
+
+			voided, err := processor.VoidAuthorization(context.Background(), authorization.ID)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got: %v", tt.expectedErr, err)
+				}
+				if len(statuses) != 0 {
+					t.Errorf("Expected the status to be left alone, got %v", statuses)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if sent == nil || sent.TransactionType != "void" || sent.OriginalReference != "ch_123" {
+				t.Errorf("Unexpected gateway request: %+v", sent)
+			}
+			if voided.Status != "VOIDED" || len(statuses) != 1 || statuses[0] != "VOIDED" {
+				t.Errorf("Expected the authorization to move to VOIDED, got %s and %v", voided.Status, statuses)
+			}
+		})
+	}
+}
+
+func TestApplyStatusCompletedAuthorization(t *testing.T) {
+	ctx := context.Background()
+	repos := newMemoryRepos(t)
+
+	authorization := &models.Transaction{Amount: 100, Currency: "EUR", Type: "authorization", Status: "PROCESSING", GatewayID: repos.gateway.ID, UserID: 1}
+	if err := repos.transactions.Create(ctx, authorization); err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+
+	processor := services.NewCallbackProcessor(repos.transactions, repos.gateways, services.WithCallbackUnitOfWork(repos.unitOfWork))
+	if err := processor.ApplyStatus(ctx, authorization.ID, "COMPLETED", services.EventCallbackProcessed); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	stored, err := repos.transactions.GetByID(ctx, authorization.ID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if stored.Status != "AUTHORIZED" {
+		t.Errorf("Expected the completed authorization to be AUTHORIZED, got %s", stored.Status)
+	}
+}
+
+// TestCaptureVoidRace voids an authorization while its capture is on its way to the gateway
+// and the other way round: the void releases what is left and the capture completing later
+// doesn't move the voided authorization to CAPTURED
+func TestCaptureVoidRace(t *testing.T) {
+	tests := []struct {
+		name  string
+		first string
+	}{
+		{name: "Voided During Capture", first: "capture"},
+		{name: "Captured During Void", first: "void"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := newMemoryRepos(t)
+
+			authorization := &models.Transaction{Amount: 100, Currency: "EUR", Type: "authorization", Status: "PENDING", GatewayID: repos.gateway.ID, UserID: 1}
+			if err := repos.transactions.Create(ctx, authorization); err != nil {
+				t.Fatalf("failed to create transaction: %v", err)
+			}
+			if err := repos.transactions.SetGatewayReference(ctx, authorization.ID, "ch_1"); err != nil {
+				t.Fatalf("failed to set gateway reference: %v", err)
+			}
+			if err := repos.transactions.UpdateStatus(ctx, authorization.ID, "AUTHORIZED"); err != nil {
+				t.Fatalf("failed to update status: %v", err)
+			}
+
+			gatewayConfig := &mockGatewayConfigProvider{
+				mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+					return config.GatewayDetails{
+						Endpoints: config.GatewayEndpoints{Capture: "/v1/charges/{reference}/capture", Void: "/v1/charges/{reference}/void"},
+						Retry:     config.GatewayRetry{MaxAttempts: 1},
+					}, true
+				},
+			}
+
+			var (
+				processor *services.TransactionProcessor
+				capture   *models.Transaction
+				secondErr error
+				sent      []string
+			)
+			client := &mockClient{
+				mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+					sent = append(sent, request.TransactionType)
+					if request.TransactionType == tt.first && len(sent) == 1 {
+						if tt.first == "capture" {
+							_, secondErr = processor.VoidAuthorization(ctx, authorization.ID)
+						} else {
+							capture, secondErr = processor.ProcessCapture(ctx, authorization.ID, 0)
+						}
+					}
+					return &gateway.Result{StatusCode: 200}, nil
+				},
+			}
+
+			processor = services.NewTransactionProcessor(
+				gatewayConfig,
+				&mockGatewaySelectorProvider{},
+				repos.transactions,
+				repos.gateways,
+				client,
+				services.WithUnitOfWork(repos.unitOfWork),
+			)
+
+			var firstErr error
+			if tt.first == "capture" {
+				capture, firstErr = processor.ProcessCapture(ctx, authorization.ID, 0)
+			} else {
+				_, firstErr = processor.VoidAuthorization(ctx, authorization.ID)
+			}
+
+			if firstErr != nil || secondErr != nil {
+				t.Fatalf("Expected both requests to go through, got %v and %v", firstErr, secondErr)
+			}
+			expectAuthorizationStatus(t, repos, authorization.ID, "VOIDED")
+
+			if err := newCaptureCallbacks(repos).ApplyStatus(ctx, capture.ID, "COMPLETED", services.EventCallbackProcessed); err != nil {
+				t.Fatalf("failed to complete capture: %v", err)
+			}
+			expectAuthorizationStatus(t, repos, authorization.ID, "VOIDED")
+		})
+	}
+}
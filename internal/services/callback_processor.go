@@ -12,19 +12,73 @@ import (
 	"time"
 )
 
+// CallbackProcessorOption customises a CallbackProcessor
+type CallbackProcessorOption func(*CallbackProcessor)
+
+// WithCallbackOutcomeRecorder reports the final outcome of every transaction a gateway calls back for
+func WithCallbackOutcomeRecorder(recorder OutcomeRecorder) CallbackProcessorOption {
+	return func(p *CallbackProcessor) {
+		p.outcomeRecorder = recorder
+	}
+}
+
+// WithCallbackLedger records the ledger entries of the statuses gateways call back with
+func WithCallbackLedger(ledger LedgerRecorder) CallbackProcessorOption {
+	return func(p *CallbackProcessor) {
+		p.ledger = ledger
+	}
+}
+
+// WithCallbackUnitOfWork reads and updates transactions in one database transaction, so that
+// concurrent callbacks for a transaction are applied one after the other
+func WithCallbackUnitOfWork(unitOfWork repository.UnitOfWork) CallbackProcessorOption {
+	return func(p *CallbackProcessor) {
+		p.unitOfWork = unitOfWork
+	}
+}
+
+// Event types of the status updates published by the CallbackProcessor
+const (
+	EventCallbackProcessed  = "callback_processed"
+	EventStatusPolled       = "status_polled"
+	EventTransactionExpired = "transaction_expired"
+)
+
+type callbackTransactionKey struct{}
+
+// ContextWithCallbackTransaction records the transaction a callback URL was issued for;
+// a callback whose payload names another transaction is rejected
+func ContextWithCallbackTransaction(ctx context.Context, transactionID int) context.Context {
+	return context.WithValue(ctx, callbackTransactionKey{}, transactionID)
+}
+
 type CallbackProcessor struct {
 	transactionRepo repository.Transaction
 	gatewayRepo     repository.Gateway
+	outcomeRecorder OutcomeRecorder
+	ledger          LedgerRecorder
+	unitOfWork      repository.UnitOfWork
 }
 
 func NewCallbackProcessor(
 	transactionRepo repository.Transaction,
 	gatewayRepo repository.Gateway,
+	opts ...CallbackProcessorOption,
 ) *CallbackProcessor {
-	return &CallbackProcessor{
+	processor := &CallbackProcessor{
 		transactionRepo: transactionRepo,
 		gatewayRepo:     gatewayRepo,
+		unitOfWork: autocommit{repository.Repositories{
+			Transactions: transactionRepo,
+			Gateways:     gatewayRepo,
+		}},
 	}
+
+	for _, opt := range opts {
+		opt(processor)
+	}
+
+	return processor
 }
 
 func (p *CallbackProcessor) ProcessCallback(ctx context.Context, gatewayName string, callbackData []byte) error {
@@ -33,13 +87,66 @@ func (p *CallbackProcessor) ProcessCallback(ctx context.Context, gatewayName str
 		return fmt.Errorf("failed to parse callback data: %w", err)
 	}
 
-	if err := p.transactionRepo.UpdateStatus(ctx, transactionID, status); err != nil {
-		return fmt.Errorf("failed to update transaction status: %w", err)
+	if expected, ok := ctx.Value(callbackTransactionKey{}).(int); ok && expected != transactionID {
+		return &ValidationError{Message: fmt.Sprintf("callback for transaction %d was sent to the URL of transaction %d", transactionID, expected)}
 	}
 
-	transaction, err := p.transactionRepo.GetByID(ctx, transactionID)
-	if err != nil {
-		return fmt.Errorf("failed to get transaction: %w", err)
+	return p.ApplyStatus(ctx, transactionID, status, EventCallbackProcessed)
+}
+
+// ApplyStatus moves a transaction to a status its gateway reported, recording its ledger entry
+// and outcome and publishing an event of the given type. Repeated statuses are ignored, as are
+// intermediate statuses reported once the transaction is final.
+// A completed capture moves its authorization to CAPTURED once the completed captures add up to
+// its amount.
+func (p *CallbackProcessor) ApplyStatus(ctx context.Context, transactionID int, status, eventType string) error {
+	var transaction, captured *models.Transaction
+	applied := false
+	err := p.unitOfWork.Do(ctx, func(repos repository.Repositories) error {
+		var err error
+		transaction, err = repos.Transactions.GetByIDForUpdate(ctx, transactionID)
+		if err != nil {
+			return fmt.Errorf("failed to get transaction: %w", err)
+		}
+
+		// Gateways report the authorizations they approved as completed
+		if transaction.Type == "authorization" && status == StatusCompleted {
+			status = StatusAuthorized
+		}
+
+		// Gateways may repeat callbacks or deliver them out of order
+		if transaction.Status == status {
+			return nil
+		}
+		if err := CheckTransition(transaction.Status, status); err != nil {
+			if IsFinalStatus(transaction.Status) && !IsFinalStatus(status) {
+				fmt.Printf("ignoring stale %s status for transaction %d, already %s\n", status, transactionID, transaction.Status)
+				return nil
+			}
+			return fmt.Errorf("transaction %d: %w", transactionID, err)
+		}
+
+		// The entry commits with the status, the locked transaction can't be written to
+		// from outside the unit of work
+		if p.ledger != nil {
+			updated := *transaction
+			updated.Status = status
+			if err := p.ledger.In(repos).RecordTransaction(ctx, &updated); err != nil {
+				return err
+			}
+		}
+
+		if err := repos.Transactions.UpdateStatus(ctx, transactionID, status); err != nil {
+			return fmt.Errorf("failed to update transaction status: %w", err)
+		}
+		transaction.Status = status
+		applied = true
+
+		captured, err = settleAuthorization(ctx, repos, transaction)
+		return err
+	})
+	if err != nil || !applied {
+		return err
 	}
 
 	gateway, err := p.gatewayRepo.FindByID(ctx, transaction.GatewayID)
@@ -47,17 +154,54 @@ func (p *CallbackProcessor) ProcessCallback(ctx context.Context, gatewayName str
 		return fmt.Errorf("failed to find gateway: %w", err)
 	}
 
+	p.recordOutcome(gateway, transaction)
+
 	err = PublishWithCircuitBreaker(func() error {
-		return p.publishTransactionEvent(ctx, transaction, gateway.DataFormatSupported)
+		return p.publishTransactionEvent(ctx, transaction, eventType, gateway.DataFormatSupported)
 	})
 
 	if err != nil {
 		fmt.Printf("failed to publish transaction update event: %v\n", err)
 	}
 
+	if captured != nil {
+		err = PublishWithCircuitBreaker(func() error {
+			return p.publishTransactionEvent(ctx, captured, eventType, gateway.DataFormatSupported)
+		})
+		if err != nil {
+			fmt.Printf("failed to publish authorization update event: %v\n", err)
+		}
+	}
+
+	if transaction.Type == "refund" && transaction.Status == StatusCompleted {
+		err = PublishWithCircuitBreaker(func() error {
+			return p.publishRefundedEvent(ctx, transaction, gateway.DataFormatSupported)
+		})
+		if err != nil {
+			fmt.Printf("failed to publish refund event: %v\n", err)
+		}
+	}
+
 	return nil
 }
 
+// recordOutcome feeds final transaction statuses back into the routing statistics
+func (p *CallbackProcessor) recordOutcome(gateway *models.Gateway, transaction *models.Transaction) {
+	if p.outcomeRecorder == nil {
+		return
+	}
+
+	// Only the final statuses that tell a success from a failure are scored
+	switch transaction.Status {
+	case StatusCompleted, StatusFailed, StatusDeclined, StatusRejected:
+	default:
+		return
+	}
+
+	// How long the transaction took to settle says nothing of the gateway's latency
+	p.outcomeRecorder.RecordResult(gateway.Name, transaction.CountryID, transaction.Status == StatusCompleted)
+}
+
 func (p *CallbackProcessor) parseCallbackData(ctx context.Context, gatewayName string, callbackData []byte) (int, string, error) {
 	gateway, err := p.gatewayRepo.FindByName(ctx, gatewayName)
 	if err != nil {
@@ -71,19 +215,19 @@ func (p *CallbackProcessor) parseCallbackData(ctx context.Context, gatewayName s
 	case "application/json":
 		var callbackJSON map[string]interface{}
 		if err := json.Unmarshal(callbackData, &callbackJSON); err != nil {
-			return 0, "", fmt.Errorf("failed to parse JSON callback data: %w", err)
+			return 0, "", fmt.Errorf("%w: failed to parse JSON callback data: %v", ErrValidation, err)
 		}
 
 		if txID, ok := callbackJSON["transaction_id"].(float64); ok {
 			transactionID = int(txID)
 		} else {
-			return 0, "", fmt.Errorf("invalid transaction ID in callback")
+			return 0, "", &ValidationError{Message: "invalid transaction ID in callback"}
 		}
 
 		if txStatus, ok := callbackJSON["status"].(string); ok {
 			status = txStatus
 		} else {
-			return 0, "", fmt.Errorf("invalid status in callback")
+			return 0, "", &ValidationError{Message: "invalid status in callback"}
 		}
 
 	case "text/xml", "application/xml":
@@ -93,8 +237,12 @@ func (p *CallbackProcessor) parseCallbackData(ctx context.Context, gatewayName s
 		}
 
 		var callbackXML XMLCallback
-		if err := xml.Unmarshal(callbackData, &callbackXML); err != nil {
-			return 0, "", fmt.Errorf("failed to parse XML callback data: %w", err)
+		if IsSOAPEnvelope(callbackData) {
+			if err := DecodeSOAP(callbackData, &callbackXML); err != nil {
+				return 0, "", fmt.Errorf("%w: failed to parse SOAP callback data: %v", ErrValidation, err)
+			}
+		} else if err := xml.Unmarshal(callbackData, &callbackXML); err != nil {
+			return 0, "", fmt.Errorf("%w: failed to parse XML callback data: %v", ErrValidation, err)
 		}
 
 		transactionID = callbackXML.TransactionID
@@ -110,6 +258,7 @@ func (p *CallbackProcessor) parseCallbackData(ctx context.Context, gatewayName s
 func (p *CallbackProcessor) publishTransactionEvent(
 	ctx context.Context,
 	transaction *models.Transaction,
+	eventType string,
 	dataFormat string,
 ) error {
 	message := map[string]interface{}{
@@ -120,7 +269,7 @@ func (p *CallbackProcessor) publishTransactionEvent(
 		"gateway_id":     transaction.GatewayID,
 		"user_id":        transaction.UserID,
 		"timestamp":      time.Now().Unix(),
-		"event_type":     "callback_processed",
+		"event_type":     eventType,
 	}
 
 	messageBytes, err := json.Marshal(message)
@@ -130,3 +279,30 @@ func (p *CallbackProcessor) publishTransactionEvent(
 
 	return kafka.PublishTransaction(ctx, strconv.Itoa(transaction.ID), messageBytes, dataFormat)
 }
+
+// publishRefundedEvent announces a completed refund of a deposit
+func (p *CallbackProcessor) publishRefundedEvent(
+	ctx context.Context,
+	refund *models.Transaction,
+	dataFormat string,
+) error {
+	message := map[string]interface{}{
+		"event_type":     "transaction.refunded",
+		"transaction_id": refund.ID,
+		"amount":         refund.Amount,
+		"currency":       refund.Currency,
+		"gateway_id":     refund.GatewayID,
+		"user_id":        refund.UserID,
+		"timestamp":      time.Now().Unix(),
+	}
+	if refund.ParentID != nil {
+		message["parent_transaction_id"] = *refund.ParentID
+	}
+
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	return kafka.PublishTransaction(ctx, strconv.Itoa(refund.ID), messageBytes, dataFormat)
+}
@@ -40,6 +40,44 @@ func PrepareTransactionPayload(
 	currency string,
 	dataFormat string,
 ) ([]byte, error) {
+	return prepareTransactionPayload(transaction, currency, dataFormat, "")
+}
+
+// PrepareReferencedPayload encodes a transaction applying to an earlier one, a refund or
+// capture, along with the gateway reference of the earlier transaction
+func PrepareReferencedPayload(
+	transaction *models.Transaction,
+	originalReference string,
+	dataFormat string,
+) ([]byte, error) {
+	return prepareTransactionPayload(transaction, transaction.Currency, dataFormat, originalReference)
+}
+
+// PrepareCancelPayload encodes the cancellation of a transaction along with its gateway reference.
+// requestType is "cancel" for withdrawals and "void" for authorizations.
+func PrepareCancelPayload(
+	transaction *models.Transaction,
+	requestType string,
+	dataFormat string,
+) ([]byte, error) {
+	cancel := *transaction
+	cancel.Type = requestType
+	return prepareTransactionPayload(&cancel, transaction.Currency, dataFormat, transaction.GatewayReference)
+}
+
+// PrepareStatusPayload encodes the status lookup of a transaction along with its gateway reference
+func PrepareStatusPayload(transaction *models.Transaction, dataFormat string) ([]byte, error) {
+	lookup := *transaction
+	lookup.Type = "status"
+	return prepareTransactionPayload(&lookup, transaction.Currency, dataFormat, transaction.GatewayReference)
+}
+
+func prepareTransactionPayload(
+	transaction *models.Transaction,
+	currency string,
+	dataFormat string,
+	originalReference string,
+) ([]byte, error) {
 
 	if dataFormat == "application/json" {
 		payloadData := map[string]interface{}{
@@ -48,22 +86,27 @@ func PrepareTransactionPayload(
 			"currency":       currency,
 			"type":           transaction.Type,
 		}
+		if originalReference != "" {
+			payloadData["original_reference"] = originalReference
+		}
 		return EncodePayload(payloadData, dataFormat)
 	}
 
 	if dataFormat == "text/xml" || dataFormat == "application/xml" {
 		type XMLPayload struct {
-			TransactionID int     `xml:"transaction_id"`
-			Amount        float64 `xml:"amount"`
-			Currency      string  `xml:"currency"`
-			Type          string  `xml:"type"`
+			TransactionID     int     `xml:"transaction_id"`
+			Amount            float64 `xml:"amount"`
+			Currency          string  `xml:"currency"`
+			Type              string  `xml:"type"`
+			OriginalReference string  `xml:"original_reference,omitempty"`
 		}
 
 		xmlPayload := XMLPayload{
-			TransactionID: transaction.ID,
-			Amount:        transaction.Amount,
-			Currency:      currency,
-			Type:          transaction.Type,
+			TransactionID:     transaction.ID,
+			Amount:            transaction.Amount,
+			Currency:          currency,
+			Type:              transaction.Type,
+			OriginalReference: originalReference,
 		}
 
 		return EncodePayload(xmlPayload, dataFormat)
@@ -0,0 +1,27 @@
+package services
+
+import "errors"
+
+var (
+	// ErrValidation is returned when a request is invalid, see ValidationError
+	ErrValidation = errors.New("invalid request")
+	// ErrGatewayUnavailable is returned when no gateway can take a transaction, or the one
+	// chosen couldn't be reached
+	ErrGatewayUnavailable = errors.New("gateway unavailable")
+	// ErrDeclined is returned when the gateway turned a transaction down
+	ErrDeclined = errors.New("transaction declined")
+)
+
+// ValidationError tells what is wrong with a request, it is ErrValidation. Its message is
+// meant for the client.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
@@ -6,53 +6,94 @@ import (
 	"payment-gateway/internal/config"
 	"payment-gateway/internal/models"
 	"payment-gateway/internal/repository"
+	"time"
 )
 
+// GatewaySelection is the gateway picked for a transaction along with the fee it charges
+type GatewaySelection struct {
+	Gateway  *models.Gateway
+	Country  *models.Country
+	Fee      float64
+	Strategy string
+}
+
+// GatewaySelectorOption customises a GatewaySelector
+type GatewaySelectorOption func(*GatewaySelector)
+
+// WithRoutingStrategy overrides the strategy configured under routing.strategy
+func WithRoutingStrategy(strategy RoutingStrategy) GatewaySelectorOption {
+	return func(s *GatewaySelector) {
+		s.strategy = strategy
+	}
+}
+
+// WithMaintenanceSchedule makes the selector skip gateways during their maintenance windows
+func WithMaintenanceSchedule(schedule *MaintenanceSchedule) GatewaySelectorOption {
+	return func(s *GatewaySelector) {
+		s.maintenance = schedule
+	}
+}
+
+// WithRoutingOverrides makes the selector honour the per-user and per-merchant
+// overrides before the country priorities
+func WithRoutingOverrides(overrideRepo repository.RoutingOverride) GatewaySelectorOption {
+	return func(s *GatewaySelector) {
+		s.overrideRepo = overrideRepo
+	}
+}
+
 // GatewaySelector implements the GatewaySelectorProvider interface
 type GatewaySelector struct {
 	gatewayConfig *config.GatewayConfig
 	countryRepo   repository.Country
 	gatewayRepo   repository.Gateway
 	userRepo      repository.User
+	overrideRepo  repository.RoutingOverride
+	strategy      RoutingStrategy
+	maintenance   *MaintenanceSchedule
 }
 
+// NewGatewaySelector routes with the strategy configured under routing.strategy unless
+// WithRoutingStrategy overrides it, failing when that strategy is unknown
 func NewGatewaySelector(
 	gatewayConfig *config.GatewayConfig,
 	countryRepo repository.Country,
 	gatewayRepo repository.Gateway,
 	userRepo repository.User,
-) *GatewaySelector {
-	return &GatewaySelector{
+	opts ...GatewaySelectorOption,
+) (*GatewaySelector, error) {
+	selector := &GatewaySelector{
 		gatewayConfig: gatewayConfig,
 		countryRepo:   countryRepo,
 		gatewayRepo:   gatewayRepo,
 		userRepo:      userRepo,
 	}
-}
-
-func (s *GatewaySelector) SelectGateway(ctx context.Context, countryCode string) (*models.Gateway, error) {
 
-	countryConfig, exists := s.gatewayConfig.Countries[countryCode]
-
-	if !exists {
-		return nil, fmt.Errorf("no configuration found for country %s", countryCode)
+	for _, opt := range opts {
+		opt(selector)
 	}
 
-	if len(countryConfig.Gateways) == 0 {
-		return nil, fmt.Errorf("no gateways defined for country: %s", countryCode)
+	if selector.strategy == nil {
+		strategy, err := NewRoutingStrategy(gatewayConfig.Routing)
+		if err != nil {
+			return nil, err
+		}
+		selector.strategy = strategy
 	}
 
-	var highestPriority int = -1
-	var highestPriorityGateway string
+	return selector, nil
+}
 
-	for gateway, priority := range countryConfig.Gateways {
-		if priority > highestPriority {
-			highestPriority = priority
-			highestPriorityGateway = gateway
-		}
+// SelectGateway returns the highest priority gateway configured for a country
+func (s *GatewaySelector) SelectGateway(ctx context.Context, countryCode string) (*models.Gateway, error) {
+	candidates, err := s.candidates(RoutingRequest{}, countryCode)
+	if err != nil {
+		return nil, err
 	}
 
-	gateway, err := s.gatewayRepo.FindByName(ctx, highestPriorityGateway)
+	ranked := PriorityStrategy{}.Rank(ctx, RoutingRequest{}, nil, candidates)
+
+	gateway, err := s.gatewayRepo.FindByName(ctx, ranked[0].Name)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to find gateway: %w", err)
@@ -61,9 +102,10 @@ func (s *GatewaySelector) SelectGateway(ctx context.Context, countryCode string)
 	return gateway, nil
 }
 
-func (s *GatewaySelector) SelectGatewayForUser(ctx context.Context, userID int) (*models.Gateway, error) {
+// SelectGatewayForUser picks the gateway for a user's transaction using the configured routing strategy
+func (s *GatewaySelector) SelectGatewayForUser(ctx context.Context, request RoutingRequest) (*GatewaySelection, error) {
 
-	user, err := s.userRepo.FindByID(ctx, userID)
+	user, err := s.userRepo.FindByID(ctx, request.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find user: %w", err)
 	}
@@ -73,5 +115,121 @@ func (s *GatewaySelector) SelectGatewayForUser(ctx context.Context, userID int)
 		return nil, fmt.Errorf("failed to find country for user: %w", err)
 	}
 
-	return s.SelectGateway(ctx, country.Code)
+	if request.Currency == "" {
+		request.Currency = country.Currency
+	}
+
+	selection, err := s.selectOverride(ctx, request, country)
+	if err != nil || selection != nil {
+		return selection, err
+	}
+
+	candidates, err := s.candidates(request, country.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	ranked := s.strategy.Rank(ctx, request, country, candidates)
+	if len(ranked) == 0 {
+		return nil, fmt.Errorf("%w: no eligible gateway for country: %s", ErrGatewayUnavailable, country.Code)
+	}
+
+	gateway, err := s.gatewayRepo.FindByName(ctx, ranked[0].Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find gateway: %w", err)
+	}
+
+	return &GatewaySelection{
+		Gateway:  gateway,
+		Country:  country,
+		Fee:      ranked[0].Fee,
+		Strategy: s.strategy.Name(),
+	}, nil
+}
+
+// selectOverride returns the gateway forced by a routing override, or nil when none applies
+func (s *GatewaySelector) selectOverride(ctx context.Context, request RoutingRequest, country *models.Country) (*GatewaySelection, error) {
+	if s.overrideRepo == nil {
+		return nil, nil
+	}
+
+	overrides, err := s.overrideRepo.FindActive(ctx, request.UserID, request.MerchantID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find routing overrides: %w", err)
+	}
+
+	override := matchRoutingOverride(overrides, request, country.Code)
+	if override == nil {
+		return nil, nil
+	}
+
+	details, exists := s.gatewayConfig.GetGatewayDetails(override.Gateway)
+	if !exists {
+		return nil, fmt.Errorf("gateway %s required by routing override %d not found in configuration", override.Gateway, override.ID)
+	}
+
+	if request.TransactionType == "authorization" && details.Endpoints.Authorize == "" {
+		return nil, fmt.Errorf("%w: gateway %s required by routing override %d can't authorize", ErrGatewayUnavailable, override.Gateway, override.ID)
+	}
+
+	// Overrides exist for contractual and risk reasons, so never route around them
+	if s.maintenance != nil && s.maintenance.IsUnderMaintenance(override.Gateway, country.Code) {
+		return nil, fmt.Errorf("%w: gateway %s required by routing override %d is under maintenance", ErrGatewayUnavailable, override.Gateway, override.ID)
+	}
+
+	gateway, err := s.gatewayRepo.FindByName(ctx, override.Gateway)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find gateway: %w", err)
+	}
+
+	fee, _ := details.CalculateFee(country.Code, request.Currency, request.TransactionType, request.Amount)
+
+	return &GatewaySelection{
+		Gateway:  gateway,
+		Country:  country,
+		Fee:      fee,
+		Strategy: routingOverrideStrategy,
+	}, nil
+}
+
+// candidates lists the gateways configured for a country that are not under
+// maintenance, with the fee each would charge
+func (s *GatewaySelector) candidates(request RoutingRequest, countryCode string) ([]RoutingCandidate, error) {
+	countryConfig, exists := s.gatewayConfig.Countries[countryCode]
+
+	if !exists {
+		return nil, fmt.Errorf("%w: no configuration found for country %s", ErrGatewayUnavailable, countryCode)
+	}
+
+	if len(countryConfig.Gateways) == 0 {
+		return nil, fmt.Errorf("%w: no gateways defined for country: %s", ErrGatewayUnavailable, countryCode)
+	}
+
+	candidates := make([]RoutingCandidate, 0, len(countryConfig.Gateways))
+	for name, priority := range countryConfig.Gateways {
+		if s.maintenance != nil && s.maintenance.IsUnderMaintenance(name, countryCode) {
+			continue
+		}
+
+		candidate := RoutingCandidate{Name: name, Priority: priority}
+
+		if details, ok := s.gatewayConfig.GetGatewayDetails(name); ok {
+			// Not every gateway can authorize without capturing
+			if request.TransactionType == "authorization" && details.Endpoints.Authorize == "" {
+				continue
+			}
+			candidate.Fee, candidate.HasFee = details.CalculateFee(countryCode, request.Currency, request.TransactionType, request.Amount)
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	if len(candidates) == 0 {
+		if request.TransactionType == "authorization" {
+			return nil, fmt.Errorf("%w: no gateway for country %s can authorize or all are under maintenance", ErrGatewayUnavailable, countryCode)
+		}
+		return nil, fmt.Errorf("%w: all gateways for country %s are under maintenance", ErrGatewayUnavailable, countryCode)
+	}
+
+	return candidates, nil
 }
@@ -0,0 +1,378 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository/memory"
+	"payment-gateway/internal/services"
+	"testing"
+	"time"
+)
+
+// Mock implementation of the User repository
+type mockUserRepo struct {
+	mockFindByID func(ctx context.Context, id int) (*models.User, error)
+}
+
+func (m *mockUserRepo) FindByID(ctx context.Context, id int) (*models.User, error) {
+	return m.mockFindByID(ctx, id)
+}
+
+// Mock implementation of the Country repository
+type mockCountryRepo struct {
+	mockFindByID func(ctx context.Context, id int) (*models.Country, error)
+}
+
+func (m *mockCountryRepo) FindByID(ctx context.Context, id int) (*models.Country, error) {
+	return m.mockFindByID(ctx, id)
+}
+
+// Mock implementation of the Gateway repository
+type mockGatewayRepo struct {
+	mockFindByID   func(ctx context.Context, id int) (*models.Gateway, error)
+	mockFindByName func(ctx context.Context, name string) (*models.Gateway, error)
+}
+
+func (m *mockGatewayRepo) FindByID(ctx context.Context, id int) (*models.Gateway, error) {
+	return m.mockFindByID(ctx, id)
+}
+
+func (m *mockGatewayRepo) FindByName(ctx context.Context, name string) (*models.Gateway, error) {
+	return m.mockFindByName(ctx, name)
+}
+
+// Mock implementation of the RoutingOverride repository
+type mockRoutingOverrideRepo struct {
+	overrides []models.RoutingOverride
+}
+
+func (m *mockRoutingOverrideRepo) Create(ctx context.Context, override *models.RoutingOverride) error {
+	override.ID = len(m.overrides) + 1
+	m.overrides = append(m.overrides, *override)
+	return nil
+}
+
+func (m *mockRoutingOverrideRepo) Delete(ctx context.Context, id int) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (m *mockRoutingOverrideRepo) List(ctx context.Context) ([]models.RoutingOverride, error) {
+	return m.overrides, nil
+}
+
+func (m *mockRoutingOverrideRepo) FindActive(ctx context.Context, userID int, merchantID string, at time.Time) ([]models.RoutingOverride, error) {
+	var active []models.RoutingOverride
+	for _, override := range m.overrides {
+		if override.ExpiresAt != nil && !override.ExpiresAt.After(at) {
+			continue
+		}
+		if (override.UserID != nil && *override.UserID == userID) || (merchantID != "" && override.MerchantID == merchantID) {
+			active = append(active, override)
+		}
+	}
+	return active, nil
+}
+
+// newTestSelector builds a selector for a single user living in the given country
+func newTestSelector(t *testing.T, gatewayConfig *config.GatewayConfig, country *models.Country, opts ...services.GatewaySelectorOption) *services.GatewaySelector {
+	userRepo := &mockUserRepo{
+		mockFindByID: func(ctx context.Context, id int) (*models.User, error) {
+			return &models.User{ID: id, CountryID: country.ID}, nil
+		},
+	}
+
+	countryRepo := &mockCountryRepo{
+		mockFindByID: func(ctx context.Context, id int) (*models.Country, error) {
+			if id != country.ID {
+				return nil, fmt.Errorf("country with ID %d not found", id)
+			}
+			return country, nil
+		},
+	}
+
+	gatewayRepo := &mockGatewayRepo{
+		mockFindByName: func(ctx context.Context, name string) (*models.Gateway, error) {
+			return &models.Gateway{ID: len(name), Name: name, DataFormatSupported: "application/json"}, nil
+		},
+	}
+
+	selector, err := services.NewGatewaySelector(gatewayConfig, countryRepo, gatewayRepo, userRepo, opts...)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return selector
+}
+
+func TestNewGatewaySelectorUnknownStrategy(t *testing.T) {
+	gatewayConfig := &config.GatewayConfig{Routing: config.RoutingConfig{Strategy: "random"}}
+
+	if _, err := services.NewGatewaySelector(gatewayConfig, &mockCountryRepo{}, &mockGatewayRepo{}, &mockUserRepo{}); err == nil {
+		t.Error("Expected an unknown routing strategy to be rejected")
+	}
+
+	// An explicit strategy replaces the configured one
+	if _, err := services.NewGatewaySelector(gatewayConfig, &mockCountryRepo{}, &mockGatewayRepo{}, &mockUserRepo{}, services.WithRoutingStrategy(services.PriorityStrategy{})); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
+
+func TestSelectGatewayForUser(t *testing.T) {
+	gatewayConfig := &config.GatewayConfig{
+		Gateways: map[string]config.GatewayDetails{
+			"paypal": {
+				Fees: []config.FeeSchedule{
+					{Percentage: 3.49, Fixed: 0.49},
+				},
+			},
+			"stripe": {
+				Fees: []config.FeeSchedule{
+					{Percentage: 2.9, Fixed: 0.30},
+					{Currency: "EUR", Percentage: 1.5, Fixed: 0.25},
+				},
+			},
+			"adyen": {},
+		},
+		Countries: map[string]config.CountryConfig{
+			"DE": {Gateways: map[string]int{"adyen": 10, "paypal": 8, "stripe": 5}},
+		},
+	}
+	country := &models.Country{ID: 3, Code: "DE", Currency: "EUR"}
+
+	tests := []struct {
+		name            string
+		strategy        string
+		request         services.RoutingRequest
+		expectedGateway string
+		expectedFee     float64
+	}{
+		{
+			name:            "Priority",
+			strategy:        config.RoutingStrategyPriority,
+			request:         services.RoutingRequest{UserID: 1, Amount: 100, Currency: "EUR", TransactionType: "deposit"},
+			expectedGateway: "adyen",
+			expectedFee:     0,
+		},
+		{
+			name:            "Cheapest",
+			strategy:        config.RoutingStrategyCost,
+			request:         services.RoutingRequest{UserID: 1, Amount: 100, Currency: "EUR", TransactionType: "deposit"},
+			expectedGateway: "stripe",
+			expectedFee:     1.75,
+		},
+		{
+			name:            "Defaults To Country Currency",
+			strategy:        config.RoutingStrategyCost,
+			request:         services.RoutingRequest{UserID: 1, Amount: 10, TransactionType: "deposit"},
+			expectedGateway: "stripe",
+			expectedFee:     0.40,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gatewayConfig.Routing.Strategy = tt.strategy
+			selector := newTestSelector(t, gatewayConfig, country)
+
+			selection, err := selector.SelectGatewayForUser(context.Background(), tt.request)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if selection.Gateway.Name != tt.expectedGateway {
+				t.Errorf("Expected gateway %s, got %s", tt.expectedGateway, selection.Gateway.Name)
+			}
+
+			if selection.Fee != tt.expectedFee {
+				t.Errorf("Expected fee %.2f, got %.2f", tt.expectedFee, selection.Fee)
+			}
+
+			if selection.Strategy != tt.strategy {
+				t.Errorf("Expected strategy %s, got %s", tt.strategy, selection.Strategy)
+			}
+		})
+	}
+}
+
+func TestCostStrategyFallsBackToPriority(t *testing.T) {
+	candidates := []services.RoutingCandidate{
+		{Name: "adyen", Priority: 10},
+		{Name: "soap_gateway", Priority: 3},
+		{Name: "stripe", Priority: 7},
+	}
+
+	ranked := services.CostStrategy{}.Rank(context.Background(), services.RoutingRequest{}, nil, candidates)
+
+	expected := []string{"adyen", "stripe", "soap_gateway"}
+	for i, name := range expected {
+		if ranked[i].Name != name {
+			t.Errorf("Expected %s at position %d, got %s", name, i, ranked[i].Name)
+		}
+	}
+}
+
+func TestSelectGatewayForUserSkipsMaintenance(t *testing.T) {
+	now := time.Now().UTC()
+	gatewayConfig := &config.GatewayConfig{
+		Gateways: map[string]config.GatewayDetails{
+			"adyen":  {},
+			"stripe": {},
+		},
+		Countries: map[string]config.CountryConfig{
+			"DE": {Gateways: map[string]int{"adyen": 10, "stripe": 5}},
+			"GB": {Gateways: map[string]int{"adyen": 10, "stripe": 5}},
+		},
+		Maintenance: []config.MaintenanceWindow{
+			{Gateway: "adyen", Countries: []string{"DE"}, Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+		},
+	}
+	windowRepo := memory.NewMaintenanceWindowRepo()
+	schedule := services.NewMaintenanceSchedule(gatewayConfig, windowRepo)
+	if err := schedule.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load maintenance windows: %v", err)
+	}
+	request := services.RoutingRequest{UserID: 1, Amount: 100, TransactionType: "deposit"}
+
+	selector := newTestSelector(t, gatewayConfig, &models.Country{ID: 3, Code: "DE"}, services.WithMaintenanceSchedule(schedule))
+	selection, err := selector.SelectGatewayForUser(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if selection.Gateway.Name != "stripe" {
+		t.Errorf("Expected stripe while adyen is under maintenance, got %s", selection.Gateway.Name)
+	}
+
+	// The window is scoped to DE only
+	selector = newTestSelector(t, gatewayConfig, &models.Country{ID: 4, Code: "GB"}, services.WithMaintenanceSchedule(schedule))
+	selection, err = selector.SelectGatewayForUser(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if selection.Gateway.Name != "adyen" {
+		t.Errorf("Expected adyen outside the maintenance scope, got %s", selection.Gateway.Name)
+	}
+
+	// Once every gateway is down there is nothing left to route to, on this instance and
+	// on the others once they reload the windows
+	if _, err := schedule.Add(context.Background(), config.MaintenanceWindow{Gateway: "stripe", Start: now.Add(-time.Hour), End: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Expected window to be added, got: %v", err)
+	}
+	other := services.NewMaintenanceSchedule(gatewayConfig, windowRepo)
+	if err := other.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load maintenance windows: %v", err)
+	}
+	for _, s := range []*services.MaintenanceSchedule{schedule, other} {
+		selector = newTestSelector(t, gatewayConfig, &models.Country{ID: 3, Code: "DE"}, services.WithMaintenanceSchedule(s))
+		if _, err := selector.SelectGatewayForUser(context.Background(), request); err == nil {
+			t.Error("Expected an error when every gateway is under maintenance")
+		}
+	}
+	if windows, err := other.List(context.Background()); err != nil || len(windows) != 2 {
+		t.Errorf("Expected the configured and the added window only, got %+v and %v", windows, err)
+	}
+
+	if _, err := schedule.Add(context.Background(), config.MaintenanceWindow{Gateway: "unknown", Start: now, End: now.Add(time.Hour)}); err == nil {
+		t.Error("Expected an error for an unknown gateway")
+	}
+	// The configured window can only be removed from the configuration, the one added can
+	windows, _ := other.List(context.Background())
+	var validationErr *services.ValidationError
+	if err := schedule.Remove(context.Background(), windows[0].ID); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a validation error removing a configured window, got: %v", err)
+	}
+	if err := schedule.Remove(context.Background(), windows[1].ID); err != nil {
+		t.Errorf("Expected the added window to be removed, got: %v", err)
+	}
+
+	// A window added to the configuration is picked up at the next start
+	gatewayConfig.Maintenance = append(gatewayConfig.Maintenance, config.MaintenanceWindow{Gateway: "stripe", Countries: []string{"GB"}, Start: now.Add(-time.Hour), End: now.Add(time.Hour)})
+	restarted := services.NewMaintenanceSchedule(gatewayConfig, windowRepo)
+	if err := restarted.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load maintenance windows: %v", err)
+	}
+	if !restarted.IsUnderMaintenance("stripe", "GB") {
+		t.Error("Expected the window added to the configuration to apply")
+	}
+}
+
+func TestSelectGatewayForUserHonoursOverrides(t *testing.T) {
+	gatewayConfig := &config.GatewayConfig{
+		Gateways: map[string]config.GatewayDetails{
+			"adyen":        {},
+			"paypal":       {},
+			"stripe":       {},
+			"soap_gateway": {},
+		},
+		Countries: map[string]config.CountryConfig{
+			"DE": {Gateways: map[string]int{"adyen": 10, "paypal": 8, "stripe": 5}},
+		},
+	}
+	country := &models.Country{ID: 3, Code: "DE", Currency: "EUR"}
+
+	vip := 1
+	expired := time.Now().Add(-time.Hour)
+	overrideRepo := &mockRoutingOverrideRepo{}
+	service := services.NewRoutingOverrideService(gatewayConfig, overrideRepo)
+	for _, override := range []models.RoutingOverride{
+		{UserID: &vip, Gateway: "paypal"},
+		{UserID: &vip, TransactionType: "withdrawal", Gateway: "stripe"},
+		{MerchantID: "acme", Gateway: "soap_gateway"},
+	} {
+		override := override
+		if err := service.Create(context.Background(), &override); err != nil {
+			t.Fatalf("Expected override to be created, got: %v", err)
+		}
+	}
+	overrideRepo.overrides = append(overrideRepo.overrides, models.RoutingOverride{ID: 4, UserID: &vip, Gateway: "adyen", ExpiresAt: &expired})
+
+	if err := service.Create(context.Background(), &models.RoutingOverride{Gateway: "paypal"}); err == nil {
+		t.Error("Expected an error for an override without user or merchant")
+	}
+
+	tests := []struct {
+		name             string
+		merchantID       string
+		request          services.RoutingRequest
+		expectedGateway  string
+		expectedStrategy string
+	}{
+		{"User Override", "", services.RoutingRequest{UserID: vip, TransactionType: "deposit"}, "paypal", "override"},
+		{"Most Specific Wins", "", services.RoutingRequest{UserID: vip, TransactionType: "withdrawal"}, "stripe", "override"},
+		{"Merchant Override", "acme", services.RoutingRequest{UserID: 2, TransactionType: "deposit"}, "soap_gateway", "override"},
+		{"No Override", "", services.RoutingRequest{UserID: 2, TransactionType: "deposit"}, "adyen", config.RoutingStrategyPriority},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector := newTestSelector(t, gatewayConfig, country, services.WithRoutingOverrides(overrideRepo))
+
+			ctx := services.ContextWithMerchantID(context.Background(), tt.merchantID)
+			tt.request.MerchantID = services.MerchantIDFromContext(ctx)
+
+			selection, err := selector.SelectGatewayForUser(ctx, tt.request)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if selection.Gateway.Name != tt.expectedGateway {
+				t.Errorf("Expected gateway %s, got %s", tt.expectedGateway, selection.Gateway.Name)
+			}
+
+			if selection.Strategy != tt.expectedStrategy {
+				t.Errorf("Expected strategy %s, got %s", tt.expectedStrategy, selection.Strategy)
+			}
+		})
+	}
+
+	// paypal has no authorize endpoint, the override can't be honoured for authorizations
+	t.Run("Override Can't Authorize", func(t *testing.T) {
+		selector := newTestSelector(t, gatewayConfig, country, services.WithRoutingOverrides(overrideRepo))
+
+		_, err := selector.SelectGatewayForUser(context.Background(), services.RoutingRequest{UserID: vip, TransactionType: "authorization"})
+		if !errors.Is(err, services.ErrGatewayUnavailable) {
+			t.Errorf("Expected ErrGatewayUnavailable, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"time"
+)
+
+// holdSweepLock is the lock held by the instance sweeping orphaned holds
+const holdSweepLock = "hold-sweep"
+
+// HoldReleaser releases the balance holds of withdrawals that never reached their gateway
+type HoldReleaser interface {
+	ReleaseHold(ctx context.Context, transactionID int) (*models.Transaction, error)
+}
+
+// HoldSweeper releases the holds of withdrawals left PENDING for longer than the hold TTL,
+// such as those of an instance that stopped between placing the hold and calling the gateway
+type HoldSweeper struct {
+	transactionRepo repository.Transaction
+	releaser        HoldReleaser
+	ttl             time.Duration
+	locker          repository.Locker
+}
+
+func NewHoldSweeper(transactionRepo repository.Transaction, releaser HoldReleaser, ttl time.Duration, locker repository.Locker) *HoldSweeper {
+	return &HoldSweeper{
+		transactionRepo: transactionRepo,
+		releaser:        releaser,
+		ttl:             ttl,
+		locker:          locker,
+	}
+}
+
+// Run sweeps at every interval until the context is done
+func (s *HoldSweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				log.Printf("hold sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// Sweep releases the orphaned holds and returns how many were released. Only one instance
+// sweeps at a time, the others return right away. Failing to release one is logged and left
+// for the next sweep.
+func (s *HoldSweeper) Sweep(ctx context.Context) (int, error) {
+	unlock, acquired, err := s.locker.TryLock(ctx, holdSweepLock)
+	if err != nil {
+		return 0, err
+	}
+	if !acquired {
+		return 0, nil
+	}
+	defer unlock()
+
+	withdrawals, err := s.transactionRepo.ListByStatus(ctx, "withdrawal", StatusPending, time.Now().Add(-s.ttl))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pending withdrawals: %w", err)
+	}
+
+	released := 0
+	for _, withdrawal := range withdrawals {
+		if _, err := s.releaser.ReleaseHold(ctx, withdrawal.ID); err != nil {
+			log.Printf("failed to release the hold of withdrawal %d: %v", withdrawal.ID, err)
+			continue
+		}
+		released++
+	}
+
+	return released, nil
+}
@@ -0,0 +1,154 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository/memory"
+	"payment-gateway/internal/services"
+	"testing"
+	"time"
+)
+
+type mockHoldReleaser struct {
+	released []int
+	err      error
+}
+
+func (m *mockHoldReleaser) ReleaseHold(ctx context.Context, transactionID int) (*models.Transaction, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.released = append(m.released, transactionID)
+	return &models.Transaction{ID: transactionID, Status: "FAILED"}, nil
+}
+
+func TestHoldSweeperSweep(t *testing.T) {
+	var listedBefore time.Time
+	transactionRepo := &mockTransactionRepo{
+		mockListByStatus: func(ctx context.Context, transactionType, status string, createdBefore time.Time) ([]models.Transaction, error) {
+			if transactionType != "withdrawal" || status != "PENDING" {
+				t.Errorf("Unexpected listing of %s %s", status, transactionType)
+			}
+			listedBefore = createdBefore
+			return []models.Transaction{{ID: 1}, {ID: 2}}, nil
+		},
+	}
+
+	releaser := &mockHoldReleaser{}
+	locker := &mockLocker{}
+	sweeper := services.NewHoldSweeper(transactionRepo, releaser, 15*time.Minute, locker)
+
+	released, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if released != 2 || len(releaser.released) != 2 {
+		t.Errorf("Expected both holds to be released, got %v", releaser.released)
+	}
+	if age := time.Since(listedBefore); age < 15*time.Minute || age > 16*time.Minute {
+		t.Errorf("Expected withdrawals older than the TTL to be listed, got %v", age)
+	}
+	if !locker.unlocked {
+		t.Error("Expected the lock to be released")
+	}
+
+	// Failures are left for the next sweep
+	releaser.err = errors.New("database unavailable")
+	released, err = sweeper.Sweep(context.Background())
+	if err != nil || released != 0 {
+		t.Errorf("Expected failed releases to be skipped, got %d and %v", released, err)
+	}
+
+	// Another instance is sweeping
+	locker.busy = true
+	transactionRepo.mockListByStatus = func(ctx context.Context, transactionType, status string, createdBefore time.Time) ([]models.Transaction, error) {
+		t.Error("Expected nothing to be listed without the lock")
+		return nil, nil
+	}
+	if released, err := sweeper.Sweep(context.Background()); released != 0 || err != nil {
+		t.Errorf("Expected the sweep to be skipped, got %d and %v", released, err)
+	}
+}
+
+func TestReleaseHold(t *testing.T) {
+	pending := models.Transaction{ID: 456, Amount: 50, Currency: "EUR", Type: "withdrawal", Status: "PENDING", GatewayID: 1, UserID: 7}
+	processing := pending
+	processing.Status = "PROCESSING"
+
+	tests := []struct {
+		name        string
+		withdrawal  models.Transaction
+		attempts    []models.TransactionAttempt
+		expectedErr error
+	}{
+		{name: "Never Sent", withdrawal: pending},
+		{name: "Gateway Unreachable", withdrawal: pending, attempts: []models.TransactionAttempt{{TransactionID: 456, Gateway: "stripe", Error: "connection refused"}}},
+		{name: "Accepted By Gateway", withdrawal: pending, attempts: []models.TransactionAttempt{{TransactionID: 456, Gateway: "stripe", ResponseStatus: 200}}, expectedErr: services.ErrNotCancellable},
+		{name: "Processing", withdrawal: processing, expectedErr: services.ErrNotCancellable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var statuses []string
+			transactionRepo := &mockTransactionRepo{
+				mockGetByID: func(ctx context.Context, transactionID int) (*models.Transaction, error) {
+					stored := tt.withdrawal
+					return &stored, nil
+				},
+				mockUpdateStatus: func(ctx context.Context, transactionID int, status string) error {
+					statuses = append(statuses, status)
+					return nil
+				},
+			}
+			ledgerRepo := memory.NewLedgerRepo()
+			ledger := services.NewLedger(ledgerRepo)
+
+			// The withdrawal reserved the user's deposit when it was created
+			deposit := &models.Transaction{ID: 1, Amount: 100, Currency: "EUR", Type: "deposit", Status: "COMPLETED", UserID: 7}
+			if err := ledger.RecordTransaction(context.Background(), deposit); err != nil {
+				t.Fatalf("failed to record deposit: %v", err)
+			}
+			withdrawal := tt.withdrawal
+			if err := ledger.ReserveWithdrawal(context.Background(), &withdrawal); err != nil {
+				t.Fatalf("failed to reserve withdrawal: %v", err)
+			}
+
+			processor := services.NewTransactionProcessor(
+				&mockGatewayConfigProvider{},
+				&mockGatewaySelectorProvider{},
+				transactionRepo,
+				&mockGatewayRepo{
+					mockFindByID: func(ctx context.Context, id int) (*models.Gateway, error) {
+						return &models.Gateway{ID: id, Name: "stripe", DataFormatSupported: "application/json"}, nil
+					},
+				},
+				&mockClient{},
+				services.WithAttemptRepository(&mockTransactionAttemptRepo{attempts: tt.attempts}),
+				services.WithLedger(ledger),
+			)
+
+			_, err := processor.ReleaseHold(context.Background(), tt.withdrawal.ID)
+			entries := ledgerRepo.Entries(tt.withdrawal.ID)[1:]
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got: %v", tt.expectedErr, err)
+				}
+				if len(statuses) != 0 || len(entries) != 0 {
+					t.Errorf("Expected the withdrawal to be left alone, got %v", statuses)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if len(statuses) != 1 || statuses[0] != "FAILED" {
+				t.Errorf("Expected the withdrawal to move to FAILED, got %v", statuses)
+			}
+			if len(entries) != 1 || entries[0].Kind != services.EntryWithdrawalReleased {
+				t.Errorf("Expected the hold to be released, got %v", entries)
+			}
+		})
+	}
+}
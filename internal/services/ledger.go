@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"sort"
+)
+
+// Ledger account types. Available and reserved accounts belong to users, the settlement
+// account stands for the money held at the gateways.
+const (
+	AccountAvailable  = "available"
+	AccountReserved   = "reserved"
+	AccountSettlement = "settlement"
+)
+
+// Journal entry kinds
+const (
+	EntryDepositCompleted   = "deposit_completed"
+	EntryRefundReserved     = "refund_reserved"
+	EntryRefundReleased     = "refund_released"
+	EntryRefundSettled      = "refund_settled"
+	EntryWithdrawalReserved = "withdrawal_reserved"
+	EntryWithdrawalReleased = "withdrawal_released"
+	EntryWithdrawalSettled  = "withdrawal_settled"
+)
+
+// LedgerRecorder keeps the user balances in step with their transactions
+type LedgerRecorder interface {
+	// ReserveWithdrawal moves the amount of a withdrawal from the user's available balance
+	// to their reserved balance, failing with repository.ErrInsufficientFunds when it's short
+	ReserveWithdrawal(ctx context.Context, transaction *models.Transaction) error
+	// ReserveRefund does the same for a refund, so the refunded money can't be withdrawn
+	// while the gateway processes the refund
+	ReserveRefund(ctx context.Context, transaction *models.Transaction) error
+	// RecordTransaction records the money movement of a transaction reaching its status, if any
+	RecordTransaction(ctx context.Context, transaction *models.Transaction) error
+	// In returns the recorder writing to the ledger of a unit of work, so that entries commit
+	// or roll back with it
+	In(repos repository.Repositories) LedgerRecorder
+}
+
+// Ledger maps transactions onto double-entry journal entries
+type Ledger struct {
+	ledgerRepo repository.Ledger
+}
+
+func NewLedger(ledgerRepo repository.Ledger) *Ledger {
+	return &Ledger{
+		ledgerRepo: ledgerRepo,
+	}
+}
+
+func (l *Ledger) ReserveWithdrawal(ctx context.Context, transaction *models.Transaction) error {
+	return l.reserve(ctx, transaction, EntryWithdrawalReserved)
+}
+
+func (l *Ledger) ReserveRefund(ctx context.Context, transaction *models.Transaction) error {
+	return l.reserve(ctx, transaction, EntryRefundReserved)
+}
+
+// reserve moves the transaction's amount from the available to the reserved balance of its user
+func (l *Ledger) reserve(ctx context.Context, transaction *models.Transaction, kind string) error {
+	entry := transfer(transaction, kind, userAccount(transaction, AccountAvailable), userAccount(transaction, AccountReserved))
+	entry.NoOverdraft = true
+
+	if err := l.ledgerRepo.Record(ctx, entry); err != nil {
+		return fmt.Errorf("failed to reserve %s %d: %w", transaction.Type, transaction.ID, err)
+	}
+
+	return nil
+}
+
+func (l *Ledger) RecordTransaction(ctx context.Context, transaction *models.Transaction) error {
+	entry := journalEntryFor(transaction)
+	if entry == nil {
+		return nil
+	}
+
+	if err := l.ledgerRepo.Record(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record %s of transaction %d: %w", entry.Kind, transaction.ID, err)
+	}
+
+	return nil
+}
+
+func (l *Ledger) In(repos repository.Repositories) LedgerRecorder {
+	if repos.Ledger == nil {
+		return l
+	}
+	return NewLedger(repos.Ledger)
+}
+
+// journalEntryFor returns the entry a transaction reaching its status calls for, nil when
+// no money moves. Withdrawals and refunds only release or settle what was reserved for them,
+// and never both.
+func journalEntryFor(transaction *models.Transaction) *models.JournalEntry {
+	switch transaction.Type {
+	case "deposit", "capture":
+		if transaction.Status == StatusCompleted {
+			settlement := models.Posting{AccountType: AccountSettlement, Currency: transaction.Currency}
+			return transfer(transaction, EntryDepositCompleted, settlement, userAccount(transaction, AccountAvailable))
+		}
+
+	case "withdrawal":
+		return settleOrRelease(transaction, EntryWithdrawalReserved, EntryWithdrawalSettled, EntryWithdrawalReleased)
+
+	case "refund":
+		return settleOrRelease(transaction, EntryRefundReserved, EntryRefundSettled, EntryRefundReleased)
+	}
+
+	return nil
+}
+
+// settleOrRelease returns the entry paying out a reservation to the gateway when the
+// transaction completed, or giving it back to the user when it ended otherwise
+func settleOrRelease(transaction *models.Transaction, reserved, settled, released string) *models.JournalEntry {
+	var entry *models.JournalEntry
+
+	switch {
+	case transaction.Status == StatusCompleted:
+		settlement := models.Posting{AccountType: AccountSettlement, Currency: transaction.Currency}
+		entry = transfer(transaction, settled, userAccount(transaction, AccountReserved), settlement)
+		entry.Excludes = released
+	case IsFinalStatus(transaction.Status):
+		entry = transfer(transaction, released, userAccount(transaction, AccountReserved), userAccount(transaction, AccountAvailable))
+		entry.Excludes = settled
+	default:
+		return nil
+	}
+
+	entry.Requires = reserved
+	return entry
+}
+
+// transfer builds an entry moving the transaction's amount from one account to another
+func transfer(transaction *models.Transaction, kind string, from, to models.Posting) *models.JournalEntry {
+	from.Amount = -transaction.Amount
+	to.Amount = transaction.Amount
+
+	return &models.JournalEntry{
+		TransactionID: transaction.ID,
+		Kind:          kind,
+		Postings:      []models.Posting{from, to},
+	}
+}
+
+func userAccount(transaction *models.Transaction, accountType string) models.Posting {
+	userID := transaction.UserID
+	return models.Posting{UserID: &userID, AccountType: accountType, Currency: transaction.Currency}
+}
+
+// Balances returns the balances of a user, one per currency
+func (l *Ledger) Balances(ctx context.Context, userID int) ([]models.Balance, error) {
+	accounts, err := l.ledgerRepo.ListAccounts(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger accounts: %w", err)
+	}
+
+	byCurrency := make(map[string]*models.Balance)
+	for _, account := range accounts {
+		balance, ok := byCurrency[account.Currency]
+		if !ok {
+			balance = &models.Balance{Currency: account.Currency}
+			byCurrency[account.Currency] = balance
+		}
+
+		switch account.Type {
+		case AccountAvailable:
+			balance.Available = account.Balance
+		case AccountReserved:
+			balance.Reserved = account.Balance
+		}
+	}
+
+	balances := make([]models.Balance, 0, len(byCurrency))
+	for _, balance := range byCurrency {
+		balances = append(balances, *balance)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Currency < balances[j].Currency
+	})
+
+	return balances, nil
+}
@@ -0,0 +1,367 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"payment-gateway/internal/repository/memory"
+	"payment-gateway/internal/services"
+	"testing"
+	"time"
+)
+
+// postingsOf describes the postings of an entry as account:amount pairs
+func postingsOf(entry *models.JournalEntry) string {
+	var description string
+	for _, posting := range entry.Postings {
+		owner := "platform"
+		if posting.UserID != nil {
+			owner = fmt.Sprintf("user%d", *posting.UserID)
+		}
+		description += fmt.Sprintf("%s/%s:%.2f ", owner, posting.AccountType, posting.Amount)
+	}
+	return description
+}
+
+func TestLedgerRecordTransaction(t *testing.T) {
+	tests := []struct {
+		name             string
+		transactionType  string
+		status           string
+		expectedKind     string
+		expectedRequires string
+		expectedExcludes string
+		expectedPostings string
+	}{
+		{
+			name: "Deposit Completed", transactionType: "deposit", status: "COMPLETED",
+			expectedKind:     services.EntryDepositCompleted,
+			expectedPostings: "platform/settlement:-50.00 user7/available:50.00 ",
+		},
+		{
+			name: "Capture Completed", transactionType: "capture", status: "COMPLETED",
+			expectedKind:     services.EntryDepositCompleted,
+			expectedPostings: "platform/settlement:-50.00 user7/available:50.00 ",
+		},
+		{
+			name: "Refund Completed", transactionType: "refund", status: "COMPLETED",
+			expectedKind:     services.EntryRefundSettled,
+			expectedRequires: services.EntryRefundReserved,
+			expectedExcludes: services.EntryRefundReleased,
+			expectedPostings: "user7/reserved:-50.00 platform/settlement:50.00 ",
+		},
+		{
+			name: "Refund Failed", transactionType: "refund", status: "FAILED",
+			expectedKind:     services.EntryRefundReleased,
+			expectedRequires: services.EntryRefundReserved,
+			expectedExcludes: services.EntryRefundSettled,
+			expectedPostings: "user7/reserved:-50.00 user7/available:50.00 ",
+		},
+		{name: "Refund Processing", transactionType: "refund", status: "PROCESSING"},
+		{
+			name: "Withdrawal Completed", transactionType: "withdrawal", status: "COMPLETED",
+			expectedKind:     services.EntryWithdrawalSettled,
+			expectedRequires: services.EntryWithdrawalReserved,
+			expectedExcludes: services.EntryWithdrawalReleased,
+			expectedPostings: "user7/reserved:-50.00 platform/settlement:50.00 ",
+		},
+		{
+			name: "Withdrawal Declined", transactionType: "withdrawal", status: "DECLINED",
+			expectedKind:     services.EntryWithdrawalReleased,
+			expectedRequires: services.EntryWithdrawalReserved,
+			expectedExcludes: services.EntryWithdrawalSettled,
+			expectedPostings: "user7/reserved:-50.00 user7/available:50.00 ",
+		},
+		{
+			name: "Withdrawal Cancelled", transactionType: "withdrawal", status: "CANCELLED",
+			expectedKind:     services.EntryWithdrawalReleased,
+			expectedRequires: services.EntryWithdrawalReserved,
+			expectedExcludes: services.EntryWithdrawalSettled,
+			expectedPostings: "user7/reserved:-50.00 user7/available:50.00 ",
+		},
+		{name: "Withdrawal Processing", transactionType: "withdrawal", status: "PROCESSING"},
+		{name: "Deposit Failed", transactionType: "deposit", status: "FAILED"},
+		{name: "Authorization Authorized", transactionType: "authorization", status: "AUTHORIZED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			ledgerRepo := memory.NewLedgerRepo()
+			ledger := services.NewLedger(ledgerRepo)
+
+			transaction := &models.Transaction{ID: 456, Amount: 50, Currency: "EUR", Type: tt.transactionType, Status: tt.status, UserID: 7}
+
+			// Refunds and withdrawals settle or release what they reserved when created
+			reserved := 0
+			if tt.transactionType == "refund" || tt.transactionType == "withdrawal" {
+				deposit := &models.Transaction{ID: 1, Amount: 100, Currency: "EUR", Type: "deposit", Status: "COMPLETED", UserID: 7}
+				if err := ledger.RecordTransaction(ctx, deposit); err != nil {
+					t.Fatalf("failed to record deposit: %v", err)
+				}
+				reserve := ledger.ReserveWithdrawal
+				if tt.transactionType == "refund" {
+					reserve = ledger.ReserveRefund
+				}
+				if err := reserve(ctx, transaction); err != nil {
+					t.Fatalf("failed to reserve %s: %v", tt.transactionType, err)
+				}
+				reserved = 1
+			}
+
+			if err := ledger.RecordTransaction(ctx, transaction); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			entries := ledgerRepo.Entries(transaction.ID)[reserved:]
+			if tt.expectedKind == "" {
+				if len(entries) != 0 {
+					t.Errorf("Expected no journal entry, got %s", entries[0].Kind)
+				}
+				return
+			}
+
+			if len(entries) != 1 {
+				t.Fatalf("Expected one journal entry, got %d", len(entries))
+			}
+			entry := entries[0]
+			if entry.TransactionID != 456 || entry.Kind != tt.expectedKind || entry.Requires != tt.expectedRequires || entry.Excludes != tt.expectedExcludes {
+				t.Errorf("Unexpected journal entry: %+v", entry)
+			}
+			if got := postingsOf(&entry); got != tt.expectedPostings {
+				t.Errorf("Expected postings %q, got %q", tt.expectedPostings, got)
+			}
+		})
+	}
+}
+
+func TestLedgerReserveWithdrawal(t *testing.T) {
+	ctx := context.Background()
+	ledgerRepo := memory.NewLedgerRepo()
+	ledger := services.NewLedger(ledgerRepo)
+
+	withdrawal := &models.Transaction{ID: 456, Amount: 50, Currency: "EUR", Type: "withdrawal", Status: "PENDING", UserID: 7}
+	if err := ledger.ReserveWithdrawal(ctx, withdrawal); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Expected ErrInsufficientFunds without a balance, got: %v", err)
+	}
+
+	deposit := &models.Transaction{ID: 1, Amount: 100, Currency: "EUR", Type: "deposit", Status: "COMPLETED", UserID: 7}
+	if err := ledger.RecordTransaction(ctx, deposit); err != nil {
+		t.Fatalf("failed to record deposit: %v", err)
+	}
+	if err := ledger.ReserveWithdrawal(ctx, withdrawal); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	entries := ledgerRepo.Entries(withdrawal.ID)
+	if len(entries) != 1 || entries[0].Kind != services.EntryWithdrawalReserved || !entries[0].NoOverdraft {
+		t.Fatalf("Expected an overdraft-checked reservation, got %+v", entries)
+	}
+	if got := postingsOf(&entries[0]); got != "user7/available:-50.00 user7/reserved:50.00 " {
+		t.Errorf("Unexpected postings: %q", got)
+	}
+}
+
+// TestLedgerWithdrawalSettledOnce records a withdrawal both completed and failed, as a sweep
+// and a late callback could, which must neither release nor settle it twice
+func TestLedgerWithdrawalSettledOnce(t *testing.T) {
+	ctx := context.Background()
+	ledgerRepo := memory.NewLedgerRepo()
+	ledger := services.NewLedger(ledgerRepo)
+
+	deposit := &models.Transaction{ID: 1, Amount: 100, Currency: "EUR", Type: "deposit", Status: "COMPLETED", UserID: 7}
+	withdrawal := &models.Transaction{ID: 2, Amount: 50, Currency: "EUR", Type: "withdrawal", Status: "PENDING", UserID: 7}
+	if err := ledger.RecordTransaction(ctx, deposit); err != nil {
+		t.Fatalf("failed to record deposit: %v", err)
+	}
+	if err := ledger.ReserveWithdrawal(ctx, withdrawal); err != nil {
+		t.Fatalf("failed to reserve withdrawal: %v", err)
+	}
+
+	for _, status := range []string{"COMPLETED", "FAILED"} {
+		withdrawal.Status = status
+		if err := ledger.RecordTransaction(ctx, withdrawal); err != nil {
+			t.Fatalf("failed to record %s withdrawal: %v", status, err)
+		}
+	}
+
+	balances, err := ledger.Balances(ctx, 7)
+	if err != nil {
+		t.Fatalf("failed to get balances: %v", err)
+	}
+	expected := []models.Balance{{Currency: "EUR", Available: 50}}
+	if fmt.Sprint(balances) != fmt.Sprint(expected) {
+		t.Errorf("Expected the withdrawal to be settled only, %v, got %v", expected, balances)
+	}
+}
+
+func TestLedgerBalances(t *testing.T) {
+	ctx := context.Background()
+	ledger := services.NewLedger(memory.NewLedgerRepo())
+
+	transactions := []*models.Transaction{
+		{ID: 1, Amount: 100, Currency: "EUR", Type: "deposit", Status: "COMPLETED", UserID: 7},
+		{ID: 2, Amount: 25, Currency: "USD", Type: "deposit", Status: "COMPLETED", UserID: 7},
+		// Someone else's
+		{ID: 3, Amount: 60, Currency: "USD", Type: "deposit", Status: "COMPLETED", UserID: 8},
+	}
+	for _, transaction := range transactions {
+		if err := ledger.RecordTransaction(ctx, transaction); err != nil {
+			t.Fatalf("failed to record deposit: %v", err)
+		}
+	}
+	withdrawal := &models.Transaction{ID: 4, Amount: 20, Currency: "USD", Type: "withdrawal", Status: "PENDING", UserID: 7}
+	if err := ledger.ReserveWithdrawal(ctx, withdrawal); err != nil {
+		t.Fatalf("failed to reserve withdrawal: %v", err)
+	}
+
+	balances, err := ledger.Balances(ctx, 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := []models.Balance{
+		{Currency: "EUR", Available: 100},
+		{Currency: "USD", Available: 5, Reserved: 20},
+	}
+	if fmt.Sprint(balances) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, balances)
+	}
+}
+
+func TestProcessWithdrawalInsufficientFunds(t *testing.T) {
+	ctx := context.Background()
+	repos := newMemoryRepos(t)
+	sent := false
+
+	gatewaySelector := &mockGatewaySelectorProvider{
+		mockSelectGatewayForUser: func(ctx context.Context, request services.RoutingRequest) (*services.GatewaySelection, error) {
+			return &services.GatewaySelection{Gateway: repos.gateway}, nil
+		},
+	}
+
+	client := &mockClient{
+		mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+			sent = true
+			return &gateway.Result{StatusCode: 200}, nil
+		},
+	}
+
+	processor := services.NewTransactionProcessor(
+		&mockGatewayConfigProvider{},
+		gatewaySelector,
+		repos.transactions,
+		repos.gateways,
+		client,
+		services.WithLedger(services.NewLedger(repos.ledger)),
+		services.WithUnitOfWork(repos.unitOfWork),
+	)
+
+	_, err := processor.ProcessWithdrawal(ctx, 123, 100, "EUR")
+	if !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Expected ErrInsufficientFunds, got: %v", err)
+	}
+	if sent {
+		t.Error("Expected no request to be sent to the gateway")
+	}
+
+	withdrawals, err := repos.transactions.ListByStatus(ctx, "withdrawal", "REJECTED", time.Now().Add(time.Minute))
+	if err != nil || len(withdrawals) != 1 {
+		t.Errorf("Expected the withdrawal to be REJECTED, got %v and %v", withdrawals, err)
+	}
+}
+
+// TestProcessRefundHoldsFunds refunds a deposit, which must take the refunded money out of
+// the user's available balance before the gateway settles the refund
+func TestProcessRefundHoldsFunds(t *testing.T) {
+	ctx := context.Background()
+	repos := newMemoryRepos(t)
+	ledger := services.NewLedger(repos.ledger)
+
+	deposit := &models.Transaction{Amount: 100, Currency: "EUR", Type: "deposit", Status: "COMPLETED", GatewayID: repos.gateway.ID, UserID: 7}
+	if err := repos.transactions.Create(ctx, deposit); err != nil {
+		t.Fatalf("failed to create deposit: %v", err)
+	}
+	if err := repos.transactions.SetGatewayReference(ctx, deposit.ID, "ch_1"); err != nil {
+		t.Fatalf("failed to set gateway reference: %v", err)
+	}
+	if err := ledger.RecordTransaction(ctx, deposit); err != nil {
+		t.Fatalf("failed to record deposit: %v", err)
+	}
+
+	var sent []string
+	client := &mockClient{
+		mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+			sent = append(sent, request.TransactionType)
+			return &gateway.Result{GatewayReference: "ref", Status: gateway.StatusProcessing, StatusCode: 200}, nil
+		},
+	}
+
+	gatewaySelector := &mockGatewaySelectorProvider{
+		mockSelectGatewayForUser: func(ctx context.Context, request services.RoutingRequest) (*services.GatewaySelection, error) {
+			return &services.GatewaySelection{Gateway: repos.gateway}, nil
+		},
+	}
+
+	gatewayConfig := &mockGatewayConfigProvider{
+		mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+			return config.GatewayDetails{
+				Endpoints: config.GatewayEndpoints{Withdrawal: "/v1/payouts", Refund: "/v1/refunds"},
+				Retry:     config.GatewayRetry{MaxAttempts: 1},
+			}, true
+		},
+	}
+
+	processor := services.NewTransactionProcessor(gatewayConfig, gatewaySelector, repos.transactions, repos.gateways, client,
+		services.WithLedger(ledger),
+		services.WithUnitOfWork(repos.unitOfWork),
+	)
+
+	refund, err := processor.ProcessRefund(ctx, deposit.ID, 60)
+	if err != nil {
+		t.Fatalf("failed to refund: %v", err)
+	}
+
+	// The refund is in flight, the money it pays back can't be withdrawn
+	if _, err := processor.ProcessWithdrawal(ctx, 7, 50, "EUR"); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Expected ErrInsufficientFunds, got: %v", err)
+	}
+	if fmt.Sprint(sent) != "[refund]" {
+		t.Errorf("Expected only the refund sent to the gateway, got %v", sent)
+	}
+
+	callbacks := services.NewCallbackProcessor(repos.transactions, repos.gateways,
+		services.WithCallbackLedger(ledger),
+		services.WithCallbackUnitOfWork(repos.unitOfWork),
+	)
+	if err := callbacks.ApplyStatus(ctx, refund.ID, "COMPLETED", services.EventCallbackProcessed); err != nil {
+		t.Fatalf("failed to complete refund: %v", err)
+	}
+
+	balances, err := ledger.Balances(ctx, 7)
+	if err != nil {
+		t.Fatalf("failed to get balances: %v", err)
+	}
+	expected := []models.Balance{{Currency: "EUR", Available: 40}}
+	if fmt.Sprint(balances) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, balances)
+	}
+
+	// What is left can't be refunded twice over
+	if _, err := processor.ProcessWithdrawal(ctx, 7, 40, "EUR"); err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+	rejected, err := processor.ProcessRefund(ctx, deposit.ID, 40)
+	if !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Expected ErrInsufficientFunds, got %v and %+v", err, rejected)
+	}
+
+	refunds, err := repos.transactions.ListByStatus(ctx, "refund", "REJECTED", time.Now().Add(time.Minute))
+	if err != nil || len(refunds) != 1 {
+		t.Errorf("Expected the second refund REJECTED, got %v and %v", refunds, err)
+	}
+}
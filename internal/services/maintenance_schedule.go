@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/repository"
+	"sync"
+	"time"
+)
+
+// MaintenanceSchedule holds the gateway maintenance windows. They are stored in the
+// repository, next to a copy of the windows of the configuration, and can be added and
+// removed at runtime through the admin API. Routing reads a copy of them, reloaded by Run
+// so that every instance picks up the changes made through another.
+type MaintenanceSchedule struct {
+	gatewayConfig *config.GatewayConfig
+	windowRepo    repository.MaintenanceWindow
+	mu            sync.RWMutex
+	windows       []config.MaintenanceWindow
+	now           func() time.Time
+}
+
+func NewMaintenanceSchedule(gatewayConfig *config.GatewayConfig, windowRepo repository.MaintenanceWindow) *MaintenanceSchedule {
+	return &MaintenanceSchedule{
+		gatewayConfig: gatewayConfig,
+		windowRepo:    windowRepo,
+		now:           time.Now,
+	}
+}
+
+// Load brings the repository's copy of the configured windows up to date, then reads them
+func (s *MaintenanceSchedule) Load(ctx context.Context) error {
+	if err := s.windowRepo.SyncConfig(ctx, s.gatewayConfig.Maintenance); err != nil {
+		return fmt.Errorf("failed to sync maintenance windows: %w", err)
+	}
+
+	return s.reload(ctx)
+}
+
+// Run reloads the windows at every interval until the context is done
+func (s *MaintenanceSchedule) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.reload(ctx); err != nil {
+				log.Printf("maintenance windows reload failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *MaintenanceSchedule) reload(ctx context.Context) error {
+	windows, err := s.windowRepo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.windows = windows
+	return nil
+}
+
+// List returns the windows ordered by ID
+func (s *MaintenanceSchedule) List(ctx context.Context) ([]config.MaintenanceWindow, error) {
+	windows, err := s.windowRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if windows == nil {
+		windows = []config.MaintenanceWindow{}
+	}
+
+	return windows, nil
+}
+
+// Add validates and stores a window, returning it with its assigned ID
+func (s *MaintenanceSchedule) Add(ctx context.Context, window config.MaintenanceWindow) (config.MaintenanceWindow, error) {
+	if err := window.Validate(); err != nil {
+		return config.MaintenanceWindow{}, &ValidationError{Message: "invalid maintenance window: " + err.Error()}
+	}
+
+	if _, exists := s.gatewayConfig.GetGatewayDetails(window.Gateway); !exists {
+		return config.MaintenanceWindow{}, &ValidationError{Message: fmt.Sprintf("invalid maintenance window: unknown gateway %s", window.Gateway)}
+	}
+
+	window.Start = window.Start.UTC()
+	window.End = window.End.UTC()
+	if err := s.windowRepo.Create(ctx, &window); err != nil {
+		return config.MaintenanceWindow{}, err
+	}
+
+	// The window already applies here, other instances pick it up on their next reload
+	if err := s.reload(ctx); err != nil {
+		log.Printf("maintenance windows reload failed: %v", err)
+	}
+
+	return window, nil
+}
+
+// Remove deletes a window, failing with a repository.NotFoundError when no window has the
+// given ID. Windows of the configuration would come back at the next start, they can only be
+// removed from it.
+func (s *MaintenanceSchedule) Remove(ctx context.Context, id int) error {
+	window, err := s.windowRepo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if window.Source == config.MaintenanceSourceConfig {
+		return &ValidationError{Message: fmt.Sprintf("maintenance window %d is configured in the gateway configuration, remove it there", id)}
+	}
+
+	if err := s.windowRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.reload(ctx); err != nil {
+		log.Printf("maintenance windows reload failed: %v", err)
+	}
+
+	return nil
+}
+
+// IsUnderMaintenance reports whether a gateway is in one of its maintenance windows for a country
+func (s *MaintenanceSchedule) IsUnderMaintenance(gatewayName, countryCode string) bool {
+	now := s.now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, window := range s.windows {
+		if window.AppliesTo(gatewayName, countryCode) && window.ActiveAt(now) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"time"
+)
+
+// settlingTypes are the transaction types gateways settle; authorizations only settle
+// through their captures
+var settlingTypes = map[string]bool{
+	"deposit":    true,
+	"withdrawal": true,
+	"refund":     true,
+	"capture":    true,
+}
+
+// Reconciler checks the transactions of a gateway against its settlement reports
+type Reconciler struct {
+	gatewayConfig      GatewayConfigProvider
+	transactionRepo    repository.Transaction
+	gatewayRepo        repository.Gateway
+	reconciliationRepo repository.Reconciliation
+}
+
+func NewReconciler(
+	gatewayConfig GatewayConfigProvider,
+	transactionRepo repository.Transaction,
+	gatewayRepo repository.Gateway,
+	reconciliationRepo repository.Reconciliation,
+) *Reconciler {
+	return &Reconciler{
+		gatewayConfig:      gatewayConfig,
+		transactionRepo:    transactionRepo,
+		gatewayRepo:        gatewayRepo,
+		reconciliationRepo: reconciliationRepo,
+	}
+}
+
+// Reconcile matches the records of a settlement report settled in [from, to) with the
+// gateway's transactions created in the same period, and stores the discrepancies found.
+// Settlements of transactions created before the period are looked up by reference, but
+// transactions settled after it are reported missing, so the period should end a few days
+// before the report does.
+func (r *Reconciler) Reconcile(ctx context.Context, gatewayName string, report io.Reader, source string, from, to time.Time) (*models.ReconciliationRun, error) {
+	gatewayDetails, exists := r.gatewayConfig.GetGatewayDetails(gatewayName)
+	if !exists {
+		return nil, fmt.Errorf("gateway %s not found in configuration", gatewayName)
+	}
+	if !gatewayDetails.Settlement.IsSet() {
+		return nil, fmt.Errorf("gateway %s has no settlement report format configured", gatewayName)
+	}
+
+	settlingGateway, err := r.gatewayRepo.FindByName(ctx, gatewayName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find gateway: %w", err)
+	}
+
+	parsed, err := ParseSettlementReport(report, gatewayDetails.Settlement)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []models.SettlementRecord
+	for _, record := range parsed {
+		if !record.SettledAt.Before(from) && record.SettledAt.Before(to) {
+			records = append(records, record)
+		}
+	}
+
+	transactions, err := r.transactionRepo.ListByGateway(ctx, settlingGateway.ID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+
+	known := make(map[string]bool, len(transactions))
+	for _, transaction := range transactions {
+		known[transaction.GatewayReference] = true
+	}
+	var unknown []string
+	for _, record := range records {
+		if !known[record.GatewayReference] {
+			unknown = append(unknown, record.GatewayReference)
+		}
+	}
+
+	earlier, err := r.transactionRepo.ListByGatewayReferences(ctx, settlingGateway.ID, unknown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up transactions: %w", err)
+	}
+
+	run := MatchSettlements(append(transactions, earlier...), records)
+	run.Gateway = gatewayName
+	run.Source = source
+	run.PeriodStart = from
+	run.PeriodEnd = to
+
+	if err := r.reconciliationRepo.Create(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to store reconciliation run: %w", err)
+	}
+
+	return run, nil
+}
+
+// MatchSettlements matches settlement records with transactions on gateway reference and
+// reports the discrepancies. Completed transactions without a settlement are missing,
+// settlements without a transaction are extra.
+func MatchSettlements(transactions []models.Transaction, records []models.SettlementRecord) *models.ReconciliationRun {
+	byReference := make(map[string]models.Transaction, len(transactions))
+	for _, transaction := range transactions {
+		if transaction.GatewayReference != "" && settlingTypes[transaction.Type] {
+			byReference[transaction.GatewayReference] = transaction
+		}
+	}
+
+	run := &models.ReconciliationRun{Records: len(records), Discrepancies: []models.ReconciliationItem{}}
+	settled := make(map[string]bool, len(records))
+
+	for _, record := range records {
+		settled[record.GatewayReference] = true
+
+		transaction, ok := byReference[record.GatewayReference]
+		if !ok {
+			run.Discrepancies = append(run.Discrepancies, models.ReconciliationItem{
+				Kind:             models.ReconciliationExtra,
+				GatewayReference: record.GatewayReference,
+				SettledAmount:    record.Amount,
+				SettledCurrency:  record.Currency,
+				SettledStatus:    record.Status,
+			})
+			continue
+		}
+
+		matched := true
+		item := discrepancy(transaction, record)
+
+		if math.Abs(transaction.Amount-record.Amount) >= 0.005 || (record.Currency != "" && record.Currency != transaction.Currency) {
+			item.Kind = models.ReconciliationAmountMismatch
+			run.Discrepancies = append(run.Discrepancies, item)
+			matched = false
+		}
+		if record.Status != transaction.Status {
+			item.Kind = models.ReconciliationStatusMismatch
+			run.Discrepancies = append(run.Discrepancies, item)
+			matched = false
+		}
+
+		if matched {
+			run.Matched++
+		}
+	}
+
+	for _, transaction := range transactions {
+		if settled[transaction.GatewayReference] || transaction.Status != StatusCompleted || !settlingTypes[transaction.Type] {
+			continue
+		}
+
+		item := discrepancy(transaction, models.SettlementRecord{GatewayReference: transaction.GatewayReference})
+		item.Kind = models.ReconciliationMissing
+		run.Discrepancies = append(run.Discrepancies, item)
+	}
+
+	return run
+}
+
+func discrepancy(transaction models.Transaction, record models.SettlementRecord) models.ReconciliationItem {
+	transactionID := transaction.ID
+	return models.ReconciliationItem{
+		GatewayReference: record.GatewayReference,
+		TransactionID:    &transactionID,
+		ExpectedAmount:   transaction.Amount,
+		SettledAmount:    record.Amount,
+		ExpectedCurrency: transaction.Currency,
+		SettledCurrency:  record.Currency,
+		ExpectedStatus:   transaction.Status,
+		SettledStatus:    record.Status,
+	}
+}
@@ -0,0 +1,102 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository/memory"
+	"payment-gateway/internal/services"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconcilerReconcile(t *testing.T) {
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	created := from.Add(48 * time.Hour)
+
+	transactions := []models.Transaction{
+		{ID: 1, Amount: 100, Currency: "EUR", Type: "deposit", Status: "COMPLETED", GatewayReference: "ch_matched", CreatedAt: created},
+		{ID: 2, Amount: 50, Currency: "EUR", Type: "deposit", Status: "COMPLETED", GatewayReference: "ch_amount", CreatedAt: created},
+		{ID: 3, Amount: 30, Currency: "EUR", Type: "deposit", Status: "PROCESSING", GatewayReference: "ch_status", CreatedAt: created},
+		{ID: 4, Amount: 20, Currency: "EUR", Type: "withdrawal", Status: "COMPLETED", GatewayReference: "po_missing", CreatedAt: created},
+		// Not settled, nothing expected from the gateway
+		{ID: 5, Amount: 10, Currency: "EUR", Type: "deposit", Status: "FAILED", GatewayReference: "ch_failed", CreatedAt: created},
+		{ID: 6, Amount: 80, Currency: "EUR", Type: "authorization", Status: "CAPTURED", GatewayReference: "ch_capture", CreatedAt: created},
+		{ID: 7, Amount: 80, Currency: "EUR", Type: "capture", Status: "COMPLETED", GatewayReference: "ch_capture", CreatedAt: created},
+	}
+	// Created before the period, settled in it
+	earlier := models.Transaction{ID: 8, Amount: 40, Currency: "EUR", Type: "deposit", Status: "COMPLETED", GatewayReference: "ch_earlier", CreatedAt: from.Add(-time.Hour)}
+
+	report := "created_utc,currency,gross,reporting_category,source_id\n" +
+		"2025-03-03 10:00:00,eur,100.00,charge,ch_matched\n" +
+		"2025-03-03 10:00:00,eur,55.00,charge,ch_amount\n" +
+		"2025-03-03 10:00:00,eur,30.00,charge,ch_status\n" +
+		"2025-03-03 10:00:00,eur,80.00,charge,ch_capture\n" +
+		"2025-03-03 10:00:00,eur,40.00,charge,ch_earlier\n" +
+		"2025-03-03 10:00:00,eur,15.00,charge,ch_extra\n" +
+		// Outside the period
+		"2025-04-02 10:00:00,eur,60.00,charge,ch_next_month\n"
+
+	transactionRepo := &mockTransactionRepo{
+		mockListByGateway: func(ctx context.Context, gatewayID int, periodStart, periodEnd time.Time) ([]models.Transaction, error) {
+			if gatewayID != 2 || !periodStart.Equal(from) || !periodEnd.Equal(to) {
+				t.Errorf("Unexpected listing of gateway %d from %v to %v", gatewayID, periodStart, periodEnd)
+			}
+			return transactions, nil
+		},
+		mockListByReferences: func(ctx context.Context, gatewayID int, references []string) ([]models.Transaction, error) {
+			if strings.Join(references, ",") != "ch_earlier,ch_extra" {
+				t.Errorf("Unexpected references looked up: %v", references)
+			}
+			return []models.Transaction{earlier}, nil
+		},
+	}
+
+	gatewayRepo := &mockGatewayRepo{
+		mockFindByName: func(ctx context.Context, name string) (*models.Gateway, error) {
+			return &models.Gateway{ID: 2, Name: name}, nil
+		},
+	}
+
+	gatewayConfig := &mockGatewayConfigProvider{
+		mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+			return config.GatewayDetails{Settlement: config.GatewaySettlement{Format: config.SettlementStripe}}, true
+		},
+	}
+
+	reconciliationRepo := memory.NewReconciliationRepo()
+	reconciler := services.NewReconciler(gatewayConfig, transactionRepo, gatewayRepo, reconciliationRepo)
+
+	run, err := reconciler.Reconcile(context.Background(), "stripe", strings.NewReader(report), "march.csv", from, to)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if stored := reconciliationRepo.Runs(); len(stored) != 1 || stored[0].ID != run.ID || len(stored[0].Discrepancies) != len(run.Discrepancies) {
+		t.Errorf("Expected the run to be stored, got %+v", stored)
+	}
+	if run.Gateway != "stripe" || run.Source != "march.csv" || run.Records != 6 || run.Matched != 3 {
+		t.Errorf("Unexpected run: %+v", run)
+	}
+
+	var got []string
+	for _, item := range run.Discrepancies {
+		transactionID := 0
+		if item.TransactionID != nil {
+			transactionID = *item.TransactionID
+		}
+		got = append(got, fmt.Sprintf("%s %s %d", item.Kind, item.GatewayReference, transactionID))
+	}
+	expected := []string{
+		"amount_mismatch ch_amount 2",
+		"status_mismatch ch_status 3",
+		"extra ch_extra 0",
+		"missing po_missing 4",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected discrepancies:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"strings"
+	"time"
+)
+
+// strategy name reported when a routing override picked the gateway
+const routingOverrideStrategy = "override"
+
+type merchantIDKey struct{}
+
+// ContextWithMerchantID attaches the merchant account a request is made for
+func ContextWithMerchantID(ctx context.Context, merchantID string) context.Context {
+	return context.WithValue(ctx, merchantIDKey{}, merchantID)
+}
+
+// MerchantIDFromContext returns the merchant account attached to the context, if any
+func MerchantIDFromContext(ctx context.Context) string {
+	merchantID, _ := ctx.Value(merchantIDKey{}).(string)
+	return merchantID
+}
+
+// RoutingOverrideService validates and manages the per-user and per-merchant routing overrides
+type RoutingOverrideService struct {
+	gatewayConfig *config.GatewayConfig
+	overrideRepo  repository.RoutingOverride
+}
+
+func NewRoutingOverrideService(gatewayConfig *config.GatewayConfig, overrideRepo repository.RoutingOverride) *RoutingOverrideService {
+	return &RoutingOverrideService{
+		gatewayConfig: gatewayConfig,
+		overrideRepo:  overrideRepo,
+	}
+}
+
+func (s *RoutingOverrideService) List(ctx context.Context) ([]models.RoutingOverride, error) {
+	return s.overrideRepo.List(ctx)
+}
+
+func (s *RoutingOverrideService) Create(ctx context.Context, override *models.RoutingOverride) error {
+	if override.UserID == nil && override.MerchantID == "" {
+		return &ValidationError{Message: "invalid routing override: user_id or merchant_id is required"}
+	}
+
+	if _, exists := s.gatewayConfig.GetGatewayDetails(override.Gateway); !exists {
+		return &ValidationError{Message: fmt.Sprintf("invalid routing override: unknown gateway %s", override.Gateway)}
+	}
+
+	if override.ExpiresAt != nil && !override.ExpiresAt.After(time.Now()) {
+		return &ValidationError{Message: "invalid routing override: expires_at must be in the future"}
+	}
+
+	override.CountryCode = strings.ToUpper(override.CountryCode)
+	override.Currency = strings.ToUpper(override.Currency)
+
+	return s.overrideRepo.Create(ctx, override)
+}
+
+func (s *RoutingOverrideService) Delete(ctx context.Context, id int) error {
+	return s.overrideRepo.Delete(ctx, id)
+}
+
+// matchRoutingOverride returns the most specific override applying to the transaction.
+// User overrides win over merchant overrides, then country, currency and transaction
+// type narrow the scope; on a tie the newest override wins.
+func matchRoutingOverride(overrides []models.RoutingOverride, request RoutingRequest, countryCode string) *models.RoutingOverride {
+	var best *models.RoutingOverride
+	bestScore := -1
+
+	for i := range overrides {
+		override := &overrides[i]
+		score := 0
+
+		if override.UserID != nil {
+			if *override.UserID != request.UserID {
+				continue
+			}
+			score += 8
+		} else if override.MerchantID == "" || override.MerchantID != request.MerchantID {
+			continue
+		}
+
+		if override.CountryCode != "" {
+			if !strings.EqualFold(override.CountryCode, countryCode) {
+				continue
+			}
+			score += 4
+		}
+
+		if override.Currency != "" {
+			if !strings.EqualFold(override.Currency, request.Currency) {
+				continue
+			}
+			score += 2
+		}
+
+		if override.TransactionType != "" {
+			if override.TransactionType != request.TransactionType {
+				continue
+			}
+			score++
+		}
+
+		if score > bestScore || (score == bestScore && override.ID > best.ID) {
+			best = override
+			bestScore = score
+		}
+	}
+
+	return best
+}
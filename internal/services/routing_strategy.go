@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"sort"
+)
+
+// RoutingRequest describes the transaction a gateway is being selected for
+type RoutingRequest struct {
+	UserID          int
+	MerchantID      string
+	Amount          float64
+	Currency        string
+	TransactionType string
+}
+
+// RoutingCandidate is a gateway configured for the user's country
+type RoutingCandidate struct {
+	Name     string
+	Priority int
+	Fee      float64
+	HasFee   bool
+}
+
+// RoutingStrategy orders the eligible gateways for a transaction, best first
+type RoutingStrategy interface {
+	Name() string
+	Rank(ctx context.Context, request RoutingRequest, country *models.Country, candidates []RoutingCandidate) []RoutingCandidate
+}
+
+// NewRoutingStrategy returns the strategy configured under routing.strategy
+func NewRoutingStrategy(routing config.RoutingConfig) (RoutingStrategy, error) {
+	switch routing.Strategy {
+	case "", config.RoutingStrategyPriority:
+		return PriorityStrategy{}, nil
+	case config.RoutingStrategyCost:
+		return CostStrategy{}, nil
+	case config.RoutingStrategyAdaptive:
+		return NewAdaptiveStrategy(routing.Adaptive), nil
+	default:
+		return nil, fmt.Errorf("unknown routing strategy %s", routing.Strategy)
+	}
+}
+
+// PriorityStrategy ranks gateways by the static priorities of the country configuration
+type PriorityStrategy struct{}
+
+func (PriorityStrategy) Name() string {
+	return config.RoutingStrategyPriority
+}
+
+func (PriorityStrategy) Rank(_ context.Context, _ RoutingRequest, _ *models.Country, candidates []RoutingCandidate) []RoutingCandidate {
+	ranked := append([]RoutingCandidate(nil), candidates...)
+	sortByPriority(ranked)
+	return ranked
+}
+
+// CostStrategy ranks the gateways with a matching fee schedule from cheapest to
+// most expensive, followed by the gateways without one in priority order
+type CostStrategy struct{}
+
+func (CostStrategy) Name() string {
+	return config.RoutingStrategyCost
+}
+
+func (CostStrategy) Rank(_ context.Context, _ RoutingRequest, _ *models.Country, candidates []RoutingCandidate) []RoutingCandidate {
+	var priced, unpriced []RoutingCandidate
+	for _, candidate := range candidates {
+		if candidate.HasFee {
+			priced = append(priced, candidate)
+		} else {
+			unpriced = append(unpriced, candidate)
+		}
+	}
+
+	sort.SliceStable(priced, func(i, j int) bool {
+		if priced[i].Fee != priced[j].Fee {
+			return priced[i].Fee < priced[j].Fee
+		}
+		if priced[i].Priority != priced[j].Priority {
+			return priced[i].Priority > priced[j].Priority
+		}
+		return priced[i].Name < priced[j].Name
+	})
+	sortByPriority(unpriced)
+
+	return append(priced, unpriced...)
+}
+
+func sortByPriority(candidates []RoutingCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority > candidates[j].Priority
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stripeCategories are the reporting categories of Stripe's balance change report that
+// settle a transaction, other lines such as fees are skipped
+var stripeCategories = map[string]bool{
+	"charge": true,
+	"refund": true,
+	"payout": true,
+}
+
+// adyenTypes are the record types of Adyen's settlement details report that settle a
+// transaction. A refund's own reference is its modification reference.
+var adyenTypes = map[string]bool{
+	"Settled":  true,
+	"Refunded": true,
+}
+
+// reportDateLayout is the date format of the Stripe and Adyen reports, in UTC
+const reportDateLayout = "2006-01-02 15:04:05"
+
+// ParseSettlementReport reads the settled transactions of a CSV settlement report in
+// the gateway's format. Amounts are positive whatever the direction of the money.
+func ParseSettlementReport(report io.Reader, settlement config.GatewaySettlement) ([]models.SettlementRecord, error) {
+	reader := csv.NewReader(report)
+	reader.TrimLeadingSpace = true
+	if settlement.Format == config.SettlementCSV {
+		reader.Comma = []rune(settlement.Delimiter)[0]
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settlement report header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	var parse func(row settlementRow) (*models.SettlementRecord, error)
+	switch settlement.Format {
+	case config.SettlementStripe:
+		parse = parseStripeSettlement
+	case config.SettlementAdyen:
+		parse = parseAdyenSettlement
+	case config.SettlementCSV:
+		parse = func(row settlementRow) (*models.SettlementRecord, error) {
+			return parseMappedSettlement(row, settlement)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported settlement format %q", settlement.Format)
+	}
+
+	var records []models.SettlementRecord
+	for line := 2; ; line++ {
+		values, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read settlement report: %w", err)
+		}
+
+		record, err := parse(settlementRow{columns: columns, values: values})
+		if err != nil {
+			return nil, fmt.Errorf("settlement report line %d: %w", line, err)
+		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+
+	return records, nil
+}
+
+// settlementRow gives access to the fields of a report line by column name
+type settlementRow struct {
+	columns map[string]int
+	values  []string
+}
+
+func (r settlementRow) get(column string) (string, error) {
+	i, ok := r.columns[column]
+	if !ok {
+		return "", fmt.Errorf("missing column %q", column)
+	}
+	if i >= len(r.values) {
+		return "", nil
+	}
+	return strings.TrimSpace(r.values[i]), nil
+}
+
+// fields returns the values of the named columns, failing on the first missing one
+func (r settlementRow) fields(columns ...string) ([]string, error) {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		value, err := r.get(column)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func parseStripeSettlement(row settlementRow) (*models.SettlementRecord, error) {
+	fields, err := row.fields("reporting_category", "source_id", "gross", "currency", "created_utc")
+	if err != nil {
+		return nil, err
+	}
+	category, reference, gross, currency, created := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	if !stripeCategories[category] {
+		return nil, nil
+	}
+
+	return newSettlementRecord(reference, gross, false, currency, StatusCompleted, created, reportDateLayout)
+}
+
+func parseAdyenSettlement(row settlementRow) (*models.SettlementRecord, error) {
+	fields, err := row.fields("Type", "Psp Reference", "Modification Reference", "Gross Credit (GC)", "Gross Debit (GC)", "Gross Currency", "Creation Date")
+	if err != nil {
+		return nil, err
+	}
+	recordType, pspReference, modificationReference, credit, debit, currency, created := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+	if !adyenTypes[recordType] {
+		return nil, nil
+	}
+
+	reference := pspReference
+	if recordType == "Refunded" && modificationReference != "" {
+		reference = modificationReference
+	}
+
+	amount := credit
+	if amount == "" {
+		amount = debit
+	}
+
+	return newSettlementRecord(reference, amount, false, currency, StatusCompleted, created, reportDateLayout)
+}
+
+func parseMappedSettlement(row settlementRow, settlement config.GatewaySettlement) (*models.SettlementRecord, error) {
+	fields, err := row.fields(settlement.Columns.Reference, settlement.Columns.Amount, settlement.Columns.Date)
+	if err != nil {
+		return nil, err
+	}
+	reference, amount, date := fields[0], fields[1], fields[2]
+
+	var currency string
+	if settlement.Columns.Currency != "" {
+		if currency, err = row.get(settlement.Columns.Currency); err != nil {
+			return nil, err
+		}
+	}
+
+	status := StatusCompleted
+	if settlement.Columns.Status != "" {
+		reported, err := row.get(settlement.Columns.Status)
+		if err != nil {
+			return nil, err
+		}
+		status = strings.ToUpper(reported)
+		if mapped, ok := settlement.Statuses[reported]; ok {
+			status = mapped
+		}
+	}
+
+	return newSettlementRecord(reference, amount, settlement.MinorUnits, currency, status, date, settlement.DateLayout)
+}
+
+func newSettlementRecord(reference, amount string, minorUnits bool, currency, status, date, dateLayout string) (*models.SettlementRecord, error) {
+	if reference == "" {
+		return nil, fmt.Errorf("missing gateway reference")
+	}
+
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	if minorUnits {
+		value /= 100
+	}
+
+	settledAt, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q: %w", date, err)
+	}
+
+	return &models.SettlementRecord{
+		GatewayReference: reference,
+		Amount:           math.Round(math.Abs(value)*100) / 100,
+		Currency:         strings.ToUpper(currency),
+		Status:           status,
+		SettledAt:        settledAt,
+	}, nil
+}
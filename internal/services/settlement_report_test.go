@@ -0,0 +1,99 @@
+package services_test
+
+import (
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/services"
+	"strings"
+	"testing"
+)
+
+func TestParseSettlementReport(t *testing.T) {
+	tests := []struct {
+		name       string
+		settlement config.GatewaySettlement
+		report     string
+		expected   []string
+	}{
+		{
+			name:       "Stripe",
+			settlement: config.GatewaySettlement{Format: config.SettlementStripe},
+			report: "balance_transaction_id,created_utc,currency,gross,fee,net,reporting_category,source_id\n" +
+				"txn_1,2025-03-07 15:42:00,eur,100.00,-1.75,98.25,charge,ch_1\n" +
+				"txn_2,2025-03-08 09:00:00,eur,-25.00,0.00,-25.00,refund,re_1\n" +
+				"txn_3,2025-03-08 09:00:00,eur,-1.75,0.00,-1.75,fee,\n",
+			expected: []string{
+				"ch_1 100.00 EUR COMPLETED 2025-03-07",
+				"re_1 25.00 EUR COMPLETED 2025-03-08",
+			},
+		},
+		{
+			name:       "Adyen",
+			settlement: config.GatewaySettlement{Format: config.SettlementAdyen},
+			report: "Company Account,Merchant Account,Psp Reference,Merchant Reference,Payment Method,Creation Date,TimeZone,Type,Modification Reference,Gross Currency,Gross Debit (GC),Gross Credit (GC)\n" +
+				"Acme,AcmeEU,8815,deposit-1,visa,2025-03-07 15:42:00,UTC,Settled,8815,EUR,,100.00\n" +
+				"Acme,AcmeEU,8815,refund-2,visa,2025-03-08 10:00:00,UTC,Refunded,8816,EUR,25.00,\n" +
+				"Acme,AcmeEU,,,,2025-03-08 10:00:00,UTC,Fee,,EUR,0.11,\n",
+			expected: []string{
+				"8815 100.00 EUR COMPLETED 2025-03-07",
+				"8816 25.00 EUR COMPLETED 2025-03-08",
+			},
+		},
+		{
+			name: "Column Mapping",
+			settlement: config.GatewaySettlement{
+				Format:     config.SettlementCSV,
+				Columns:    config.SettlementColumns{Reference: "transaction_ref", Amount: "amount", Currency: "currency", Status: "state", Date: "value_date"},
+				Delimiter:  ";",
+				DateLayout: "2006-01-02",
+				MinorUnits: true,
+				Statuses:   map[string]string{"SETTLED": "COMPLETED"},
+			},
+			report: "transaction_ref;amount;currency;state;value_date\n" +
+				"SOAP-1;10050;usd;SETTLED;2025-03-07\n" +
+				"SOAP-2;2000;usd;returned;2025-03-08\n",
+			expected: []string{
+				"SOAP-1 100.50 USD COMPLETED 2025-03-07",
+				"SOAP-2 20.00 USD RETURNED 2025-03-08",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := services.ParseSettlementReport(strings.NewReader(tt.report), tt.settlement)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			var got []string
+			for _, record := range records {
+				got = append(got, fmt.Sprintf("%s %.2f %s %s %s", record.GatewayReference, record.Amount, record.Currency, record.Status, record.SettledAt.Format("2006-01-02")))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected records:\n%s\ngot:\n%s", strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseSettlementReportErrors(t *testing.T) {
+	stripe := config.GatewaySettlement{Format: config.SettlementStripe}
+
+	tests := []struct {
+		name   string
+		report string
+	}{
+		{"Missing Column", "created_utc,currency,gross,reporting_category\n2025-03-07 15:42:00,eur,100.00,charge\n"},
+		{"Invalid Amount", "created_utc,currency,gross,reporting_category,source_id\n2025-03-07 15:42:00,eur,abc,charge,ch_1\n"},
+		{"Invalid Date", "created_utc,currency,gross,reporting_category,source_id\n07/03/2025,eur,100.00,charge,ch_1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := services.ParseSettlementReport(strings.NewReader(tt.report), stripe); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
+	"payment-gateway/internal/models"
+	"strings"
+)
+
+// Envelope namespaces of the supported SOAP versions
+const (
+	SOAP11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	SOAP12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// SOAPFault is a soap:Fault returned by a gateway, in either SOAP version
+type SOAPFault struct {
+	Code   string
+	Reason string
+	Actor  string
+	Detail string
+}
+
+func (f *SOAPFault) Error() string {
+	return fmt.Sprintf("soap fault %s: %s", f.Code, f.Reason)
+}
+
+// SOAPCodec wraps requests in a SOAP envelope and unwraps responses and callbacks
+type SOAPCodec struct {
+	settings config.GatewaySOAP
+}
+
+func NewSOAPCodec(settings config.GatewaySOAP) *SOAPCodec {
+	return &SOAPCodec{
+		settings: settings,
+	}
+}
+
+// soapTransactionRequest is the body of the requests sent to SOAP gateways
+type soapTransactionRequest struct {
+	XMLName       xml.Name
+	TransactionID int     `xml:"transaction_id"`
+	Amount        float64 `xml:"amount"`
+	Currency      string  `xml:"currency"`
+	Type          string  `xml:"type"`
+	// OriginalReference is the gateway reference of the transaction a refund, capture or cancellation is for
+	OriginalReference string `xml:"original_reference,omitempty"`
+}
+
+// soapTransactionResponse is the body of the responses and callbacks of SOAP gateways
+type soapTransactionResponse struct {
+	TransactionID    int    `xml:"transaction_id"`
+	GatewayReference string `xml:"gateway_reference"`
+	Status           string `xml:"status"`
+	DeclineCode      string `xml:"decline_code"`
+}
+
+// EncodeTransaction returns the envelope for a transaction and the headers it must be sent with
+func (c *SOAPCodec) EncodeTransaction(transaction *models.Transaction, currency string) ([]byte, map[string]string, error) {
+	return c.encodeRequest("TransactionRequest", transaction, currency, "")
+}
+
+// EncodeReferenced returns the envelope for a refund or capture of the transaction with the
+// given gateway reference and the headers it must be sent with
+func (c *SOAPCodec) EncodeReferenced(transaction *models.Transaction, originalReference string) ([]byte, map[string]string, error) {
+	element := "RefundRequest"
+	if transaction.Type == "capture" {
+		element = "CaptureRequest"
+	}
+	return c.encodeRequest(element, transaction, transaction.Currency, originalReference)
+}
+
+// EncodeCancel returns the envelope cancelling a transaction, a "cancel" of a withdrawal or a
+// "void" of an authorization, and the headers it must be sent with
+func (c *SOAPCodec) EncodeCancel(transaction *models.Transaction, requestType string) ([]byte, map[string]string, error) {
+	element := "CancelRequest"
+	if requestType == "void" {
+		element = "VoidRequest"
+	}
+	return c.encodeRequest(element, transaction, transaction.Currency, transaction.GatewayReference)
+}
+
+// EncodeStatus returns the envelope looking up the status of a transaction by its gateway
+// reference and the headers it must be sent with
+func (c *SOAPCodec) EncodeStatus(transaction *models.Transaction) ([]byte, map[string]string, error) {
+	return c.encodeRequest("StatusRequest", transaction, transaction.Currency, transaction.GatewayReference)
+}
+
+func (c *SOAPCodec) encodeRequest(
+	element string,
+	transaction *models.Transaction,
+	currency string,
+	originalReference string,
+) ([]byte, map[string]string, error) {
+	body := soapTransactionRequest{
+		XMLName:           xml.Name{Space: c.settings.Namespace, Local: element},
+		TransactionID:     transaction.ID,
+		Amount:            transaction.Amount,
+		Currency:          currency,
+		Type:              transaction.Type,
+		OriginalReference: originalReference,
+	}
+
+	payload, err := c.Encode(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payload, c.Headers(), nil
+}
+
+// Encode wraps a body element in an envelope of the configured SOAP version
+func (c *SOAPCodec) Encode(body interface{}) ([]byte, error) {
+	content, err := xml.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal soap body: %w", err)
+	}
+
+	var envelope bytes.Buffer
+	envelope.WriteString(xml.Header)
+	fmt.Fprintf(&envelope, `<soap:Envelope xmlns:soap="%s"><soap:Body>`, c.envelopeNamespace())
+	envelope.Write(content)
+	envelope.WriteString(`</soap:Body></soap:Envelope>`)
+
+	return envelope.Bytes(), nil
+}
+
+// Headers returns the content type and action headers of the configured SOAP version
+func (c *SOAPCodec) Headers() map[string]string {
+	if c.settings.Version == "1.2" {
+		contentType := "application/soap+xml; charset=utf-8"
+		if c.settings.Action != "" {
+			contentType += fmt.Sprintf(`; action="%s"`, c.settings.Action)
+		}
+		return map[string]string{"Content-Type": contentType}
+	}
+
+	return map[string]string{
+		"Content-Type": "text/xml; charset=utf-8",
+		"SOAPAction":   fmt.Sprintf(`"%s"`, c.settings.Action),
+	}
+}
+
+// ApplyResponse reads the gateway reference and status of a SOAP response into the result.
+// A soap:Fault is returned as a *SOAPFault.
+func (c *SOAPCodec) ApplyResponse(result *gateway.Result) error {
+	var response soapTransactionResponse
+	if err := DecodeSOAP(result.RawResponse, &response); err != nil {
+		return err
+	}
+
+	result.GatewayReference = response.GatewayReference
+	result.DeclineCode = response.DeclineCode
+
+	switch strings.ToUpper(response.Status) {
+	case gateway.StatusCompleted:
+		result.Status = gateway.StatusCompleted
+	case gateway.StatusFailed, "DECLINED":
+		result.Status = gateway.StatusFailed
+	default:
+		result.Status = gateway.StatusProcessing
+	}
+
+	return nil
+}
+
+func (c *SOAPCodec) envelopeNamespace() string {
+	if c.settings.Version == "1.2" {
+		return SOAP12Namespace
+	}
+	return SOAP11Namespace
+}
+
+type soapEnvelope struct {
+	XMLName xml.Name
+	Body    struct {
+		Fault   *soapFault `xml:"Fault"`
+		Content []byte     `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// soapFault holds the fields of both SOAP 1.1 and SOAP 1.2 faults
+type soapFault struct {
+	// SOAP 1.1
+	FaultCode   string `xml:"faultcode"`
+	FaultString string `xml:"faultstring"`
+	FaultActor  string `xml:"faultactor"`
+	FaultDetail struct {
+		Content string `xml:",innerxml"`
+	} `xml:"detail"`
+
+	// SOAP 1.2
+	Code struct {
+		Value   string `xml:"Value"`
+		Subcode struct {
+			Value string `xml:"Value"`
+		} `xml:"Subcode"`
+	} `xml:"Code"`
+	Reason struct {
+		Text []string `xml:"Text"`
+	} `xml:"Reason"`
+	Role   string `xml:"Role"`
+	Detail struct {
+		Content string `xml:",innerxml"`
+	} `xml:"Detail"`
+}
+
+func (f *soapFault) toError() *SOAPFault {
+	if f.FaultCode != "" || f.FaultString != "" {
+		return &SOAPFault{
+			Code:   f.FaultCode,
+			Reason: f.FaultString,
+			Actor:  f.FaultActor,
+			Detail: strings.TrimSpace(f.FaultDetail.Content),
+		}
+	}
+
+	code := f.Code.Value
+	if f.Code.Subcode.Value != "" {
+		code += "/" + f.Code.Subcode.Value
+	}
+
+	return &SOAPFault{
+		Code:   code,
+		Reason: strings.Join(f.Reason.Text, "; "),
+		Actor:  f.Role,
+		Detail: strings.TrimSpace(f.Detail.Content),
+	}
+}
+
+// IsSOAPEnvelope reports whether an XML document is a SOAP envelope
+func IsSOAPEnvelope(data []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local == "Envelope" &&
+				(start.Name.Space == SOAP11Namespace || start.Name.Space == SOAP12Namespace)
+		}
+	}
+}
+
+// DecodeSOAP unmarshals the body element of a SOAP 1.1 or 1.2 envelope into v.
+// A soap:Fault is returned as a *SOAPFault.
+func DecodeSOAP(data []byte, v interface{}) error {
+	var envelope soapEnvelope
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("failed to parse soap envelope: %w", err)
+	}
+
+	if envelope.XMLName.Local != "Envelope" ||
+		(envelope.XMLName.Space != SOAP11Namespace && envelope.XMLName.Space != SOAP12Namespace) {
+		return fmt.Errorf("not a soap envelope: %s", envelope.XMLName.Local)
+	}
+
+	if envelope.Body.Fault != nil {
+		return envelope.Body.Fault.toError()
+	}
+
+	if err := xml.Unmarshal(envelope.Body.Content, v); err != nil {
+		return fmt.Errorf("failed to parse soap body: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package services_test
+
+import (
+	"errors"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/services"
+	"strings"
+	"testing"
+)
+
+func TestSOAPCodecEncodeTransaction(t *testing.T) {
+	transaction := &models.Transaction{ID: 42, Amount: 10.5, Type: "deposit"}
+
+	tests := []struct {
+		name            string
+		settings        config.GatewaySOAP
+		envelope        string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:     "SOAP 1.1",
+			settings: config.GatewaySOAP{Version: "1.1", Namespace: "urn:payments", Action: "process"},
+			envelope: services.SOAP11Namespace,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/xml; charset=utf-8",
+				"SOAPAction":   `"process"`,
+			},
+		},
+		{
+			name:     "SOAP 1.2",
+			settings: config.GatewaySOAP{Version: "1.2", Namespace: "urn:payments", Action: "process"},
+			envelope: services.SOAP12Namespace,
+			expectedHeaders: map[string]string{
+				"Content-Type": `application/soap+xml; charset=utf-8; action="process"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, headers, err := services.NewSOAPCodec(tt.settings).EncodeTransaction(transaction, "EUR")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			body := string(payload)
+			for _, part := range []string{
+				`<soap:Envelope xmlns:soap="` + tt.envelope + `"><soap:Body>`,
+				`<TransactionRequest xmlns="urn:payments">`,
+				`<transaction_id>42</transaction_id><amount>10.5</amount><currency>EUR</currency><type>deposit</type>`,
+			} {
+				if !strings.Contains(body, part) {
+					t.Errorf("Expected envelope to contain %s, got %s", part, body)
+				}
+			}
+
+			if len(headers) != len(tt.expectedHeaders) {
+				t.Errorf("Expected headers %v, got %v", tt.expectedHeaders, headers)
+			}
+			for key, value := range tt.expectedHeaders {
+				if headers[key] != value {
+					t.Errorf("Expected header %s to be %s, got %s", key, value, headers[key])
+				}
+			}
+		})
+	}
+}
+
+func TestSOAPCodecApplyResponse(t *testing.T) {
+	codec := services.NewSOAPCodec(config.GatewaySOAP{Version: "1.1", Namespace: "urn:payments"})
+
+	result := &gateway.Result{RawResponse: []byte(`<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:pay="urn:payments">
+  <soap:Body>
+    <pay:TransactionResponse>
+      <pay:gateway_reference>SG-20240611-0042</pay:gateway_reference>
+      <pay:status>COMPLETED</pay:status>
+    </pay:TransactionResponse>
+  </soap:Body>
+</soap:Envelope>`)}
+
+	if err := codec.ApplyResponse(result); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.GatewayReference != "SG-20240611-0042" {
+		t.Errorf("Expected gateway reference SG-20240611-0042, got %s", result.GatewayReference)
+	}
+	if result.Status != gateway.StatusCompleted {
+		t.Errorf("Expected status %s, got %s", gateway.StatusCompleted, result.Status)
+	}
+}
+
+func TestDecodeSOAPFault(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope string
+		expected services.SOAPFault
+	}{
+		{
+			name: "SOAP 1.1",
+			envelope: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <soap:Fault>
+      <faultcode>soap:Client</faultcode>
+      <faultstring>Invalid currency</faultstring>
+      <detail><code>E102</code></detail>
+    </soap:Fault>
+  </soap:Body>
+</soap:Envelope>`,
+			expected: services.SOAPFault{Code: "soap:Client", Reason: "Invalid currency", Detail: "<code>E102</code>"},
+		},
+		{
+			name: "SOAP 1.2",
+			envelope: `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+  <env:Body>
+    <env:Fault>
+      <env:Code>
+        <env:Value>env:Sender</env:Value>
+        <env:Subcode><env:Value>pay:LimitExceeded</env:Value></env:Subcode>
+      </env:Code>
+      <env:Reason><env:Text xml:lang="en">Daily limit exceeded</env:Text></env:Reason>
+    </env:Fault>
+  </env:Body>
+</env:Envelope>`,
+			expected: services.SOAPFault{Code: "env:Sender/pay:LimitExceeded", Reason: "Daily limit exceeded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !services.IsSOAPEnvelope([]byte(tt.envelope)) {
+				t.Fatal("Expected the document to be recognised as a SOAP envelope")
+			}
+
+			var body struct{}
+			err := services.DecodeSOAP([]byte(tt.envelope), &body)
+
+			var fault *services.SOAPFault
+			if !errors.As(err, &fault) {
+				t.Fatalf("Expected a SOAP fault, got: %v", err)
+			}
+			if *fault != tt.expected {
+				t.Errorf("Expected fault %+v, got %+v", tt.expected, *fault)
+			}
+		})
+	}
+}
+
+func TestDecodeSOAPRejectsBareXML(t *testing.T) {
+	data := []byte(`<XMLCallback><transaction_id>1</transaction_id></XMLCallback>`)
+
+	if services.IsSOAPEnvelope(data) {
+		t.Error("Expected bare XML not to be recognised as a SOAP envelope")
+	}
+
+	var body struct{}
+	if err := services.DecodeSOAP(data, &body); err == nil {
+		t.Error("Expected an error for bare XML, got nil")
+	}
+}
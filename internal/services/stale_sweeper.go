@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
+	"time"
+)
+
+// staleSweepLock is the lock held by the instance sweeping stale transactions
+const staleSweepLock = "stale-transaction-sweep"
+
+// staleSweepPageSize is how many transactions a sweep lists at a time
+const staleSweepPageSize = 500
+
+// StaleSweeperConfig is the gateway configuration the stale transaction sweeper reads
+type StaleSweeperConfig interface {
+	GatewayConfigProvider
+	// MinStatusSLA returns the shortest status_sla of the gateways, in seconds
+	MinStatusSLA() int
+}
+
+// StatusPoller looks transactions up at their gateway
+type StatusPoller interface {
+	PollStatus(ctx context.Context, transaction *models.Transaction) (string, error)
+}
+
+// StatusApplier moves transactions to the statuses their gateway reported
+type StatusApplier interface {
+	ApplyStatus(ctx context.Context, transactionID int, status, eventType string) error
+}
+
+// StaleTransactionSweeper revisits the transactions left PENDING or PROCESSING, such as those
+// whose callback never arrived. Past the status_sla of their gateway their status is looked up
+// at the gateway, past its expire_after they are marked EXPIRED.
+type StaleTransactionSweeper struct {
+	gatewayConfig   StaleSweeperConfig
+	transactionRepo repository.Transaction
+	gatewayRepo     repository.Gateway
+	poller          StatusPoller
+	applier         StatusApplier
+	locker          repository.Locker
+}
+
+func NewStaleTransactionSweeper(
+	gatewayConfig StaleSweeperConfig,
+	transactionRepo repository.Transaction,
+	gatewayRepo repository.Gateway,
+	poller StatusPoller,
+	applier StatusApplier,
+	locker repository.Locker,
+) *StaleTransactionSweeper {
+	return &StaleTransactionSweeper{
+		gatewayConfig:   gatewayConfig,
+		transactionRepo: transactionRepo,
+		gatewayRepo:     gatewayRepo,
+		poller:          poller,
+		applier:         applier,
+		locker:          locker,
+	}
+}
+
+// Run sweeps at every interval until the context is done
+func (s *StaleTransactionSweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				log.Printf("stale transaction sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// Sweep resolves the stale transactions and returns how many were moved to another status.
+// Only one instance sweeps at a time, the others return right away. Failing to resolve a
+// transaction is logged and left for the next sweep.
+func (s *StaleTransactionSweeper) Sweep(ctx context.Context) (int, error) {
+	unlock, acquired, err := s.locker.TryLock(ctx, staleSweepLock)
+	if err != nil {
+		return 0, err
+	}
+	if !acquired {
+		return 0, nil
+	}
+	defer unlock()
+
+	now := time.Now()
+	// Younger transactions are within the status_sla of every gateway
+	createdBefore := now.Add(-time.Duration(s.gatewayConfig.MinStatusSLA()) * time.Second)
+
+	// Limits are per gateway, so they are looked up once per gateway
+	limits := make(map[int]staleLimits)
+	resolved := 0
+	afterID := 0
+	for {
+		transactions, err := s.transactionRepo.ListByStatuses(ctx, []string{StatusPending, StatusProcessing}, createdBefore, afterID, staleSweepPageSize)
+		if err != nil {
+			return resolved, fmt.Errorf("failed to list transactions in progress: %w", err)
+		}
+
+		for i := range transactions {
+			transaction := &transactions[i]
+
+			limit, ok := limits[transaction.GatewayID]
+			if !ok {
+				limit, err = s.limitsFor(ctx, transaction.GatewayID)
+				if err != nil {
+					log.Printf("transaction %d: %v", transaction.ID, err)
+					continue
+				}
+				limits[transaction.GatewayID] = limit
+			}
+
+			if s.resolve(ctx, transaction, now.Sub(transaction.CreatedAt), limit) {
+				resolved++
+			}
+		}
+
+		if len(transactions) < staleSweepPageSize {
+			return resolved, nil
+		}
+		afterID = transactions[len(transactions)-1].ID
+	}
+}
+
+// resolve looks a transaction up at its gateway once past the status SLA and expires it
+// once past expire_after, reporting whether it was moved to another status
+func (s *StaleTransactionSweeper) resolve(ctx context.Context, transaction *models.Transaction, age time.Duration, limit staleLimits) bool {
+	if age < limit.statusSLA {
+		return false
+	}
+
+	status, err := s.poller.PollStatus(ctx, transaction)
+	if err != nil {
+		log.Printf("failed to look up the status of transaction %d: %v", transaction.ID, err)
+	}
+
+	eventType := EventStatusPolled
+	if status == "" {
+		if age < limit.expireAfter {
+			return false
+		}
+		status = StatusExpired
+		eventType = EventTransactionExpired
+	}
+
+	if err := s.applier.ApplyStatus(ctx, transaction.ID, status, eventType); err != nil {
+		log.Printf("failed to move stale transaction %d to %s: %v", transaction.ID, status, err)
+		return false
+	}
+
+	return true
+}
+
+type staleLimits struct {
+	statusSLA   time.Duration
+	expireAfter time.Duration
+}
+
+func (s *StaleTransactionSweeper) limitsFor(ctx context.Context, gatewayID int) (staleLimits, error) {
+	gateway, err := s.gatewayRepo.FindByID(ctx, gatewayID)
+	if err != nil {
+		return staleLimits{}, fmt.Errorf("failed to find gateway: %w", err)
+	}
+
+	details, exists := s.gatewayConfig.GetGatewayDetails(gateway.Name)
+	if !exists {
+		return staleLimits{}, fmt.Errorf("gateway %s not found in configuration", gateway.Name)
+	}
+
+	return staleLimits{
+		statusSLA:   time.Duration(details.StatusSLA) * time.Second,
+		expireAfter: time.Duration(details.ExpireAfter) * time.Second,
+	}, nil
+}
@@ -0,0 +1,266 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/services"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockLocker struct {
+	busy     bool
+	unlocked bool
+}
+
+func (m *mockLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	if m.busy {
+		return nil, false, nil
+	}
+	return func() { m.unlocked = true }, true, nil
+}
+
+type mockStatusPoller struct {
+	mockPollStatus func(ctx context.Context, transaction *models.Transaction) (string, error)
+}
+
+func (m *mockStatusPoller) PollStatus(ctx context.Context, transaction *models.Transaction) (string, error) {
+	return m.mockPollStatus(ctx, transaction)
+}
+
+type mockStatusApplier struct {
+	applied []string
+}
+
+func (m *mockStatusApplier) ApplyStatus(ctx context.Context, transactionID int, status, eventType string) error {
+	m.applied = append(m.applied, fmt.Sprintf("%d %s %s", transactionID, status, eventType))
+	return nil
+}
+
+func TestStaleTransactionSweeperSweep(t *testing.T) {
+	now := time.Now()
+	transactions := []models.Transaction{
+		// Within the SLA
+		{ID: 1, Status: "PROCESSING", GatewayID: 1, CreatedAt: now.Add(-5 * time.Minute)},
+		{ID: 2, Status: "PROCESSING", GatewayID: 1, CreatedAt: now.Add(-20 * time.Minute)},
+		{ID: 3, Status: "PROCESSING", GatewayID: 1, CreatedAt: now.Add(-20 * time.Minute)},
+		{ID: 4, Status: "PROCESSING", GatewayID: 1, CreatedAt: now.Add(-20 * time.Minute)},
+		// Past the deadline
+		{ID: 5, Status: "PENDING", GatewayID: 1, CreatedAt: now.Add(-4 * time.Hour)},
+		{ID: 6, Status: "PROCESSING", GatewayID: 1, CreatedAt: now.Add(-4 * time.Hour)},
+		{ID: 7, Status: "PROCESSING", GatewayID: 1, CreatedAt: now.Add(-4 * time.Hour)},
+	}
+	// What the gateway reports for each transaction looked up
+	polled := map[int]string{2: "COMPLETED", 3: "", 4: "error", 5: "", 6: "FAILED", 7: "error"}
+
+	var listedBefore time.Time
+	transactionRepo := &mockTransactionRepo{
+		mockListByStatuses: func(ctx context.Context, statuses []string, createdBefore time.Time, afterID, limit int) ([]models.Transaction, error) {
+			if strings.Join(statuses, ",") != "PENDING,PROCESSING" {
+				t.Errorf("Unexpected listing of %v", statuses)
+			}
+			listedBefore = createdBefore
+			return transactions, nil
+		},
+	}
+
+	// The other gateways have a longer status_sla
+	gatewayConfig := &mockGatewayConfigProvider{
+		mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+			return config.GatewayDetails{StatusSLA: 15 * 60, ExpireAfter: 3 * 60 * 60}, true
+		},
+		minStatusSLA: 10 * 60,
+	}
+
+	gatewayRepo := &mockGatewayRepo{
+		mockFindByID: func(ctx context.Context, id int) (*models.Gateway, error) {
+			return &models.Gateway{ID: id, Name: "stripe"}, nil
+		},
+	}
+
+	var lookedUp []int
+	poller := &mockStatusPoller{
+		mockPollStatus: func(ctx context.Context, transaction *models.Transaction) (string, error) {
+			lookedUp = append(lookedUp, transaction.ID)
+			if polled[transaction.ID] == "error" {
+				return "", errors.New("gateway unavailable")
+			}
+			return polled[transaction.ID], nil
+		},
+	}
+
+	applier := &mockStatusApplier{}
+	locker := &mockLocker{}
+	sweeper := services.NewStaleTransactionSweeper(gatewayConfig, transactionRepo, gatewayRepo, poller, applier, locker)
+
+	resolved, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if age := time.Since(listedBefore); age < 10*time.Minute || age > 11*time.Minute {
+		t.Errorf("Expected transactions older than the shortest SLA to be listed, got %v", age)
+	}
+	if fmt.Sprint(lookedUp) != "[2 3 4 5 6 7]" {
+		t.Errorf("Expected the transactions past the SLA to be looked up, got %v", lookedUp)
+	}
+
+	expected := []string{
+		"2 COMPLETED status_polled",
+		"5 EXPIRED transaction_expired",
+		"6 FAILED status_polled",
+		"7 EXPIRED transaction_expired",
+	}
+	if resolved != 4 || strings.Join(applier.applied, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %d transactions resolved:\n%s\ngot %d:\n%s", len(expected), strings.Join(expected, "\n"), resolved, strings.Join(applier.applied, "\n"))
+	}
+	if !locker.unlocked {
+		t.Error("Expected the lock to be released")
+	}
+
+	// Another instance is sweeping
+	locker.busy = true
+	transactionRepo.mockListByStatuses = func(ctx context.Context, statuses []string, createdBefore time.Time, afterID, limit int) ([]models.Transaction, error) {
+		t.Error("Expected nothing to be listed without the lock")
+		return nil, nil
+	}
+	if resolved, err := sweeper.Sweep(context.Background()); resolved != 0 || err != nil {
+		t.Errorf("Expected the sweep to be skipped, got %d and %v", resolved, err)
+	}
+}
+
+func TestStaleTransactionSweeperPages(t *testing.T) {
+	var transactions []models.Transaction
+	for id := 1; id <= 1200; id++ {
+		transactions = append(transactions, models.Transaction{ID: id, Status: "PENDING", GatewayID: 1, CreatedAt: time.Now().Add(-4 * time.Hour)})
+	}
+
+	var pages []string
+	transactionRepo := &mockTransactionRepo{
+		mockListByStatuses: func(ctx context.Context, statuses []string, createdBefore time.Time, afterID, limit int) ([]models.Transaction, error) {
+			pages = append(pages, fmt.Sprintf("after %d", afterID))
+			page := transactions[afterID:]
+			if len(page) > limit {
+				page = page[:limit]
+			}
+			return page, nil
+		},
+	}
+
+	gatewayConfig := &mockGatewayConfigProvider{
+		mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+			return config.GatewayDetails{StatusSLA: 15 * 60, ExpireAfter: 3 * 60 * 60}, true
+		},
+	}
+
+	gatewayRepo := &mockGatewayRepo{
+		mockFindByID: func(ctx context.Context, id int) (*models.Gateway, error) {
+			return &models.Gateway{ID: id, Name: "stripe"}, nil
+		},
+	}
+
+	poller := &mockStatusPoller{
+		mockPollStatus: func(ctx context.Context, transaction *models.Transaction) (string, error) {
+			return "", nil
+		},
+	}
+
+	applier := &mockStatusApplier{}
+	sweeper := services.NewStaleTransactionSweeper(gatewayConfig, transactionRepo, gatewayRepo, poller, applier, &mockLocker{})
+
+	resolved, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if resolved != len(transactions) || len(applier.applied) != len(transactions) {
+		t.Errorf("Expected every transaction to be expired, got %d", resolved)
+	}
+	if strings.Join(pages, ", ") != "after 0, after 500, after 1000" {
+		t.Errorf("Expected the transactions to be listed a page at a time, got %v", pages)
+	}
+}
+
+func TestPollStatus(t *testing.T) {
+	tests := []struct {
+		name            string
+		transactionType string
+		reference       string
+		statusCode      int
+		gatewayStatus   string
+		paymentRef      string
+		expectedStatus  string
+		expectedRef     string
+		expectLookup    bool
+	}{
+		{name: "Completed", transactionType: "deposit", reference: "ch_1", statusCode: 200, gatewayStatus: gateway.StatusCompleted, expectedStatus: "COMPLETED", expectLookup: true},
+		{name: "Authorized", transactionType: "authorization", reference: "ch_1", statusCode: 200, gatewayStatus: gateway.StatusCompleted, expectedStatus: "AUTHORIZED", expectLookup: true},
+		{name: "Failed", transactionType: "deposit", reference: "ch_1", statusCode: 200, gatewayStatus: gateway.StatusFailed, expectedStatus: "FAILED", expectLookup: true},
+		{name: "Captured Order", transactionType: "deposit", reference: "5O190127TN364715T", statusCode: 200, gatewayStatus: gateway.StatusCompleted, paymentRef: "3C679366HH908993F", expectedStatus: "COMPLETED", expectedRef: "3C679366HH908993F", expectLookup: true},
+		{name: "Still Processing", transactionType: "deposit", reference: "ch_1", statusCode: 200, gatewayStatus: gateway.StatusProcessing, expectLookup: true},
+		{name: "Not Found", transactionType: "withdrawal", reference: "po_1", statusCode: http.StatusNotFound, gatewayStatus: gateway.StatusFailed, expectLookup: true},
+		{name: "No Reference", transactionType: "deposit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			looked := false
+			stored := ""
+			client := &mockClient{
+				mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+					looked = true
+					if request.TransactionType != "status" || request.OriginalReference != tt.reference {
+						t.Errorf("Unexpected request: %+v", request)
+					}
+					result := &gateway.Result{StatusCode: tt.statusCode, Status: tt.gatewayStatus, GatewayReference: tt.paymentRef}
+					if tt.statusCode >= 300 {
+						return result, fmt.Errorf("gateway returned non-success status: %d", tt.statusCode)
+					}
+					return result, nil
+				},
+			}
+
+			processor := services.NewTransactionProcessor(
+				&mockGatewayConfigProvider{
+					mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+						return config.GatewayDetails{Endpoints: config.GatewayEndpoints{Status: "/v1/charges/{reference}"}}, true
+					},
+				},
+				&mockGatewaySelectorProvider{},
+				&mockTransactionRepo{
+					mockSetGatewayReference: func(ctx context.Context, transactionID int, reference string) error {
+						stored = reference
+						return nil
+					},
+				},
+				&mockGatewayRepo{
+					mockFindByID: func(ctx context.Context, id int) (*models.Gateway, error) {
+						return &models.Gateway{ID: id, Name: "stripe", DataFormatSupported: "application/json"}, nil
+					},
+				},
+				client,
+			)
+
+			status, err := processor.PollStatus(context.Background(), &models.Transaction{
+				ID: 42, Type: tt.transactionType, Status: "PROCESSING", GatewayID: 1, GatewayReference: tt.reference,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("Expected status %q, got %q", tt.expectedStatus, status)
+			}
+			if looked != tt.expectLookup {
+				t.Errorf("Expected lookup %v, got %v", tt.expectLookup, looked)
+			}
+			if stored != tt.expectedRef {
+				t.Errorf("Expected stored reference %q, got %q", tt.expectedRef, stored)
+			}
+		})
+	}
+}
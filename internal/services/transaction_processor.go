@@ -3,18 +3,23 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
 	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
 	"payment-gateway/internal/kafka"
 	"payment-gateway/internal/models"
 	"payment-gateway/internal/repository"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Client defines the interface for gateway communication
 type Client interface {
-	SendTransaction(ctx context.Context, transactionType string, payload []byte, transactionID int, gatewayDetails config.GatewayDetails) error
+	SendTransaction(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error)
 }
 
 // GatewayConfigProvider defines the interface for accessing gateway configuration
@@ -25,29 +30,89 @@ type GatewayConfigProvider interface {
 
 // GatewaySelectorProvider defines the interface for selecting gateways
 type GatewaySelectorProvider interface {
-	// SelectGatewayForUser selects a gateway for a given user
-	SelectGatewayForUser(ctx context.Context, userID int) (*models.Gateway, error)
+	// SelectGatewayForUser selects a gateway for a given user's transaction
+	SelectGatewayForUser(ctx context.Context, request RoutingRequest) (*GatewaySelection, error)
 }
 
+// TransactionProcessorOption customises a TransactionProcessor
+type TransactionProcessorOption func(*TransactionProcessor)
+
+// WithSendOutcomeRecorder reports the outcome of every request sent to a gateway
+func WithSendOutcomeRecorder(recorder OutcomeRecorder) TransactionProcessorOption {
+	return func(p *TransactionProcessor) {
+		p.outcomeRecorder = recorder
+	}
+}
+
+// WithAttemptRepository stores every request sent to a gateway along with its response
+func WithAttemptRepository(attemptRepo repository.TransactionAttempt) TransactionProcessorOption {
+	return func(p *TransactionProcessor) {
+		p.attemptRepo = attemptRepo
+	}
+}
+
+// WithLedger keeps the user balances in the ledger, withdrawals are then limited to the available balance
+func WithLedger(ledger LedgerRecorder) TransactionProcessorOption {
+	return func(p *TransactionProcessor) {
+		p.ledger = ledger
+	}
+}
+
+// WithUnitOfWork updates transactions in database transactions that lock them, so that the
+// responses of gateways and their callbacks don't overwrite each other
+func WithUnitOfWork(unitOfWork repository.UnitOfWork) TransactionProcessorOption {
+	return func(p *TransactionProcessor) {
+		p.unitOfWork = unitOfWork
+	}
+}
+
+// ErrNotRefundable is returned when a refund is requested for a transaction that can't be refunded
+var ErrNotRefundable = errors.New("transaction can't be refunded")
+
+var (
+	// ErrNotCancellable is returned when a cancellation is requested for a transaction that can't be cancelled
+	ErrNotCancellable = errors.New("transaction can't be cancelled")
+	// ErrAlreadySettled is returned when the gateway has settled a transaction before it could be cancelled
+	ErrAlreadySettled = errors.New("transaction is already settled")
+)
+
 type TransactionProcessor struct {
 	gatewayConfig   GatewayConfigProvider
 	gatewaySelector GatewaySelectorProvider
 	transactionRepo repository.Transaction
+	gatewayRepo     repository.Gateway
 	gatewayClient   Client
+	outcomeRecorder OutcomeRecorder
+	attemptRepo     repository.TransactionAttempt
+	ledger          LedgerRecorder
+	unitOfWork      repository.UnitOfWork
 }
 
 func NewTransactionProcessor(
 	gatewayConfig GatewayConfigProvider,
 	gatewaySelector GatewaySelectorProvider,
 	transactionRepo repository.Transaction,
+	gatewayRepo repository.Gateway,
 	gatewayClient Client,
+	opts ...TransactionProcessorOption,
 ) *TransactionProcessor {
-	return &TransactionProcessor{
+	processor := &TransactionProcessor{
 		gatewayConfig:   gatewayConfig,
 		gatewaySelector: gatewaySelector,
 		transactionRepo: transactionRepo,
+		gatewayRepo:     gatewayRepo,
 		gatewayClient:   gatewayClient,
+		unitOfWork: autocommit{repository.Repositories{
+			Transactions: transactionRepo,
+			Gateways:     gatewayRepo,
+		}},
+	}
+
+	for _, opt := range opts {
+		opt(processor)
 	}
+
+	return processor
 }
 
 func (p *TransactionProcessor) ProcessDeposit(ctx context.Context, userID int, amount float64, currency string) (*models.Transaction, error) {
@@ -65,47 +130,369 @@ func (p *TransactionProcessor) processTransaction(
 	currency string,
 	transactionType string,
 ) (*models.Transaction, error) {
-	gateway, err := p.gatewaySelector.SelectGatewayForUser(ctx, userID)
+	if amount <= 0 {
+		return nil, &ValidationError{Message: "amount must be positive"}
+	}
+
+	selection, err := p.gatewaySelector.SelectGatewayForUser(ctx, RoutingRequest{
+		UserID:          userID,
+		MerchantID:      MerchantIDFromContext(ctx),
+		Amount:          amount,
+		Currency:        currency,
+		TransactionType: transactionType,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to select gateway: %w", err)
 	}
 
+	selectedGateway := selection.Gateway
+
 	transaction := &models.Transaction{
 		Amount:    amount,
+		Currency:  currency,
+		Fee:       selection.Fee,
 		Type:      transactionType,
 		Status:    "PENDING",
-		GatewayID: gateway.ID,
+		GatewayID: selectedGateway.ID,
 		UserID:    userID,
 		CreatedAt: time.Now(),
 	}
 
+	if selection.Country != nil {
+		transaction.CountryID = selection.Country.ID
+		if transaction.Currency == "" {
+			transaction.Currency = selection.Country.Currency
+		}
+	}
+
 	if err := p.transactionRepo.Create(ctx, transaction); err != nil {
 		return nil, fmt.Errorf("failed to create transaction: %w", err)
 	}
 
-	gatewayDetails, exists := p.gatewayConfig.GetGatewayDetails(gateway.Name)
+	if transactionType == "withdrawal" && p.ledger != nil {
+		if err := p.ledger.ReserveWithdrawal(ctx, transaction); err != nil {
+			p.reject(ctx, transaction, err)
+			return nil, err
+		}
+	}
+
+	if err := p.submit(ctx, transaction, selectedGateway, ""); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// ProcessRefund refunds a completed deposit or capture through the gateway it went through,
+// in full when amount is 0. The refund is a child transaction with its own status.
+func (p *TransactionProcessor) ProcessRefund(ctx context.Context, transactionID int, amount float64) (*models.Transaction, error) {
+	if amount < 0 {
+		return nil, fmt.Errorf("%w: amount must not be negative", ErrNotRefundable)
+	}
+
+	parent, err := p.transactionRepo.GetByID(ctx, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	if parent.Type != "deposit" && parent.Type != "capture" {
+		return nil, fmt.Errorf("%w: only deposits and captures can be refunded, transaction %d is a %s", ErrNotRefundable, parent.ID, parent.Type)
+	}
+	if parent.Status != StatusCompleted {
+		return nil, fmt.Errorf("%w: transaction %d is %s", ErrNotRefundable, parent.ID, parent.Status)
+	}
+	if parent.GatewayReference == "" {
+		return nil, fmt.Errorf("%w: transaction %d has no gateway reference", ErrNotRefundable, parent.ID)
+	}
+
+	if amount == 0 {
+		refunded, err := p.transactionRepo.ChildrenAmount(ctx, parent.ID, "refund")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get refunded amount: %w", err)
+		}
+		amount = math.Round((parent.Amount-refunded)*100) / 100
+		if amount <= 0 {
+			return nil, fmt.Errorf("%w: transaction %d is already refunded", ErrNotRefundable, parent.ID)
+		}
+	}
+
+	originalGateway, err := p.gatewayRepo.FindByID(ctx, parent.GatewayID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find gateway: %w", err)
+	}
+
+	refund := &models.Transaction{
+		Amount:    amount,
+		Currency:  parent.Currency,
+		Type:      "refund",
+		Status:    StatusPending,
+		GatewayID: parent.GatewayID,
+		CountryID: parent.CountryID,
+		UserID:    parent.UserID,
+		ParentID:  &parent.ID,
+		CreatedAt: time.Now(),
+	}
+
+	// The repository caps the refunds of a transaction at its amount
+	if err := p.transactionRepo.CreateChild(ctx, refund); err != nil {
+		return nil, fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	// The refunded money leaves the user's balance now, not once the gateway settles it
+	if p.ledger != nil {
+		if err := p.ledger.ReserveRefund(ctx, refund); err != nil {
+			p.reject(ctx, refund, err)
+			return nil, err
+		}
+	}
+
+	if err := p.submit(ctx, refund, originalGateway, parent.GatewayReference); err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// CancelTransaction voids a pending withdrawal at its gateway and moves it to CANCELLED.
+// A gateway refusing the cancellation is taken as the withdrawal having been settled.
+func (p *TransactionProcessor) CancelTransaction(ctx context.Context, transactionID int) (*models.Transaction, error) {
+	transaction, err := p.transactionRepo.GetByID(ctx, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	if transaction.Type != "withdrawal" {
+		return nil, fmt.Errorf("%w: only withdrawals can be cancelled, transaction %d is a %s", ErrNotCancellable, transaction.ID, transaction.Type)
+	}
+	if transaction.Status == StatusCompleted {
+		return nil, fmt.Errorf("%w: withdrawal %d is %s", ErrAlreadySettled, transaction.ID, transaction.Status)
+	}
+
+	if err := p.cancel(ctx, transaction, "cancel", StatusCancelled); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// ReleaseHold fails a withdrawal left PENDING without having reached its gateway,
+// releasing the hold it placed on the user's balance. Withdrawals the gateway answered
+// for are left alone, the gateway may still settle them.
+func (p *TransactionProcessor) ReleaseHold(ctx context.Context, transactionID int) (*models.Transaction, error) {
+	transaction, err := p.transactionRepo.GetByID(ctx, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	if transaction.Type != "withdrawal" || transaction.Status != StatusPending {
+		return nil, fmt.Errorf("%w: transaction %d is a %s %s, not a pending withdrawal", ErrNotCancellable, transaction.ID, transaction.Status, transaction.Type)
+	}
+
+	if p.attemptRepo != nil {
+		attempts, err := p.attemptRepo.ListByTransaction(ctx, transaction.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transaction attempts: %w", err)
+		}
+		for _, attempt := range attempts {
+			if attempt.ResponseStatus >= 200 && attempt.ResponseStatus < 300 {
+				return nil, fmt.Errorf("%w: withdrawal %d was accepted by %s", ErrNotCancellable, transaction.ID, attempt.Gateway)
+			}
+		}
+	}
+
+	if err := p.updateStatus(ctx, transaction, StatusFailed); err != nil {
+		return nil, err
+	}
+
+	selectedGateway, err := p.gatewayRepo.FindByID(ctx, transaction.GatewayID)
+	if err != nil {
+		fmt.Printf("failed to find gateway: %v\n", err)
+		return transaction, nil
+	}
+
+	err = PublishWithCircuitBreaker(func() error {
+		return p.publishTransactionEvent(ctx, transaction, selectedGateway.DataFormatSupported)
+	})
+
+	if err != nil {
+		fmt.Printf("failed to publish transaction event: %v\n", err)
+	}
+
+	return transaction, nil
+}
+
+// PollStatus looks a transaction up at its gateway and returns the status to move it to,
+// or "" while the gateway has nothing final to report. Gateways without a status endpoint,
+// transactions without a gateway reference and lookups the gateway can't find report nothing.
+func (p *TransactionProcessor) PollStatus(ctx context.Context, transaction *models.Transaction) (string, error) {
+	selectedGateway, err := p.gatewayRepo.FindByID(ctx, transaction.GatewayID)
+	if err != nil {
+		return "", fmt.Errorf("failed to find gateway: %w", err)
+	}
+
+	gatewayDetails, exists := p.gatewayConfig.GetGatewayDetails(selectedGateway.Name)
+	if !exists {
+		return "", fmt.Errorf("gateway %s not found in configuration", selectedGateway.Name)
+	}
+
+	endpoint := gatewayDetails.Endpoints.Status
+	if endpoint == "" || (strings.Contains(endpoint, gateway.ReferencePlaceholder) && transaction.GatewayReference == "") {
+		return "", nil
+	}
+
+	var (
+		soapCodec *SOAPCodec
+		payload   []byte
+		headers   map[string]string
+	)
+	if gatewayDetails.SOAP.IsSet() {
+		soapCodec = NewSOAPCodec(gatewayDetails.SOAP)
+		payload, headers, err = soapCodec.EncodeStatus(transaction)
+	} else {
+		payload, err = PrepareStatusPayload(transaction, selectedGateway.DataFormatSupported)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare payload: %w", err)
+	}
+
+	// A single attempt, the next sweep asks again
+	result, err := p.gatewayClient.SendTransaction(ctx, &gateway.Request{
+		Gateway:           selectedGateway.Name,
+		TransactionType:   "status",
+		TransactionID:     transaction.ID,
+		Amount:            transaction.Amount,
+		Currency:          transaction.Currency,
+		Payload:           payload,
+		Headers:           headers,
+		OriginalReference: transaction.GatewayReference,
+	}, gatewayDetails)
+	if result != nil && result.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+
+	var soapFault *SOAPFault
+	if soapCodec != nil {
+		soapFault, err = applySOAPResponse(soapCodec, result, err)
+	}
+	if soapFault != nil {
+		return "", fmt.Errorf("gateway refused the status lookup: %w", soapFault)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up status at gateway: %w", err)
+	}
+
+	// Callbacks carry no reference, so a payment the gateway created after the transaction
+	// was sent, like PayPal's capture of an approved order, is only learned here
+	if result.Status != gateway.StatusProcessing && result.GatewayReference != "" && result.GatewayReference != transaction.GatewayReference {
+		if err := p.transactionRepo.SetGatewayReference(ctx, transaction.ID, result.GatewayReference); err != nil {
+			return "", fmt.Errorf("failed to set gateway reference: %w", err)
+		}
+		transaction.GatewayReference = result.GatewayReference
+	}
+
+	switch result.Status {
+	case gateway.StatusCompleted:
+		if transaction.Type == "authorization" {
+			return StatusAuthorized, nil
+		}
+		return StatusCompleted, nil
+	case gateway.StatusFailed:
+		return StatusFailed, nil
+	}
+
+	return "", nil
+}
+
+// cancel sends a "cancel" or "void" request for a transaction to its gateway and moves
+// the transaction to the given status once the gateway accepted it
+func (p *TransactionProcessor) cancel(ctx context.Context, transaction *models.Transaction, requestType, status string) error {
+	if err := CheckTransition(transaction.Status, status); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotCancellable, err)
+	}
+
+	selectedGateway, err := p.gatewayRepo.FindByID(ctx, transaction.GatewayID)
+	if err != nil {
+		return fmt.Errorf("failed to find gateway: %w", err)
+	}
+
+	gatewayDetails, exists := p.gatewayConfig.GetGatewayDetails(selectedGateway.Name)
 	if !exists {
-		return nil, fmt.Errorf("gateway %s not found in configuration", gateway.Name)
+		return fmt.Errorf("gateway %s not found in configuration", selectedGateway.Name)
 	}
 
-	dataFormat := gateway.DataFormatSupported
-	payload, err := PrepareTransactionPayload(transaction, currency, dataFormat)
+	endpoint := gatewayDetails.Endpoints.For(requestType)
+	if endpoint == "" {
+		return fmt.Errorf("%w: gateway %s doesn't support %s requests", ErrNotCancellable, selectedGateway.Name, requestType)
+	}
+	if strings.Contains(endpoint, gateway.ReferencePlaceholder) && transaction.GatewayReference == "" {
+		return fmt.Errorf("%w: %s %d has no gateway reference yet", ErrNotCancellable, transaction.Type, transaction.ID)
+	}
+
+	dataFormat := selectedGateway.DataFormatSupported
+
+	var (
+		soapCodec *SOAPCodec
+		payload   []byte
+		headers   map[string]string
+	)
+	if gatewayDetails.SOAP.IsSet() {
+		soapCodec = NewSOAPCodec(gatewayDetails.SOAP)
+		payload, headers, err = soapCodec.EncodeCancel(transaction, requestType)
+	} else {
+		payload, err = PrepareCancelPayload(transaction, requestType, dataFormat)
+	}
 	if err != nil {
-		p.transactionRepo.UpdateStatus(ctx, transaction.ID, "FAILED")
-		return nil, fmt.Errorf("failed to prepare payload: %w", err)
+		return fmt.Errorf("failed to prepare payload: %w", err)
 	}
 
+	request := &gateway.Request{
+		Gateway:           selectedGateway.Name,
+		TransactionType:   requestType,
+		TransactionID:     transaction.ID,
+		Amount:            transaction.Amount,
+		Currency:          transaction.Currency,
+		Payload:           payload,
+		Headers:           headers,
+		OriginalReference: transaction.GatewayReference,
+	}
+
+	var result *gateway.Result
+	var soapFault *SOAPFault
 	err = RetryOperation(func() error {
-		return p.gatewayClient.SendTransaction(ctx, transactionType, payload, transaction.ID, gatewayDetails)
+		var err error
+		result, err = p.gatewayClient.SendTransaction(ctx, request, gatewayDetails)
+		if soapCodec != nil {
+			soapFault, err = applySOAPResponse(soapCodec, result, err)
+		}
+
+		if soapFault != nil {
+			p.recordAttempt(ctx, transaction.ID, selectedGateway.Name, result, soapFault)
+			return nil
+		}
+
+		p.recordAttempt(ctx, transaction.ID, selectedGateway.Name, result, err)
+		if err != nil && isRefusal(result) {
+			// The gateway understood the request and won't cancel, asking again won't help
+			return nil
+		}
+		return err
 	}, gatewayDetails.Retry.MaxAttempts)
 
 	if err != nil {
-		p.transactionRepo.UpdateStatus(ctx, transaction.ID, "FAILED")
-		return nil, fmt.Errorf("failed to send request to gateway: %w", err)
+		return fmt.Errorf("%w: failed to send %s request: %v", ErrGatewayUnavailable, requestType, err)
 	}
 
-	if err := p.transactionRepo.UpdateStatus(ctx, transaction.ID, "PROCESSING"); err != nil {
-		return nil, fmt.Errorf("failed to update transaction status: %w", err)
+	// Successful cancellations may report the transaction as failed or cancelled,
+	// only a refusal matters
+	if soapFault != nil {
+		return fmt.Errorf("%w: gateway refused to %s %s %d: %v", ErrAlreadySettled, requestType, transaction.Type, transaction.ID, soapFault)
+	}
+	if isRefusal(result) {
+		return fmt.Errorf("%w: gateway refused to %s %s %d: %s", ErrAlreadySettled, requestType, transaction.Type, transaction.ID, result.DeclineCode)
+	}
+
+	if err := p.updateStatus(ctx, transaction, status); err != nil {
+		return err
 	}
 
 	err = PublishWithCircuitBreaker(func() error {
@@ -116,7 +503,306 @@ func (p *TransactionProcessor) processTransaction(
 		fmt.Printf("failed to publish transaction event: %v\n", err)
 	}
 
-	return transaction, nil
+	return nil
+}
+
+// isRefusal reports whether the gateway turned a request down, as opposed to being
+// unavailable or rejecting the service's credentials
+func isRefusal(result *gateway.Result) bool {
+	if result == nil {
+		return false
+	}
+
+	switch result.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+
+	return result.StatusCode >= 400 && result.StatusCode < 500
+}
+
+// submit sends a stored transaction to its gateway, retrying as configured, and moves it
+// to PROCESSING once the gateway accepted it. originalReference is set for refunds and captures.
+func (p *TransactionProcessor) submit(
+	ctx context.Context,
+	transaction *models.Transaction,
+	selectedGateway *models.Gateway,
+	originalReference string,
+) error {
+	gatewayDetails, exists := p.gatewayConfig.GetGatewayDetails(selectedGateway.Name)
+	if !exists {
+		return fmt.Errorf("gateway %s not found in configuration", selectedGateway.Name)
+	}
+
+	dataFormat := selectedGateway.DataFormatSupported
+
+	var (
+		soapCodec *SOAPCodec
+		payload   []byte
+		headers   map[string]string
+		err       error
+	)
+	switch {
+	case gatewayDetails.SOAP.IsSet() && originalReference != "":
+		soapCodec = NewSOAPCodec(gatewayDetails.SOAP)
+		payload, headers, err = soapCodec.EncodeReferenced(transaction, originalReference)
+	case gatewayDetails.SOAP.IsSet():
+		soapCodec = NewSOAPCodec(gatewayDetails.SOAP)
+		payload, headers, err = soapCodec.EncodeTransaction(transaction, transaction.Currency)
+	case originalReference != "":
+		payload, err = PrepareReferencedPayload(transaction, originalReference, dataFormat)
+	default:
+		payload, err = PrepareTransactionPayload(transaction, transaction.Currency, dataFormat)
+	}
+	if err != nil {
+		p.fail(ctx, transaction)
+		return fmt.Errorf("failed to prepare payload: %w", err)
+	}
+
+	request := &gateway.Request{
+		Gateway:           selectedGateway.Name,
+		TransactionType:   transaction.Type,
+		TransactionID:     transaction.ID,
+		Amount:            transaction.Amount,
+		Currency:          transaction.Currency,
+		Payload:           payload,
+		Headers:           headers,
+		OriginalReference: originalReference,
+	}
+
+	var result *gateway.Result
+	var soapFault *SOAPFault
+	err = RetryOperation(func() error {
+		startedAt := time.Now()
+		var err error
+		result, err = p.gatewayClient.SendTransaction(ctx, request, gatewayDetails)
+		if soapCodec != nil {
+			soapFault, err = applySOAPResponse(soapCodec, result, err)
+		}
+
+		// Every attempt is timed, the transaction is scored once it failed or got its final status
+		if p.outcomeRecorder != nil {
+			p.outcomeRecorder.RecordLatency(selectedGateway.Name, transaction.CountryID, time.Since(startedAt))
+		}
+
+		if soapFault != nil {
+			p.recordAttempt(ctx, transaction.ID, selectedGateway.Name, result, soapFault)
+			// A fault is the gateway's final answer, it is not retried
+			return nil
+		}
+
+		p.recordAttempt(ctx, transaction.ID, selectedGateway.Name, result, err)
+		return err
+	}, gatewayDetails.Retry.MaxAttempts)
+
+	if err != nil {
+		p.recordResult(selectedGateway.Name, transaction.CountryID, false)
+		p.fail(ctx, transaction)
+		return fmt.Errorf("%w: failed to send request: %v", ErrGatewayUnavailable, err)
+	}
+
+	if soapFault != nil {
+		p.recordResult(selectedGateway.Name, transaction.CountryID, false)
+		p.fail(ctx, transaction)
+		return fmt.Errorf("%w: gateway rejected transaction: %v", ErrDeclined, soapFault)
+	}
+
+	if result != nil && result.Status == gateway.StatusFailed {
+		p.recordResult(selectedGateway.Name, transaction.CountryID, false)
+		p.fail(ctx, transaction)
+		return fmt.Errorf("%w: %s", ErrDeclined, result.DeclineCode)
+	}
+
+	// A gateway approving the transaction in its response doesn't call back for it
+	status := StatusProcessing
+	if result != nil && result.Status == gateway.StatusCompleted {
+		status = StatusCompleted
+		if transaction.Type == "authorization" {
+			status = StatusAuthorized
+		}
+		p.recordResult(selectedGateway.Name, transaction.CountryID, true)
+	}
+
+	// The gateway may have called back already, its status is kept then
+	var captured *models.Transaction
+	err = p.unitOfWork.Do(ctx, func(repos repository.Repositories) error {
+		stored, err := repos.Transactions.GetByIDForUpdate(ctx, transaction.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get transaction: %w", err)
+		}
+
+		if result != nil && result.GatewayReference != "" {
+			if err := repos.Transactions.SetGatewayReference(ctx, transaction.ID, result.GatewayReference); err != nil {
+				return fmt.Errorf("failed to store gateway reference: %w", err)
+			}
+			transaction.GatewayReference = result.GatewayReference
+		}
+
+		if status == StatusProcessing {
+			if stored.Status != StatusPending {
+				return nil
+			}
+			if err := repos.Transactions.UpdateStatus(ctx, transaction.ID, StatusProcessing); err != nil {
+				return fmt.Errorf("failed to update transaction status: %w", err)
+			}
+			return nil
+		}
+
+		if stored.Status == status || CheckTransition(stored.Status, status) != nil {
+			return nil
+		}
+		if err := p.setStatus(ctx, repos, stored, status); err != nil {
+			return err
+		}
+		transaction.Status = status
+
+		captured, err = settleAuthorization(ctx, repos, stored)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = PublishWithCircuitBreaker(func() error {
+		return p.publishTransactionEvent(ctx, transaction, dataFormat)
+	})
+
+	if err != nil {
+		fmt.Printf("failed to publish transaction event: %v\n", err)
+	}
+
+	if captured != nil {
+		err = PublishWithCircuitBreaker(func() error {
+			return p.publishTransactionEvent(ctx, captured, dataFormat)
+		})
+		if err != nil {
+			fmt.Printf("failed to publish authorization event: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// updateStatus moves a transaction to a status, recording its ledger entry in the same
+// unit of work. The transition is checked against the stored status, which a callback may
+// have changed since the transaction was read, failing with ErrInvalidTransition.
+func (p *TransactionProcessor) updateStatus(ctx context.Context, transaction *models.Transaction, status string) error {
+	return p.unitOfWork.Do(ctx, func(repos repository.Repositories) error {
+		// Locking the transaction keeps a callback from moving it in between
+		locked, err := repos.Transactions.GetByIDForUpdate(ctx, transaction.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get transaction: %w", err)
+		}
+
+		if err := p.setStatus(ctx, repos, locked, status); err != nil {
+			return err
+		}
+		transaction.Status = status
+
+		return nil
+	})
+}
+
+// setStatus moves a transaction locked in a unit of work to a status, recording its ledger entry
+func (p *TransactionProcessor) setStatus(ctx context.Context, repos repository.Repositories, locked *models.Transaction, status string) error {
+	if err := CheckTransition(locked.Status, status); err != nil {
+		return fmt.Errorf("transaction %d: %w", locked.ID, err)
+	}
+
+	if p.ledger != nil {
+		updated := *locked
+		updated.Status = status
+		if err := p.ledger.In(repos).RecordTransaction(ctx, &updated); err != nil {
+			return err
+		}
+	}
+
+	if err := repos.Transactions.UpdateStatus(ctx, locked.ID, status); err != nil {
+		return fmt.Errorf("failed to update transaction status: %w", err)
+	}
+	locked.Status = status
+
+	return nil
+}
+
+// reject ends a transaction whose funds couldn't be reserved, REJECTED when the user's balance
+// is short and FAILED otherwise. The caller is already failing, so errors are only logged.
+func (p *TransactionProcessor) reject(ctx context.Context, transaction *models.Transaction, reserveErr error) {
+	status := StatusFailed
+	if errors.Is(reserveErr, repository.ErrInsufficientFunds) {
+		status = StatusRejected
+	}
+
+	if err := p.updateStatus(ctx, transaction, status); err != nil {
+		fmt.Printf("failed to mark transaction %d as %s: %v\n", transaction.ID, status, err)
+	}
+}
+
+// recordResult reports a final status decided from the gateway's response, which no callback
+// will report again
+func (p *TransactionProcessor) recordResult(gatewayName string, countryID int, success bool) {
+	if p.outcomeRecorder != nil {
+		p.outcomeRecorder.RecordResult(gatewayName, countryID, success)
+	}
+}
+
+// fail moves a transaction the gateway didn't take to FAILED. The caller is already
+// failing, so errors are only logged.
+func (p *TransactionProcessor) fail(ctx context.Context, transaction *models.Transaction) {
+	if err := p.updateStatus(ctx, transaction, StatusFailed); err != nil {
+		fmt.Printf("failed to mark transaction %d as failed: %v\n", transaction.ID, err)
+	}
+}
+
+// applySOAPResponse reads a SOAP gateway's response into the result, returning the
+// fault the gateway answered with separately from transport and parsing errors
+func applySOAPResponse(codec *SOAPCodec, result *gateway.Result, sendErr error) (*SOAPFault, error) {
+	if result == nil || len(result.RawResponse) == 0 {
+		return nil, sendErr
+	}
+
+	if err := codec.ApplyResponse(result); err != nil {
+		var fault *SOAPFault
+		if errors.As(err, &fault) {
+			result.Status = gateway.StatusFailed
+			result.DeclineCode = fault.Code
+			return fault, nil
+		}
+		if sendErr == nil {
+			return nil, err
+		}
+	}
+
+	return nil, sendErr
+}
+
+// recordAttempt stores a gateway request and its outcome. Failing to store it
+// must not fail the transaction, so errors are only logged.
+func (p *TransactionProcessor) recordAttempt(ctx context.Context, transactionID int, gatewayName string, result *gateway.Result, sendErr error) {
+	if p.attemptRepo == nil {
+		return
+	}
+
+	attempt := &models.TransactionAttempt{
+		TransactionID: transactionID,
+		Gateway:       gatewayName,
+	}
+
+	if result != nil {
+		attempt.RequestPayload = string(result.RequestBody)
+		attempt.ResponseStatus = result.StatusCode
+		attempt.ResponseBody = string(result.ResponseBody)
+		attempt.LatencyMs = result.Latency.Milliseconds()
+		attempt.GatewayReference = result.GatewayReference
+	}
+
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+	}
+
+	if err := p.attemptRepo.Create(ctx, attempt); err != nil {
+		fmt.Printf("failed to record transaction attempt: %v\n", err)
+	}
 }
 
 func (p *TransactionProcessor) publishTransactionEvent(
@@ -125,13 +811,19 @@ func (p *TransactionProcessor) publishTransactionEvent(
 	dataFormat string,
 ) error {
 	message := map[string]interface{}{
-		"transaction_id": transaction.ID,
-		"status":         transaction.Status,
-		"type":           transaction.Type,
-		"amount":         transaction.Amount,
-		"gateway_id":     transaction.GatewayID,
-		"user_id":        transaction.UserID,
-		"timestamp":      time.Now().Unix(),
+		"transaction_id":    transaction.ID,
+		"status":            transaction.Status,
+		"type":              transaction.Type,
+		"amount":            transaction.Amount,
+		"currency":          transaction.Currency,
+		"fee":               transaction.Fee,
+		"gateway_reference": transaction.GatewayReference,
+		"gateway_id":        transaction.GatewayID,
+		"user_id":           transaction.UserID,
+		"timestamp":         time.Now().Unix(),
+	}
+	if transaction.ParentID != nil {
+		message["parent_transaction_id"] = *transaction.ParentID
 	}
 
 	messageBytes, err := json.Marshal(message)
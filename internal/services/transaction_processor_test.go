@@ -2,29 +2,38 @@ package services_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
 	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository"
 	"payment-gateway/internal/services"
 	"testing"
+	"time"
 )
 
 // Mock implementation of the GatewayConfigProvider
 type mockGatewayConfigProvider struct {
 	mockGetGatewayDetails func(gatewayName string) (config.GatewayDetails, bool)
+	minStatusSLA          int
 }
 
 func (m *mockGatewayConfigProvider) GetGatewayDetails(gatewayName string) (config.GatewayDetails, bool) {
 	return m.mockGetGatewayDetails(gatewayName)
 }
 
+func (m *mockGatewayConfigProvider) MinStatusSLA() int {
+	return m.minStatusSLA
+}
+
 // Mock implementation of the GatewaySelectorProvider
 type mockGatewaySelectorProvider struct {
-	mockSelectGatewayForUser func(ctx context.Context, userID int) (*models.Gateway, error)
+	mockSelectGatewayForUser func(ctx context.Context, request services.RoutingRequest) (*services.GatewaySelection, error)
 }
 
-func (m *mockGatewaySelectorProvider) SelectGatewayForUser(ctx context.Context, userID int) (*models.Gateway, error) {
-	return m.mockSelectGatewayForUser(ctx, userID)
+func (m *mockGatewaySelectorProvider) SelectGatewayForUser(ctx context.Context, request services.RoutingRequest) (*services.GatewaySelection, error) {
+	return m.mockSelectGatewayForUser(ctx, request)
 }
 
 // Mock implementation of the Transaction repository
@@ -32,6 +41,15 @@ type mockTransactionRepo struct {
 	mockCreate       func(ctx context.Context, transaction *models.Transaction) error
 	mockUpdateStatus func(ctx context.Context, transactionID int, status string) error
 	mockGetByID      func(ctx context.Context, transactionID int) (*models.Transaction, error)
+
+	mockSetGatewayReference func(ctx context.Context, transactionID int, reference string) error
+	mockCreateChild         func(ctx context.Context, child *models.Transaction) error
+	mockChildrenAmount      func(ctx context.Context, transactionID int, childType string) (float64, error)
+	mockCompletedChildren   func(ctx context.Context, transactionID int, childType string) (float64, error)
+	mockListByStatus        func(ctx context.Context, transactionType, status string, createdBefore time.Time) ([]models.Transaction, error)
+	mockListByStatuses      func(ctx context.Context, statuses []string, createdBefore time.Time, afterID, limit int) ([]models.Transaction, error)
+	mockListByGateway       func(ctx context.Context, gatewayID int, from, to time.Time) ([]models.Transaction, error)
+	mockListByReferences    func(ctx context.Context, gatewayID int, references []string) ([]models.Transaction, error)
 }
 
 func (m *mockTransactionRepo) Create(ctx context.Context, transaction *models.Transaction) error {
@@ -46,13 +64,71 @@ func (m *mockTransactionRepo) GetByID(ctx context.Context, transactionID int) (*
 	return m.mockGetByID(ctx, transactionID)
 }
 
+// GetByIDForUpdate reads like GetByID, the mocks have nothing to lock
+func (m *mockTransactionRepo) GetByIDForUpdate(ctx context.Context, transactionID int) (*models.Transaction, error) {
+	return m.mockGetByID(ctx, transactionID)
+}
+
+func (m *mockTransactionRepo) SetGatewayReference(ctx context.Context, transactionID int, reference string) error {
+	return m.mockSetGatewayReference(ctx, transactionID, reference)
+}
+
+func (m *mockTransactionRepo) CreateChild(ctx context.Context, child *models.Transaction) error {
+	return m.mockCreateChild(ctx, child)
+}
+
+func (m *mockTransactionRepo) ChildrenAmount(ctx context.Context, transactionID int, childType string) (float64, error) {
+	return m.mockChildrenAmount(ctx, transactionID, childType)
+}
+
+func (m *mockTransactionRepo) CompletedChildrenAmount(ctx context.Context, transactionID int, childType string) (float64, error) {
+	return m.mockCompletedChildren(ctx, transactionID, childType)
+}
+
+func (m *mockTransactionRepo) ListByStatus(ctx context.Context, transactionType, status string, createdBefore time.Time) ([]models.Transaction, error) {
+	return m.mockListByStatus(ctx, transactionType, status, createdBefore)
+}
+
+func (m *mockTransactionRepo) ListByStatuses(ctx context.Context, statuses []string, createdBefore time.Time, afterID, limit int) ([]models.Transaction, error) {
+	return m.mockListByStatuses(ctx, statuses, createdBefore, afterID, limit)
+}
+
+func (m *mockTransactionRepo) ListByGateway(ctx context.Context, gatewayID int, from, to time.Time) ([]models.Transaction, error) {
+	return m.mockListByGateway(ctx, gatewayID, from, to)
+}
+
+func (m *mockTransactionRepo) ListByGatewayReferences(ctx context.Context, gatewayID int, references []string) ([]models.Transaction, error) {
+	return m.mockListByReferences(ctx, gatewayID, references)
+}
+
+// Mock implementation of the TransactionAttempt repository
+type mockTransactionAttemptRepo struct {
+	attempts []models.TransactionAttempt
+}
+
+func (m *mockTransactionAttemptRepo) Create(ctx context.Context, attempt *models.TransactionAttempt) error {
+	attempt.ID = len(m.attempts) + 1
+	m.attempts = append(m.attempts, *attempt)
+	return nil
+}
+
+func (m *mockTransactionAttemptRepo) ListByTransaction(ctx context.Context, transactionID int) ([]models.TransactionAttempt, error) {
+	var attempts []models.TransactionAttempt
+	for _, attempt := range m.attempts {
+		if attempt.TransactionID == transactionID {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts, nil
+}
+
 // Mock implementation of the Client
 type mockClient struct {
-	mockSendTransaction func(ctx context.Context, transactionType string, payload []byte, transactionID int, gatewayDetails config.GatewayDetails) error
+	mockSendTransaction func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error)
 }
 
-func (m *mockClient) SendTransaction(ctx context.Context, transactionType string, payload []byte, transactionID int, gatewayDetails config.GatewayDetails) error {
-	return m.mockSendTransaction(ctx, transactionType, payload, transactionID, gatewayDetails)
+func (m *mockClient) SendTransaction(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+	return m.mockSendTransaction(ctx, request, gatewayDetails)
 }
 
 func TestProcessDeposit(t *testing.T) {
@@ -80,7 +156,11 @@ func runTransactionTest(
 	gatewayID := 1
 	gatewayName := "stripe"
 	transactionID := 456
+	countryID := 7
+	fee := 3.2
 	dataFormat := "application/json"
+	gatewayReference := "ref_123"
+	storedReference := ""
 
 	// Create mock gateway details
 	gatewayDetails := config.GatewayDetails{
@@ -111,15 +191,22 @@ func runTransactionTest(
 	}
 
 	mockGatewaySelector := &mockGatewaySelectorProvider{
-		mockSelectGatewayForUser: func(ctx context.Context, uid int) (*models.Gateway, error) {
-			if uid == userID {
-				return &models.Gateway{
+		mockSelectGatewayForUser: func(ctx context.Context, request services.RoutingRequest) (*services.GatewaySelection, error) {
+			if request.UserID != userID {
+				return nil, fmt.Errorf("gateway not found for user")
+			}
+			if request.TransactionType != transactionType {
+				return nil, fmt.Errorf("unexpected transaction type: %s", request.TransactionType)
+			}
+			return &services.GatewaySelection{
+				Gateway: &models.Gateway{
 					ID:                  gatewayID,
 					Name:                gatewayName,
 					DataFormatSupported: dataFormat,
-				}, nil
-			}
-			return nil, fmt.Errorf("gateway not found for user")
+				},
+				Country: &models.Country{ID: countryID, Code: "US", Currency: currency},
+				Fee:     fee,
+			}, nil
 		},
 	}
 
@@ -148,26 +235,46 @@ func runTransactionTest(
 				UserID:    userID,
 			}, nil
 		},
+		mockSetGatewayReference: func(ctx context.Context, tid int, reference string) error {
+			if tid != transactionID {
+				return fmt.Errorf("transaction not found")
+			}
+			storedReference = reference
+			return nil
+		},
 	}
 
 	mockClient := &mockClient{
-		mockSendTransaction: func(ctx context.Context, tType string, payload []byte, tid int, gDetails config.GatewayDetails) error {
-			if tType != transactionType {
-				return fmt.Errorf("unexpected transaction type: %s", tType)
+		mockSendTransaction: func(ctx context.Context, request *gateway.Request, gDetails config.GatewayDetails) (*gateway.Result, error) {
+			if request.TransactionType != transactionType {
+				return nil, fmt.Errorf("unexpected transaction type: %s", request.TransactionType)
 			}
-			if tid != transactionID {
-				return fmt.Errorf("unexpected transaction ID: %d", tid)
+			if request.TransactionID != transactionID {
+				return nil, fmt.Errorf("unexpected transaction ID: %d", request.TransactionID)
 			}
-			return nil
+			if request.Gateway != gatewayName || request.Amount != amount || request.Currency != currency {
+				return nil, fmt.Errorf("unexpected request: %+v", request)
+			}
+			return &gateway.Result{
+				GatewayReference: gatewayReference,
+				Status:           gateway.StatusProcessing,
+				StatusCode:       201,
+				RequestBody:      []byte(`{"amount":100}`),
+				ResponseBody:     []byte(`{"id":"ref_123"}`),
+			}, nil
 		},
 	}
 
+	mockAttemptRepo := &mockTransactionAttemptRepo{}
+
 	// Create the processor with mocks
 	processor := services.NewTransactionProcessor(
 		mockGatewayConfig,
 		mockGatewaySelector,
 		mockTransactionRepo,
+		&mockGatewayRepo{},
 		mockClient,
+		services.WithAttemptRepository(mockAttemptRepo),
 	)
 
 	// Process the transaction
@@ -206,4 +313,360 @@ func runTransactionTest(
 	if transaction.UserID != userID {
 		t.Errorf("Expected user ID %d, got %d", userID, transaction.UserID)
 	}
+
+	if transaction.CountryID != countryID {
+		t.Errorf("Expected country ID %d, got %d", countryID, transaction.CountryID)
+	}
+
+	if transaction.Fee != fee {
+		t.Errorf("Expected fee %.2f, got %.2f", fee, transaction.Fee)
+	}
+
+	if transaction.Currency != currency {
+		t.Errorf("Expected currency %s, got %s", currency, transaction.Currency)
+	}
+
+	if transaction.GatewayReference != gatewayReference || storedReference != gatewayReference {
+		t.Errorf("Expected gateway reference %s to be stored, got %s (stored %s)", gatewayReference, transaction.GatewayReference, storedReference)
+	}
+
+	if len(mockAttemptRepo.attempts) != 1 {
+		t.Fatalf("Expected 1 recorded attempt, got %d", len(mockAttemptRepo.attempts))
+	}
+
+	attempt := mockAttemptRepo.attempts[0]
+	if attempt.TransactionID != transactionID || attempt.Gateway != gatewayName || attempt.ResponseStatus != 201 {
+		t.Errorf("Unexpected attempt recorded: %+v", attempt)
+	}
+
+	if attempt.GatewayReference != gatewayReference || attempt.ResponseBody != `{"id":"ref_123"}` {
+		t.Errorf("Expected attempt to keep the gateway response, got %+v", attempt)
+	}
+}
+
+// TestProcessApprovedImmediately has the gateway approve transactions in its response, which
+// no callback follows
+func TestProcessApprovedImmediately(t *testing.T) {
+	tests := []struct {
+		name              string
+		transactionType   string
+		expectedStatus    string
+		expectedAvailable float64
+	}{
+		{name: "Deposit", transactionType: "deposit", expectedStatus: "COMPLETED", expectedAvailable: 100},
+		{name: "Authorization", transactionType: "authorization", expectedStatus: "AUTHORIZED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := newMemoryRepos(t)
+			ledger := services.NewLedger(repos.ledger)
+
+			client := &mockClient{
+				mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+					return &gateway.Result{GatewayReference: "ch_1", Status: gateway.StatusCompleted, StatusCode: 200}, nil
+				},
+			}
+
+			processor := services.NewTransactionProcessor(
+				&mockGatewayConfigProvider{
+					mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+						return config.GatewayDetails{
+							Endpoints: config.GatewayEndpoints{Deposit: "/v1/charges", Authorize: "/v1/charges", Capture: "/v1/charges/{reference}/capture"},
+							Retry:     config.GatewayRetry{MaxAttempts: 1},
+						}, true
+					},
+				},
+				&mockGatewaySelectorProvider{
+					mockSelectGatewayForUser: func(ctx context.Context, request services.RoutingRequest) (*services.GatewaySelection, error) {
+						return &services.GatewaySelection{Gateway: repos.gateway}, nil
+					},
+				},
+				repos.transactions, repos.gateways, client,
+				services.WithLedger(ledger),
+				services.WithUnitOfWork(repos.unitOfWork),
+			)
+
+			process := processor.ProcessDeposit
+			if tt.transactionType == "authorization" {
+				process = processor.ProcessAuthorization
+			}
+			transaction, err := process(ctx, 7, 100, "EUR")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			stored, err := repos.transactions.GetByID(ctx, transaction.ID)
+			if err != nil {
+				t.Fatalf("failed to get transaction: %v", err)
+			}
+			if stored.Status != tt.expectedStatus || transaction.Status != tt.expectedStatus {
+				t.Errorf("Expected the %s to be %s, got %s", tt.transactionType, tt.expectedStatus, stored.Status)
+			}
+
+			balances, err := ledger.Balances(ctx, 7)
+			if err != nil {
+				t.Fatalf("failed to get balances: %v", err)
+			}
+			available := 0.0
+			if len(balances) == 1 {
+				available = balances[0].Available
+			}
+			if available != tt.expectedAvailable {
+				t.Errorf("Expected %.2f available, got %v", tt.expectedAvailable, balances)
+			}
+
+			if tt.transactionType != "authorization" {
+				return
+			}
+
+			// An immediately approved capture captures its authorization
+			capture, err := processor.ProcessCapture(ctx, transaction.ID, 0)
+			if err != nil {
+				t.Fatalf("failed to capture: %v", err)
+			}
+			if capture.Status != "COMPLETED" {
+				t.Errorf("Expected the capture to be COMPLETED, got %s", capture.Status)
+			}
+			expectAuthorizationStatus(t, repos, transaction.ID, "CAPTURED")
+		})
+	}
+}
+
+func TestProcessRefund(t *testing.T) {
+	parent := &models.Transaction{
+		ID:               456,
+		Amount:           100,
+		Currency:         "EUR",
+		Type:             "deposit",
+		Status:           "COMPLETED",
+		GatewayID:        2,
+		CountryID:        7,
+		UserID:           123,
+		GatewayReference: "ch_123",
+	}
+
+	tests := []struct {
+		name           string
+		parent         models.Transaction
+		amount         float64
+		refunded       float64
+		limitErr       error
+		expectedAmount float64
+		expectedErr    error
+	}{
+		{name: "Full Refund", parent: *parent, refunded: 30, expectedAmount: 70},
+		{name: "Partial Refund", parent: *parent, amount: 25, refunded: 30, expectedAmount: 25},
+		{name: "Already Refunded", parent: *parent, refunded: 100, expectedErr: services.ErrNotRefundable},
+		{name: "Over The Refundable Amount", parent: *parent, amount: 80, limitErr: repository.ErrAmountLimitExceeded, expectedErr: repository.ErrAmountLimitExceeded},
+		{name: "Withdrawal", parent: models.Transaction{ID: 456, Type: "withdrawal", Status: "COMPLETED", GatewayReference: "po_1"}, expectedErr: services.ErrNotRefundable},
+		{name: "Not Completed", parent: models.Transaction{ID: 456, Type: "deposit", Status: "PROCESSING", GatewayReference: "ch_123"}, expectedErr: services.ErrNotRefundable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent *gateway.Request
+			var statuses []string
+
+			transactionRepo := &mockTransactionRepo{
+				mockGetByID: func(ctx context.Context, transactionID int) (*models.Transaction, error) {
+					if transactionID != tt.parent.ID {
+						return &models.Transaction{ID: transactionID, Type: "refund", Status: "PENDING"}, nil
+					}
+					stored := tt.parent
+					return &stored, nil
+				},
+				mockChildrenAmount: func(ctx context.Context, transactionID int, childType string) (float64, error) {
+					return tt.refunded, nil
+				},
+				mockCreateChild: func(ctx context.Context, refund *models.Transaction) error {
+					if tt.limitErr != nil {
+						return tt.limitErr
+					}
+					refund.ID = 789
+					return nil
+				},
+				mockUpdateStatus: func(ctx context.Context, transactionID int, status string) error {
+					statuses = append(statuses, status)
+					return nil
+				},
+				mockSetGatewayReference: func(ctx context.Context, transactionID int, reference string) error {
+					return nil
+				},
+			}
+
+			gatewayRepo := &mockGatewayRepo{
+				mockFindByID: func(ctx context.Context, id int) (*models.Gateway, error) {
+					if id != parent.GatewayID {
+						return nil, fmt.Errorf("gateway %d not found", id)
+					}
+					return &models.Gateway{ID: id, Name: "stripe", DataFormatSupported: "application/json"}, nil
+				},
+			}
+
+			client := &mockClient{
+				mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+					sent = request
+					return &gateway.Result{GatewayReference: "re_1", Status: gateway.StatusProcessing, StatusCode: 200}, nil
+				},
+			}
+
+			gatewayConfig := &mockGatewayConfigProvider{
+				mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+					return config.GatewayDetails{
+						Endpoints: config.GatewayEndpoints{Refund: "/v1/refunds"},
+						Retry:     config.GatewayRetry{MaxAttempts: 1},
+					}, name == "stripe"
+				},
+			}
+
+			processor := services.NewTransactionProcessor(gatewayConfig, &mockGatewaySelectorProvider{}, transactionRepo, gatewayRepo, client)
+
+			refund, err := processor.ProcessRefund(context.Background(), parent.ID, tt.amount)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got: %v", tt.expectedErr, err)
+				}
+				if sent != nil {
+					t.Error("Expected no request to be sent to the gateway")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if refund.Type != "refund" || refund.Amount != tt.expectedAmount || refund.Currency != "EUR" {
+				t.Errorf("Unexpected refund: %+v", refund)
+			}
+			if refund.ParentID == nil || *refund.ParentID != parent.ID {
+				t.Errorf("Expected refund to belong to transaction %d, got %v", parent.ID, refund.ParentID)
+			}
+
+			if sent == nil {
+				t.Fatal("Expected the refund to be sent to the gateway")
+			}
+			if sent.Gateway != "stripe" || sent.TransactionType != "refund" || sent.TransactionID != 789 || sent.OriginalReference != "ch_123" {
+				t.Errorf("Unexpected gateway request: %+v", sent)
+			}
+
+			if len(statuses) != 1 || statuses[0] != "PROCESSING" {
+				t.Errorf("Expected the refund to move to PROCESSING, got %v", statuses)
+			}
+		})
+	}
+}
+
+func TestCancelTransaction(t *testing.T) {
+	withdrawal := models.Transaction{
+		ID:               456,
+		Amount:           50,
+		Currency:         "EUR",
+		Type:             "withdrawal",
+		Status:           "PROCESSING",
+		GatewayID:        2,
+		UserID:           123,
+		GatewayReference: "po_123",
+	}
+	settled := withdrawal
+	settled.Status = "COMPLETED"
+	failed := withdrawal
+	failed.Status = "FAILED"
+	deposit := withdrawal
+	deposit.Type = "deposit"
+	unsent := withdrawal
+	unsent.Status = "PENDING"
+	unsent.GatewayReference = ""
+
+	approved := &gateway.Result{GatewayReference: "po_123", Status: gateway.StatusFailed, StatusCode: 200}
+	refused := &gateway.Result{Status: gateway.StatusFailed, DeclineCode: "payout_not_cancelable", StatusCode: 400}
+
+	tests := []struct {
+		name           string
+		transaction    models.Transaction
+		cancelEndpoint string
+		result         *gateway.Result
+		sendErr        error
+		expectedSends  int
+		expectedErr    error
+	}{
+		{name: "Cancelled", transaction: withdrawal, result: approved, expectedSends: 1},
+		{name: "Refused By Gateway", transaction: withdrawal, result: refused, sendErr: errors.New("gateway returned non-success status: 400"), expectedSends: 1, expectedErr: services.ErrAlreadySettled},
+		{name: "Already Completed", transaction: settled, expectedErr: services.ErrAlreadySettled},
+		{name: "Already Failed", transaction: failed, expectedErr: services.ErrNotCancellable},
+		{name: "Deposit", transaction: deposit, expectedErr: services.ErrNotCancellable},
+		{name: "Not Sent Yet", transaction: unsent, expectedErr: services.ErrNotCancellable},
+		{name: "Unsupported By Gateway", transaction: withdrawal, cancelEndpoint: "-", expectedErr: services.ErrNotCancellable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []*gateway.Request
+			var statuses []string
+
+			transactionRepo := &mockTransactionRepo{
+				mockGetByID: func(ctx context.Context, transactionID int) (*models.Transaction, error) {
+					stored := tt.transaction
+					return &stored, nil
+				},
+				mockUpdateStatus: func(ctx context.Context, transactionID int, status string) error {
+					statuses = append(statuses, status)
+					return nil
+				},
+			}
+
+			gatewayRepo := &mockGatewayRepo{
+				mockFindByID: func(ctx context.Context, id int) (*models.Gateway, error) {
+					return &models.Gateway{ID: id, Name: "stripe", DataFormatSupported: "application/json"}, nil
+				},
+			}
+
+			client := &mockClient{
+				mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+					sent = append(sent, request)
+					return tt.result, tt.sendErr
+				},
+			}
+
+			cancelEndpoint := "/v1/payouts/{reference}/cancel"
+			if tt.cancelEndpoint == "-" {
+				cancelEndpoint = ""
+			}
+			gatewayConfig := &mockGatewayConfigProvider{
+				mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+					return config.GatewayDetails{
+						Endpoints: config.GatewayEndpoints{Cancel: cancelEndpoint},
+						Retry:     config.GatewayRetry{MaxAttempts: 2},
+					}, true
+				},
+			}
+
+			processor := services.NewTransactionProcessor(gatewayConfig, &mockGatewaySelectorProvider{}, transactionRepo, gatewayRepo, client)
+
+			transaction, err := processor.CancelTransaction(context.Background(), withdrawal.ID)
+			if len(sent) != tt.expectedSends {
+				t.Errorf("Expected %d requests to the gateway, got %d", tt.expectedSends, len(sent))
+			}
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got: %v", tt.expectedErr, err)
+				}
+				if len(statuses) != 0 {
+					t.Errorf("Expected the status to be left alone, got %v", statuses)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if sent[0].TransactionType != "cancel" || sent[0].TransactionID != withdrawal.ID || sent[0].OriginalReference != "po_123" {
+				t.Errorf("Unexpected gateway request: %+v", sent[0])
+			}
+			if transaction.Status != "CANCELLED" || len(statuses) != 1 || statuses[0] != "CANCELLED" {
+				t.Errorf("Expected the withdrawal to move to CANCELLED, got %s and %v", transaction.Status, statuses)
+			}
+		})
+	}
 }
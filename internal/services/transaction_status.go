@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Transaction statuses
+const (
+	StatusPending    = "PENDING"
+	StatusProcessing = "PROCESSING"
+	StatusCompleted  = "COMPLETED"
+	StatusFailed     = "FAILED"
+	StatusDeclined   = "DECLINED"
+	StatusRejected   = "REJECTED"
+	StatusCancelled  = "CANCELLED"
+	StatusAuthorized = "AUTHORIZED"
+	StatusCaptured   = "CAPTURED"
+	StatusVoided     = "VOIDED"
+	StatusExpired    = "EXPIRED"
+)
+
+// ErrInvalidTransition is returned when a transaction can't move to the requested status
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// transitions lists the statuses a transaction may move to from each status;
+// statuses without an entry are final
+var transitions = map[string][]string{
+	StatusPending:    {StatusProcessing, StatusCompleted, StatusFailed, StatusDeclined, StatusRejected, StatusCancelled, StatusAuthorized, StatusExpired},
+	StatusProcessing: {StatusCompleted, StatusFailed, StatusDeclined, StatusRejected, StatusCancelled, StatusAuthorized, StatusExpired},
+	// An authorization ends captured, or voided by us or the gateway
+	StatusAuthorized: {StatusCaptured, StatusVoided},
+}
+
+var knownStatuses = map[string]bool{
+	StatusPending:    true,
+	StatusProcessing: true,
+	StatusCompleted:  true,
+	StatusFailed:     true,
+	StatusDeclined:   true,
+	StatusRejected:   true,
+	StatusCancelled:  true,
+	StatusAuthorized: true,
+	StatusCaptured:   true,
+	StatusVoided:     true,
+	StatusExpired:    true,
+}
+
+// IsFinalStatus reports whether a transaction in the status can't change anymore
+func IsFinalStatus(status string) bool {
+	return knownStatuses[status] && len(transitions[status]) == 0
+}
+
+// CheckTransition returns ErrInvalidTransition unless a transaction may move from one status to the other
+func CheckTransition(from, to string) error {
+	if !knownStatuses[to] {
+		return fmt.Errorf("%w: unknown status %s", ErrInvalidTransition, to)
+	}
+
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+}
@@ -0,0 +1,50 @@
+package services_test
+
+import (
+	"errors"
+	"payment-gateway/internal/services"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		from, to    string
+		expectError bool
+	}{
+		{"PENDING", "PROCESSING", false},
+		{"PENDING", "FAILED", false},
+		{"PROCESSING", "COMPLETED", false},
+		{"PROCESSING", "DECLINED", false},
+		{"PROCESSING", "CANCELLED", false},
+		{"CANCELLED", "COMPLETED", true},
+		{"PROCESSING", "AUTHORIZED", false},
+		{"AUTHORIZED", "CAPTURED", false},
+		{"AUTHORIZED", "VOIDED", false},
+		{"CAPTURED", "VOIDED", true},
+		{"PENDING", "EXPIRED", false},
+		{"PROCESSING", "EXPIRED", false},
+		{"AUTHORIZED", "EXPIRED", true},
+		{"EXPIRED", "COMPLETED", true},
+		{"PROCESSING", "PENDING", true},
+		{"COMPLETED", "PROCESSING", true},
+		{"COMPLETED", "FAILED", true},
+		{"FAILED", "COMPLETED", true},
+		{"PROCESSING", "SETTLED", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" To "+tt.to, func(t *testing.T) {
+			err := services.CheckTransition(tt.from, tt.to)
+			if tt.expectError && !errors.Is(err, services.ErrInvalidTransition) {
+				t.Errorf("Expected ErrInvalidTransition, got: %v", err)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+		})
+	}
+
+	if !services.IsFinalStatus("COMPLETED") || services.IsFinalStatus("PROCESSING") {
+		t.Error("Expected COMPLETED to be final and PROCESSING not to be")
+	}
+}
@@ -0,0 +1,15 @@
+package services
+
+import (
+	"context"
+	"payment-gateway/internal/repository"
+)
+
+// autocommit is the unit of work of the services given none, every call commits on its own
+type autocommit struct {
+	repos repository.Repositories
+}
+
+func (a autocommit) Do(ctx context.Context, fn func(repos repository.Repositories) error) error {
+	return fn(a.repos)
+}
@@ -0,0 +1,297 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"payment-gateway/db"
+	"payment-gateway/internal/config"
+	"payment-gateway/internal/gateway"
+	"payment-gateway/internal/models"
+	"payment-gateway/internal/repository/memory"
+	"payment-gateway/internal/repository/postgres"
+	"payment-gateway/internal/services"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRepos are in-memory repositories holding the stripe gateway
+type memoryRepos struct {
+	transactions *memory.TransactionRepo
+	gateways     *memory.GatewayRepo
+	ledger       *memory.LedgerRepo
+	unitOfWork   *memory.UnitOfWork
+	gateway      *models.Gateway
+}
+
+func newMemoryRepos(t *testing.T) memoryRepos {
+	t.Helper()
+
+	repos := memoryRepos{
+		transactions: memory.NewTransactionRepo(),
+		gateways:     memory.NewGatewayRepo(),
+		ledger:       memory.NewLedgerRepo(),
+		gateway:      &models.Gateway{Name: "stripe", DataFormatSupported: "application/json"},
+	}
+	repos.unitOfWork = memory.NewUnitOfWork(repos.transactions, repos.gateways, memory.NewCountryRepo(), memory.NewUserRepo(), repos.ledger)
+
+	if err := repos.gateways.Add(context.Background(), repos.gateway); err != nil {
+		t.Fatalf("failed to add gateway: %v", err)
+	}
+	return repos
+}
+
+func TestApplyStatusConcurrentCallbacks(t *testing.T) {
+	ctx := context.Background()
+	repos := newMemoryRepos(t)
+
+	deposit := &models.Transaction{Amount: 100, Currency: "EUR", Type: "deposit", Status: "PROCESSING", GatewayID: repos.gateway.ID, UserID: 1}
+	if err := repos.transactions.Create(ctx, deposit); err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+
+	processor := services.NewCallbackProcessor(repos.transactions, repos.gateways, services.WithCallbackUnitOfWork(repos.unitOfWork))
+
+	// The gateway reports the deposit completed and failed at the same time, only one may win
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		rejected = make(map[string]int)
+	)
+	for i := 0; i < 10; i++ {
+		status := "COMPLETED"
+		if i%2 == 1 {
+			status = "FAILED"
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := processor.ApplyStatus(ctx, deposit.ID, status, services.EventCallbackProcessed)
+			if err == nil {
+				return
+			}
+			if !errors.Is(err, services.ErrInvalidTransition) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			rejected[status]++
+		}()
+	}
+	wg.Wait()
+
+	stored, err := repos.transactions.GetByID(ctx, deposit.ID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+
+	lost := "FAILED"
+	if stored.Status == "FAILED" {
+		lost = "COMPLETED"
+	}
+	if rejected[stored.Status] != 0 || rejected[lost] != 5 {
+		t.Errorf("Expected every %s callback to be rejected once the deposit is %s, got %v", lost, stored.Status, rejected)
+	}
+}
+
+func TestSubmitKeepsCallbackStatus(t *testing.T) {
+	ctx := context.Background()
+	repos := newMemoryRepos(t)
+
+	gatewaySelector := &mockGatewaySelectorProvider{
+		mockSelectGatewayForUser: func(ctx context.Context, request services.RoutingRequest) (*services.GatewaySelection, error) {
+			return &services.GatewaySelection{Gateway: repos.gateway}, nil
+		},
+	}
+
+	gatewayConfig := &mockGatewayConfigProvider{
+		mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+			return config.GatewayDetails{
+				Endpoints: config.GatewayEndpoints{Deposit: "/v1/charges"},
+				Retry:     config.GatewayRetry{MaxAttempts: 1},
+			}, true
+		},
+	}
+
+	// The callback arrives before the gateway's response
+	client := &mockClient{
+		mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+			if err := repos.transactions.UpdateStatus(ctx, request.TransactionID, "COMPLETED"); err != nil {
+				t.Errorf("failed to apply callback: %v", err)
+			}
+			return &gateway.Result{GatewayReference: "ch_1", Status: gateway.StatusProcessing, StatusCode: 200}, nil
+		},
+	}
+
+	processor := services.NewTransactionProcessor(
+		gatewayConfig,
+		gatewaySelector,
+		repos.transactions,
+		repos.gateways,
+		client,
+		services.WithUnitOfWork(repos.unitOfWork),
+	)
+
+	deposit, err := processor.ProcessDeposit(ctx, 1, 100, "EUR")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	stored, err := repos.transactions.GetByID(ctx, deposit.ID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if stored.Status != "COMPLETED" || stored.GatewayReference != "ch_1" {
+		t.Errorf("Expected COMPLETED with reference ch_1, got %s with %q", stored.Status, stored.GatewayReference)
+	}
+}
+
+// openTestDatabase returns a database whose search path is a new, migrated schema, skipping
+// the test when TEST_DATABASE_URL is not set
+func openTestDatabase(t *testing.T, schema string) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	if _, err := admin.Exec(`DROP SCHEMA IF EXISTS ` + schema + ` CASCADE; CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA IF EXISTS ` + schema + ` CASCADE`) })
+
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	database, err := sql.Open("postgres", url+separator+"search_path="+schema)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	migrator, err := db.NewMigrator(database)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	return database
+}
+
+// TestApplyStatusLedgerPostgres records the ledger entry of a callback while its unit of work
+// holds the lock on the transaction, which the entry refers to
+func TestApplyStatusLedgerPostgres(t *testing.T) {
+	database := openTestDatabase(t, "services_unit_of_work")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var gatewayID, userID int
+	err := database.QueryRowContext(ctx, `INSERT INTO gateways (name, data_format_supported) VALUES ('stripe', 'application/json') RETURNING id`).Scan(&gatewayID)
+	if err != nil {
+		t.Fatalf("failed to add gateway: %v", err)
+	}
+	err = database.QueryRowContext(ctx, `INSERT INTO users (username, email, password) VALUES ('alice', 'alice@example.com', '') RETURNING id`).Scan(&userID)
+	if err != nil {
+		t.Fatalf("failed to add user: %v", err)
+	}
+
+	transactionRepo := postgres.NewTransactionRepo(database)
+	deposit := &models.Transaction{Amount: 100, Currency: "EUR", Type: "deposit", Status: "PROCESSING", GatewayID: gatewayID, UserID: userID}
+	if err := transactionRepo.Create(ctx, deposit); err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+
+	ledger := services.NewLedger(postgres.NewLedgerRepo(database))
+	processor := services.NewCallbackProcessor(
+		transactionRepo,
+		postgres.NewGatewayRepo(database),
+		services.WithCallbackUnitOfWork(postgres.NewUnitOfWork(database)),
+		services.WithCallbackLedger(ledger),
+	)
+
+	if err := processor.ApplyStatus(ctx, deposit.ID, "COMPLETED", services.EventCallbackProcessed); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	stored, err := transactionRepo.GetByID(ctx, deposit.ID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if stored.Status != "COMPLETED" {
+		t.Errorf("Expected COMPLETED, got %s", stored.Status)
+	}
+
+	balances, err := ledger.Balances(ctx, userID)
+	if err != nil {
+		t.Fatalf("failed to get balances: %v", err)
+	}
+	if len(balances) != 1 || balances[0].Available != 100 {
+		t.Errorf("Expected 100 EUR available, got %+v", balances)
+	}
+}
+
+func TestCancelTransactionCompletedMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	repos := newMemoryRepos(t)
+
+	withdrawal := &models.Transaction{Amount: 100, Currency: "EUR", Type: "withdrawal", Status: "PROCESSING", GatewayID: repos.gateway.ID, UserID: 1}
+	if err := repos.transactions.Create(ctx, withdrawal); err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+
+	gatewayConfig := &mockGatewayConfigProvider{
+		mockGetGatewayDetails: func(name string) (config.GatewayDetails, bool) {
+			return config.GatewayDetails{
+				Endpoints: config.GatewayEndpoints{Cancel: "/v1/payouts/cancel"},
+				Retry:     config.GatewayRetry{MaxAttempts: 1},
+			}, true
+		},
+	}
+
+	// The withdrawal's callback arrives while the cancellation is on its way
+	client := &mockClient{
+		mockSendTransaction: func(ctx context.Context, request *gateway.Request, gatewayDetails config.GatewayDetails) (*gateway.Result, error) {
+			if err := repos.transactions.UpdateStatus(ctx, request.TransactionID, "COMPLETED"); err != nil {
+				t.Errorf("failed to apply callback: %v", err)
+			}
+			return &gateway.Result{StatusCode: 200}, nil
+		},
+	}
+
+	processor := services.NewTransactionProcessor(
+		gatewayConfig,
+		&mockGatewaySelectorProvider{},
+		repos.transactions,
+		repos.gateways,
+		client,
+		services.WithUnitOfWork(repos.unitOfWork),
+	)
+
+	if _, err := processor.CancelTransaction(ctx, withdrawal.ID); !errors.Is(err, services.ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition, got: %v", err)
+	}
+
+	stored, err := repos.transactions.GetByID(ctx, withdrawal.ID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if stored.Status != "COMPLETED" {
+		t.Errorf("Expected the withdrawal to stay COMPLETED, got %s", stored.Status)
+	}
+}